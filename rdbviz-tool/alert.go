@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// alertSeverities are the severities PagerDuty accepts, also used as the
+// severity label of Alertmanager alerts.
+var alertSeverities = []string{"critical", "error", "warning", "info"}
+
+// alertmanagerAlert is one alert of the Alertmanager v2 API.
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+}
+
+// pagerDutyEvent is an event of the PagerDuty Events API v2.
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string         `json:"summary"`
+	Source        string         `json:"source"`
+	Severity      string         `json:"severity"`
+	Component     string         `json:"component"`
+	Group         string         `json:"group,omitempty"`
+	Class         string         `json:"class"`
+	CustomDetails map[string]any `json:"custom_details"`
+}
+
+// setupAlerts checks -alert-severity and reads the PagerDuty routing key of
+// -pagerduty.
+func (nf *notifyFlags) setupAlerts() error {
+	ok := false
+	for _, s := range alertSeverities {
+		ok = ok || nf.severity == s
+	}
+	if !ok {
+		return fmt.Errorf("-alert-severity must be one of %s", strings.Join(alertSeverities, ", "))
+	}
+	if !nf.pagerDuty {
+		return nil
+	}
+	nf.pagerDutyKey = os.Getenv("PAGERDUTY_ROUTING_KEY")
+	if nf.pagerDutyKeyFile != "" {
+		key, err := os.ReadFile(nf.pagerDutyKeyFile)
+		if err != nil {
+			return err
+		}
+		nf.pagerDutyKey = strings.TrimSpace(string(key))
+	}
+	if nf.pagerDutyKey == "" {
+		return errors.New("-pagerduty needs $PAGERDUTY_ROUTING_KEY or -pagerduty-key-file")
+	}
+	return nil
+}
+
+// alert fires one alert per violation of n to Alertmanager and PagerDuty.
+// Nothing is resolved: Alertmanager lets the alerts expire after its
+// resolve_timeout, PagerDuty incidents are resolved by hand.
+func (nf *notifyFlags) alert(n notification) error {
+	if nf.alertmanager != "" {
+		alerts := make([]alertmanagerAlert, len(n.Violations))
+		for i, v := range n.Violations {
+			a := alertmanagerAlert{
+				Labels: map[string]string{
+					"alertname": "RdbvizThresholdBreached",
+					"metric":    v.Metric,
+					"severity":  nf.severity,
+					"source":    n.Source,
+				},
+				Annotations: map[string]string{
+					"summary":     n.name() + ": " + v.Summary,
+					"description": strings.Join(v.Offenders, "\n"),
+				},
+				StartsAt: time.Now(),
+			}
+			if n.Instance != "" {
+				a.Labels["redis_instance"] = n.Instance
+			}
+			if n.Shard != "" {
+				a.Labels["redis_shard"] = n.Shard
+			}
+			alerts[i] = a
+		}
+		if err := postJSON(strings.TrimSuffix(nf.alertmanager, "/")+"/api/v2/alerts", alerts); err != nil {
+			return fmt.Errorf("alertmanager: %w", err)
+		}
+	}
+	if nf.pagerDuty {
+		for _, v := range n.Violations {
+			e := pagerDutyEvent{
+				RoutingKey:  nf.pagerDutyKey,
+				EventAction: "trigger",
+				// one incident per instance and metric, however often it fires
+				DedupKey: "rdbviz:" + n.name() + ":" + v.Metric,
+				Payload: pagerDutyPayload{
+					Summary:   n.name() + ": " + v.Summary,
+					Source:    n.Source,
+					Severity:  nf.severity,
+					Component: "redis",
+					Group:     n.Instance,
+					Class:     v.Metric,
+					CustomDetails: map[string]any{
+						"offenders":     v.Offenders,
+						"keys":          n.Keys,
+						"estimated_mem": n.EstimatedMem,
+					},
+				},
+			}
+			if err := postJSON(nf.pagerDutyURL, e); err != nil {
+				return fmt.Errorf("pagerduty: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"rdbviz-tool/pkg/rdbviz"
+	"rdbviz-tool/pkg/report"
+)
+
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+)
+
+// The parts of a report served by serve -reports, for dashboards that would
+// rather not download and parse whole report files:
+//
+//	GET /api/reports/{id}/summary   meta, summary, types and DBs
+//	GET /api/reports/{id}/prefixes  ?type=&prefix=&min_size=&sort=&order=&offset=&limit=
+//	GET /api/reports/{id}/bigkeys   ?type=&db=&prefix=&min_size=&sort=&order=&offset=&limit=
+func (d *reportDir) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/reports/{id}/summary", d.handleSummary)
+	mux.HandleFunc("GET /api/reports/{id}/prefixes", d.handlePrefixes)
+	mux.HandleFunc("GET /api/reports/{id}/bigkeys", d.handleBigKeys)
+}
+
+// loadedReport is the last report parsed for the API, kept until its file
+// changes since a dashboard usually pages through one report.
+type loadedReport struct {
+	id   string
+	info os.FileInfo
+	rep  *rdbviz.Report
+}
+
+var errNoReport = errors.New("no such report")
+
+func (d *reportDir) load(id string) (*rdbviz.Report, error) {
+	p, ok := d.path(id)
+	if !ok {
+		return nil, errNoReport
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, errNoReport
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if l := d.loaded; l != nil && l.id == id && l.info.Size() == info.Size() && l.info.ModTime().Equal(info.ModTime()) {
+		return l.rep, nil
+	}
+	rep, err := loadReport(p)
+	if err != nil {
+		return nil, err
+	}
+	d.loaded = &loadedReport{id: id, info: info, rep: rep}
+	return rep, nil
+}
+
+// report loads the report of the request, or answers it with an error.
+func (d *reportDir) report(w http.ResponseWriter, r *http.Request) (*rdbviz.Report, bool) {
+	rep, err := d.load(r.PathValue("id"))
+	switch {
+	case errors.Is(err, errNoReport):
+		http.NotFound(w, r)
+		return nil, false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return rep, true
+}
+
+func (d *reportDir) handleSummary(w http.ResponseWriter, r *http.Request) {
+	rep, ok := d.report(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, struct {
+		Meta    report.Meta       `json:"meta"`
+		Summary report.Summary    `json:"summary"`
+		Types   []report.TypeStat `json:"types"`
+		DBs     []report.DBReport `json:"dbs,omitempty"`
+	}{rep.Meta, rep.Summary, rep.Types, rep.DBs})
+}
+
+// page is a slice of a filtered list; Total counts the whole list.
+type page[T any] struct {
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Items  []T `json:"items"`
+}
+
+// listQuery is the filtering, sorting and pagination common to the lists.
+type listQuery struct {
+	prefix  string
+	minSize int64
+	sort    string
+	asc     bool
+	offset  int
+	limit   int
+}
+
+func parseListQuery(q url.Values) (listQuery, error) {
+	lq := listQuery{prefix: q.Get("prefix"), sort: q.Get("sort"), limit: apiDefaultLimit}
+	var err error
+	if s := q.Get("min_size"); s != "" {
+		if lq.minSize, err = rdbviz.ParseBytes(s); err != nil {
+			return lq, fmt.Errorf("min_size: %v", err)
+		}
+	}
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		lq.asc = true
+	default:
+		return lq, errors.New("order must be asc or desc")
+	}
+	if s := q.Get("offset"); s != "" {
+		if lq.offset, err = strconv.Atoi(s); err != nil || lq.offset < 0 {
+			return lq, errors.New("offset must be a non-negative integer")
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		if lq.limit, err = strconv.Atoi(s); err != nil || lq.limit <= 0 || lq.limit > apiMaxLimit {
+			return lq, fmt.Errorf("limit must be between 1 and %d", apiMaxLimit)
+		}
+	}
+	return lq, nil
+}
+
+// paginate sorts items by the field of lq.sort among fields, keeping the
+// report's order when there is none, and cuts the requested page.
+func paginate[T any](items []T, lq listQuery, fields map[string]func(T) float64) (page[T], error) {
+	if lq.sort != "" {
+		field, ok := fields[lq.sort]
+		if !ok {
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return page[T]{}, fmt.Errorf("sort must be one of %s", strings.Join(names, ", "))
+		}
+		items = slices.Clone(items)
+		slices.SortStableFunc(items, func(a, b T) int {
+			if lq.asc {
+				return cmp.Compare(field(a), field(b))
+			}
+			return cmp.Compare(field(b), field(a))
+		})
+	}
+	p := page[T]{Total: len(items), Offset: lq.offset, Limit: lq.limit, Items: []T{}}
+	if lq.offset < len(items) {
+		p.Items = items[lq.offset:min(lq.offset+lq.limit, len(items))]
+	}
+	return p, nil
+}
+
+var prefixFields = map[string]func(report.PrefixStat) float64{
+	"count":         func(p report.PrefixStat) float64 { return float64(p.Count) },
+	"size":          func(p report.PrefixStat) float64 { return float64(p.Size) },
+	"estimated_mem": func(p report.PrefixStat) float64 { return float64(p.EstimatedMem) },
+	"children":      func(p report.PrefixStat) float64 { return float64(p.Children) },
+	"ttl_share":     func(p report.PrefixStat) float64 { return p.TTLShare },
+}
+
+// handlePrefixes lists the prefixes of the report, or of one type with
+// type=. prefix= keeps the prefixes below a prefix, itself excluded, for a
+// drill-down.
+func (d *reportDir) handlePrefixes(w http.ResponseWriter, r *http.Request) {
+	rep, ok := d.report(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	lq, err := parseListQuery(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list := rep.Prefixes
+	if t := q.Get("type"); t != "" {
+		list = nil
+		for _, g := range rep.PrefixesByType {
+			if g.Type == t {
+				list = g.Prefixes
+			}
+		}
+	}
+	items := []report.PrefixStat{}
+	for _, p := range list {
+		if p.Size >= lq.minSize && p.Prefix != lq.prefix && strings.HasPrefix(p.Prefix, lq.prefix) {
+			items = append(items, p)
+		}
+	}
+	pg, err := paginate(items, lq, prefixFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, pg)
+}
+
+var bigKeyFields = map[string]func(report.BigKey) float64{
+	"size":             func(k report.BigKey) float64 { return float64(k.Size) },
+	"estimated_mem":    func(k report.BigKey) float64 { return float64(k.EstimatedMem) },
+	"elements":         func(k report.BigKey) float64 { return float64(k.Elements) },
+	"avg_element_size": func(k report.BigKey) float64 { return k.AvgElementSize },
+}
+
+// handleBigKeys lists the bigkeys of the report. With type= or db= alone the
+// per-type or per-DB list is used when the report has one, as it goes deeper
+// than the overall list.
+func (d *reportDir) handleBigKeys(w http.ResponseWriter, r *http.Request) {
+	rep, ok := d.report(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	lq, err := parseListQuery(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	typ := q.Get("type")
+	db := -1
+	if s := q.Get("db"); s != "" {
+		if db, err = strconv.Atoi(s); err != nil || db < 0 {
+			http.Error(w, "db must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+	list := rep.BigKeys
+	switch {
+	case typ != "" && db < 0 && rep.BigKeysByType != nil:
+		list = nil
+		for _, g := range rep.BigKeysByType {
+			if g.Type == typ {
+				list = g.BigKeys
+			}
+		}
+	case typ == "" && db >= 0 && rep.BigKeysByDB != nil:
+		list = nil
+		for _, g := range rep.BigKeysByDB {
+			if g.DB == db {
+				list = g.BigKeys
+			}
+		}
+	}
+	items := []report.BigKey{}
+	for _, k := range list {
+		if (typ == "" || k.Type == typ) && (db < 0 || k.DB == db) &&
+			k.Size >= lq.minSize && strings.HasPrefix(k.Key, lq.prefix) {
+			items = append(items, k)
+		}
+	}
+	pg, err := paginate(items, lq, bigKeyFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, pg)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// authFlags protect serve: reports name keys and namespaces, so anything
+// listening beyond localhost should ask for credentials.
+type authFlags struct {
+	tokenFile string
+	basicFile string
+	tlsCert   string
+	tlsKey    string
+	clientCA  string
+}
+
+func addAuthFlags(fs *flag.FlagSet) *authFlags {
+	af := &authFlags{}
+	fs.StringVar(&af.tokenFile, "token-file", "", "file of bearer tokens accepted, one per line")
+	fs.StringVar(&af.basicFile, "basic-auth-file", "", "file of user:password lines accepted with HTTP basic auth")
+	fs.StringVar(&af.tlsCert, "tls-cert", "", "certificate to serve HTTPS with, with -tls-key")
+	fs.StringVar(&af.tlsKey, "tls-key", "", "key of -tls-cert")
+	fs.StringVar(&af.clientCA, "tls-client-ca", "", "CA bundle client certificates must be signed by (mutual TLS; needs -tls-cert)")
+	return af
+}
+
+// authenticator checks the credentials of a request: a bearer token, or
+// basic auth with a listed user or with any user and a token as password,
+// which lets a browser log in with a token.
+type authenticator struct {
+	tokens []string
+	users  map[string]string
+}
+
+func (a *authenticator) enabled() bool {
+	return len(a.tokens) > 0 || len(a.users) > 0
+}
+
+func (a *authenticator) allowed(r *http.Request) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.validToken(token)
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	if want, ok := a.users[user]; ok && subtle.ConstantTimeCompare([]byte(pass), []byte(want)) == 1 {
+		return true
+	}
+	return a.validToken(pass)
+}
+
+func (a *authenticator) validToken(token string) bool {
+	ok := false
+	for _, t := range a.tokens {
+		// no early exit, so the time taken does not tell which token matched
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+func (a *authenticator) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.allowed(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="rdbviz", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readCredentialLines returns the non-empty lines of path that are not
+// comments.
+func readCredentialLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, sc.Err()
+}
+
+// authenticator loads the credential files; it is disabled when neither is
+// set.
+func (af *authFlags) authenticator() (*authenticator, error) {
+	a := &authenticator{users: map[string]string{}}
+	if af.tokenFile != "" {
+		lines, err := readCredentialLines(af.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) == 0 {
+			return nil, fmt.Errorf("%s: no tokens", af.tokenFile)
+		}
+		a.tokens = lines
+	}
+	if af.basicFile != "" {
+		lines, err := readCredentialLines(af.basicFile)
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range lines {
+			user, pass, ok := strings.Cut(line, ":")
+			if !ok || user == "" || pass == "" {
+				return nil, fmt.Errorf("%s: entry %d is not user:password", af.basicFile, i+1)
+			}
+			a.users[user] = pass
+		}
+		if len(a.users) == 0 {
+			return nil, fmt.Errorf("%s: no users", af.basicFile)
+		}
+	}
+	return a, nil
+}
+
+// tlsConfig returns the TLS configuration of -tls-client-ca, nil without it.
+func (af *authFlags) tlsConfig() (*tls.Config, error) {
+	if (af.tlsCert == "") != (af.tlsKey == "") {
+		return nil, errors.New("-tls-cert and -tls-key go together")
+	}
+	if af.clientCA == "" {
+		return nil, nil
+	}
+	if af.tlsCert == "" {
+		return nil, errors.New("-tls-client-ca needs -tls-cert")
+	}
+	pem, err := os.ReadFile(af.clientCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no certificates", af.clientCA)
+	}
+	return &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}, nil
+}
+
+// isLoopback tells whether addr only listens on the local host.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// benchStage is the result of one stage of the bench subcommand, the fastest
+// of its runs.
+type benchStage struct {
+	Stage      string  `json:"stage"`
+	Seconds    float64 `json:"seconds"`
+	MBPerSec   float64 `json:"mb_per_sec"`
+	Keys       int64   `json:"keys"`
+	KeysPerSec float64 `json:"keys_per_sec"`
+	AllocBytes uint64  `json:"alloc_bytes"`
+	PeakRSS    int64   `json:"peak_rss"`
+}
+
+// runBench is the bench subcommand: it times reading, decoding, analyzing a
+// dump and encoding its report, so parse throughput can be compared across
+// releases. decode parses without aggregation, analyze with the default
+// analysis; each stage runs -runs times and the fastest run is reported.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	lf := addLogFlags(fs)
+	pf := addProfileFlags(fs)
+	rdbPath := fs.String("rdb", "", "path to dump.rdb")
+	runs := fs.Int("runs", 1, "runs per stage, the fastest is reported")
+	opts := rdbviz.DefaultOptions()
+	fs.IntVar(&opts.Workers, "workers", opts.Workers, "analyze: goroutines computing key sizes, memory and classes")
+	fs.Var(byteSizeInt{&opts.ReadBuffer}, "read-buffer", "analyze: buffer the dump is read through (0 for the decoder's 4KB)")
+	fs.BoolVar(&opts.ReadAhead, "read-ahead", opts.ReadAhead, "analyze: read ahead on a separate goroutine")
+	fs.Var(byteRate{&opts.MaxReadRate}, "max-read-rate", "analyze: throttle reading the dump to this rate (0 for no limit)")
+	jsonOut := fs.Bool("json", false, "print the results as JSON")
+	fs.Parse(args)
+	lf.setup()
+
+	if *rdbPath == "" {
+		fmt.Println("usage: rdbviz-tool bench -rdb dump.rdb [-runs 3] [-workers 4] [-json]")
+		os.Exit(2)
+	}
+	if *runs < 1 {
+		fatal(2, "-runs must be at least 1")
+	}
+	analyzer, err := rdbviz.New(opts)
+	if err != nil {
+		fatal(2, "invalid options", "err", err)
+	}
+	stat, err := os.Stat(*rdbPath)
+	if err != nil {
+		fatal(1, "open rdb error", "err", err)
+	}
+	fileSize := stat.Size()
+
+	var rep *rdbviz.Report
+	stages := []struct {
+		name string
+		run  func() (int64, error)
+	}{
+		{"read", func() (int64, error) {
+			f, err := os.Open(*rdbPath)
+			if err != nil {
+				return 0, err
+			}
+			defer f.Close()
+			_, err = io.Copy(io.Discard, f)
+			return 0, err
+		}},
+		{"decode", func() (int64, error) {
+			f, err := os.Open(*rdbPath)
+			if err != nil {
+				return 0, err
+			}
+			defer f.Close()
+			var keys int64
+			err = parser.NewDecoder(f).Parse(func(o parser.RedisObject) bool {
+				if o.GetKey() != "" {
+					keys++
+				}
+				return true
+			})
+			return keys, err
+		}},
+		{"analyze", func() (int64, error) {
+			r, err := analyzer.AnalyzeFile(context.Background(), *rdbPath)
+			if err != nil {
+				return 0, err
+			}
+			rep = r
+			return r.Summary.TotalKeys, nil
+		}},
+		{"encode", func() (int64, error) {
+			_, err := json.Marshal(rep)
+			return 0, err
+		}},
+	}
+
+	stopProfile := pf.start()
+	results := make([]benchStage, 0, len(stages))
+	for _, st := range stages {
+		best := benchStage{Stage: st.name}
+		for i := 0; i < *runs; i++ {
+			runtime.GC()
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			start := time.Now()
+			keys, err := st.run()
+			elapsed := time.Since(start)
+			if err != nil {
+				stopProfile()
+				fatal(1, "bench error", "stage", st.name, "err", err)
+			}
+			runtime.ReadMemStats(&after)
+			slog.Debug("bench run", "stage", st.name, "run", i+1, "elapsed", elapsed)
+			if i == 0 || elapsed.Seconds() < best.Seconds {
+				best.Seconds = elapsed.Seconds()
+				best.Keys = keys
+				best.AllocBytes = after.TotalAlloc - before.TotalAlloc
+			}
+		}
+		if best.Seconds > 0 {
+			best.MBPerSec = float64(fileSize) / (1 << 20) / best.Seconds
+			best.KeysPerSec = float64(best.Keys) / best.Seconds
+		}
+		best.PeakRSS = peakRSS()
+		results = append(results, best)
+	}
+	stopProfile()
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]any{
+			"rdb":        *rdbPath,
+			"size":       fileSize,
+			"workers":    opts.Workers,
+			"runs":       *runs,
+			"go_version": runtime.Version(),
+			"stages":     results,
+		})
+		return
+	}
+	fmt.Printf("%s: %s, %d workers, best of %d\n\n", *rdbPath, rdbviz.FormatBytes(fileSize), opts.Workers, *runs)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "stage\ttime\tMB/s\tkeys/s\talloc\tpeak RSS\t\n")
+	for _, r := range results {
+		keysPerSec, rss := "-", "-"
+		if r.Keys > 0 {
+			keysPerSec = fmt.Sprintf("%.0f", r.KeysPerSec)
+		}
+		if r.PeakRSS > 0 {
+			rss = rdbviz.FormatBytes(r.PeakRSS)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1f\t%s\t%s\t%s\t\n", r.Stage, time.Duration(r.Seconds*float64(time.Second)).Round(time.Millisecond),
+			r.MBPerSec, keysPerSec, rdbviz.FormatBytes(int64(r.AllocBytes)), rss)
+	}
+	w.Flush()
+	fmt.Println("\nread is the raw file read, decode parses without aggregation, analyze runs the default analysis, encode marshals its report; peak RSS is the process high-water mark after each stage")
+}
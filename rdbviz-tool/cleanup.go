@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// runCleanup is the cleanup subcommand: it emits UNLINK commands for the keys
+// of a dump whose expiration has passed, for redis-cli to run.
+func runCleanup(args []string) {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	lf := addLogFlags(fs)
+	rdbPath := fs.String("rdb", "", "path to dump.rdb")
+	outPath := fs.String("out", "", "output file (default stdout)")
+	batch := fs.Int("batch", 100, "keys per UNLINK command")
+	rate := fs.Int("rate", 0, "max keys per second written, for piping straight into redis-cli (0 for no limit)")
+	pipe := fs.Bool("pipe", false, "write the RESP protocol for redis-cli --pipe instead of one command per line")
+	match := fs.String("match", "*", "only unlink expired keys matching this glob")
+	grace := fs.Duration("grace", 0, "only unlink keys expired at least this long before now")
+	fs.Parse(args)
+	lf.setup()
+
+	if *rdbPath == "" {
+		fmt.Println("usage: rdbviz-tool cleanup -rdb dump.rdb [-out unlink.txt] [-batch 100] [-rate 1000] [-pipe]")
+		os.Exit(2)
+	}
+	if *batch <= 0 {
+		fatal(2, "-batch must be positive")
+	}
+	if *rate < 0 {
+		fatal(2, "-rate must not be negative")
+	}
+
+	out := io.Writer(os.Stdout)
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fatal(1, "create error", "err", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	rdbFile, err := os.Open(*rdbPath)
+	if err != nil {
+		fatal(1, "open rdb error", "err", err)
+	}
+	defer rdbFile.Close()
+
+	u := newUnlinker(out, *batch, *rate, *pipe)
+	cutoff := time.Now().Add(-*grace)
+	err = parser.NewDecoder(rdbFile).Parse(func(o parser.RedisObject) bool {
+		key := o.GetKey()
+		exp := o.GetExpiration()
+		if key == "" || exp == nil || !exp.Before(cutoff) || !rdbviz.GlobMatch(*match, key) {
+			return true
+		}
+		u.add(o.GetDBIndex(), key, int64(o.GetSize()))
+		return true
+	})
+	if err != nil {
+		fatal(1, "parse error", "err", err)
+	}
+	if err := u.close(); err != nil {
+		fatal(1, "write error", "err", err)
+	}
+	slog.Info("unlink commands written", "keys", u.keys, "size", rdbviz.FormatBytes(u.size), "commands", u.commands)
+}
+
+// unlinker batches keys into UNLINK commands, one DB at a time, and paces the
+// writes to rate keys per second.
+type unlinker struct {
+	w        *bufio.Writer
+	batch    int
+	rate     int
+	pipe     bool
+	db       int
+	pending  []string
+	next     time.Time
+	keys     int64
+	size     int64
+	commands int64
+}
+
+func newUnlinker(w io.Writer, batch, rate int, pipe bool) *unlinker {
+	return &unlinker{w: bufio.NewWriter(w), batch: batch, rate: rate, pipe: pipe, db: -1}
+}
+
+func (u *unlinker) add(db int, key string, size int64) {
+	if db != u.db {
+		u.flush()
+		u.command("SELECT", strconv.Itoa(db))
+		u.db = db
+	}
+	u.pending = append(u.pending, key)
+	u.keys++
+	u.size += size
+	if len(u.pending) >= u.batch {
+		u.flush()
+	}
+}
+
+func (u *unlinker) flush() {
+	if len(u.pending) == 0 {
+		return
+	}
+	if u.rate > 0 {
+		// hand over what is buffered before waiting, so the reader keeps up
+		u.w.Flush()
+		now := time.Now()
+		if u.next.After(now) {
+			time.Sleep(u.next.Sub(now))
+		} else {
+			u.next = now
+		}
+		u.next = u.next.Add(time.Duration(len(u.pending)) * time.Second / time.Duration(u.rate))
+	}
+	u.command(append([]string{"UNLINK"}, u.pending...)...)
+	u.commands++
+	u.pending = u.pending[:0]
+}
+
+func (u *unlinker) command(args ...string) {
+	if u.pipe {
+		rdbviz.WriteCommand(u.w, args...)
+		return
+	}
+	for i, a := range args {
+		if i > 0 {
+			u.w.WriteByte(' ')
+		}
+		u.w.WriteString(redisQuote(a))
+	}
+	u.w.WriteByte('\n')
+}
+
+func (u *unlinker) close() error {
+	u.flush()
+	return u.w.Flush()
+}
+
+// redisQuote quotes s the way redis-cli splits its input lines: plain
+// arguments as they are, anything else in double quotes with \xHH escapes.
+func redisQuote(s string) string {
+	plain := s != ""
+	for i := 0; i < len(s) && plain; i++ {
+		c := s[i]
+		plain = c > ' ' && c < 0x7f && c != '"' && c != '\''
+	}
+	if plain {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' || c == '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"math"
+	"time"
+
+	"rdbviz-tool/pkg/rdbviz"
+	"rdbviz-tool/pkg/report"
+)
+
+// Completion statuses. partial is an interrupted analyze that wrote the
+// report of the keys read so far.
+const (
+	completionSucceeded = "succeeded"
+	completionPartial   = "partial"
+	completionFailed    = "failed"
+)
+
+// completionFlags post an event when an analysis ends, failed or not, for
+// ticketing and workflow systems waiting on it.
+type completionFlags struct {
+	url string
+}
+
+func addCompletionFlags(fs *flag.FlagSet) *completionFlags {
+	cf := &completionFlags{}
+	fs.StringVar(&cf.url, "notify-url", "", "URL to POST a JSON event to when an analysis ends, with its status, duration, summary and report location")
+	return cf
+}
+
+// completion is the -notify-url body. Report is where the report can be
+// read: a path for analyze, a URL of the API for serve.
+type completion struct {
+	Event    string          `json:"event"`
+	Status   string          `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	Job      string          `json:"job,omitempty"`
+	Source   string          `json:"source"`
+	Instance string          `json:"instance,omitempty"`
+	Shard    string          `json:"shard,omitempty"`
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"`
+	Duration float64         `json:"duration_seconds"`
+	Report   string          `json:"report,omitempty"`
+	Outputs  []string        `json:"outputs,omitempty"`
+	Summary  *report.Summary `json:"summary,omitempty"`
+}
+
+// newCompletion describes an analysis of source started at start that
+// ended now: failed when err is set, with the summary of rep when there
+// is one.
+func newCompletion(source string, opts rdbviz.Options, start time.Time, rep *rdbviz.Report, err error) completion {
+	end := time.Now()
+	c := completion{
+		Event:    "analysis.completed",
+		Status:   completionSucceeded,
+		Source:   source,
+		Instance: opts.Instance,
+		Shard:    opts.Shard,
+		Started:  start,
+		Finished: end,
+		Duration: math.Round(end.Sub(start).Seconds()*1000) / 1000,
+	}
+	if err != nil {
+		c.Status, c.Error = completionFailed, err.Error()
+	}
+	if rep != nil {
+		c.Summary = &rep.Summary
+	}
+	return c
+}
+
+func (cf *completionFlags) post(c completion) error {
+	if cf == nil || cf.url == "" {
+		return nil
+	}
+	return postJSON(cf.url, c)
+}
+
+// send posts c, failing the command if it cannot.
+func (cf *completionFlags) send(c completion) {
+	if cf.url == "" {
+		return
+	}
+	if err := cf.post(c); err != nil {
+		fatal(1, "notify-url error", "err", err)
+	}
+	slog.Info("completion posted", "status", c.Status)
+}
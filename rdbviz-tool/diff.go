@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// runDiff is the diff subcommand: it compares two reports of the same
+// instance, e.g. before and after a release, and prints what changed in the
+// totals, per type and per prefix.
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	lf := addLogFlags(fs)
+	nf := addNotifyFlags(fs)
+	topN := fs.Int("topn", 20, "prefixes listed, by absolute change in estimated memory")
+	fs.Parse(args)
+	lf.setup()
+	if err := nf.setupAlerts(); err != nil {
+		fatal(2, "alert error", "err", err)
+	}
+
+	if fs.NArg() != 2 {
+		fmt.Println("usage: rdbviz-tool diff [-topn 20] [-slack-webhook url] [-webhook url] old.json new.json")
+		os.Exit(2)
+	}
+	before, err := loadReport(fs.Arg(0))
+	if err != nil {
+		fatal(1, "load error", "err", err)
+	}
+	after, err := loadReport(fs.Arg(1))
+	if err != nil {
+		fatal(1, "load error", "err", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "\told\tnew\tchange\t\n")
+	fmt.Fprintf(w, "keys\t%d\t%d\t%s\t\n", before.Summary.TotalKeys, after.Summary.TotalKeys, countDelta(before.Summary.TotalKeys, after.Summary.TotalKeys))
+	fmt.Fprintf(w, "size\t%s\t%s\t%s\t\n", rdbviz.FormatBytes(before.Summary.TotalSize), rdbviz.FormatBytes(after.Summary.TotalSize), bytesDelta(before.Summary.TotalSize, after.Summary.TotalSize))
+	fmt.Fprintf(w, "estimated mem\t%s\t%s\t%s\t\n", rdbviz.FormatBytes(before.Summary.TotalMem), rdbviz.FormatBytes(after.Summary.TotalMem), bytesDelta(before.Summary.TotalMem, after.Summary.TotalMem))
+	fmt.Fprintf(w, "expired keys\t%d\t%d\t%s\t\n", before.Summary.Expired, after.Summary.Expired, countDelta(before.Summary.Expired, after.Summary.Expired))
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "type\told keys\tnew keys\told mem\tnew mem\tmem change\t\n")
+	for _, t := range typeDiff(before, after) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t\n", t.name, t.oldCount, t.newCount,
+			rdbviz.FormatBytes(t.oldMem), rdbviz.FormatBytes(t.newMem), bytesDelta(t.oldMem, t.newMem))
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "prefix\told keys\tnew keys\told mem\tnew mem\tmem change\t\n")
+	for _, p := range prefixDiff(before, after, *topN) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t\n", p.name, p.oldCount, p.newCount,
+			rdbviz.FormatBytes(p.oldMem), rdbviz.FormatBytes(p.newMem), bytesDelta(p.oldMem, p.newMem))
+	}
+	w.Flush()
+	// reports only keep their top prefixes
+	fmt.Println("\nprefixes missing from one report's top list count as 0 there")
+	nf.notify(nf.diffNotification(before, after))
+}
+
+func loadReport(path string) (*rdbviz.Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rep rdbviz.Report
+	if err := json.NewDecoder(f).Decode(&rep); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &rep, nil
+}
+
+// diffRow is one type or prefix in both reports.
+type diffRow struct {
+	name               string
+	oldCount, newCount int64
+	oldMem, newMem     int64
+}
+
+func typeDiff(before, after *rdbviz.Report) []diffRow {
+	rows := map[string]*diffRow{}
+	row := func(name string) *diffRow {
+		r, ok := rows[name]
+		if !ok {
+			r = &diffRow{name: name}
+			rows[name] = r
+		}
+		return r
+	}
+	for _, t := range before.Types {
+		r := row(t.Type)
+		r.oldCount, r.oldMem = t.Count, t.EstimatedMem
+	}
+	for _, t := range after.Types {
+		r := row(t.Type)
+		r.newCount, r.newMem = t.Count, t.EstimatedMem
+	}
+	return sortedRows(rows, 0)
+}
+
+func prefixDiff(before, after *rdbviz.Report, topN int) []diffRow {
+	rows := map[string]*diffRow{}
+	for _, p := range before.Prefixes {
+		rows[p.Prefix] = &diffRow{name: p.Prefix, oldCount: p.Count, oldMem: p.EstimatedMem}
+	}
+	for _, p := range after.Prefixes {
+		r, ok := rows[p.Prefix]
+		if !ok {
+			r = &diffRow{name: p.Prefix}
+			rows[p.Prefix] = r
+		}
+		r.newCount, r.newMem = p.Count, p.EstimatedMem
+	}
+	return sortedRows(rows, topN)
+}
+
+// sortedRows orders rows by absolute change in estimated memory and keeps
+// the first topN (all for 0).
+func sortedRows(rows map[string]*diffRow, topN int) []diffRow {
+	list := make([]diffRow, 0, len(rows))
+	for _, r := range rows {
+		list = append(list, *r)
+	}
+	abs := func(v int64) int64 {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	sort.Slice(list, func(i, j int) bool {
+		di, dj := abs(list[i].newMem-list[i].oldMem), abs(list[j].newMem-list[j].oldMem)
+		if di != dj {
+			return di > dj
+		}
+		return list[i].name < list[j].name
+	})
+	if topN > 0 && len(list) > topN {
+		list = list[:topN]
+	}
+	return list
+}
+
+func countDelta(before, after int64) string {
+	return fmt.Sprintf("%+d%s", after-before, percentDelta(before, after))
+}
+
+func bytesDelta(before, after int64) string {
+	d := after - before
+	sign := "+"
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	return sign + rdbviz.FormatBytes(d) + percentDelta(before, after)
+}
+
+func percentDelta(before, after int64) string {
+	if before == 0 {
+		if after == 0 {
+			return ""
+		}
+		return " (new)"
+	}
+	return fmt.Sprintf(" (%+.1f%%)", float64(after-before)/float64(before)*100)
+}
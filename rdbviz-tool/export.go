@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// runExport is the export subcommand: it writes the keys of a dump matching a
+// filter as RESP commands, so they can be replayed into a scratch instance
+// with redis-cli --pipe.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	lf := addLogFlags(fs)
+	rdbPath := fs.String("rdb", "", "path to dump.rdb")
+	outPath := fs.String("out", "", "output file (default stdout)")
+	match := fs.String("match", "*", "only export keys matching this glob")
+	db := fs.Int("db", -1, "only export keys of this DB (-1 for all)")
+	batch := fs.Int("batch", 1000, "max elements per write command for lists, hashes, sets and zsets")
+	keepExpired := fs.Bool("keep-expired", false, "also export keys whose TTL has passed, without their TTL")
+	fs.Parse(args)
+	lf.setup()
+
+	if *rdbPath == "" {
+		fmt.Println("usage: rdbviz-tool export -rdb dump.rdb -match 'user:*' [-db 0] [-out subset.resp]")
+		os.Exit(2)
+	}
+	if *batch <= 0 {
+		fatal(2, "-batch must be positive")
+	}
+
+	out := io.Writer(os.Stdout)
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fatal(1, "create error", "err", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	rdbFile, err := os.Open(*rdbPath)
+	if err != nil {
+		fatal(1, "open rdb error", "err", err)
+	}
+	defer rdbFile.Close()
+
+	e := &exporter{w: bufio.NewWriter(out), batch: *batch, db: -1, skipped: map[string]int64{}}
+	now := time.Now()
+	err = parser.NewDecoder(rdbFile).Parse(func(o parser.RedisObject) bool {
+		key := o.GetKey()
+		if key == "" || (*db >= 0 && o.GetDBIndex() != *db) || !rdbviz.GlobMatch(*match, key) {
+			return true
+		}
+		exp := o.GetExpiration()
+		if exp != nil && exp.Before(now) {
+			if !*keepExpired {
+				return true
+			}
+			exp = nil
+		}
+		e.export(o, exp)
+		return true
+	})
+	if err != nil {
+		fatal(1, "parse error", "err", err)
+	}
+	if err := e.w.Flush(); err != nil {
+		fatal(1, "write error", "err", err)
+	}
+	slog.Info("keys exported", "keys", e.keys, "size", rdbviz.FormatBytes(e.size), "commands", e.commands)
+	for t, n := range e.skipped {
+		slog.Warn("keys skipped: no command form", "type", t, "keys", n)
+	}
+}
+
+// exporter turns parsed objects back into write commands.
+type exporter struct {
+	w        *bufio.Writer
+	batch    int
+	db       int
+	keys     int64
+	size     int64
+	commands int64
+	skipped  map[string]int64
+}
+
+func (e *exporter) export(o parser.RedisObject, exp *time.Time) {
+	key := o.GetKey()
+	var cmd string
+	var args []string
+	switch obj := o.(type) {
+	case *parser.StringObject:
+		cmd, args = "SET", []string{string(obj.Value)}
+	case *parser.ListObject, *parser.SetObject, *parser.HashObject, *parser.ZSetObject:
+		cmd, args = rdbviz.ElementArgs(o)
+	default:
+		// streams and module types have no plain write command
+		e.skipped[o.GetType()]++
+		return
+	}
+	if db := o.GetDBIndex(); db != e.db {
+		e.command("SELECT", strconv.Itoa(db))
+		e.db = db
+	}
+	e.keys++
+	e.size += int64(o.GetSize())
+	e.command("DEL", key)
+	step := rdbviz.ArgStep(cmd)
+	n := e.batch * step
+	for i := 0; i < len(args); i += n {
+		end := i + n
+		if end > len(args) {
+			end = len(args)
+		}
+		e.command(append([]string{cmd, key}, args[i:end]...)...)
+	}
+	if exp != nil {
+		e.command("PEXPIREAT", key, strconv.FormatInt(exp.UnixMilli(), 10))
+	}
+}
+
+func (e *exporter) command(args ...string) {
+	rdbviz.WriteCommand(e.w, args...)
+	e.commands++
+}
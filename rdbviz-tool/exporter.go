@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// runExporter is the exporter subcommand: it analyzes a dump source every
+// -interval and serves the keyspace gauges of the last analysis on /metrics,
+// so Prometheus can scrape the composition of a keyspace like any target.
+func runExporter(args []string) {
+	fs := flag.NewFlagSet("exporter", flag.ExitOnError)
+	lf := addLogFlags(fs)
+	af := addAuthFlags(fs)
+	source := fs.String("rdb", "", "dump to analyze: a path, an http(s) URL, or exec: and a command writing the dump to stdout, e.g. exec:redis-cli -h cache-1 --rdb /dev/stdout")
+	addr := fs.String("addr", "localhost:9121", "listen address")
+	interval := fs.Duration("interval", 15*time.Minute, "time between analyses")
+	tmpDir := fs.String("tmp-dir", "", "directory holding fetched dumps while they are analyzed (default the system temp directory)")
+	opts := rdbviz.DefaultOptions()
+	fs.StringVar(&opts.Instance, "instance", "", "instance label of the series")
+	fs.StringVar(&opts.PrefixSep, "prefix-sep", opts.PrefixSep, "prefix separator")
+	fs.IntVar(&opts.PrefixDepth, "prefix-depth", opts.PrefixDepth, "prefix depth")
+	fs.IntVar(&opts.TopN, "topn", opts.TopN, "prefixes exported, the largest")
+	fs.Parse(args)
+	lf.setup()
+
+	if *source == "" {
+		fmt.Println("usage: rdbviz-tool exporter -rdb dump.rdb [-interval 15m] [-addr localhost:9121] [-instance name]")
+		os.Exit(2)
+	}
+	if *interval <= 0 {
+		fatal(2, "-interval must be positive", "got", *interval)
+	}
+	opts.Logger = slog.Default()
+	if err := opts.Validate(); err != nil {
+		fatal(2, "invalid options", "err", err)
+	}
+	auth, err := af.authenticator()
+	if err != nil {
+		fatal(2, "auth error", "err", err)
+	}
+	tlsConfig, err := af.tlsConfig()
+	if err != nil {
+		fatal(2, "tls error", "err", err)
+	}
+
+	e := &metricsExporter{source: *source, tmpDir: *tmpDir, opts: opts}
+	go e.loop(*interval)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", e.handleMetrics)
+	var handler http.Handler = mux
+	if auth.enabled() {
+		handler = auth.wrap(mux)
+	}
+	srv := &http.Server{Addr: *addr, Handler: handler, TLSConfig: tlsConfig}
+	slog.Info("exporting", "rdb", displaySource(*source), "interval", *interval, "addr", *addr)
+	if af.tlsCert != "" {
+		err = srv.ListenAndServeTLS(af.tlsCert, af.tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
+		fatal(1, "serve error", "err", err)
+	}
+}
+
+// metricsExporter keeps the metrics of the last successful analysis along with
+// gauges about the analyses themselves.
+type metricsExporter struct {
+	source string
+	tmpDir string
+	opts   rdbviz.Options
+
+	mu          sync.Mutex
+	metrics     []byte
+	lastSuccess time.Time
+	lastRun     time.Time
+	duration    time.Duration
+	failures    int64
+	// of a local dump at the last analysis, only used by the loop
+	modTime time.Time
+	size    int64
+}
+
+func (e *metricsExporter) loop(interval time.Duration) {
+	for {
+		e.analyze()
+		time.Sleep(interval)
+	}
+}
+
+// analyze refreshes the metrics; a local dump that has not changed since
+// the last analysis is not read again.
+func (e *metricsExporter) analyze() {
+	var st os.FileInfo
+	if !remoteSource(e.source) {
+		st, _ = os.Stat(e.source)
+		if st != nil && st.ModTime().Equal(e.modTime) && st.Size() == e.size {
+			slog.Debug("dump unchanged, not analyzed again", "rdb", e.source)
+			return
+		}
+	}
+	start := time.Now()
+	metrics, err := e.run()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastRun, e.duration = start, time.Since(start)
+	if err != nil {
+		e.failures++
+		slog.Error("analysis failed", "rdb", displaySource(e.source), "err", err)
+		return
+	}
+	e.metrics, e.lastSuccess = metrics, time.Now()
+	if st != nil {
+		e.modTime, e.size = st.ModTime(), st.Size()
+	}
+	slog.Info("analysis done", "rdb", displaySource(e.source), "elapsed", e.duration.Round(time.Millisecond))
+}
+
+func (e *metricsExporter) run() ([]byte, error) {
+	ctx := context.Background()
+	path, cleanup, err := fetchDump(ctx, http.DefaultClient, e.source, e.tmpDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	analyzer, err := rdbviz.New(e.opts)
+	if err != nil {
+		return nil, err
+	}
+	rep, err := analyzer.AnalyzeFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return rdbviz.MetricsWriter{Instance: e.opts.Instance}.Metrics(rep), nil
+}
+
+func (e *metricsExporter) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	labels := ""
+	if e.opts.Instance != "" {
+		labels = fmt.Sprintf("{instance=%q}", e.opts.Instance)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(e.metrics)
+	gauge := func(name, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s%s %g\n", name, help, name, name, labels, v)
+	}
+	unix := func(t time.Time) float64 {
+		if t.IsZero() {
+			return 0
+		}
+		return float64(t.UnixMilli()) / 1000
+	}
+	gauge("rdbviz_last_analysis_timestamp_seconds", "When the last analysis started.", unix(e.lastRun))
+	gauge("rdbviz_last_success_timestamp_seconds", "When the last successful analysis ended; the keyspace series are from it.", unix(e.lastSuccess))
+	gauge("rdbviz_analysis_duration_seconds", "Duration of the last analysis.", e.duration.Seconds())
+	fmt.Fprintf(w, "# HELP rdbviz_analysis_failures_total Analyses that failed.\n# TYPE rdbviz_analysis_failures_total counter\nrdbviz_analysis_failures_total%s %d\n", labels, e.failures)
+}
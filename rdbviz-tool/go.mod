@@ -2,4 +2,20 @@ module rdbviz-tool
 
 go 1.22
 
-require github.com/hdt3213/rdb v1.3.0
+require (
+	github.com/hdt3213/rdb v1.3.0
+	github.com/klauspost/compress v1.18.0
+	github.com/segmentio/kafka-go v0.4.47
+	github.com/tetratelabs/wazero v1.8.2
+	go.etcd.io/bbolt v1.3.11
+	google.golang.org/grpc v1.67.1
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+)
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// grafanaFlags mark each analysis with an annotation in Grafana, spanning
+// the time it ran, so keyspace changes line up with other dashboards.
+type grafanaFlags struct {
+	url       string
+	tokenFile string
+	token     string
+	dashboard string
+	tags      string
+}
+
+func addGrafanaFlags(fs *flag.FlagSet) *grafanaFlags {
+	gf := &grafanaFlags{}
+	fs.StringVar(&gf.url, "grafana", "", "Grafana URL to create an annotation of each analysis in, with the service account token of $GRAFANA_TOKEN or -grafana-token-file")
+	fs.StringVar(&gf.tokenFile, "grafana-token-file", "", "-grafana: file holding the service account token")
+	fs.StringVar(&gf.dashboard, "grafana-dashboard", "", "-grafana: UID of the dashboard to annotate (default an organization annotation, shown by tag)")
+	fs.StringVar(&gf.tags, "grafana-tags", "", "-grafana: comma-separated tags added to the annotations, e.g. env:prod")
+	return gf
+}
+
+// setup reads the token of -grafana.
+func (gf *grafanaFlags) setup() error {
+	if gf.url == "" {
+		return nil
+	}
+	gf.token = os.Getenv("GRAFANA_TOKEN")
+	if gf.tokenFile != "" {
+		token, err := os.ReadFile(gf.tokenFile)
+		if err != nil {
+			return err
+		}
+		gf.token = strings.TrimSpace(string(token))
+	}
+	if gf.token == "" {
+		return errors.New("-grafana needs $GRAFANA_TOKEN or -grafana-token-file")
+	}
+	return nil
+}
+
+// grafanaAnnotation is the body of POST /api/annotations. Times are in
+// milliseconds.
+type grafanaAnnotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	Time         int64    `json:"time"`
+	TimeEnd      int64    `json:"timeEnd"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// annotate creates the annotation of c, tagged rdbviz, with its instance,
+// shard and status.
+func (gf *grafanaFlags) annotate(c completion) error {
+	if gf == nil || gf.url == "" {
+		return nil
+	}
+	tags := []string{"rdbviz", "status:" + c.Status}
+	name := c.Source
+	if c.Instance != "" {
+		tags = append(tags, "instance:"+c.Instance)
+		name = c.Instance
+	}
+	if c.Shard != "" {
+		tags = append(tags, "shard:"+c.Shard)
+		name += "/" + c.Shard
+	}
+	if gf.tags != "" {
+		tags = append(tags, strings.Split(gf.tags, ",")...)
+	}
+	text := fmt.Sprintf("rdbviz analysis of %s %s", name, c.Status)
+	if s := c.Summary; s != nil {
+		text += fmt.Sprintf(": %d keys, %s estimated memory, %s serialized, %d with TTL",
+			s.TotalKeys, rdbviz.FormatBytes(s.TotalMem), rdbviz.FormatBytes(s.TotalSize), s.WithTTL)
+	}
+	if c.Error != "" {
+		text += ": " + c.Error
+	}
+	if c.Report != "" {
+		text += "\nreport: " + c.Report
+	}
+	a := grafanaAnnotation{
+		DashboardUID: gf.dashboard,
+		Time:         c.Started.UnixMilli(),
+		TimeEnd:      c.Finished.UnixMilli(),
+		Tags:         tags,
+		Text:         text,
+	}
+	if err := postJSONAuth(strings.TrimSuffix(gf.url, "/")+"/api/annotations", "Bearer "+gf.token, a); err != nil {
+		return fmt.Errorf("grafana: %w", err)
+	}
+	return nil
+}
+
+// send annotates c, failing the command if it cannot.
+func (gf *grafanaFlags) send(c completion) {
+	if gf.url == "" {
+		return
+	}
+	if err := gf.annotate(c); err != nil {
+		fatal(1, "grafana error", "err", err)
+	}
+	slog.Info("grafana annotation created", "status", c.Status)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"rdbviz-tool/pkg/rdbviz"
+	"rdbviz-tool/pkg/rdbvizpb"
+)
+
+// grpcServer serves the AnalysisService of pkg/rdbvizpb over the jobs and
+// reports of serve -reports, for services that would rather not poll the
+// HTTP API or run the CLI.
+type grpcServer struct {
+	rdbvizpb.UnimplementedAnalysisServiceServer
+	jobs *jobRunner
+}
+
+// serveGRPC serves on lis with the TLS and credentials of the HTTP server:
+// a token or user:password goes in the authorization metadata, as the
+// Authorization header.
+func serveGRPC(lis net.Listener, jr *jobRunner, auth *authenticator, af *authFlags, tlsConfig *tls.Config) error {
+	var opts []grpc.ServerOption
+	if af.tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(af.tlsCert, af.tlsKey)
+		if err != nil {
+			return err
+		}
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(cfg)))
+	}
+	if auth.enabled() {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if !grpcAllowed(ctx, auth) {
+					return nil, status.Error(codes.Unauthenticated, "unauthorized")
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if !grpcAllowed(ss.Context(), auth) {
+					return status.Error(codes.Unauthenticated, "unauthorized")
+				}
+				return handler(srv, ss)
+			}))
+	}
+	gs := grpc.NewServer(opts...)
+	rdbvizpb.RegisterAnalysisServiceServer(gs, &grpcServer{jobs: jr})
+	return gs.Serve(lis)
+}
+
+func grpcAllowed(ctx context.Context, auth *authenticator) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return auth.allowed(&http.Request{Header: http.Header{"Authorization": md.Get("authorization")}})
+}
+
+func (s *grpcServer) SubmitAnalysis(ctx context.Context, in *rdbvizpb.SubmitAnalysisRequest) (*rdbvizpb.Job, error) {
+	req := analyzeRequest{URL: in.Url, Name: in.Name, TopN: int(in.TopN), Instance: in.Instance, Shard: in.Shard}
+	if err := s.jobs.guard.check(req.URL); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.Name != "" && !validReportID(req.Name) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid report name %q", req.Name)
+	}
+	opts, err := req.options()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	j, err := s.jobs.newJob(req, opts)
+	if err != nil {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	slog.Info("analysis queued", "job", j.ID, "source", j.Source)
+	go s.jobs.run(j)
+	return jobProto(s.jobs.snapshot(j)), nil
+}
+
+func (s *grpcServer) StreamProgress(in *rdbvizpb.StreamProgressRequest, stream rdbvizpb.AnalysisService_StreamProgressServer) error {
+	j, ok := s.jobs.get(in.JobId)
+	if !ok {
+		return status.Errorf(codes.NotFound, "no job %q", in.JobId)
+	}
+	for {
+		c, changed := s.jobs.watch(j)
+		if err := stream.Send(jobProto(c)); err != nil {
+			return err
+		}
+		if c.Status == jobDone || c.Status == jobFailed {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (s *grpcServer) GetReport(ctx context.Context, in *rdbvizpb.GetReportRequest) (*rdbvizpb.Report, error) {
+	d := s.jobs.reports
+	rep, err := d.load(in.Id)
+	switch {
+	case errors.Is(err, errNoReport):
+		return nil, status.Errorf(codes.NotFound, "no report %q", in.Id)
+	case err != nil:
+		return nil, err
+	}
+	p, _ := d.path(in.Id)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	types := map[string]int64{}
+	for t, n := range rep.Summary.TypeCounts {
+		types[t] = int64(n)
+	}
+	return &rdbvizpb.Report{
+		Id:           in.Id,
+		Source:       rep.Meta.Source,
+		Instance:     rep.Meta.Instance,
+		Shard:        rep.Meta.Shard,
+		GeneratedAt:  rep.Meta.GeneratedAt,
+		TotalKeys:    rep.Summary.TotalKeys,
+		TotalSize:    rep.Summary.TotalSize,
+		EstimatedMem: rep.Summary.TotalMem,
+		WithTtl:      rep.Summary.WithTTL,
+		Expired:      rep.Summary.Expired,
+		TypeKeys:     types,
+		Json:         data,
+	}, nil
+}
+
+// StreamKeys takes a job slot for the analysis, which Send blocks while the
+// client's flow control window is full.
+func (s *grpcServer) StreamKeys(in *rdbvizpb.StreamKeysRequest, stream rdbvizpb.AnalysisService_StreamKeysServer) error {
+	if err := s.jobs.guard.check(in.Url); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	opts, err := analyzeRequest{Instance: in.Instance, Shard: in.Shard}.options()
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	match := in.Match
+	if match == "" {
+		match = "*"
+	}
+	ctx := stream.Context()
+	jr := s.jobs
+	select {
+	case jr.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-jr.slots }()
+
+	log := slog.Default().With("source", displaySource(in.Url))
+	start := time.Now()
+	path, cleanup, err := fetchDump(ctx, jr.client, in.Url, jr.uploadDir, jr.maxUpload)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "fetch dump: %v", err)
+	}
+	defer cleanup()
+	opts.Logger = log
+	analyzer, err := rdbviz.New(opts)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	var sent int64
+	_, err = analyzer.AnalyzeFileFunc(ctx, path, func(rec rdbviz.KeyRecord) error {
+		if rec.Size < in.MinSize || !strings.HasPrefix(rec.Key, in.Prefix) || !rdbviz.GlobMatch(match, rec.Key) {
+			return nil
+		}
+		sent++
+		return stream.Send(keyProto(rec))
+	})
+	if err != nil {
+		log.Warn("key stream ended", "keys", sent, "err", err)
+		return err
+	}
+	log.Info("keys streamed", "keys", sent, "elapsed", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+var jobStatuses = map[string]rdbvizpb.Job_Status{
+	jobQueued:      rdbvizpb.Job_STATUS_QUEUED,
+	jobDownloading: rdbvizpb.Job_STATUS_DOWNLOADING,
+	jobRunning:     rdbvizpb.Job_STATUS_RUNNING,
+	jobDone:        rdbvizpb.Job_STATUS_DONE,
+	jobFailed:      rdbvizpb.Job_STATUS_FAILED,
+}
+
+func jobProto(j job) *rdbvizpb.Job {
+	pb := &rdbvizpb.Job{
+		Id:       j.ID,
+		Status:   jobStatuses[j.Status],
+		Source:   j.Source,
+		ReportId: j.Report,
+		Error:    j.Error,
+		Created:  timestamppb.New(j.Created),
+	}
+	if j.Started != nil {
+		pb.Started = timestamppb.New(*j.Started)
+	}
+	if j.Finished != nil {
+		pb.Finished = timestamppb.New(*j.Finished)
+	}
+	if p := j.Progress; p != nil {
+		pb.Progress = &rdbvizpb.Progress{
+			Stage:          p.Stage,
+			Db:             int32(p.DB),
+			Keys:           p.Keys,
+			Bytes:          p.Bytes,
+			TotalBytes:     p.TotalBytes,
+			Percent:        p.Percent,
+			ElapsedSeconds: p.Elapsed,
+			EtaSeconds:     p.ETA,
+		}
+	}
+	return pb
+}
+
+func keyProto(rec rdbviz.KeyRecord) *rdbvizpb.Key {
+	k := &rdbvizpb.Key{
+		Db:           int32(rec.DB),
+		Key:          []byte(rec.Key),
+		Type:         rec.Type,
+		Encoding:     rec.Encoding,
+		Size:         rec.Size,
+		EstimatedMem: rec.EstimatedMem,
+		Elements:     rec.Elements,
+		IdleSeconds:  rec.Idle,
+	}
+	if rec.Expiration != nil {
+		k.ExpiresAt = timestamppb.New(*rec.Expiration)
+	}
+	return k
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+var (
+	historyRuns    = []byte("runs")    // run ID -> historyRun
+	historyReports = []byte("reports") // run ID -> report JSON
+)
+
+// historyStore keeps the reports posted to serve -history in a bbolt file,
+// with the instance, shard and time of each run, so the runs of an instance
+// can be browsed and compared over months. Run IDs are the store's sequence
+// numbers.
+type historyStore struct {
+	db *bolt.DB
+}
+
+// historyRun is the metadata of a stored report; Time is when the report was
+// generated, Stored when it was added to the history.
+type historyRun struct {
+	ID         string    `json:"id"`
+	Instance   string    `json:"instance"`
+	Shard      string    `json:"shard,omitempty"`
+	Time       time.Time `json:"time"`
+	Stored     time.Time `json:"stored"`
+	Source     string    `json:"source"`
+	TotalKeys  int64     `json:"total_keys"`
+	TotalSize  int64     `json:"total_size"`
+	TotalMem   int64     `json:"estimated_mem"`
+	ExpiredMem int64     `json:"expired_estimated_mem"`
+}
+
+// historyInstance sums up the runs of one instance.
+type historyInstance struct {
+	Instance string    `json:"instance"`
+	Runs     int       `json:"runs"`
+	Latest   time.Time `json:"latest"`
+	LatestID string    `json:"latest_id"`
+}
+
+var errNoRun = errors.New("no such run")
+
+func openHistory(path string) (*historyStore, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{historyRuns, historyReports} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &historyStore{db: db}, nil
+}
+
+// add stores rep under the instance and shard of its meta. data is rep as
+// JSON, kept as is so the stored report is the one posted.
+func (h *historyStore) add(rep *rdbviz.Report, data []byte) (historyRun, error) {
+	run := historyRun{
+		Instance:   rep.Meta.Instance,
+		Shard:      rep.Meta.Shard,
+		Stored:     time.Now().UTC(),
+		Source:     rep.Meta.Source,
+		TotalKeys:  rep.Summary.TotalKeys,
+		TotalSize:  rep.Summary.TotalSize,
+		TotalMem:   rep.Summary.TotalMem,
+		ExpiredMem: rep.Summary.ExpiredMem,
+	}
+	run.Time = run.Stored
+	if t, err := time.Parse(time.RFC3339, rep.Meta.GeneratedAt); err == nil {
+		run.Time = t.UTC()
+	}
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(historyRuns)
+		seq, err := runs.NextSequence()
+		if err != nil {
+			return err
+		}
+		run.ID = strconv.FormatUint(seq, 10)
+		meta, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		if err := runs.Put([]byte(run.ID), meta); err != nil {
+			return err
+		}
+		return tx.Bucket(historyReports).Put([]byte(run.ID), data)
+	})
+	return run, err
+}
+
+// runs lists the runs of instance, of one shard unless shard is empty,
+// newest first; an empty instance lists all runs.
+func (h *historyStore) runs(instance, shard string) ([]historyRun, error) {
+	list := []historyRun{}
+	err := h.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyRuns).ForEach(func(_, v []byte) error {
+			var run historyRun
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			if (instance == "" || run.Instance == instance) && (shard == "" || run.Shard == shard) {
+				list = append(list, run)
+			}
+			return nil
+		})
+	})
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Time.Equal(list[j].Time) {
+			return list[i].Time.After(list[j].Time)
+		}
+		// the same report posted twice: the last stored first
+		return len(list[i].ID) > len(list[j].ID) || (len(list[i].ID) == len(list[j].ID) && list[i].ID > list[j].ID)
+	})
+	return list, err
+}
+
+func (h *historyStore) instances() ([]historyInstance, error) {
+	runs, err := h.runs("", "")
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*historyInstance{}
+	list := []historyInstance{}
+	for _, run := range runs {
+		// newest first: the first run of an instance is its latest
+		in, ok := byName[run.Instance]
+		if !ok {
+			list = append(list, historyInstance{Instance: run.Instance, Latest: run.Time, LatestID: run.ID})
+			in = &list[len(list)-1]
+			byName[run.Instance] = in
+		}
+		in.Runs++
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Instance < list[j].Instance })
+	return list, nil
+}
+
+// report returns the stored JSON of run id.
+func (h *historyStore) report(id string) ([]byte, error) {
+	var data []byte
+	err := h.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(historyReports).Get([]byte(id))
+		if v == nil {
+			return errNoRun
+		}
+		data = bytes.Clone(v)
+		return nil
+	})
+	return data, err
+}
+
+func (h *historyStore) load(id string) (*rdbviz.Report, error) {
+	data, err := h.report(id)
+	if err != nil {
+		return nil, err
+	}
+	var rep rdbviz.Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+func (h *historyStore) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/history/instances", h.handleInstances)
+	mux.HandleFunc("GET /api/history/runs", h.handleRuns)
+	mux.HandleFunc("POST /api/history/runs", h.handleAdd)
+	mux.HandleFunc("GET /api/history/runs/{id}", h.handleReport)
+	mux.HandleFunc("GET /api/history/compare", h.handleCompare)
+}
+
+func (h *historyStore) handleInstances(w http.ResponseWriter, r *http.Request) {
+	list, err := h.instances()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, list)
+}
+
+func (h *historyStore) handleRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	list, err := h.runs(q.Get("instance"), q.Get("shard"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, list)
+}
+
+// handleAdd stores the report posted as the body; instance= and shard=
+// override those of its meta, e.g. for reports made without -instance.
+func (h *historyStore) handleAdd(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var rep rdbviz.Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		http.Error(w, "bad report: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	if q.Has("instance") || q.Has("shard") {
+		if q.Has("instance") {
+			rep.Meta.Instance = q.Get("instance")
+		}
+		if q.Has("shard") {
+			rep.Meta.Shard = q.Get("shard")
+		}
+		if data, err = json.Marshal(&rep); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if rep.Meta.Instance == "" {
+		http.Error(w, "the report has no instance: set instance= or analyze with -instance", http.StatusBadRequest)
+		return
+	}
+	run, err := h.add(&rep, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("run stored", "run", run.ID, "instance", run.Instance, "shard", run.Shard)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, run)
+}
+
+func (h *historyStore) handleReport(w http.ResponseWriter, r *http.Request) {
+	data, err := h.report(r.PathValue("id"))
+	switch {
+	case errors.Is(err, errNoRun):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// compareRow is a diffRow as served by /api/history/compare.
+type compareRow struct {
+	Name     string `json:"name"`
+	OldCount int64  `json:"old_count"`
+	NewCount int64  `json:"new_count"`
+	OldMem   int64  `json:"old_estimated_mem"`
+	NewMem   int64  `json:"new_estimated_mem"`
+}
+
+func compareRows(rows []diffRow) []compareRow {
+	out := make([]compareRow, len(rows))
+	for i, r := range rows {
+		out[i] = compareRow{r.name, r.oldCount, r.newCount, r.oldMem, r.newMem}
+	}
+	return out
+}
+
+// handleCompare answers what the diff subcommand prints for runs from= and
+// to=: the totals, and the types and the topn= prefixes (20 by default) by
+// change in estimated memory.
+func (h *historyStore) handleCompare(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	topN := 20
+	if s := q.Get("topn"); s != "" {
+		var err error
+		if topN, err = strconv.Atoi(s); err != nil || topN < 0 {
+			http.Error(w, "topn must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+	var reps [2]*rdbviz.Report
+	for i, name := range []string{"from", "to"} {
+		rep, err := h.load(q.Get(name))
+		switch {
+		case errors.Is(err, errNoRun):
+			http.Error(w, name+": "+err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		reps[i] = rep
+	}
+	before, after := reps[0], reps[1]
+	writeJSON(w, struct {
+		From     string       `json:"from"`
+		To       string       `json:"to"`
+		Totals   []compareRow `json:"totals"`
+		Types    []compareRow `json:"types"`
+		Prefixes []compareRow `json:"prefixes"`
+	}{
+		From: q.Get("from"),
+		To:   q.Get("to"),
+		Totals: []compareRow{
+			{"all", before.Summary.TotalKeys, after.Summary.TotalKeys, before.Summary.TotalMem, after.Summary.TotalMem},
+			{"expired", before.Summary.Expired, after.Summary.Expired, before.Summary.ExpiredMem, after.Summary.ExpiredMem},
+		},
+		Types:    compareRows(typeDiff(before, after)),
+		Prefixes: compareRows(prefixDiff(before, after, topN)),
+	})
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// Job states, in order.
+const (
+	jobQueued      = "queued"
+	jobDownloading = "downloading"
+	jobRunning     = "running"
+	jobDone        = "done"
+	jobFailed      = "failed"
+)
+
+// jobProgressEvery is how often a running job's progress is refreshed.
+const jobProgressEvery = time.Second
+
+// jobRunner analyzes dumps posted to /api/analyze in the background, at most
+// one per slot at a time, and writes their reports to the -reports
+// directory under the job ID. Jobs are kept in memory: their reports
+// outlive a restart, their status does not.
+type jobRunner struct {
+	reports   *reportDir
+	history   *historyStore // also stores the reports when set
+	uploadDir string
+	maxUpload int64
+	slots     chan struct{}
+	// guard checks the dump URLs of clients, fetched with client;
+	// scheduleClient fetches the operator's -schedule sources
+	guard          *urlGuard
+	client         *http.Client
+	scheduleClient *http.Client
+	// otlp, when set, is copied for each job to export its trace and
+	// metrics
+	otlp *rdbviz.OTLPWriter
+	// completion posts the end of each job, with a link to its report
+	// under publicURL, and grafana annotates it
+	completion *completionFlags
+	grafana    *grafanaFlags
+	publicURL  string
+
+	mu   sync.Mutex
+	jobs map[string]*job
+	seq  int
+}
+
+// job is the status of one analysis, as served by /api/jobs/{id}. Report is
+// the ID of its report once done.
+type job struct {
+	ID       string         `json:"id"`
+	Status   string         `json:"status"`
+	Source   string         `json:"source"`
+	Report   string         `json:"report,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Progress *progressEvent `json:"progress,omitempty"`
+	Created  time.Time      `json:"created"`
+	Started  *time.Time     `json:"started,omitempty"`
+	Finished *time.Time     `json:"finished,omitempty"`
+	fetch    string         // dump source read by the job, see fetchDump
+	dump     string         // uploaded dump, removed when the job ends
+	opts     rdbviz.Options
+	changed  chan struct{} // closed by the next update, see watch
+	// scheduled jobs fetch a source of the operator's, not of a client
+	scheduled bool
+}
+
+func newJobRunner(reports *reportDir, history *historyStore, uploadDir string, maxUpload int64, slots int, guard *urlGuard) *jobRunner {
+	return &jobRunner{
+		reports:        reports,
+		history:        history,
+		uploadDir:      uploadDir,
+		maxUpload:      maxUpload,
+		slots:          make(chan struct{}, slots),
+		guard:          guard,
+		client:         guard.client(),
+		scheduleClient: &http.Client{},
+		jobs:           map[string]*job{},
+	}
+}
+
+func (jr *jobRunner) register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/analyze", jr.handleAnalyze)
+	mux.HandleFunc("GET /api/jobs", jr.handleList)
+	mux.HandleFunc("GET /api/jobs/{id}", jr.handleJob)
+}
+
+// analyzeRequest is the JSON body of /api/analyze for a dump to fetch, e.g.
+// a presigned object storage URL.
+type analyzeRequest struct {
+	URL      string `json:"url"`
+	Name     string `json:"name"`
+	TopN     int    `json:"topn"`
+	Instance string `json:"instance"`
+	Shard    string `json:"shard"`
+	file     string // name of the uploaded file
+}
+
+// handleAnalyze queues a job for a dump uploaded as the "rdb" file of a
+// multipart form, posted as the raw body, or referenced by a JSON
+// {"url": ...} body. name= (or "name") sets the report ID, topn= the length
+// of the top lists, and instance= and shard= the labels of the report's
+// meta. It answers 202 with the job.
+func (jr *jobRunner) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := analyzeRequest{Name: q.Get("name"), Instance: q.Get("instance"), Shard: q.Get("shard")}
+	if s := q.Get("topn"); s != "" {
+		var err error
+		if req.TopN, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "topn must be an integer", http.StatusBadRequest)
+			return
+		}
+	}
+	if jr.maxUpload > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, jr.maxUpload)
+	}
+	ctype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var body io.Reader
+	switch ctype {
+	case "application/json":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := jr.guard.check(req.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "multipart/form-data":
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				http.Error(w, `no "rdb" file in the form`, http.StatusBadRequest)
+				return
+			}
+			if part.FormName() == "rdb" {
+				body = part
+				req.file = part.FileName()
+				break
+			}
+		}
+	default:
+		body = r.Body
+	}
+
+	if req.Name != "" && !validReportID(req.Name) {
+		http.Error(w, fmt.Sprintf("invalid report name %q", req.Name), http.StatusBadRequest)
+		return
+	}
+	opts, err := req.options()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	j, err := jr.newJob(req, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if body != nil {
+		if err := jr.receive(j, body); err != nil {
+			jr.drop(j)
+			status := http.StatusInternalServerError
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, "upload failed: "+err.Error(), status)
+			return
+		}
+	}
+	slog.Info("analysis queued", "job", j.ID, "source", j.Source)
+	go jr.run(j)
+	w.Header().Set("Location", "/api/jobs/"+j.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, jr.snapshot(j))
+}
+
+// options returns the analysis options of req.
+func (req analyzeRequest) options() (rdbviz.Options, error) {
+	opts := rdbviz.DefaultOptions()
+	if req.TopN > 0 {
+		opts.TopN = req.TopN
+	}
+	opts.Instance, opts.Shard = req.Instance, req.Shard
+	return opts, opts.Validate()
+}
+
+// newJob reserves the report ID of a job: req.Name when given, else one
+// made of the time and a sequence number.
+func (jr *jobRunner) newJob(req analyzeRequest, opts rdbviz.Options) (*job, error) {
+	id := req.Name
+	if id == "" {
+		jr.mu.Lock()
+		jr.seq++
+		id = fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), jr.seq)
+		jr.mu.Unlock()
+	}
+	j := &job{ID: id, Status: jobQueued, Source: "upload", Created: time.Now(), fetch: req.URL, opts: opts}
+	if req.file != "" {
+		j.Source = "upload:" + req.file
+	}
+	if req.URL != "" {
+		j.Source = displaySource(req.URL)
+	}
+	return j, jr.reserve(j)
+}
+
+// reserve adds j to the jobs unless its ID is taken by a job or a report.
+func (jr *jobRunner) reserve(j *job) error {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	if _, ok := jr.jobs[j.ID]; ok {
+		return fmt.Errorf("job %q already exists", j.ID)
+	}
+	if _, ok := jr.reports.path(j.ID); ok {
+		return fmt.Errorf("report %q already exists", j.ID)
+	}
+	jr.jobs[j.ID] = j
+	return nil
+}
+
+func (jr *jobRunner) drop(j *job) {
+	jr.mu.Lock()
+	delete(jr.jobs, j.ID)
+	jr.mu.Unlock()
+	if j.dump != "" {
+		os.Remove(j.dump)
+	}
+}
+
+// receive stores the dump read from body in the upload directory.
+func (jr *jobRunner) receive(j *job, body io.Reader) error {
+	f, err := os.CreateTemp(jr.uploadDir, "rdbviz-"+j.ID+"-*.rdb")
+	if err != nil {
+		return err
+	}
+	jr.update(j, func() { j.dump = f.Name() })
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// run waits for a slot and analyzes the dump of j.
+func (jr *jobRunner) run(j *job) {
+	jr.slots <- struct{}{}
+	defer func() { <-jr.slots }()
+	defer func() {
+		if j.dump != "" {
+			os.Remove(j.dump)
+		}
+	}()
+	log := slog.Default().With("job", j.ID)
+	ctx := context.Background()
+	now := time.Now()
+	jr.update(j, func() { j.Started = &now })
+
+	var otlp *rdbviz.OTLPWriter
+	if jr.otlp != nil {
+		w := *jr.otlp
+		otlp = &w
+	}
+	var rep *rdbviz.Report
+	err := func() error {
+		dump := j.dump
+		if j.fetch != "" {
+			if remoteSource(j.fetch) {
+				jr.update(j, func() { j.Status = jobDownloading })
+			}
+			client := jr.client
+			if j.scheduled {
+				client = jr.scheduleClient
+			}
+			start := time.Now()
+			path, cleanup, err := fetchDump(ctx, client, j.fetch, jr.uploadDir, jr.maxUpload)
+			if otlp != nil && remoteSource(j.fetch) {
+				otlp.RecordStage(rdbviz.StageTiming{Stage: "download", Start: start, End: time.Now(), Err: err})
+			}
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			dump = path
+		}
+		jr.update(j, func() { j.Status = jobRunning })
+		opts := j.opts
+		if otlp != nil {
+			opts.OnStage = otlp.RecordStage
+		}
+		opts.Logger = log
+		opts.Progress = jobProgressEvery
+		opts.OnProgress = func(p rdbviz.Progress) {
+			e := newProgressEvent(p)
+			jr.update(j, func() { j.Progress = &e })
+		}
+		analyzer, err := rdbviz.New(opts)
+		if err != nil {
+			return err
+		}
+		rep, err = analyzer.AnalyzeFile(ctx, dump)
+		if err != nil {
+			return err
+		}
+		rep.Meta.Source = j.Source
+		if err := (rdbviz.JSONWriter{Path: filepath.Join(jr.reports.dir, j.ID+".json")}).WriteReport(rep); err != nil {
+			return err
+		}
+		if otlp != nil {
+			// the report is there, a collector being down does not fail the job
+			if err := otlp.WriteReport(rep); err != nil {
+				log.Warn("otlp export failed", "err", err)
+			}
+		}
+		if jr.history == nil || rep.Meta.Instance == "" {
+			return nil
+		}
+		data, err := json.Marshal(rep)
+		if err != nil {
+			return err
+		}
+		run, err := jr.history.add(rep, data)
+		if err == nil {
+			log.Info("run stored", "run", run.ID, "instance", run.Instance, "shard", run.Shard)
+		}
+		return err
+	}()
+
+	end := time.Now()
+	jr.update(j, func() {
+		j.Finished = &end
+		j.Progress = nil
+		if err != nil {
+			j.Status, j.Error = jobFailed, err.Error()
+			return
+		}
+		j.Status, j.Report = jobDone, j.ID
+	})
+	c := newCompletion(j.Source, j.opts, now, rep, err)
+	c.Job = j.ID
+	if err == nil {
+		c.Report = jr.publicURL + "/api/reports/" + url.PathEscape(j.ID)
+	}
+	// the job is over either way, a receiver being down only warns
+	if err := jr.completion.post(c); err != nil {
+		log.Warn("notify-url error", "err", err)
+	}
+	if err := jr.grafana.annotate(c); err != nil {
+		log.Warn("grafana error", "err", err)
+	}
+	if err != nil {
+		log.Error("analysis failed", "err", err)
+		return
+	}
+	log.Info("analysis done", "report", j.ID, "elapsed", end.Sub(now).Round(time.Millisecond))
+}
+
+func (jr *jobRunner) update(j *job, fn func()) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	fn()
+	if j.changed != nil {
+		close(j.changed)
+		j.changed = nil
+	}
+}
+
+// watch returns a copy of j and a channel closed once it changes.
+func (jr *jobRunner) watch(j *job) (job, <-chan struct{}) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	if j.changed == nil {
+		j.changed = make(chan struct{})
+	}
+	return copyJob(j), j.changed
+}
+
+// get returns the job of id.
+func (jr *jobRunner) get(id string) (*job, bool) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	j, ok := jr.jobs[id]
+	return j, ok
+}
+
+// snapshot copies j for encoding outside the lock.
+func (jr *jobRunner) snapshot(j *job) job {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	return copyJob(j)
+}
+
+// copyJob copies j, under jr.mu.
+func copyJob(j *job) job {
+	c := *j
+	if j.Progress != nil {
+		p := *j.Progress
+		c.Progress = &p
+	}
+	return c
+}
+
+func (jr *jobRunner) handleList(w http.ResponseWriter, r *http.Request) {
+	jr.mu.Lock()
+	list := make([]*job, 0, len(jr.jobs))
+	for _, j := range jr.jobs {
+		list = append(list, j)
+	}
+	jr.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	out := make([]job, len(list))
+	for i, j := range list {
+		out[i] = jr.snapshot(j)
+	}
+	writeJSON(w, out)
+}
+
+func (jr *jobRunner) handleJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := jr.get(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, jr.snapshot(j))
+}
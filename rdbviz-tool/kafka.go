@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// kafkaFlags publish a snapshot of the keyspace to a Kafka topic: every
+// key as it is parsed, or the prefix table once the analysis ends, then an
+// end record.
+type kafkaFlags struct {
+	brokers string
+	topic   string
+	records string
+	batch   int
+}
+
+func addKafkaFlags(fs *flag.FlagSet) *kafkaFlags {
+	kf := &kafkaFlags{}
+	fs.StringVar(&kf.brokers, "kafka-brokers", "", "comma-separated Kafka brokers to publish the keyspace to, e.g. kafka-1:9092,kafka-2:9092")
+	fs.StringVar(&kf.topic, "kafka-topic", "", "-kafka-brokers: topic of the records")
+	fs.StringVar(&kf.records, "kafka-records", "keys", "-kafka-brokers: records published: keys, one per key during the parse, or prefixes, the prefix table at the end")
+	fs.IntVar(&kf.batch, "kafka-batch", 1000, "-kafka-brokers: records sent per produce request")
+	return kf
+}
+
+// kafkaRecord is the JSON value of a message. Record is key, prefix or
+// end; every record of a snapshot carries the time it started, so
+// consumers can drop keys the end record's snapshot did not see.
+type kafkaRecord struct {
+	Record       string     `json:"record"`
+	Snapshot     string     `json:"snapshot"`
+	Instance     string     `json:"instance,omitempty"`
+	Shard        string     `json:"shard,omitempty"`
+	DB           *int       `json:"db,omitempty"`
+	Key          string     `json:"key,omitempty"`
+	Prefix       string     `json:"prefix,omitempty"`
+	Type         string     `json:"type,omitempty"`
+	Encoding     string     `json:"encoding,omitempty"`
+	Keys         int64      `json:"keys,omitempty"`
+	Size         int64      `json:"size"`
+	EstimatedMem int64      `json:"estimated_mem"`
+	Elements     int64      `json:"elements,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Idle         *int64     `json:"idle_seconds,omitempty"`
+	Source       string     `json:"source,omitempty"`
+}
+
+// kafkaSink batches the records of one analysis. Its methods are called
+// from the analyzing goroutine only.
+type kafkaSink struct {
+	w        *kafka.Writer
+	records  string
+	batch    int
+	snapshot string
+	instance string
+	shard    string
+	pending  []kafka.Message
+}
+
+// sink returns the sink configured by the flags, nil without
+// -kafka-brokers.
+func (kf *kafkaFlags) sink(opts rdbviz.Options) (*kafkaSink, error) {
+	if kf.brokers == "" {
+		return nil, nil
+	}
+	switch {
+	case kf.topic == "":
+		return nil, errors.New("-kafka-brokers needs -kafka-topic")
+	case kf.records != "keys" && kf.records != "prefixes":
+		return nil, errors.New("-kafka-records must be keys or prefixes")
+	case kf.batch < 1:
+		return nil, errors.New("-kafka-batch must be at least 1")
+	}
+	return &kafkaSink{
+		w: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(kf.brokers, ",")...),
+			Topic:        kf.topic,
+			Balancer:     &kafka.Hash{},
+			BatchSize:    kf.batch,
+			RequiredAcks: kafka.RequireAll,
+		},
+		records:  kf.records,
+		batch:    kf.batch,
+		snapshot: time.Now().UTC().Format(time.RFC3339),
+		instance: opts.Instance,
+		shard:    opts.Shard,
+	}, nil
+}
+
+// onKey is the callback of the analysis, nil unless keys are published.
+func (s *kafkaSink) onKey() func(rdbviz.KeyRecord) error {
+	if s == nil || s.records != "keys" {
+		return nil
+	}
+	return func(rec rdbviz.KeyRecord) error {
+		r := kafkaRecord{
+			Record:       "key",
+			DB:           &rec.DB,
+			Key:          rec.Key,
+			Type:         rec.Type,
+			Encoding:     rec.Encoding,
+			Size:         rec.Size,
+			EstimatedMem: rec.EstimatedMem,
+			Elements:     rec.Elements,
+			ExpiresAt:    rec.Expiration,
+		}
+		if rec.Idle >= 0 {
+			r.Idle = &rec.Idle
+		}
+		// the message key keeps each Redis key on one partition and lets a
+		// compacted topic keep its last record
+		return s.add(strconv.Itoa(rec.DB)+"/"+rec.Key, r)
+	}
+}
+
+func (s *kafkaSink) add(key string, r kafkaRecord) error {
+	r.Snapshot, r.Instance, r.Shard = s.snapshot, s.instance, s.shard
+	if s.shard != "" {
+		key = s.shard + "/" + key
+	}
+	if s.instance != "" {
+		key = s.instance + "/" + key
+	}
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.pending = append(s.pending, kafka.Message{Key: []byte(key), Value: value})
+	if len(s.pending) >= s.batch {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *kafkaSink) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err := s.w.WriteMessages(ctx, s.pending...)
+	s.pending = s.pending[:0]
+	return err
+}
+
+// finish publishes the prefixes of rep when they are the records, then the
+// end record with the totals, and closes the writer.
+func (s *kafkaSink) finish(rep *rdbviz.Report) error {
+	var err error
+	if s.records == "prefixes" {
+		for _, p := range rep.Prefixes {
+			if err = s.add("prefix/"+p.Prefix, kafkaRecord{Record: "prefix", Prefix: p.Prefix, Keys: p.Count, Size: p.Size, EstimatedMem: p.EstimatedMem}); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = s.add("end", kafkaRecord{
+			Record:       "end",
+			Keys:         rep.Summary.TotalKeys,
+			Size:         rep.Summary.TotalSize,
+			EstimatedMem: rep.Summary.TotalMem,
+			Source:       rep.Meta.Source,
+		})
+	}
+	if err == nil {
+		err = s.flush()
+	}
+	return errors.Join(err, s.w.Close())
+}
+
+// close drops what is pending, for an analysis that failed.
+func (s *kafkaSink) close() {
+	s.w.Close()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// runKeys is the keys subcommand (formerly export-keys): it lists the key
+// names of a dump with a prefix, one per line, with optional tab-separated
+// columns.
+func runKeys(args []string) {
+	fs := flag.NewFlagSet("keys", flag.ExitOnError)
+	lf := addLogFlags(fs)
+	rdbPath := fs.String("rdb", "", "path to dump.rdb")
+	outPath := fs.String("out", "", "output file (default stdout)")
+	prefix := fs.String("prefix", "", "only list keys starting with this prefix")
+	match := fs.String("match", "*", "only list keys matching this glob")
+	columns := fs.String("columns", "", "extra columns before the key, comma-separated: db, type, size, ttl")
+	fs.Parse(args)
+	lf.setup()
+
+	if *rdbPath == "" {
+		fmt.Println("usage: rdbviz-tool keys -rdb dump.rdb -prefix session: [-columns db,size,ttl] [-out keys.txt]")
+		os.Exit(2)
+	}
+	var cols []string
+	if *columns != "" {
+		cols = strings.Split(*columns, ",")
+		for _, c := range cols {
+			switch c {
+			case "db", "type", "size", "ttl":
+			default:
+				fatal(2, "unknown column, use db, type, size or ttl", "column", c)
+			}
+		}
+	}
+
+	out := io.Writer(os.Stdout)
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fatal(1, "create error", "err", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	rdbFile, err := os.Open(*rdbPath)
+	if err != nil {
+		fatal(1, "open rdb error", "err", err)
+	}
+	defer rdbFile.Close()
+
+	w := bufio.NewWriter(out)
+	now := time.Now()
+	var keys int64
+	err = parser.NewDecoder(rdbFile).Parse(func(o parser.RedisObject) bool {
+		key := o.GetKey()
+		if key == "" || !strings.HasPrefix(key, *prefix) || !rdbviz.GlobMatch(*match, key) {
+			return true
+		}
+		for _, c := range cols {
+			switch c {
+			case "db":
+				w.WriteString(strconv.Itoa(o.GetDBIndex()))
+			case "type":
+				w.WriteString(o.GetType())
+			case "size":
+				w.WriteString(strconv.Itoa(o.GetSize()))
+			case "ttl":
+				w.WriteString(strconv.FormatInt(keyTTL(o.GetExpiration(), now), 10))
+			}
+			w.WriteByte('\t')
+		}
+		w.WriteString(redisQuote(key))
+		w.WriteByte('\n')
+		keys++
+		return true
+	})
+	if err != nil {
+		fatal(1, "parse error", "err", err)
+	}
+	if err := w.Flush(); err != nil {
+		fatal(1, "write error", "err", err)
+	}
+	slog.Info("keys listed", "keys", keys)
+}
+
+// keyTTL is the remaining TTL in seconds like the TTL command reports it:
+// -1 without expiration, 0 once expired.
+func keyTTL(expiration *time.Time, now time.Time) int64 {
+	if expiration == nil {
+		return -1
+	}
+	if !expiration.After(now) {
+		return 0
+	}
+	return int64(expiration.Sub(now) / time.Second)
+}
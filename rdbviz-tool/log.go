@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// logFlags are the -log-format and -log-level flags every subcommand takes,
+// with the -quiet, -v and -vv shorthands for the level.
+type logFlags struct {
+	format  string
+	level   string
+	quiet   bool
+	verbose bool
+	trace   bool
+}
+
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	lf := &logFlags{}
+	fs.StringVar(&lf.format, "log-format", "text", "log format on stderr: text or json")
+	fs.StringVar(&lf.level, "log-level", "info", "minimum log level: debug, info, warn or error")
+	fs.BoolVar(&lf.quiet, "quiet", false, "log errors only, without progress, e.g. for cron")
+	fs.BoolVar(&lf.verbose, "v", false, "log debug diagnostics")
+	fs.BoolVar(&lf.trace, "vv", false, "also log per-key diagnostics, such as skipped records and undecodable values")
+	return lf
+}
+
+// setup installs the default slog logger the flags describe; the tool's own
+// messages go to it, while reports and command output stay on stdout.
+func (lf *logFlags) setup() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(lf.level)); err != nil {
+		fmt.Fprintf(os.Stderr, "-log-level must be debug, info, warn or error, got %q\n", lf.level)
+		os.Exit(2)
+	}
+	switch {
+	case lf.quiet && (lf.verbose || lf.trace):
+		fmt.Fprintln(os.Stderr, "-quiet cannot be combined with -v or -vv")
+		os.Exit(2)
+	case lf.quiet:
+		level = slog.LevelError
+	case lf.trace:
+		level = rdbviz.LevelTrace
+	case lf.verbose:
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: traceLevelName}
+	var h slog.Handler
+	switch lf.format {
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		fmt.Fprintf(os.Stderr, "-log-format must be text or json, got %q\n", lf.format)
+		os.Exit(2)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// traceLevelName names rdbviz.LevelTrace TRACE instead of DEBUG-4.
+func traceLevelName(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.LevelKey && a.Value.Any() == rdbviz.LevelTrace {
+		a.Value = slog.StringValue("TRACE")
+	}
+	return a
+}
+
+// fatal logs msg at error level and exits with code.
+func fatal(code int, msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(code)
+}
@@ -1,466 +1,478 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
+	"log/slog"
+	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/hdt3213/rdb/parser"
+	"rdbviz-tool/pkg/rdbviz"
 )
 
-type Meta struct {
-	Source       string            `json:"source"`
-	GeneratedAt  string            `json:"generated_at"`
-	RedisVersion string            `json:"redis_version,omitempty"`
-	RedisBits    string            `json:"redis_bits,omitempty"`
-	CTime        string            `json:"ctime,omitempty"`
-	UsedMem      string            `json:"used_mem,omitempty"`
-	AOFBase      string            `json:"aof_base,omitempty"`
-	Aux          map[string]string `json:"aux,omitempty"`
-}
-
-type Summary struct {
-	TotalKeys  int64          `json:"total_keys"`
-	TotalSize  int64          `json:"total_size"`
-	DBCount    int            `json:"db_count"`
-	DBKeys     map[int]int64  `json:"db_keys"`
-	WithTTL    int64          `json:"with_ttl"`
-	NoTTL      int64          `json:"no_ttl"`
-	Expired    int64          `json:"expired"`
-	NowISO     string         `json:"now"`
-	TypeCounts map[string]int `json:"type_counts"`
-}
-
-type TypeStat struct {
-	Type  string `json:"type"`
-	Count int64  `json:"count"`
-	Size  int64  `json:"size"`
-}
-
-type Bucket struct {
-	Label string `json:"label"`
-	Count int64  `json:"count"`
-}
+// usage lists the subcommands.
+const usage = `usage: rdbviz-tool <command> [flags]
 
-type PrefixStat struct {
-	Prefix string `json:"prefix"`
-	Count  int64  `json:"count"`
-	Size   int64  `json:"size"`
-}
+commands:
+  analyze   parse a dump, or compare shard reports, into report.json
+  diff      compare two reports
+  merge     combine per-shard reports into one cluster report
+  serve     serve the rdbviz page and a directory of reports over HTTP
+  export    write matching keys as RESP commands for redis-cli --pipe
+  verify    check a dump's checksum and that every record decodes
+  keys      list key names with a prefix
+  cleanup   generate UNLINK commands for expired keys
+  bench     measure read, decode and analysis throughput of a dump
+  exporter  re-analyze a dump on an interval and serve Prometheus metrics
 
-type PrefixTypeGroup struct {
-	Type     string       `json:"type"`
-	Prefixes []PrefixStat `json:"prefixes"`
-}
-
-type BigKey struct {
-	DB          int       `json:"db"`
-	Key         string    `json:"key"`
-	Type        string    `json:"type"`
-	Size        int64     `json:"size"`
-	Encoding    string    `json:"encoding"`
-	Elements    int64     `json:"elements"`
-	Expiration *time.Time `json:"expiration,omitempty"`
-}
-
-type Report struct {
-	Meta        Meta         `json:"meta"`
-	Summary     Summary      `json:"summary"`
-	Types       []TypeStat   `json:"types"`
-	TTLBuckets  []Bucket     `json:"ttl_buckets"`
-	SizeBuckets []Bucket     `json:"size_buckets"`
-	Prefixes    []PrefixStat `json:"prefixes"`
-	PrefixesByType []PrefixTypeGroup `json:"prefixes_by_type"`
-	BigKeys     []BigKey     `json:"bigkeys"`
-}
-
-type ttlBucket struct {
-	Label string
-	Max   time.Duration
-}
-
-var ttlBuckets = []ttlBucket{
-	{Label: "<=1h", Max: time.Hour},
-	{Label: "1h-1d", Max: 24 * time.Hour},
-	{Label: "1d-7d", Max: 7 * 24 * time.Hour},
-	{Label: "7d-30d", Max: 30 * 24 * time.Hour},
-	{Label: "30d-90d", Max: 90 * 24 * time.Hour},
-	{Label: ">90d", Max: 36500 * 24 * time.Hour},
-}
-
-var sizeBuckets = []struct {
-	Label string
-	Max   int64
-}{
-	{Label: "0-1KB", Max: 1 * 1024},
-	{Label: "1KB-10KB", Max: 10 * 1024},
-	{Label: "10KB-100KB", Max: 100 * 1024},
-	{Label: "100KB-1MB", Max: 1 * 1024 * 1024},
-	{Label: "1MB-10MB", Max: 10 * 1024 * 1024},
-	{Label: "10MB-100MB", Max: 100 * 1024 * 1024},
-	{Label: ">100MB", Max: 1<<63 - 1},
-}
-
-type prefixAgg struct {
-	Count int64
-	Size  int64
-}
-
-type bigKeyHeap []BigKey
-
-func (h bigKeyHeap) Len() int           { return len(h) }
-func (h bigKeyHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
-func (h bigKeyHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
-
-func (h *bigKeyHeap) Push(x interface{}) {
-	*h = append(*h, x.(BigKey))
-}
-
-func (h *bigKeyHeap) Pop() interface{} {
-	old := *h
-	n := len(old)
-	x := old[n-1]
-	*h = old[:n-1]
-	return x
-}
+run "rdbviz-tool <command> -h" for the flags of a command`
 
 func main() {
-	rdbPath := flag.String("rdb", "", "path to dump.rdb")
-	outPath := flag.String("out", "", "output report.json")
-	sep := flag.String("prefix-sep", ":", "prefix separator")
-	maxDepth := flag.Int("prefix-depth", 3, "max prefix depth")
-	topN := flag.Int("topn", 50, "top N for prefixes and bigkeys")
-	progressEvery := flag.Duration("progress", 5*time.Second, "progress interval (0 to disable)")
-	flag.Parse()
-
-	if *rdbPath == "" || *outPath == "" {
-		fmt.Println("usage: rdbviz-tool -rdb dump.rdb -out report.json [-prefix-sep :] [-prefix-depth 3] [-topn 50]")
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
 		os.Exit(2)
 	}
-
-	rdbAbs, _ := filepath.Abs(*rdbPath)
-	now := time.Now()
-
-	meta := Meta{
-		Source:      rdbAbs,
-		GeneratedAt: now.Format(time.RFC3339),
-		Aux:         map[string]string{},
+	cmd, args := os.Args[1], os.Args[2:]
+	if strings.HasPrefix(cmd, "-") {
+		// flags without a command analyze, like before subcommands existed
+		cmd, args = "analyze", os.Args[1:]
+	}
+	switch cmd {
+	case "analyze":
+		runAnalyze(args)
+	case "diff":
+		runDiff(args)
+	case "merge":
+		runMerge(args)
+	case "serve":
+		runServe(args)
+	case "export":
+		runExport(args)
+	case "verify":
+		runVerify(args)
+	case "keys", "export-keys":
+		runKeys(args)
+	case "cleanup":
+		runCleanup(args)
+	case "bench":
+		runBench(args)
+	case "exporter":
+		runExporter(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Println(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", cmd, usage)
+		os.Exit(2)
 	}
+}
 
-	summary := Summary{
-		DBKeys:     map[int]int64{},
-		TypeCounts: map[string]int{},
-		NowISO:     now.Format(time.RFC3339),
+// runAnalyze is the analyze subcommand: it parses a dump into a report, or
+// compares the reports of all shards of a cluster with -shards.
+func runAnalyze(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	lf := addLogFlags(fs)
+	pf := addProfileFlags(fs)
+	of := addOTLPFlags(fs)
+	nf := addNotifyFlags(fs)
+	kf := addKafkaFlags(fs)
+	cf := addCompletionFlags(fs)
+	gf := addGrafanaFlags(fs)
+	opts := rdbviz.DefaultOptions()
+	rdbPath := fs.String("rdb", "", "path to dump.rdb")
+	outPath := fs.String("out", "", "output report.json")
+	htmlPath := fs.String("html", "", "output self-contained HTML page with the report embedded")
+	pageDir := fs.String("page-dir", "../rdbviz", "-html: directory of the rdbviz page")
+	csvDir := fs.String("csv-dir", "", "output directory for types.csv, prefixes.csv and bigkeys.csv")
+	metricsPath := fs.String("metrics", "", "output file of Prometheus text-format metrics")
+	publish := fs.String("publish", "", "s3:// or gs:// URL to upload the report, and the page of -html, under, e.g. s3://bucket/reports/; credentials from the AWS_* variables or GOOGLE_OAUTH_ACCESS_TOKEN")
+	statsdAddr := fs.String("statsd", "", "host:port of a StatsD server to push the metrics to over UDP")
+	statsdPrefix := fs.String("statsd-prefix", "rdbviz", "-statsd: prefix of the metric names")
+	dogstatsd := fs.Bool("dogstatsd", false, "-statsd: send DogStatsD tags instead of putting instance, DB, type and prefix in the metric names")
+	statsdTags := fs.String("statsd-tags", "", "-dogstatsd: comma-separated tags added to every metric, e.g. env:prod,team:cache")
+	datadog := fs.Bool("datadog", false, "submit the metrics and an analysis-complete event to Datadog, with the API key of $DD_API_KEY or -datadog-api-key-file")
+	datadogKeyFile := fs.String("datadog-api-key-file", "", "-datadog: file holding the API key")
+	datadogSite := fs.String("datadog-site", "", "-datadog: Datadog site, e.g. datadoghq.eu (default $DD_SITE, else datadoghq.com)")
+	datadogTags := fs.String("datadog-tags", "", "-datadog: comma-separated tags added to the metrics and the event, e.g. env:prod")
+	fs.StringVar(&opts.PrefixSep, "prefix-sep", opts.PrefixSep, "prefix separator")
+	fs.Var(prefixDepth{depth: &opts.PrefixDepth, auto: &opts.PrefixAutoDepth}, "prefix-depth", "max prefix depth, or \"auto\" to split while groups exceed -prefix-min-keys")
+	fs.Int64Var(&opts.PrefixMinKeys, "prefix-min-keys", opts.PrefixMinKeys, "auto prefix depth: a prefix is split further only when it groups more than this many keys")
+	fs.IntVar(&opts.TopN, "topn", opts.TopN, "top N for prefixes and bigkeys")
+	fs.DurationVar(&opts.Progress, "progress", opts.Progress, "progress interval (0 to disable)")
+	progressFormat := fs.String("progress-format", "auto", "progress display: bar, log lines, json objects, or auto for a bar when stderr is a terminal")
+	fs.IntVar(&opts.Workers, "workers", opts.Workers, "goroutines computing key sizes, memory and classes while the dump is decoded (1 for a single goroutine)")
+	fs.Var(byteSizeInt{&opts.ReadBuffer}, "read-buffer", "buffer the dump is read through, e.g. 4MB (0 for the decoder's 4KB)")
+	fs.BoolVar(&opts.ReadAhead, "read-ahead", opts.ReadAhead, "read the next -read-buffer of the dump on a separate goroutine while the current one is parsed")
+	fs.Var(byteRate{&opts.MaxReadRate}, "max-read-rate", "throttle reading the dump to this rate, e.g. 100MB/s (0 for no limit)")
+	fs.Var(byteSize{&opts.MaxMem}, "max-mem", "spill prefix tables and dedup hashes to disk past this estimated size, e.g. 2GB (0 for no limit)")
+	fs.StringVar(&opts.SpillDir, "spill-dir", opts.SpillDir, "-max-mem: directory of the temporary spill files (empty for the system default)")
+	fs.BoolVar(&opts.PartialOnCancel, "partial-on-interrupt", opts.PartialOnCancel, "on Ctrl-C while parsing, write the report of the keys read so far")
+	fs.IntVar(&opts.PrefixLen, "prefix-len", opts.PrefixLen, "group keys by their first N characters instead of separator segments (0 to disable)")
+	fs.IntVar(&opts.SuffixDepth, "suffix-depth", opts.SuffixDepth, "also group keys by their last N segments (0 to disable)")
+	fs.BoolVar(&opts.Patterns, "patterns", opts.Patterns, "normalize IDs/UUIDs/hashes in key names and report key patterns")
+	fs.IntVar(&opts.PatternMax, "pattern-max", opts.PatternMax, "max distinct key patterns tracked, the rest count as __other__")
+	fs.IntVar(&opts.PrefixTopKeys, "prefix-top-keys", opts.PrefixTopKeys, "list the N largest keys of each top prefix (0 to disable)")
+	fs.IntVar(&opts.PrefixMaxEntries, "prefix-max-entries", opts.PrefixMaxEntries, "max distinct prefixes kept per prefix table, smallest fold into __other__ (0 for no limit)")
+	fs.BoolVar(&opts.PrefixChildren, "prefix-children", opts.PrefixChildren, "estimate the distinct child segments under each top prefix with a HyperLogLog")
+	fs.IntVar(&opts.PrefixSketch, "prefix-sketch", opts.PrefixSketch, "count each prefix table in a SpaceSaving top-K sketch of N prefixes, approximate with error bounds (0 for exact maps)")
+	fs.BoolVar(&opts.BigKeysByType, "bigkeys-by-type", opts.BigKeysByType, "also keep a top N bigkey list per type")
+	fs.BoolVar(&opts.BigKeysByDB, "bigkeys-by-db", opts.BigKeysByDB, "also keep a top N bigkey list per DB when the dump has more than one")
+	fs.StringVar(&opts.BigKeySort, "bigkey-sort", opts.BigKeySort, "bigkey ranking: size, estimated_mem, elements or avg_element_size")
+	fs.StringVar(&opts.Allocator, "allocator", opts.Allocator, "allocator assumed by the memory model: jemalloc or libc")
+	fs.StringVar(&opts.Instance, "instance", "", "Redis instance the dump came from, recorded in the report meta")
+	fs.StringVar(&opts.Shard, "shard", "", "shard of -instance the dump came from, recorded in the report meta")
+	fs.Float64Var(&opts.SampleRate, "sample", opts.SampleRate, "fraction of keys to analyze (0-1], estimates are scaled up")
+	fs.Int64Var(&opts.MaxKeys, "max-keys", opts.MaxKeys, "stop after analyzing N keys (0 for no limit)")
+	fs.BoolVar(&opts.PerDB, "per-db", opts.PerDB, "also report types, TTL buckets, prefixes and bigkeys for each DB")
+	fs.BoolVar(&opts.Slots, "slots", opts.Slots, "add the keys and bytes of every cluster hash slot to the slot report, 16384 entries each, as -shards needs (default the 1024-slot ranges and top slots only)")
+	fs.Float64Var(&opts.HotSlotFactor, "hot-slot-factor", opts.HotSlotFactor, "flag slots with at least this many times an even share of LFU-estimated accesses")
+	shardPaths := fs.String("shards", "", "comma-separated reports of all shards of a cluster, compared instead of parsing -rdb")
+	fs.Float64Var(&opts.BalanceTolerance, "balance-tolerance", opts.BalanceTolerance, "-shards: allowed deviation of a shard's estimated memory from the mean")
+	fs.IntVar(&opts.Reshard, "reshard", opts.Reshard, "plan contiguous slot ranges for this many target nodes from the slot data (0 to disable)")
+	fs.Float64Var(&opts.HashTagHot, "hashtag-hot", opts.HashTagHot, "flag hash tags holding at least this fraction of all bytes")
+	fs.Var(&opts.TTLRules, "ttl-rule", "what-if TTL rule pattern=ttl, e.g. \"session:*=24h\" or \"cache:*=7d\" (repeatable)")
+	fs.Int64Var(&opts.MaxMemory, "maxmemory", opts.MaxMemory, "simulate eviction policies at this maxmemory in bytes (0 to disable)")
+	fs.Int64Var(&opts.OffloadMinSize, "offload-min-size", opts.OffloadMinSize, "min key size in bytes for offload candidates (0 to disable)")
+	fs.Int64Var(&opts.CandidateMinSize, "candidate-min-size", opts.CandidateMinSize, "min size in bytes for keys without TTL to be eviction candidates (0 to disable candidates)")
+	fs.Var(&opts.CandidatePolicies, "candidate-policy", "prefix rule pattern=action for eviction candidates, action one of delete, expire, evict or keep (repeatable)")
+	pluginPaths := fs.String("plugins", "", "comma-separated plugins adding report sections: Go plugins (.so) exporting Aggregators, or WebAssembly modules (.wasm) of the rdbviz ABI, see doc/USAGE.md")
+	classifyPath := fs.String("classify", "", "file of rules pattern group [owner] [label=value ...] assigning keys to logical groups (empty to disable)")
+	allowlistPath := fs.String("allowlist", "", "file of approved key patterns, one glob per line; report keys matching none (empty to disable)")
+	fs.Float64Var(&opts.ExpirySpike, "expiry-spike", opts.ExpirySpike, "flag minutes in which at least this fraction of all keys expire")
+	fs.Int64Var(&opts.DedupMinSize, "dedup-min-size", opts.DedupMinSize, "min string value size in bytes checked for duplicates (0 to disable)")
+	fs.StringVar(&opts.Compress, "compress", opts.Compress, "compress sampled string values with gzip or zstd and report ratios per prefix (empty to disable)")
+	fs.Float64Var(&opts.CompressSample, "compress-sample", opts.CompressSample, "fraction of string values compressed for -compress")
+	fs.Float64Var(&opts.EntropySample, "entropy-sample", opts.EntropySample, "fraction of string values whose entropy is measured per prefix (0 to disable)")
+	fs.Float64Var(&opts.JSONSample, "json-sample", opts.JSONSample, "fraction of string values checked for JSON and profiled by top-level field (0 to disable)")
+	fs.Float64Var(&opts.FormatSample, "format-sample", opts.FormatSample, "fraction of string values fingerprinted by serialization format (0 to disable)")
+	fs.Float64Var(&opts.CrossDBSample, "crossdb-sample", opts.CrossDBSample, "-per-db: fraction of key names tracked for duplicates across DBs (0 to disable), chosen by name hash")
+	fs.StringVar(&opts.Baseline, "baseline", opts.Baseline, "older dump of the same instance to rank prefixes by growth against (empty to disable)")
+	fs.StringVar(&opts.LiveAddr, "live-addr", opts.LiveAddr, "host:port of a live instance to check the dump against (empty to disable)")
+	fs.StringVar(&opts.LivePassword, "live-password", opts.LivePassword, "password for -live-addr")
+	fs.BoolVar(&opts.Drift, "drift", opts.Drift, "-live-addr: SCAN the instance and compare key counts per namespace")
+	fs.IntVar(&opts.MemoryCheck, "memory-check", opts.MemoryCheck, "-live-addr: run MEMORY USAGE on the top N bigkeys and compare with size and the memory model (0 to disable)")
+	fs.Float64Var(&opts.DriftThreshold, "drift-threshold", opts.DriftThreshold, "-live-addr: flag namespaces whose live key count differs from the dump's by more than this fraction")
+	fs.StringVar(&opts.MigrateTarget, "migrate-target", opts.MigrateTarget, "host:port to plan moving bigkeys to; writes -migrate-script (empty to disable)")
+	fs.StringVar(&opts.MigrateScript, "migrate-script", opts.MigrateScript, "-migrate-target: path of the generated redis-cli script")
+	fs.StringVar(&opts.MigrateKeys, "migrate-keys", opts.MigrateKeys, "-migrate-target: glob selecting the bigkeys to move")
+	fs.StringVar(&opts.MigrateMethod, "migrate-method", opts.MigrateMethod, "-migrate-target: migrate or dump-restore for keys moved whole")
+	fs.Int64Var(&opts.MigrateChunk, "migrate-chunk", opts.MigrateChunk, "-migrate-target: copy lists, hashes, sets and zsets with more elements in chunks of this many (0 to never chunk)")
+	fs.Float64Var(&opts.DedupSample, "dedup-sample", opts.DedupSample, "fraction of distinct values tracked for duplicate detection (0-1], chosen by value hash")
+	fs.Parse(args)
+	lf.setup()
+	if err := nf.setupAlerts(); err != nil {
+		fatal(2, "alert error", "err", err)
+	}
+	if err := gf.setup(); err != nil {
+		fatal(2, "grafana error", "err", err)
+	}
+	endProgress := setupProgress(*progressFormat, fs, lf, &opts)
+	opts.Logger = slog.Default()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *shardPaths != "" {
+		if *outPath == "" {
+			fmt.Println("usage: rdbviz-tool analyze -shards a.json,b.json,c.json -out report.json [-balance-tolerance 0.05]")
+			os.Exit(2)
+		}
+		start := time.Now()
+		rep, err := rdbviz.AnalyzeShards(ctx, strings.Split(*shardPaths, ","), opts)
+		if err != nil {
+			fatal(1, "load shards error", "err", err)
+		}
+		writeReport(rep, outputs(*outPath, "", "", "", "")...)
+		c := newCompletion(*shardPaths, opts, start, rep, nil)
+		c.Report, _ = filepath.Abs(*outPath)
+		cf.send(c)
+		gf.send(c)
+		nf.notify(nf.analyzeNotification(rep))
+		return
 	}
 
-	typeCount := map[string]int64{}
-	typeSize := map[string]int64{}
-	prefixes := map[string]prefixAgg{}
-	prefixesByType := map[string]map[string]prefixAgg{}
-	bigKeys := make(bigKeyHeap, 0, *topN)
-
-	ttlCounts := map[string]int64{
-		"no-expire": 0,
-		"expired":   0,
+	outs := outputs(*outPath, *htmlPath, *pageDir, *csvDir, *metricsPath)
+	var reportPath string
+	if len(outs) > 0 {
+		reportPath, _ = filepath.Abs(outs[0].dest)
 	}
-	for _, b := range ttlBuckets {
-		ttlCounts[b.Label] = 0
+	var pw *rdbviz.PublishWriter
+	if *publish != "" {
+		if !strings.HasPrefix(*publish, "s3://") && !strings.HasPrefix(*publish, "gs://") {
+			fatal(2, "-publish must be an s3:// or gs:// URL", "got", *publish)
+		}
+		w := publishWriter(*publish)
+		if *htmlPath != "" {
+			w.PageDir = *pageDir
+		}
+		pw = &w
+		outs = append(outs, output{*publish, w})
 	}
-
-	sizeCounts := map[string]int64{}
-	for _, b := range sizeBuckets {
-		sizeCounts[b.Label] = 0
+	if *statsdAddr != "" {
+		sw := rdbviz.StatsDWriter{Addr: *statsdAddr, Prefix: *statsdPrefix, DogStatsD: *dogstatsd}
+		if *statsdTags != "" {
+			sw.Tags = strings.Split(*statsdTags, ",")
+		}
+		outs = append(outs, output{"statsd://" + *statsdAddr, sw})
 	}
-
-	expireCount := int64(0)
-	noExpireCount := int64(0)
-	expiredCount := int64(0)
-
-	rdbFile, err := os.Open(rdbAbs)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "open rdb error: %v\n", err)
-		os.Exit(1)
+	if *datadog {
+		dw := rdbviz.DatadogWriter{APIKey: os.Getenv("DD_API_KEY"), Site: *datadogSite}
+		if dw.Site == "" {
+			dw.Site = os.Getenv("DD_SITE")
+		}
+		if *datadogKeyFile != "" {
+			key, err := os.ReadFile(*datadogKeyFile)
+			if err != nil {
+				fatal(2, "datadog error", "err", err)
+			}
+			dw.APIKey = strings.TrimSpace(string(key))
+		}
+		if dw.APIKey == "" {
+			fatal(2, "-datadog needs $DD_API_KEY or -datadog-api-key-file")
+		}
+		if *datadogTags != "" {
+			dw.Tags = strings.Split(*datadogTags, ",")
+		}
+		outs = append(outs, output{"datadog", dw})
 	}
-	defer rdbFile.Close()
-	stat, err := rdbFile.Stat()
+	otlp, err := of.writer()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "stat rdb error: %v\n", err)
-		os.Exit(1)
+		fatal(2, "otlp error", "err", err)
 	}
-	fileSize := stat.Size()
-
-	dec := parser.NewDecoder(rdbFile).WithSpecialOpCode()
-	lastPrint := time.Now()
-	err = dec.Parse(func(o parser.RedisObject) bool {
-		switch obj := o.(type) {
-		case *parser.AuxObject:
-			key := strings.TrimSpace(obj.Key)
-			val := strings.TrimSpace(obj.Value)
-			meta.Aux[key] = val
-			switch key {
-			case "redis-ver":
-				meta.RedisVersion = val
-			case "redis-bits":
-				meta.RedisBits = val
-			case "ctime":
-				meta.CTime = val
-			case "used-mem":
-				meta.UsedMem = val
-			case "aof-base":
-				meta.AOFBase = val
+	if otlp != nil {
+		opts.OnStage = otlp.RecordStage
+		outs = append(outs, output{"otlp " + of.endpoint, otlp})
+	}
+	if *rdbPath == "" || (len(outs) == 0 && kf.brokers == "") {
+		fmt.Println("usage: rdbviz-tool analyze -rdb dump.rdb -out report.json [-html report.html] [-csv-dir dir] [-metrics rdb.prom] [-statsd host:8125] [-prefix-sep :] [-prefix-depth 3] [-topn 50]")
+		os.Exit(2)
+	}
+	if *pluginPaths != "" {
+		for _, p := range strings.Split(*pluginPaths, ",") {
+			if err := rdbviz.LoadPlugin(p); err != nil {
+				fatal(1, "plugin error", "err", err)
 			}
-			return true
-		case *parser.DBSizeObject:
-			return true
 		}
-
-		key := o.GetKey()
-		db := o.GetDBIndex()
-		objType := o.GetType()
-		encoding := o.GetEncoding()
-		expiration := o.GetExpiration()
-		if key == "" {
-			return true
+	}
+	if *classifyPath != "" {
+		rules, err := rdbviz.LoadClassRules(*classifyPath)
+		if err != nil {
+			fatal(1, "classify error", "err", err)
 		}
-
-		size := getSize(o)
-		summary.TotalKeys++
-		summary.TotalSize += size
-		summary.DBKeys[db]++
-		sizeCounts[getSizeBucket(size)]++
-
-		typeCount[objType]++
-		typeSize[objType] += size
-		summary.TypeCounts[objType]++
-
-		if expiration == nil {
-			noExpireCount++
-			ttlCounts["no-expire"]++
-		} else {
-			expireCount++
-			if expiration.Before(now) {
-				expiredCount++
-				ttlCounts["expired"]++
-			} else {
-				ttl := expiration.Sub(now)
-				placed := false
-				for _, b := range ttlBuckets {
-					if ttl <= b.Max {
-						ttlCounts[b.Label]++
-						placed = true
-						break
-					}
-				}
-				if !placed {
-					ttlCounts[">90d"]++
-				}
-			}
+		opts.Classifier = rules
+	}
+	if *allowlistPath != "" {
+		patterns, err := rdbviz.LoadAllowlist(*allowlistPath)
+		if err != nil {
+			fatal(1, "allowlist error", "err", err)
 		}
-
-		applyPrefixes(prefixes, key, size, *sep, *maxDepth)
-		applyPrefixesByType(prefixesByType, objType, key, size, *sep, *maxDepth)
-
-		bk := BigKey{
-			DB:          db,
-			Key:         key,
-			Type:        objType,
-			Size:        size,
-			Encoding:    encoding,
-			Elements:    getElementCount(o),
-			Expiration: expiration,
+		opts.Allowlist = patterns
+	}
+	analyzer, err := rdbviz.New(opts)
+	if err != nil {
+		fatal(2, "invalid options", "err", err)
+	}
+	sink, err := kf.sink(opts)
+	if err != nil {
+		fatal(2, "kafka error", "err", err)
+	}
+	source, _ := filepath.Abs(*rdbPath)
+	start := time.Now()
+	// failed posts the -notify-url event and the annotation of a failed
+	// analysis and exits
+	failed := func(msg string, rep *rdbviz.Report, err error) {
+		c := newCompletion(source, opts, start, rep, err)
+		if perr := cf.post(c); perr != nil {
+			slog.Warn("notify-url error", "err", perr)
 		}
-		pushBigKey(&bigKeys, bk, *topN)
-
-		if *progressEvery > 0 && time.Since(lastPrint) >= *progressEvery {
-			read := int64(dec.GetReadCount())
-			percent := float64(0)
-			if fileSize > 0 {
-				percent = float64(read) / float64(fileSize) * 100
-			}
-			fmt.Fprintf(os.Stderr, "[progress] keys=%d read=%s/%s (%.1f%%)\n",
-				summary.TotalKeys, formatBytes(read), formatBytes(fileSize), percent)
-			lastPrint = time.Now()
+		if perr := gf.annotate(c); perr != nil {
+			slog.Warn("grafana error", "err", perr)
 		}
-		return true
-	})
+		fatal(1, msg, "err", err)
+	}
+	stopProfile := pf.start()
+	rep, err := analyzer.AnalyzeFileFunc(ctx, *rdbPath, sink.onKey())
+	endProgress()
+	stopProfile()
+	if sink != nil && err != nil {
+		// no end record: the snapshot is incomplete
+		sink.close()
+	}
+	if err != nil && rep == nil {
+		failed("analyze error", nil, err)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "parse error: %v\n", err)
-		os.Exit(1)
+		slog.Warn("interrupted, writing a partial report", "keys", rep.Meta.Sampling.SampledKeys)
 	}
-
-	summary.WithTTL = expireCount
-	summary.NoTTL = noExpireCount
-	summary.Expired = expiredCount
-	summary.DBCount = len(summary.DBKeys)
-
-	types := make([]TypeStat, 0, len(typeCount))
-	for t, c := range typeCount {
-		types = append(types, TypeStat{Type: t, Count: c, Size: typeSize[t]})
+	if err := writeOutputs(rep, outs...); err != nil {
+		failed("write error", rep, err)
 	}
-	sort.Slice(types, func(i, j int) bool { return types[i].Size > types[j].Size })
-
-	ttlList := make([]Bucket, 0, len(ttlCounts))
-	order := []string{"no-expire", "expired"}
-	for _, b := range ttlBuckets {
-		order = append(order, b.Label)
-	}
-	for _, label := range order {
-		if v, ok := ttlCounts[label]; ok {
-			ttlList = append(ttlList, Bucket{Label: label, Count: v})
+	if pw != nil {
+		slog.Info("report published", "objects", pw.Objects(rep))
+	}
+	if sink != nil && err == nil {
+		if err := sink.finish(rep); err != nil {
+			failed("kafka error", rep, err)
 		}
+		slog.Info("snapshot published", "topic", kf.topic, "records", kf.records)
 	}
-
-	prefixList := make([]PrefixStat, 0, len(prefixes))
-	for p, a := range prefixes {
-		prefixList = append(prefixList, PrefixStat{Prefix: p, Count: a.Count, Size: a.Size})
+	c := newCompletion(source, opts, start, rep, nil)
+	if err != nil {
+		c.Status, c.Error = completionPartial, err.Error()
+	}
+	c.Report = reportPath
+	if pw != nil {
+		c.Report = pw.Objects(rep)[0]
 	}
-	sort.Slice(prefixList, func(i, j int) bool { return prefixList[i].Size > prefixList[j].Size })
-	if *topN > 0 && len(prefixList) > *topN {
-		prefixList = prefixList[:*topN]
+	for _, o := range outs {
+		c.Outputs = append(c.Outputs, o.dest)
 	}
+	cf.send(c)
+	gf.send(c)
+	nf.notify(nf.analyzeNotification(rep))
+	if err != nil {
+		os.Exit(1)
+	}
+}
 
-	byType := make([]PrefixTypeGroup, 0, len(prefixesByType))
-	for t, pm := range prefixesByType {
-		items := make([]PrefixStat, 0, len(pm))
-		for p, a := range pm {
-			items = append(items, PrefixStat{Prefix: p, Count: a.Count, Size: a.Size})
-		}
-		sort.Slice(items, func(i, j int) bool { return items[i].Size > items[j].Size })
-		if *topN > 0 && len(items) > *topN {
-			items = items[:*topN]
+// logProgress logs the progress of an analysis.
+func logProgress(p rdbviz.Progress) {
+	args := []any{"stage", p.Stage, "db", p.DB, "keys", p.Keys}
+	if p.Stage != rdbviz.StageScan {
+		args = append(args, "read", rdbviz.FormatBytes(p.BytesRead))
+	}
+	if p.TotalBytes > 0 {
+		args = append(args, "total", rdbviz.FormatBytes(p.TotalBytes), "percent", math.Round(p.Percent()*10)/10)
+		if d := p.ETA.Round(time.Second); d > 0 {
+			args = append(args, "eta", d)
 		}
-		byType = append(byType, PrefixTypeGroup{Type: t, Prefixes: items})
 	}
-	sort.Slice(byType, func(i, j int) bool { return byType[i].Type < byType[j].Type })
+	slog.Info("progress", args...)
+}
 
-	sort.Slice(bigKeys, func(i, j int) bool { return bigKeys[i].Size > bigKeys[j].Size })
+// prefixDepth is the -prefix-depth flag value: a fixed depth or "auto".
+type prefixDepth struct {
+	depth *int
+	auto  *bool
+}
 
-	sizeList := make([]Bucket, 0, len(sizeBuckets))
-	for _, b := range sizeBuckets {
-		sizeList = append(sizeList, Bucket{Label: b.Label, Count: sizeCounts[b.Label]})
+func (d prefixDepth) String() string {
+	if d.auto == nil {
+		return ""
 	}
-
-	report := Report{
-		Meta:        meta,
-		Summary:     summary,
-		Types:       types,
-		TTLBuckets:  ttlList,
-		SizeBuckets: sizeList,
-		Prefixes:    prefixList,
-		PrefixesByType: byType,
-		BigKeys:     bigKeys,
+	if *d.auto {
+		return "auto"
 	}
+	return strconv.Itoa(*d.depth)
+}
 
-	if err := os.MkdirAll(filepath.Dir(*outPath), 0o755); err != nil {
-		fmt.Fprintf(os.Stderr, "mkdir error: %v\n", err)
-		os.Exit(1)
+func (d prefixDepth) Set(s string) error {
+	if s == "auto" {
+		*d.auto = true
+		return nil
 	}
-
-	f, err := os.Create(*outPath)
+	n, err := strconv.Atoi(s)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "create error: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("expected a number or \"auto\", got %q", s)
 	}
-	defer f.Close()
+	*d.auto = false
+	*d.depth = n
+	return nil
+}
 
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(report); err != nil {
-		fmt.Fprintf(os.Stderr, "write error: %v\n", err)
-		os.Exit(1)
+// byteSize is a flag value of bytes with an optional unit, e.g. "2GB".
+type byteSize struct{ n *int64 }
+
+func (b byteSize) String() string {
+	if b.n == nil || *b.n == 0 {
+		return "0"
 	}
+	return strconv.FormatInt(*b.n, 10)
+}
 
-	fmt.Printf("report written: %s\n", *outPath)
+func (b byteSize) Set(s string) error {
+	n, err := rdbviz.ParseBytes(s)
+	if err != nil {
+		return err
+	}
+	*b.n = n
+	return nil
 }
 
-func getSize(o parser.RedisObject) int64 {
-	return int64(o.GetSize())
+// byteRate is a byteSize per second, e.g. "100MB/s".
+type byteRate struct{ n *int64 }
+
+func (b byteRate) String() string { return byteSize(b).String() }
+
+func (b byteRate) Set(s string) error {
+	return byteSize(b).Set(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
 }
 
-func getSizeBucket(size int64) string {
-	for _, b := range sizeBuckets {
-		if size <= b.Max {
-			return b.Label
-		}
+// byteSizeInt is byteSize for an int option.
+type byteSizeInt struct{ n *int }
+
+func (b byteSizeInt) String() string {
+	if b.n == nil {
+		return "0"
 	}
-	return ">100MB"
+	return strconv.Itoa(*b.n)
 }
 
-func formatBytes(bytes int64) string {
-	if bytes < 0 {
-		return "0 B"
-	}
-	units := []string{"B", "KB", "MB", "GB", "TB"}
-	v := float64(bytes)
-	i := 0
-	for v >= 1024 && i < len(units)-1 {
-		v /= 1024
-		i++
-	}
-	if v < 10 && i > 0 {
-		return fmt.Sprintf("%.2f %s", v, units[i])
+func (b byteSizeInt) Set(s string) error {
+	n, err := rdbviz.ParseBytes(s)
+	if err != nil {
+		return err
 	}
-	return fmt.Sprintf("%.1f %s", v, units[i])
+	*b.n = int(n)
+	return nil
 }
 
-func getElementCount(o parser.RedisObject) int64 {
-	return int64(o.GetElemCount())
+// output is one destination of a report, named for the message printed
+// once it is written.
+type output struct {
+	dest string
+	w    rdbviz.ReportWriter
 }
 
-func applyPrefixes(agg map[string]prefixAgg, key string, size int64, sep string, maxDepth int) {
-	if sep == "" || maxDepth <= 0 {
-		return
+// outputs collects the analyze destinations set on the command line.
+func outputs(jsonPath, htmlPath, pageDir, csvDir, metricsPath string) []output {
+	var outs []output
+	if jsonPath != "" {
+		outs = append(outs, output{jsonPath, rdbviz.JSONWriter{Path: jsonPath}})
 	}
-	parts := strings.Split(key, sep)
-	if len(parts) == 0 {
-		return
+	if htmlPath != "" {
+		outs = append(outs, output{htmlPath, rdbviz.HTMLWriter{Path: htmlPath, PageDir: pageDir}})
 	}
-	if len(parts) < maxDepth {
-		maxDepth = len(parts)
+	if csvDir != "" {
+		outs = append(outs, output{csvDir, rdbviz.CSVWriter{Dir: csvDir}})
 	}
-	for i := 1; i <= maxDepth; i++ {
-		p := strings.Join(parts[:i], sep)
-		if i < len(parts) {
-			p = p + sep
-		}
-		a := agg[p]
-		a.Count++
-		a.Size += size
-		agg[p] = a
+	if metricsPath != "" {
+		outs = append(outs, output{metricsPath, rdbviz.MetricsWriter{Path: metricsPath}})
 	}
+	return outs
 }
 
-func applyPrefixesByType(agg map[string]map[string]prefixAgg, objType, key string, size int64, sep string, maxDepth int) {
-	if sep == "" || maxDepth <= 0 {
-		return
-	}
-	m, ok := agg[objType]
-	if !ok {
-		m = map[string]prefixAgg{}
-		agg[objType] = m
+func writeReport(rep *rdbviz.Report, outs ...output) {
+	if err := writeOutputs(rep, outs...); err != nil {
+		fatal(1, "write error", "err", err)
 	}
-	applyPrefixes(m, key, size, sep, maxDepth)
 }
-func pushBigKey(h *bigKeyHeap, bk BigKey, topN int) {
-	if topN <= 0 {
-		return
-	}
-	if len(*h) < topN {
-		*h = append(*h, bk)
-		return
+
+func writeOutputs(rep *rdbviz.Report, outs ...output) error {
+	ws := make([]rdbviz.ReportWriter, len(outs))
+	for i, o := range outs {
+		ws[i] = o.w
 	}
-	minIdx := 0
-	for i := 1; i < len(*h); i++ {
-		if (*h)[i].Size < (*h)[minIdx].Size {
-			minIdx = i
-		}
+	if err := rdbviz.MultiWriter(ws...).WriteReport(rep); err != nil {
+		return err
 	}
-	if bk.Size > (*h)[minIdx].Size {
-		(*h)[minIdx] = bk
+	for _, o := range outs {
+		slog.Info("report written", "path", o.dest)
 	}
+	return nil
 }
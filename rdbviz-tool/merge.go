@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// runMerge is the merge subcommand: it combines per-shard reports into one
+// cluster report without parsing the dumps again.
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	lf := addLogFlags(fs)
+	outPath := fs.String("out", "", "output report.json")
+	topN := fs.Int("topn", 50, "TopN prefixes and bigkeys kept in the merged report")
+	fs.Parse(args)
+	lf.setup()
+
+	if *outPath == "" || fs.NArg() < 2 {
+		fmt.Println("usage: rdbviz-tool merge -out cluster.json shard-a.json shard-b.json [...]")
+		os.Exit(2)
+	}
+	rep, err := rdbviz.Merge(context.Background(), fs.Args(), *topN)
+	if err != nil {
+		fatal(1, "merge error", "err", err)
+	}
+	writeReport(rep, outputs(*outPath, "", "", "", "")...)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"rdbviz-tool/pkg/rdbviz"
+	"rdbviz-tool/pkg/report"
+)
+
+// notifyGrowthRows is how many growing prefixes a notification lists.
+const notifyGrowthRows = 5
+
+// notifyFlags post a summary of an analysis or a diff to a Slack incoming
+// webhook or any HTTP endpoint taking JSON, and fire alerts on its
+// violations to Alertmanager or PagerDuty.
+type notifyFlags struct {
+	slack     string
+	webhook   string
+	maxMem    int64
+	maxGrowth float64
+
+	alertmanager     string
+	pagerDuty        bool
+	pagerDutyKeyFile string
+	pagerDutyKey     string
+	pagerDutyURL     string
+	severity         string
+}
+
+func addNotifyFlags(fs *flag.FlagSet) *notifyFlags {
+	nf := &notifyFlags{}
+	fs.StringVar(&nf.slack, "slack-webhook", "", "Slack incoming webhook URL to post a summary to")
+	fs.StringVar(&nf.webhook, "webhook", "", "URL to POST the summary to as JSON")
+	fs.Var(byteSize{&nf.maxMem}, "alert-mem", "-slack-webhook, -webhook: flag estimated memory above this, e.g. 8GB (0 for no limit)")
+	fs.Float64Var(&nf.maxGrowth, "alert-growth", 0, "-slack-webhook, -webhook: flag estimated memory growing by more than this fraction over the baseline or old report, e.g. 0.2 (0 for no limit)")
+	fs.StringVar(&nf.alertmanager, "alertmanager", "", "Alertmanager URL to fire an alert to for each violation, e.g. http://alertmanager:9093")
+	fs.BoolVar(&nf.pagerDuty, "pagerduty", false, "trigger a PagerDuty incident for each violation, with the routing key of $PAGERDUTY_ROUTING_KEY or -pagerduty-key-file")
+	fs.StringVar(&nf.pagerDutyKeyFile, "pagerduty-key-file", "", "-pagerduty: file holding the routing key of the service")
+	fs.StringVar(&nf.pagerDutyURL, "pagerduty-url", "https://events.pagerduty.com/v2/enqueue", "-pagerduty: Events API v2 endpoint, e.g. https://events.eu.pagerduty.com/v2/enqueue")
+	fs.StringVar(&nf.severity, "alert-severity", "warning", "-alertmanager, -pagerduty: severity of the alerts: critical, error, warning or info")
+	return nf
+}
+
+func (nf *notifyFlags) enabled() bool {
+	return nf.slack != "" || nf.webhook != "" || nf.alertmanager != "" || nf.pagerDuty
+}
+
+// notification is the summary posted, as the -webhook JSON body.
+type notification struct {
+	Kind         string         `json:"kind"` // analyze or diff
+	Title        string         `json:"title"`
+	Source       string         `json:"source"`
+	Instance     string         `json:"instance,omitempty"`
+	Shard        string         `json:"shard,omitempty"`
+	Keys         int64          `json:"keys"`
+	EstimatedMem int64          `json:"estimated_mem"`
+	BaseMem      int64          `json:"base_estimated_mem,omitempty"`
+	MemDelta     int64          `json:"mem_delta,omitempty"`
+	Growth       []notifyGrowth `json:"growth"`
+	Violations   []violation    `json:"violations"`
+}
+
+// violation is a threshold a report breaks: the metric, what happened and
+// the largest contributors, e.g. prefixes or shards.
+type violation struct {
+	Metric    string   `json:"metric"`
+	Summary   string   `json:"summary"`
+	Offenders []string `json:"offenders,omitempty"`
+}
+
+type notifyGrowth struct {
+	Prefix   string `json:"prefix"`
+	OldMem   int64  `json:"old_estimated_mem"`
+	NewMem   int64  `json:"new_estimated_mem"`
+	MemDelta int64  `json:"mem_delta"`
+}
+
+// analyzeNotification summarizes rep; the growth is over -baseline, if
+// given.
+func (nf *notifyFlags) analyzeNotification(rep *rdbviz.Report) notification {
+	n := notification{
+		Kind:         "analyze",
+		Source:       rep.Meta.Source,
+		Instance:     rep.Meta.Instance,
+		Shard:        rep.Meta.Shard,
+		Keys:         rep.Summary.TotalKeys,
+		EstimatedMem: rep.Summary.TotalMem,
+		Growth:       []notifyGrowth{},
+	}
+	n.Title = "rdbviz analysis of " + n.name()
+	if g := rep.Growth; g != nil {
+		n.BaseMem, n.MemDelta = g.BaseMem, g.MemDelta
+		for _, p := range g.ByAbsolute {
+			if len(n.Growth) == notifyGrowthRows {
+				break
+			}
+			if p.MemDelta > 0 {
+				n.Growth = append(n.Growth, notifyGrowth{Prefix: p.Prefix, OldMem: p.BaseMem, NewMem: p.EstimatedMem, MemDelta: p.MemDelta})
+			}
+		}
+	}
+	n.Violations = append(nf.violations(n, rep.Growth != nil, topPrefixes(rep)), reportViolations(rep)...)
+	return n
+}
+
+// diffNotification summarizes the change from before to after.
+func (nf *notifyFlags) diffNotification(before, after *rdbviz.Report) notification {
+	n := notification{
+		Kind:         "diff",
+		Source:       after.Meta.Source,
+		Instance:     after.Meta.Instance,
+		Shard:        after.Meta.Shard,
+		Keys:         after.Summary.TotalKeys,
+		EstimatedMem: after.Summary.TotalMem,
+		BaseMem:      before.Summary.TotalMem,
+		MemDelta:     after.Summary.TotalMem - before.Summary.TotalMem,
+		Growth:       []notifyGrowth{},
+	}
+	n.Title = "rdbviz diff of " + n.name()
+	for _, r := range prefixDiff(before, after, 0) {
+		if len(n.Growth) == notifyGrowthRows {
+			break
+		}
+		if r.newMem > r.oldMem {
+			n.Growth = append(n.Growth, notifyGrowth{Prefix: r.name, OldMem: r.oldMem, NewMem: r.newMem, MemDelta: r.newMem - r.oldMem})
+		}
+	}
+	n.Violations = nf.violations(n, true, topPrefixes(after))
+	return n
+}
+
+func (n notification) name() string {
+	name := n.Instance
+	if name == "" {
+		name = n.Source
+	}
+	if n.Shard != "" {
+		name += "/" + n.Shard
+	}
+	return name
+}
+
+// violations checks n against -alert-mem, with the largest prefixes as
+// offenders, and, when it has a base to grow from, -alert-growth, with the
+// prefixes that grew most.
+func (nf *notifyFlags) violations(n notification, hasBase bool, largest []string) []violation {
+	out := []violation{}
+	if nf.maxMem > 0 && n.EstimatedMem > nf.maxMem {
+		out = append(out, violation{
+			Metric:    "estimated_memory",
+			Summary:   fmt.Sprintf("estimated memory %s is above %s", rdbviz.FormatBytes(n.EstimatedMem), rdbviz.FormatBytes(nf.maxMem)),
+			Offenders: largest,
+		})
+	}
+	if nf.maxGrowth > 0 && hasBase && n.BaseMem > 0 {
+		if growth := float64(n.MemDelta) / float64(n.BaseMem); growth > nf.maxGrowth {
+			v := violation{Metric: "memory_growth", Summary: fmt.Sprintf("estimated memory grew %.1f%%, more than %.1f%%", growth*100, nf.maxGrowth*100)}
+			for _, g := range n.Growth {
+				v.Offenders = append(v.Offenders, fmt.Sprintf("%s %s", g.Prefix, bytesDelta(g.OldMem, g.NewMem)))
+			}
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// topPrefixes lists the largest prefixes of rep by estimated memory.
+func topPrefixes(rep *rdbviz.Report) []string {
+	prefixes := append([]report.PrefixStat(nil), rep.Prefixes...)
+	sort.SliceStable(prefixes, func(i, j int) bool { return prefixes[i].EstimatedMem > prefixes[j].EstimatedMem })
+	var out []string
+	for i, p := range prefixes {
+		if i == notifyGrowthRows {
+			break
+		}
+		out = append(out, fmt.Sprintf("%s %s", p.Prefix, rdbviz.FormatBytes(p.EstimatedMem)))
+	}
+	return out
+}
+
+// reportViolations collects what the sections of rep already flag against
+// their own thresholds.
+func reportViolations(rep *rdbviz.Report) []violation {
+	var out []violation
+	if d := rep.Drift; d != nil && d.Drifted > 0 {
+		v := violation{Metric: "drift", Summary: fmt.Sprintf("%d namespaces drifted more than %.0f%% from the live instance", d.Drifted, d.Threshold*100)}
+		for _, p := range d.Namespaces {
+			if p.Drifted && len(v.Offenders) < notifyGrowthRows {
+				v.Offenders = append(v.Offenders, fmt.Sprintf("%s %+.1f%%", p.Prefix, p.Change*100))
+			}
+		}
+		out = append(out, v)
+	}
+	if b := rep.ShardBalance; b != nil {
+		v := violation{Metric: "shard_balance"}
+		for _, s := range b.Shards {
+			if math.Abs(s.Deviation) > b.Tolerance {
+				v.Offenders = append(v.Offenders, fmt.Sprintf("%s %+.1f%%", s.Name, s.Deviation*100))
+			}
+		}
+		if len(v.Offenders) > 0 {
+			v.Summary = fmt.Sprintf("%d shards are more than %.0f%% off the mean estimated memory", len(v.Offenders), b.Tolerance*100)
+			out = append(out, v)
+		}
+	}
+	if e := rep.ExpiryTimeline; e != nil && len(e.Spikes) > 0 {
+		v := violation{Metric: "expiry_spikes", Summary: fmt.Sprintf("%d minutes each expire more than %.1f%% of the keys", len(e.Spikes), e.SpikeShare*100)}
+		for i, s := range e.Spikes {
+			if i == notifyGrowthRows {
+				break
+			}
+			v.Offenders = append(v.Offenders, fmt.Sprintf("%s %d keys", s.Minute, s.Count))
+		}
+		out = append(out, v)
+	}
+	if h := rep.HashTags; h != nil && len(h.Hot) > 0 {
+		v := violation{Metric: "hot_hash_tags", Summary: fmt.Sprintf("%d hash tags each hold more than %.1f%% of the data", len(h.Hot), h.HotShare*100)}
+		for i, t := range h.Hot {
+			if i == notifyGrowthRows {
+				break
+			}
+			v.Offenders = append(v.Offenders, fmt.Sprintf("{%s} %s", t.Tag, rdbviz.FormatBytes(t.EstimatedMem)))
+		}
+		out = append(out, v)
+	}
+	if gv := rep.Governance; gv != nil && gv.UnregisteredKeys > 0 {
+		v := violation{Metric: "unregistered_keys", Summary: fmt.Sprintf("%d keys (%s) in unregistered namespaces", gv.UnregisteredKeys, rdbviz.FormatBytes(gv.UnregisteredMem))}
+		for i, u := range gv.Unregistered {
+			if i == notifyGrowthRows {
+				break
+			}
+			v.Offenders = append(v.Offenders, fmt.Sprintf("%s %d keys", u.Prefix, u.Keys))
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// slackText formats n in Slack's mrkdwn.
+func (n notification) slackText() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s*\n%d keys, %s estimated memory", n.Title, n.Keys, rdbviz.FormatBytes(n.EstimatedMem))
+	if n.BaseMem > 0 {
+		fmt.Fprintf(&b, ", %s", bytesDelta(n.BaseMem, n.EstimatedMem))
+	}
+	b.WriteString("\n")
+	if len(n.Growth) > 0 {
+		b.WriteString("\n*Top growth*\n")
+		for _, g := range n.Growth {
+			fmt.Fprintf(&b, "• `%s` %s → %s, %s\n", g.Prefix, rdbviz.FormatBytes(g.OldMem), rdbviz.FormatBytes(g.NewMem), bytesDelta(g.OldMem, g.NewMem))
+		}
+	}
+	if len(n.Violations) > 0 {
+		b.WriteString("\n*Violations*\n")
+		for _, v := range n.Violations {
+			fmt.Fprintf(&b, ":warning: %s", v.Summary)
+			if len(v.Offenders) > 0 {
+				fmt.Fprintf(&b, ": %s", strings.Join(v.Offenders, ", "))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// send posts n to the configured webhooks.
+func (nf *notifyFlags) send(n notification) error {
+	if nf.slack != "" {
+		if err := postJSON(nf.slack, map[string]string{"text": n.slackText()}); err != nil {
+			return fmt.Errorf("slack: %w", err)
+		}
+	}
+	if nf.webhook != "" {
+		if err := postJSON(nf.webhook, n); err != nil {
+			return fmt.Errorf("webhook: %w", err)
+		}
+	}
+	return nil
+}
+
+func postJSON(url string, body any) error {
+	return postJSONAuth(url, "", body)
+}
+
+// postJSONAuth posts body with authorization as the Authorization header,
+// if set.
+func postJSONAuth(url, authorization string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// notify sends n to the webhooks set and its violations to the alert
+// receivers set, failing the command if it cannot.
+func (nf *notifyFlags) notify(n notification) {
+	if !nf.enabled() {
+		return
+	}
+	if err := nf.send(n); err != nil {
+		fatal(1, "notification error", "err", err)
+	}
+	if nf.slack != "" || nf.webhook != "" {
+		slog.Info("notification sent", "violations", len(n.Violations))
+	}
+	if len(n.Violations) == 0 || (nf.alertmanager == "" && !nf.pagerDuty) {
+		return
+	}
+	if err := nf.alert(n); err != nil {
+		fatal(1, "alert error", "err", err)
+	}
+	slog.Warn("alerts fired", "violations", len(n.Violations))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// otlpFlags export analyses to an OpenTelemetry collector. The service name
+// and resource attributes come from the standard OTEL_SERVICE_NAME and
+// OTEL_RESOURCE_ATTRIBUTES variables.
+type otlpFlags struct {
+	endpoint string
+	headers  string
+}
+
+func addOTLPFlags(fs *flag.FlagSet) *otlpFlags {
+	of := &otlpFlags{}
+	fs.StringVar(&of.endpoint, "otlp", "", "base URL of an OpenTelemetry collector to export a trace and metrics of each analysis to over OTLP/HTTP, e.g. http://localhost:4318")
+	fs.StringVar(&of.headers, "otlp-headers", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), "-otlp: comma-separated key=value headers sent to the collector")
+	return of
+}
+
+// writer returns the writer configured by the flags, nil without -otlp.
+// Each analysis needs its own copy.
+func (of *otlpFlags) writer() (*rdbviz.OTLPWriter, error) {
+	if of.endpoint == "" {
+		return nil, nil
+	}
+	headers, err := parseKeyValues(of.headers, "-otlp-headers")
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := parseKeyValues(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"), "OTEL_RESOURCE_ATTRIBUTES")
+	if err != nil {
+		return nil, err
+	}
+	return &rdbviz.OTLPWriter{
+		Endpoint:    of.endpoint,
+		Headers:     headers,
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		Attributes:  attrs,
+	}, nil
+}
+
+// parseKeyValues parses "k1=v1,k2=v2" as the OTEL_* variables write it.
+func parseKeyValues(s, name string) (map[string]string, error) {
+	kv := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("%s: %q is not key=value", name, pair)
+		}
+		kv[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return kv, nil
+}
@@ -0,0 +1,423 @@
+// Package memmodel estimates how much RAM Redis 7 needs to hold a key,
+// following the in-memory encoding of each type: robj and dict entry
+// overheads, sds headers, listpack/ziplist/intset blobs and
+// hashtable/skiplist structures, with every allocation rounded the way the
+// allocator rounds it. It is the cost model behind rdbviz reports, usable on
+// its own by tools that see keys some other way, e.g. a live SCAN.
+//
+// Estimate is the entry point for a parsed object: it returns the memory of
+// the key, its dict entries and its value. The per-type EstimateString,
+// EstimateList, EstimateHash, EstimateSet, EstimateZSet and EstimateStream
+// return the memory of a value including its robj but not its key; Key adds
+// the key and its dict entries. The package functions use the jemalloc
+// model; a Model selects the allocator.
+package memmodel
+
+import (
+	"math/bits"
+	"strconv"
+
+	"github.com/hdt3213/rdb/model"
+	"github.com/hdt3213/rdb/parser"
+)
+
+// Sizes of Redis 7 internal structures on a 64-bit build.
+const (
+	robjSize          = 16
+	dictEntrySize     = 24
+	dictSize          = 56
+	pointerSize       = 8
+	quicklistSize     = 40
+	quicklistNodeSize = 32
+	zsetSize          = 16
+	zskiplistSize     = 32
+	zskiplistMaxLevel = 32
+	zslNodeBaseSize   = 24 // ele, score, backward
+	zslLevelSize      = 16 // forward, span
+	streamSize        = 48
+	raxNodeSize       = 64
+	streamGroupSize   = 64
+	streamNackSize    = 48
+	embstrMaxLen      = 44
+	listpackHeader    = 6 + 1 // total bytes + num elements, end byte
+	ziplistHeader     = 10 + 1
+	intsetHeader      = 8
+	quicklistFill     = 8 * 1024 // list-max-listpack-size -2
+)
+
+// zslAvgLevelBytes is the expected size of a skiplist node's level array: with
+// ZSKIPLIST_P = 0.25 a node has 4/3 levels on average.
+const zslAvgLevelBytes = zslLevelSize * 4 / 3
+
+// Allocators a Model can round allocations for.
+const (
+	Jemalloc = "jemalloc"
+	Libc     = "libc"
+)
+
+// Model is the memory model for one allocator. An unknown Allocator counts
+// allocations at their requested size.
+type Model struct {
+	Allocator string
+}
+
+// Default is the model of a stock Redis build, which uses jemalloc.
+var Default = Model{Allocator: Jemalloc}
+
+// Alloc is the size the allocator hands out for a request of n bytes.
+func (m Model) Alloc(n int) int64 {
+	switch m.Allocator {
+	case Jemalloc:
+		return int64(jemallocSize(n))
+	case Libc:
+		return int64(libcSize(n))
+	}
+	return int64(n)
+}
+
+// jemallocSize rounds n up to a jemalloc size class: 8, then multiples of 16
+// up to 128, then four classes per power of two (160, 192, 224, 256, 320...).
+func jemallocSize(n int) int {
+	switch {
+	case n <= 0:
+		return 0
+	case n <= 8:
+		return 8
+	case n <= 128:
+		return (n + 15) &^ 15
+	}
+	step := 1 << (bits.Len(uint(n-1)) - 3)
+	return (n + step - 1) &^ (step - 1)
+}
+
+// libcSize is the glibc malloc chunk size for a request of n bytes: an 8 byte
+// header, 16 byte alignment and a 32 byte minimum chunk.
+func libcSize(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	c := (n + 8 + 15) &^ 15
+	if c < 32 {
+		c = 32
+	}
+	return c
+}
+
+// Estimate returns the estimated RAM of o including its key and the
+// top-level dict entry (and the expires entry when it has a TTL).
+func (m Model) Estimate(o parser.RedisObject) int64 {
+	mem := m.Key(len(o.GetKey()), o.GetExpiration() != nil)
+	switch obj := o.(type) {
+	case *parser.StringObject:
+		mem += m.EstimateString(obj.Value)
+	case *parser.ListObject:
+		mem += m.EstimateList(obj.Encoding, obj.Values)
+	case *parser.HashObject:
+		mem += m.EstimateHash(obj.Encoding, obj.Hash)
+	case *parser.SetObject:
+		mem += m.EstimateSet(obj.Encoding, obj.Members)
+	case *parser.ZSetObject:
+		mem += m.EstimateZSet(obj.Encoding, obj.Entries)
+	case *parser.StreamObject:
+		mem += m.EstimateStream(obj)
+	default:
+		mem += m.Alloc(robjSize) + int64(o.GetSize())
+	}
+	return mem
+}
+
+// Key is the memory of a key name of keyLen bytes and its entry in the
+// keyspace dict, plus its entry in the expires dict when it has a TTL.
+func (m Model) Key(keyLen int, ttl bool) int64 {
+	mem := m.Alloc(dictEntrySize) + pointerSize + m.SDS(keyLen)
+	if ttl {
+		mem += m.Alloc(dictEntrySize) + pointerSize
+	}
+	return mem
+}
+
+func sdsHeader(n int) int {
+	switch {
+	case n < 1<<5:
+		return 1
+	case n < 1<<8:
+		return 3
+	case n < 1<<16:
+		return 5
+	case n < 1<<32:
+		return 9
+	}
+	return 17
+}
+
+// SDS is the memory of an sds string of n bytes.
+func (m Model) SDS(n int) int64 {
+	return m.Alloc(sdsHeader(n) + n + 1)
+}
+
+// IsSharedInt reports whether v is stored as an integer rather than a
+// string.
+func IsSharedInt(v []byte) bool {
+	if len(v) == 0 || len(v) > 20 {
+		return false
+	}
+	_, err := strconv.ParseInt(string(v), 10, 64)
+	return err == nil
+}
+
+// EstimateString is the memory of a string value: a shared integer, an embstr
+// up to 44 bytes or a raw sds.
+func (m Model) EstimateString(v []byte) int64 {
+	switch {
+	case IsSharedInt(v):
+		return m.Alloc(robjSize)
+	case len(v) <= embstrMaxLen:
+		return m.Alloc(robjSize + sdsHeader(len(v)) + len(v) + 1)
+	}
+	return m.Alloc(robjSize) + m.SDS(len(v))
+}
+
+// listpackEntry is the encoded size of one listpack element including its
+// backlen.
+func listpackEntry(v []byte) int {
+	n := 0
+	if i, err := strconv.ParseInt(string(v), 10, 64); err == nil && len(v) <= 20 {
+		switch {
+		case i >= 0 && i <= 127:
+			n = 1
+		case i >= -4096 && i < 4096:
+			n = 2
+		case i >= -1<<15 && i < 1<<15:
+			n = 3
+		case i >= -1<<23 && i < 1<<23:
+			n = 4
+		case i >= -1<<31 && i < 1<<31:
+			n = 5
+		default:
+			n = 9
+		}
+	} else {
+		switch {
+		case len(v) < 64:
+			n = 1 + len(v)
+		case len(v) < 4096:
+			n = 2 + len(v)
+		default:
+			n = 5 + len(v)
+		}
+	}
+	switch {
+	case n < 1<<7:
+		return n + 1
+	case n < 1<<14:
+		return n + 2
+	case n < 1<<21:
+		return n + 3
+	case n < 1<<28:
+		return n + 4
+	}
+	return n + 5
+}
+
+// ziplistEntry is the encoded size of one ziplist element assuming a
+// one-byte prevlen, which holds for all but entries following large ones.
+func ziplistEntry(v []byte) int {
+	if i, err := strconv.ParseInt(string(v), 10, 64); err == nil && len(v) <= 20 {
+		switch {
+		case i >= 0 && i <= 12:
+			return 2
+		case i >= -1<<7 && i < 1<<7:
+			return 3
+		case i >= -1<<15 && i < 1<<15:
+			return 4
+		case i >= -1<<23 && i < 1<<23:
+			return 5
+		case i >= -1<<31 && i < 1<<31:
+			return 6
+		}
+		return 10
+	}
+	prev := 1
+	if len(v) >= 254 {
+		prev = 5
+	}
+	switch {
+	case len(v) < 64:
+		return prev + 1 + len(v)
+	case len(v) < 16384:
+		return prev + 2 + len(v)
+	}
+	return prev + 5 + len(v)
+}
+
+func (m Model) packed(encoding string, values ...[][]byte) int64 {
+	if encoding == model.ZipListEncoding {
+		n := ziplistHeader
+		for _, vs := range values {
+			for _, v := range vs {
+				n += ziplistEntry(v)
+			}
+		}
+		return m.Alloc(n)
+	}
+	n := listpackHeader
+	for _, vs := range values {
+		for _, v := range vs {
+			n += listpackEntry(v)
+		}
+	}
+	return m.Alloc(n)
+}
+
+func isPacked(encoding string) bool {
+	switch encoding {
+	case model.ZipListEncoding, model.ListPackEncoding, model.ListPackExEncoding, model.ZipMapEncoding:
+		return true
+	}
+	return false
+}
+
+func (m Model) dict(entries int) int64 {
+	buckets := 4
+	for buckets < entries {
+		buckets <<= 1
+	}
+	return m.Alloc(dictSize) + m.Alloc(buckets*pointerSize)
+}
+
+// EstimateList is the memory of a list: a ziplist in old dumps, else a
+// quicklist of listpack nodes.
+func (m Model) EstimateList(encoding string, values [][]byte) int64 {
+	if encoding == model.ZipListEncoding {
+		return m.Alloc(robjSize) + m.packed(encoding, values)
+	}
+	// quicklist of listpack nodes, each filled up to list-max-listpack-size
+	mem := m.Alloc(robjSize) + m.Alloc(quicklistSize)
+	node := listpackHeader
+	for _, v := range values {
+		e := listpackEntry(v)
+		if node+e > quicklistFill && node > listpackHeader {
+			mem += m.Alloc(quicklistNodeSize) + m.Alloc(node)
+			node = listpackHeader
+		}
+		node += e
+	}
+	if node > listpackHeader {
+		mem += m.Alloc(quicklistNodeSize) + m.Alloc(node)
+	}
+	return mem
+}
+
+// EstimateHash is the memory of a hash in the given encoding, a listpack
+// (or ziplist, zipmap) or a hashtable.
+func (m Model) EstimateHash(encoding string, fields map[string][]byte) int64 {
+	if isPacked(encoding) {
+		packed := make([][]byte, 0, len(fields)*2)
+		for f, v := range fields {
+			packed = append(packed, []byte(f), v)
+		}
+		return m.Alloc(robjSize) + m.packed(encoding, packed)
+	}
+	mem := m.Alloc(robjSize) + m.dict(len(fields))
+	for f, v := range fields {
+		mem += m.Alloc(dictEntrySize) + m.SDS(len(f)) + m.SDS(len(v))
+	}
+	return mem
+}
+
+// EstimateSet is the memory of a set in the given encoding, an intset, a
+// listpack or a hashtable.
+func (m Model) EstimateSet(encoding string, members [][]byte) int64 {
+	switch {
+	case encoding == model.IntSetEncoding:
+		width := 2
+		for _, v := range members {
+			i, _ := strconv.ParseInt(string(v), 10, 64)
+			switch {
+			case i < -1<<31 || i >= 1<<31:
+				width = 8
+			case (i < -1<<15 || i >= 1<<15) && width < 4:
+				width = 4
+			}
+		}
+		return m.Alloc(robjSize) + m.Alloc(intsetHeader+width*len(members))
+	case isPacked(encoding):
+		return m.Alloc(robjSize) + m.packed(encoding, members)
+	}
+	mem := m.Alloc(robjSize) + m.dict(len(members))
+	for _, v := range members {
+		mem += m.Alloc(dictEntrySize) + m.SDS(len(v))
+	}
+	return mem
+}
+
+// EstimateZSet is the memory of a sorted set in the given encoding, a
+// listpack or a skiplist with its dict.
+func (m Model) EstimateZSet(encoding string, entries []*model.ZSetEntry) int64 {
+	if isPacked(encoding) {
+		packed := make([][]byte, 0, len(entries)*2)
+		for _, e := range entries {
+			packed = append(packed, []byte(e.Member), []byte(strconv.FormatFloat(e.Score, 'g', 17, 64)))
+		}
+		return m.Alloc(robjSize) + m.packed(encoding, packed)
+	}
+	mem := m.Alloc(robjSize) + m.Alloc(zsetSize) + m.dict(len(entries)) + m.Alloc(zskiplistSize)
+	mem += m.Alloc(zslNodeBaseSize + zskiplistMaxLevel*zslLevelSize)
+	node := m.Alloc(zslNodeBaseSize + zslAvgLevelBytes)
+	for _, e := range entries {
+		mem += node + m.SDS(len(e.Member)) + m.Alloc(dictEntrySize)
+	}
+	return mem
+}
+
+// EstimateStream is the memory of a stream: its rax of listpack nodes and
+// its consumer groups with their pending entries.
+func (m Model) EstimateStream(o *parser.StreamObject) int64 {
+	mem := m.Alloc(robjSize) + m.Alloc(streamSize)
+	for _, e := range o.Entries {
+		n := listpackHeader
+		for _, msg := range e.Msgs {
+			n += 3 // entry flags, ms and seq diffs
+			for f, v := range msg.Fields {
+				n += listpackEntry([]byte(f)) + listpackEntry([]byte(v))
+			}
+		}
+		mem += m.Alloc(raxNodeSize) + m.Alloc(n)
+	}
+	for _, g := range o.Groups {
+		mem += m.Alloc(streamGroupSize) + int64(len(g.Pending))*m.Alloc(streamNackSize)
+		for _, c := range g.Consumers {
+			mem += m.Alloc(streamGroupSize) + m.SDS(len(c.Name))
+		}
+	}
+	return mem
+}
+
+// Estimate returns the estimated RAM of o under the Default model.
+func Estimate(o parser.RedisObject) int64 { return Default.Estimate(o) }
+
+// EstimateString is Default.EstimateString.
+func EstimateString(v []byte) int64 { return Default.EstimateString(v) }
+
+// EstimateList is Default.EstimateList.
+func EstimateList(encoding string, values [][]byte) int64 {
+	return Default.EstimateList(encoding, values)
+}
+
+// EstimateHash is Default.EstimateHash.
+func EstimateHash(encoding string, fields map[string][]byte) int64 {
+	return Default.EstimateHash(encoding, fields)
+}
+
+// EstimateSet is Default.EstimateSet.
+func EstimateSet(encoding string, members [][]byte) int64 {
+	return Default.EstimateSet(encoding, members)
+}
+
+// EstimateZSet is Default.EstimateZSet.
+func EstimateZSet(encoding string, entries []*model.ZSetEntry) int64 {
+	return Default.EstimateZSet(encoding, entries)
+}
+
+// EstimateStream is Default.EstimateStream.
+func EstimateStream(o *parser.StreamObject) int64 { return Default.EstimateStream(o) }
@@ -0,0 +1,166 @@
+package rdbviz
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// RDB opcodes that may precede a key record.
+const (
+	rdbOpIdle     = 0xf8
+	rdbOpFreq     = 0xf9
+	rdbOpResizeDB = 0xfb
+	rdbOpExpireMs = 0xfc
+	rdbOpExpire   = 0xfd
+	rdbOpSelectDB = 0xfe
+)
+
+const (
+	sniffRing = 16 * 1024 // more than the decoder's 4 KiB bufio read-ahead
+	sniffHead = 64        // enough for SELECTDB, RESIZEDB, IDLE, FREQ and EXPIRETIME
+)
+
+// accessSniffer recovers the LRU idle time and LFU frequency of each key.
+// The decoder skips those opcodes, so the sniffer sits between the file and
+// the decoder and keeps the first bytes of every record: after each callback
+// the decoder's read count is where the next record's opcodes start.
+type accessSniffer struct {
+	r    io.Reader
+	pos  int64
+	ring [sniffRing]byte
+	want int64
+	head [sniffHead]byte
+	got  int
+}
+
+func newAccessSniffer(r io.Reader) *accessSniffer {
+	return &accessSniffer{r: r}
+}
+
+func (s *accessSniffer) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.capture(p[:n], s.pos)
+		tail := p[:n]
+		if len(tail) > sniffRing {
+			tail = tail[len(tail)-sniffRing:]
+		}
+		start := s.pos + int64(n-len(tail))
+		for i := 0; i < len(tail); {
+			off := int((start + int64(i)) % sniffRing)
+			i += copy(s.ring[off:], tail[i:])
+		}
+		s.pos += int64(n)
+	}
+	return n, err
+}
+
+// capture copies the part of b (starting at offset at) that falls into the
+// wanted head window.
+func (s *accessSniffer) capture(b []byte, at int64) {
+	from := s.want + int64(s.got)
+	end := s.want + sniffHead
+	if at+int64(len(b)) <= from || at >= end {
+		return
+	}
+	lo := from - at
+	if lo < 0 {
+		return // gap: the window start was not contiguous with what we have
+	}
+	hi := int64(len(b))
+	if at+hi > end {
+		hi = end - at
+	}
+	s.got += copy(s.head[s.got:], b[lo:hi])
+}
+
+// next returns the idle seconds and LFU counter of the record that ended at
+// readCount (unknownAccess when absent) and starts capturing the next one.
+func (s *accessSniffer) next(readCount int64) (idle, freq int64) {
+	idle, freq = parseAccessOpcodes(s.head[:s.got])
+
+	s.want = readCount
+	s.got = 0
+	if readCount < s.pos && s.pos-readCount <= sniffRing {
+		// bytes already read ahead by the decoder
+		end := s.pos
+		if end > readCount+sniffHead {
+			end = readCount + sniffHead
+		}
+		for off := readCount; off < end; off++ {
+			s.head[s.got] = s.ring[off%sniffRing]
+			s.got++
+		}
+	}
+	return idle, freq
+}
+
+// parseAccessOpcodes walks the opcodes in front of a key record.
+func parseAccessOpcodes(b []byte) (idle, freq int64) {
+	idle, freq = unknownAccess, unknownAccess
+	for i := 0; i < len(b); {
+		switch b[i] {
+		case rdbOpIdle:
+			v, n := rdbLength(b[i+1:])
+			if n == 0 {
+				return
+			}
+			idle = int64(v)
+			i += 1 + n
+		case rdbOpFreq:
+			if i+1 >= len(b) {
+				return
+			}
+			freq = int64(b[i+1])
+			i += 2
+		case rdbOpExpireMs:
+			i += 9
+		case rdbOpExpire:
+			i += 5
+		case rdbOpSelectDB:
+			_, n := rdbLength(b[i+1:])
+			if n == 0 {
+				return
+			}
+			i += 1 + n
+		case rdbOpResizeDB:
+			_, n1 := rdbLength(b[i+1:])
+			if n1 == 0 {
+				return
+			}
+			_, n2 := rdbLength(b[i+1+n1:])
+			if n2 == 0 {
+				return
+			}
+			i += 1 + n1 + n2
+		default:
+			return
+		}
+	}
+	return
+}
+
+// rdbLength decodes an RDB length, returning 0 bytes consumed when b is too
+// short or holds a special encoding.
+func rdbLength(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	switch b[0] >> 6 {
+	case 0:
+		return uint64(b[0] & 0x3f), 1
+	case 1:
+		if len(b) < 2 {
+			return 0, 0
+		}
+		return uint64(b[0]&0x3f)<<8 | uint64(b[1]), 2
+	case 2:
+		switch {
+		case b[0] == 0x80 && len(b) >= 5:
+			return uint64(binary.BigEndian.Uint32(b[1:5])), 5
+		case b[0] == 0x81 && len(b) >= 9:
+			return binary.BigEndian.Uint64(b[1:9]), 9
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,343 @@
+package rdbviz
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// Aggregator builds one section of the report from the analyzed keys:
+// Observe is called for every KeyRecord in dump order, Finalize once after
+// the parse for the section's value.
+type Aggregator interface {
+	Observe(KeyRecord)
+	Finalize() any
+}
+
+type registeredAggregator struct {
+	name   string
+	newAgg func() Aggregator
+}
+
+var (
+	aggregatorsMu sync.Mutex
+	aggregators   []registeredAggregator
+)
+
+// RegisterAggregator adds a custom section to every report. Each analysis
+// calls newAgg for a fresh Aggregator and stores its Finalize value as
+// report.Custom[name]; the value must encode to JSON and is not scaled up
+// for sampled runs. It panics when name is registered twice and is meant to
+// be called from an init function.
+func RegisterAggregator(name string, newAgg func() Aggregator) {
+	if err := registerAggregator(name, newAgg); err != nil {
+		panic("rdbviz: " + err.Error())
+	}
+}
+
+func registerAggregator(name string, newAgg func() Aggregator) error {
+	aggregatorsMu.Lock()
+	defer aggregatorsMu.Unlock()
+	for _, r := range aggregators {
+		if r.name == name {
+			return fmt.Errorf("aggregator %q registered twice", name)
+		}
+	}
+	aggregators = append(aggregators, registeredAggregator{name: name, newAgg: newAgg})
+	return nil
+}
+
+// customAggregators returns fresh instances of the registered aggregators.
+func customAggregators() ([]string, []Aggregator) {
+	aggregatorsMu.Lock()
+	defer aggregatorsMu.Unlock()
+	names := make([]string, len(aggregators))
+	aggs := make([]Aggregator, len(aggregators))
+	for i, r := range aggregators {
+		names[i] = r.name
+		aggs[i] = r.newAgg()
+	}
+	return names, aggs
+}
+
+// summaryStats is the built-in aggregator behind report.Summary, apart from
+// the size percentiles and DB count filled in once the parse is done.
+type summaryStats struct {
+	now     time.Time
+	summary report.Summary
+}
+
+func newSummaryStats(now time.Time) *summaryStats {
+	return &summaryStats{
+		now: now,
+		summary: report.Summary{
+			DBKeys:     map[int]int64{},
+			DBSize:     map[int]int64{},
+			DBMem:      map[int]int64{},
+			TypeCounts: map[string]int{},
+			NowISO:     now.Format(time.RFC3339),
+		},
+	}
+}
+
+func (s *summaryStats) Observe(k KeyRecord) {
+	sum := &s.summary
+	sum.TotalKeys++
+	sum.TotalSize += k.Size
+	sum.TotalMem += k.EstimatedMem
+	sum.DBKeys[k.DB]++
+	sum.DBSize[k.DB] += k.Size
+	sum.DBMem[k.DB] += k.EstimatedMem
+	sum.TypeCounts[k.Type]++
+	switch {
+	case k.Expiration == nil:
+		sum.NoTTL++
+	case k.Expiration.Before(s.now):
+		sum.WithTTL++
+		sum.Expired++
+		sum.ExpiredSize += k.Size
+		sum.ExpiredMem += k.EstimatedMem
+	default:
+		sum.WithTTL++
+	}
+}
+
+func (s *summaryStats) Finalize() any { return s.result() }
+
+func (s *summaryStats) result() report.Summary {
+	s.summary.DBCount = len(s.summary.DBKeys)
+	return s.summary
+}
+
+// ttlStats is the built-in aggregator behind report.TTLBuckets.
+type ttlStats struct {
+	now    time.Time
+	counts map[string]int64
+}
+
+func newTTLStats(now time.Time) *ttlStats {
+	return &ttlStats{now: now, counts: newTTLCounts()}
+}
+
+func (t *ttlStats) Observe(k KeyRecord) {
+	t.counts[ttlLabel(k.Expiration, t.now)]++
+}
+
+func (t *ttlStats) Finalize() any { return t.result() }
+
+func (t *ttlStats) result() []report.Bucket {
+	return ttlBucketList(t.counts)
+}
+
+// bigKeyStats is the built-in aggregator behind report.BigKeys.
+type bigKeyStats struct {
+	topN   int
+	metric func(report.BigKey) float64
+	keys   bigKeyHeap
+}
+
+func newBigKeyStats(topN int, metric func(report.BigKey) float64) *bigKeyStats {
+	return &bigKeyStats{topN: topN, metric: metric, keys: make(bigKeyHeap, 0, topN)}
+}
+
+func (b *bigKeyStats) Observe(k KeyRecord) {
+	if i := pushBigKey(&b.keys, bigKeyOf(k), b.topN, b.metric); i >= 0 {
+		b.keys[i].LargestMember = largestMember(k.Object)
+		b.keys[i].Scores = scoreStats(k.Object)
+	}
+}
+
+func (b *bigKeyStats) Finalize() any { return b.result() }
+
+func (b *bigKeyStats) result() []report.BigKey {
+	sort.Slice(b.keys, func(i, j int) bool { return b.metric(b.keys[i]) > b.metric(b.keys[j]) })
+	return b.keys
+}
+
+// bigKeyOf is the bigkey entry of a key, without the member details only
+// kept for keys that make a list.
+func bigKeyOf(k KeyRecord) report.BigKey {
+	return report.BigKey{
+		DB:             k.DB,
+		Key:            k.Key,
+		Type:           k.Type,
+		Size:           k.Size,
+		EstimatedMem:   k.EstimatedMem,
+		Encoding:       k.Encoding,
+		Elements:       k.Elements,
+		Expiration:     k.Expiration,
+		AvgElementSize: avgElementSize(k.Size, k.Elements),
+	}
+}
+
+// prefixStats is the built-in aggregator behind the prefix tables: all keys,
+// per type, per encoding and expired keys, capped by the shared fold.
+type prefixStats struct {
+	now        time.Time
+	sep        string
+	maxDepth   int
+	prefixLen  int
+	autoPrune  bool
+	minKeys    int64
+	topN       int
+	fold       *prefixFold
+	topKeys    *prefixTopKeys
+	prefixes   map[string]prefixAgg
+	byType     map[string]map[string]prefixAgg
+	byEncoding map[string]map[string]prefixAgg
+	expired    map[string]prefixAgg
+	typeMem    map[string]int64
+	runs       []*spillRun
+	sketch     *prefixSketch
+	children   *prefixChildren
+}
+
+// prefixSections is what prefixStats finalizes to.
+type prefixSections struct {
+	Prefixes []report.PrefixStat
+	ByType   []report.PrefixTypeGroup
+	Expired  []report.PrefixStat
+	Mix      []report.PrefixMix
+	Fold     *report.PrefixFold
+}
+
+func newPrefixStats(now time.Time, opts Options, maxDepth int) *prefixStats {
+	p := &prefixStats{
+		now:        now,
+		sep:        opts.PrefixSep,
+		maxDepth:   maxDepth,
+		prefixLen:  opts.PrefixLen,
+		autoPrune:  opts.PrefixAutoDepth && opts.PrefixLen <= 0,
+		minKeys:    opts.PrefixMinKeys,
+		topN:       opts.TopN,
+		fold:       &prefixFold{maxEntries: opts.PrefixMaxEntries},
+		prefixes:   map[string]prefixAgg{},
+		byType:     map[string]map[string]prefixAgg{},
+		byEncoding: map[string]map[string]prefixAgg{},
+		expired:    map[string]prefixAgg{},
+		typeMem:    map[string]int64{},
+	}
+	if opts.PrefixTopKeys > 0 {
+		p.topKeys = newPrefixTopKeys(opts.PrefixTopKeys)
+	}
+	if opts.PrefixChildren && opts.PrefixLen <= 0 {
+		p.children = newPrefixChildren(opts.PrefixSep, maxDepth)
+	}
+	if opts.PrefixSketch > 0 {
+		p.sketch = newPrefixSketch(opts.PrefixSketch)
+	}
+	return p
+}
+
+func (p *prefixStats) Observe(k KeyRecord) {
+	expired := k.Expiration != nil && k.Expiration.Before(p.now)
+	ttl := int64(noTTL)
+	if k.Expiration != nil {
+		ttl = int64(k.Expiration.Sub(p.now) / time.Second)
+	}
+	size, mem := k.Size, k.EstimatedMem
+	p.typeMem[k.Type] += mem
+	if p.prefixLen > 0 {
+		applyFixedPrefix(p.prefixes, k.Key, size, mem, ttl, p.prefixLen)
+		applyFixedPrefix(typePrefixes(p.byType, k.Type), k.Key, size, mem, ttl, p.prefixLen)
+		applyFixedPrefix(typePrefixes(p.byEncoding, k.Encoding), k.Key, size, mem, ttl, p.prefixLen)
+		if expired {
+			applyFixedPrefix(p.expired, k.Key, size, mem, ttl, p.prefixLen)
+		}
+	} else {
+		applyPrefixes(p.prefixes, k.Key, size, mem, ttl, p.sep, p.maxDepth)
+		if p.children != nil {
+			p.children.observe(k.Key, size)
+		}
+		applyPrefixesByType(p.byType, k.Type, k.Key, size, mem, ttl, p.sep, p.maxDepth)
+		applyPrefixesByType(p.byEncoding, k.Encoding, k.Key, size, mem, ttl, p.sep, p.maxDepth)
+		if expired {
+			applyPrefixes(p.expired, k.Key, size, mem, ttl, p.sep, p.maxDepth)
+		}
+	}
+	if ps := p.sketch; ps != nil {
+		ps.all.absorb(p.prefixes)
+		ps.group(ps.byType, k.Type).absorb(p.byType[k.Type])
+		ps.group(ps.byEncoding, k.Encoding).absorb(p.byEncoding[k.Encoding])
+		if expired {
+			ps.expired.absorb(p.expired)
+		}
+	} else {
+		p.fold.capPrefixes(p.prefixes)
+		if pm, ok := p.byType[k.Type]; ok {
+			p.fold.capPrefixes(pm)
+		}
+		if pm, ok := p.byEncoding[k.Encoding]; ok {
+			p.fold.capPrefixes(pm)
+		}
+		if expired {
+			p.fold.capPrefixes(p.expired)
+		}
+	}
+	if p.topKeys != nil {
+		group := namespaceOf(k.Key, p.sep)
+		if p.prefixLen > 0 {
+			group = fixedPrefix(k.Key, p.prefixLen)
+		}
+		p.topKeys.observe(group, report.PrefixKey{DB: k.DB, Key: k.Key, Type: k.Type, Size: size, EstimatedMem: mem})
+	}
+}
+
+func (p *prefixStats) Finalize() any { return p.result() }
+
+// result prunes the tables for auto depth, so a growth snapshot must be
+// taken from p.prefixes before. With a sketch, unsketch must be called first.
+func (p *prefixStats) result() prefixSections {
+	if p.autoPrune {
+		prunePrefixes(p.prefixes, p.sep, p.minKeys)
+		prunePrefixes(p.expired, p.sep, p.minKeys)
+	}
+
+	prefixList := prefixStatList(p.prefixes, p.topN)
+	if p.sketch != nil {
+		p.sketch.all.annotate(prefixList)
+	}
+	if p.children != nil {
+		p.children.attach(prefixList)
+	}
+	if p.topKeys != nil {
+		p.topKeys.attach(prefixList, func(prefix string) string {
+			if p.prefixLen > 0 {
+				return prefix
+			}
+			return namespaceOf(prefix, p.sep)
+		})
+	}
+	// the mix is looked up before the per-type tables are pruned on their own
+	mix := prefixMix(prefixList, p.byType, p.byEncoding)
+	if p.autoPrune {
+		for _, pm := range p.byType {
+			prunePrefixes(pm, p.sep, p.minKeys)
+		}
+	}
+
+	byType := make([]report.PrefixTypeGroup, 0, len(p.byType))
+	for t, pm := range p.byType {
+		list := prefixStatList(pm, p.topN)
+		if p.sketch != nil && p.sketch.byType[t] != nil {
+			p.sketch.byType[t].annotate(list)
+		}
+		byType = append(byType, report.PrefixTypeGroup{Type: t, EstimatedMem: p.typeMem[t], Prefixes: list})
+	}
+	sort.Slice(byType, func(i, j int) bool { return byType[i].Type < byType[j].Type })
+	expiredList := prefixStatList(p.expired, p.topN)
+	if p.sketch != nil {
+		p.sketch.expired.annotate(expiredList)
+	}
+
+	return prefixSections{
+		Prefixes: prefixList,
+		ByType:   byType,
+		Expired:  expiredList,
+		Mix:      mix,
+		Fold:     p.fold.result(),
+	}
+}
@@ -0,0 +1,813 @@
+// Package rdbviz analyzes Redis RDB dumps into the report rendered by the
+// rdbviz page. The rdbviz-tool command is a thin CLI over it; services can
+// embed it the same way:
+//
+//	a, err := rdbviz.New(rdbviz.DefaultOptions())
+//	if err != nil {
+//		return err
+//	}
+//	rep, err := a.AnalyzeFile(ctx, "dump.rdb")
+package rdbviz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/memmodel"
+	"rdbviz-tool/pkg/report"
+)
+
+// Report is the analysis result, serialized as report.json.
+type Report = report.Report
+
+// Analyzer runs analyses with a fixed set of options. It holds no state
+// between runs and may be reused.
+type Analyzer struct {
+	opts Options
+}
+
+// New returns an Analyzer after validating opts.
+func New(opts Options) (*Analyzer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return &Analyzer{opts: opts}, nil
+}
+
+// AnalyzeFile parses the dump at path and builds its report. Options that
+// reach out to a live instance or write a migration script do so after the
+// dump has been parsed.
+//
+// Cancelling ctx stops the analysis within a key. The error is ctx.Err(),
+// with a nil report unless PartialOnCancel is set and the cancellation came
+// while parsing the dump: the report then covers the keys read so far,
+// marked truncated and extrapolated like a MaxKeys cut, without the live
+// checks and migration plan.
+func (a *Analyzer) AnalyzeFile(ctx context.Context, path string) (*Report, error) {
+	return a.AnalyzeFileFunc(ctx, path, nil)
+}
+
+// AnalyzeFileFunc is AnalyzeFile calling onKey for every analyzed key, as
+// Analyze does.
+func (a *Analyzer) AnalyzeFileFunc(ctx context.Context, path string, onKey func(KeyRecord) error) (*Report, error) {
+	rdbAbs, _ := filepath.Abs(path)
+	rdbFile, err := os.Open(rdbAbs)
+	if err != nil {
+		return nil, err
+	}
+	defer rdbFile.Close()
+	stat, err := rdbFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return a.analyze(ctx, rdbFile, rdbAbs, stat.Size(), onKey)
+}
+
+// analyze parses the dump read from r. source is recorded in the report and
+// the migration script; fileSize is 0 when unknown, in which case progress
+// has no percentage and a -max-keys cut is not extrapolated to the rest of
+// the dump. onKey, if set, sees every analyzed key and stops the parse by
+// returning an error.
+func (a *Analyzer) analyze(ctx context.Context, r io.Reader, source string, fileSize int64, onKey func(KeyRecord) error) (*Report, error) {
+	opts := a.opts
+	now := time.Now()
+	maxDepth := opts.PrefixDepth
+	if opts.PrefixAutoDepth {
+		maxDepth = autoPrefixMaxDepth
+	}
+	metric, err := bigKeyMetric(opts.BigKeySort)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := report.Meta{
+		Source:       source,
+		GeneratedAt:  now.Format(time.RFC3339),
+		Aux:          map[string]string{},
+		MemAllocator: opts.Allocator,
+		Instance:     opts.Instance,
+		Shard:        opts.Shard,
+	}
+
+	typeCount := map[string]int64{}
+	typeSize := map[string]int64{}
+	typeMem := map[string]int64{}
+	mm := memmodel.Model{Allocator: opts.Allocator}
+	sum := newSummaryStats(now)
+	ttls := newTTLStats(now)
+	pfx := newPrefixStats(now, opts, maxDepth)
+	bigKeys := newBigKeyStats(opts.TopN, metric)
+	customNames, custom := customAggregators()
+	aggs := append([]Aggregator{sum, ttls, pfx, bigKeys}, custom...)
+	var classes *classStats
+	if opts.Classifier != nil {
+		classes = newClassStats(opts.Classifier, opts.TopN)
+		aggs = append(aggs, classes)
+	}
+	suffixes := map[string]prefixAgg{}
+	var patternAgg *patternStats
+	if opts.Patterns {
+		patternAgg = newPatternStats(opts.PrefixSep, opts.PatternMax)
+	}
+	encodings := newEncodingStats(mm, opts.TopN)
+	keyNames := newKeyNameStats(mm, opts.TopN)
+	elements := newElementStats()
+	log := opts.logger()
+	hlls := newHLLStats(opts.TopN, log)
+	bitmaps := newBitmapStats(opts.TopN)
+	geo := newGeoStats(now, opts.TopN)
+	timeline := newExpiryTimeline(now, opts.ExpirySpike, opts.TopN)
+	percentiles := newSizePercentiles(opts.PrefixSep, opts.TopN)
+	cold := newColdKeys(opts.PrefixSep, opts.TopN)
+	var typeBig *typeBigKeys
+	if opts.BigKeysByType {
+		typeBig = newTypeBigKeys(opts.TopN, metric)
+	}
+	var dbBig *dbBigKeys
+	if opts.BigKeysByDB {
+		dbBig = newDBBigKeys(opts.TopN, metric)
+	}
+	var offload *offloadAgg
+	if opts.OffloadMinSize > 0 {
+		offload = newOffloadAgg(opts.OffloadMinSize, opts.PrefixSep, opts.TopN)
+	}
+	orphans := newOrphanStats(opts.PrefixSep, opts.TopN)
+	var governance *governanceStats
+	if len(opts.Allowlist) > 0 {
+		governance = newGovernanceStats(opts.Allowlist, opts.PrefixSep, opts.TopN)
+	}
+	var candidates *candidateStats
+	if opts.CandidateMinSize > 0 {
+		candidates = newCandidateStats(opts.CandidateMinSize, opts.CandidatePolicies, opts.PrefixSep, opts.TopN)
+	}
+	var eviction *evictionSim
+	if opts.MaxMemory > 0 {
+		eviction = newEvictionSim(opts.PrefixSep, opts.TopN)
+	}
+	var dbAgg *dbStats
+	if opts.PerDB {
+		pruneMinKeys := int64(0)
+		if opts.PrefixAutoDepth && opts.PrefixLen <= 0 {
+			pruneMinKeys = opts.PrefixMinKeys
+		}
+		dbAgg = newDBStats(now, opts.PrefixSep, maxDepth, opts.PrefixLen, pruneMinKeys, opts.TopN, metric, opts.PrefixMaxEntries)
+	}
+	slotAgg := newSlotStats(opts.HotSlotFactor, opts.TopN)
+	hashTags := newHashTagStats(opts.HashTagHot, opts.PrefixSep, opts.TopN)
+	var whatIf *ttlWhatIf
+	if len(opts.TTLRules) > 0 {
+		whatIf = newTTLWhatIf(opts.TTLRules)
+	}
+	var compress *compressStats
+	if opts.Compress != "" {
+		compress, err = newCompressStats(opts.Compress, opts.CompressSample, opts.PrefixSep, opts.TopN)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var entropy *entropyStats
+	if opts.EntropySample > 0 {
+		entropy = newEntropyStats(opts.EntropySample, opts.PrefixSep, opts.TopN)
+	}
+	var jsonProfile *jsonStats
+	if opts.JSONSample > 0 {
+		jsonProfile = newJSONStats(opts.JSONSample, opts.PrefixSep, opts.TopN)
+	}
+	var formats *formatStats
+	if opts.FormatSample > 0 {
+		formats = newFormatStats(opts.FormatSample, opts.PrefixSep, opts.TopN)
+	}
+	// the key names are held until the end, worth it only when the dump has
+	// several DBs and they are asked about
+	var crossDB *crossDBStats
+	if opts.PerDB && opts.CrossDBSample > 0 {
+		crossDB = newCrossDBStats(opts.CrossDBSample, opts.TopN)
+	}
+	var growth *growthStats
+	if opts.Baseline != "" {
+		start := time.Now()
+		growth, err = loadBaseline(ctx, opts, mm, maxDepth)
+		var keys int64
+		if growth != nil {
+			keys = growth.keys
+		}
+		opts.stageDone(StageBaseline, start, keys, 0, err)
+		if err != nil {
+			return nil, fmt.Errorf("baseline: %w", err)
+		}
+	}
+	var drift *driftStats
+	if opts.LiveAddr != "" && opts.Drift {
+		drift = newDriftStats(opts.PrefixSep, opts.TopN)
+	}
+	var dedup *dedupStats
+	if opts.DedupMinSize > 0 {
+		dedup = newDedupStats(mm, opts.DedupMinSize, opts.DedupSample, opts.TopN)
+	}
+	spill := newSpiller(opts, pfx, dedup)
+	defer spill.cleanup()
+
+	sizeCounts := map[string]int64{}
+	for _, b := range sizeBuckets {
+		sizeCounts[b.Label] = 0
+	}
+
+	r, stopRead := dumpReader(r, opts)
+	defer stopRead()
+	sniffer := newAccessSniffer(r)
+	dec := parser.NewDecoder(sniffer).WithSpecialOpCode()
+	progress := newProgressReporter(opts, StageParse, fileSize)
+	onAux := func(obj *parser.AuxObject) {
+		key := strings.TrimSpace(obj.Key)
+		val := strings.TrimSpace(obj.Value)
+		meta.Aux[key] = val
+		log.Debug("aux field", "key", key, "value", val)
+		switch key {
+		case "redis-ver":
+			meta.RedisVersion = val
+		case "redis-bits":
+			meta.RedisBits = val
+		case "ctime":
+			meta.CTime = val
+		case "used-mem":
+			meta.UsedMem = val
+		case "aof-base":
+			meta.AOFBase = val
+		case "repl-id":
+			meta.ReplID = val
+		case "repl-offset":
+			meta.ReplOffset = val
+		case "repl-stream-db":
+			meta.ReplStreamDB = val
+		}
+	}
+	prepare := func(o parser.RedisObject, idle, freq int64) KeyRecord {
+		rec := KeyRecord{
+			DB:         o.GetDBIndex(),
+			Key:        o.GetKey(),
+			Type:       o.GetType(),
+			Encoding:   o.GetEncoding(),
+			Size:       getSize(o),
+			Elements:   getElementCount(o),
+			Expiration: o.GetExpiration(),
+			Idle:       idle,
+			Freq:       freq,
+			Object:     o,
+		}
+		rec.EstimatedMem = mm.Estimate(o)
+		if opts.Classifier != nil {
+			rec.Class = opts.Classifier.Classify(rec.DB, rec.Key)
+		}
+		return rec
+	}
+	var keyErr, spillErr error
+	consume := func(rec KeyRecord, read int64) bool {
+		o := rec.Object
+		db, key, objType, encoding := rec.DB, rec.Key, rec.Type, rec.Encoding
+		size, mem, elemCount := rec.Size, rec.EstimatedMem, rec.Elements
+		expiration, idle, freq := rec.Expiration, rec.Idle, rec.Freq
+		for _, ag := range aggs {
+			ag.Observe(rec)
+		}
+		if size == 0 {
+			log.Log(ctx, LevelTrace, "key with an empty value", "db", db, "key", key, "type", objType, "encoding", encoding)
+		}
+		sizeCounts[getSizeBucket(size)]++
+
+		typeCount[objType]++
+		typeSize[objType] += size
+		typeMem[objType] += mem
+		encodings.observe(o, size, mem)
+		keyNames.observe(db, key, objType, mem)
+		elements.observe(objType, elemCount, size, mem)
+
+		ttl := int64(noTTL)
+		if expiration != nil {
+			ttl = int64(expiration.Sub(now) / time.Second)
+		}
+		if patternAgg != nil {
+			patternAgg.observe(key, size, mem)
+		}
+		if opts.SuffixDepth > 0 {
+			applySuffixes(suffixes, key, size, mem, ttl, opts.PrefixSep, opts.SuffixDepth)
+			pfx.fold.capPrefixes(suffixes)
+		}
+
+		bk := bigKeyOf(rec)
+		if typeBig != nil {
+			typeBig.observe(o, bk)
+		}
+		if dbBig != nil {
+			dbBig.observe(o, bk)
+		}
+		if dbAgg != nil {
+			dbAgg.observe(o, bk, ttl)
+		}
+
+		if offload != nil {
+			offload.observe(db, key, objType, encoding, size, mem, expiration != nil, idle, freq)
+		}
+		orphans.observe(db, key, objType, size, mem)
+		if governance != nil {
+			governance.observe(key, size, mem)
+		}
+		if candidates != nil {
+			candidates.observe(db, key, objType, size, mem, ttl, idle, freq)
+		}
+		hlls.observe(o, mem)
+		bitmaps.observe(o, mem)
+		geo.observe(o, size, mem)
+		timeline.observe(expiration, size, mem)
+		percentiles.observe(key, objType, size)
+		cold.observe(key, idle, size, mem)
+		if eviction != nil {
+			eviction.observe(key, size, mem, ttl, idle, freq)
+		}
+		if whatIf != nil {
+			whatIf.observe(key, size, mem, ttl)
+		}
+		slotAgg.observe(key, size, mem, freq)
+		hashTags.observe(key, size, mem)
+		if crossDB != nil {
+			crossDB.observe(db, key, size, mem)
+		}
+		if drift != nil {
+			drift.observe(db, key)
+		}
+		if dedup != nil {
+			dedup.observe(db, o)
+		}
+		if compress != nil {
+			compress.observe(o)
+		}
+		if entropy != nil {
+			entropy.observe(o)
+		}
+		if jsonProfile != nil {
+			jsonProfile.observe(o)
+		}
+		if formats != nil {
+			formats.observe(o)
+		}
+		if spill != nil {
+			if spillErr = spill.observe(); spillErr != nil {
+				return false
+			}
+		}
+		if onKey != nil {
+			if keyErr = onKey(rec); keyErr != nil {
+				return false
+			}
+		}
+
+		progress.tick(db, sum.summary.TotalKeys, read)
+		return true
+	}
+	parseStart := time.Now()
+	truncated, cancelled, err := parseDump(ctx, dec, sniffer, opts, onAux, prepare, consume)
+	parseErr := err
+	if cancelled && !opts.PartialOnCancel {
+		parseErr = ctx.Err()
+	}
+	opts.stageDone(StageParse, parseStart, sum.summary.TotalKeys, int64(dec.GetReadCount()), errors.Join(parseErr, keyErr, spillErr))
+	reportStart := time.Now()
+	log.Debug("parse finished", "keys", sum.summary.TotalKeys, "read", dec.GetReadCount(), "elapsed", time.Since(now).Round(time.Millisecond),
+		"truncated", truncated, "cancelled", cancelled)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	if spillErr != nil {
+		return nil, fmt.Errorf("spill: %v", spillErr)
+	}
+	if cancelled {
+		if !opts.PartialOnCancel {
+			return nil, ctx.Err()
+		}
+		truncated = true
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse: %v", err)
+	}
+
+	summary := sum.result()
+	summary.SizePercentiles = percentiles.all.percentiles()
+
+	types := make([]report.TypeStat, 0, len(typeCount))
+	for t, c := range typeCount {
+		types = append(types, report.TypeStat{Type: t, Count: c, Size: typeSize[t], EstimatedMem: typeMem[t], SizePercentiles: percentiles.typePercentiles(t)})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Size > types[j].Size })
+
+	meta.Replication = replicationNote(meta)
+	meta.BigKeySort = opts.BigKeySort
+	switch {
+	case opts.PrefixLen > 0:
+		meta.PrefixMode = "fixed-length"
+		meta.PrefixLen = opts.PrefixLen
+	case opts.PrefixAutoDepth:
+		meta.PrefixMode = "auto"
+	default:
+		meta.PrefixMode = "separator"
+	}
+	meta.PrefixSketch = opts.PrefixSketch
+	pfx.unsketch()
+	if growth != nil {
+		growth.snapshot(pfx.prefixes)
+	}
+	if err := pfx.unspill(); err != nil {
+		return nil, fmt.Errorf("spill: %v", err)
+	}
+	prefixTables := pfx.result()
+
+	sizeList := make([]report.Bucket, 0, len(sizeBuckets))
+	for _, b := range sizeBuckets {
+		sizeList = append(sizeList, report.Bucket{Label: b.Label, Count: sizeCounts[b.Label]})
+	}
+
+	read := int64(dec.GetReadCount())
+	scale := 1 / opts.SampleRate
+	if truncated && read > 0 && fileSize > 0 {
+		scale *= float64(fileSize) / float64(read)
+	}
+
+	rep := report.Report{
+		Meta:                  meta,
+		Summary:               summary,
+		Types:                 types,
+		TTLBuckets:            ttls.result(),
+		SizeBuckets:           sizeList,
+		Prefixes:              prefixTables.Prefixes,
+		PrefixesByType:        prefixTables.ByType,
+		BigKeys:               bigKeys.result(),
+		PrefixFold:            prefixTables.Fold,
+		Encodings:             encodings.result(),
+		KeyNames:              keyNames.result(),
+		Elements:              elements.result(),
+		ExpiredPrefixes:       prefixTables.Expired,
+		PrefixMix:             prefixTables.Mix,
+		PrefixSizePercentiles: percentiles.prefixPercentiles(),
+		HyperLogLogs:          hlls.result(),
+		Bitmaps:               bitmaps.result(),
+		Geo:                   geo.result(),
+		ExpiryTimeline:        timeline.result(summary.TotalKeys),
+		ColdKeys:              cold.result(),
+	}
+	if typeBig != nil {
+		rep.BigKeysByType = typeBig.result()
+	}
+	if dbBig != nil && summary.DBCount > 1 {
+		rep.BigKeysByDB = dbBig.result()
+	}
+	if opts.SuffixDepth > 0 {
+		rep.Suffixes = suffixList(suffixes, opts.TopN)
+	}
+	if patternAgg != nil {
+		rep.Patterns = patternAgg.result(opts.TopN)
+	}
+	if offload != nil {
+		rep.Offload = offload.result()
+	}
+	if candidates != nil {
+		rep.Candidates = candidates.result()
+	}
+	if governance != nil {
+		rep.Governance = governance.result()
+	}
+	if classes != nil {
+		rep.Classes = classes.result()
+	}
+	rep.Orphans = orphans.result()
+	if crossDB != nil && summary.DBCount > 1 {
+		rep.CrossDB = crossDB.result()
+	}
+	if dedup != nil {
+		if rep.Dedup, err = dedup.result(); err != nil {
+			return nil, fmt.Errorf("spill: %v", err)
+		}
+	}
+	if compress != nil {
+		rep.Compression = compress.result()
+	}
+	if entropy != nil {
+		rep.Entropy = entropy.result()
+	}
+	if jsonProfile != nil {
+		rep.JSON = jsonProfile.result()
+	}
+	if formats != nil {
+		rep.Formats = formats.result()
+	}
+
+	if eviction != nil {
+		rep.Eviction = eviction.result(opts.MaxMemory, scale)
+	}
+	if whatIf != nil {
+		rep.TTLWhatIf = whatIf.result()
+	}
+	if dbAgg != nil {
+		rep.DBs = dbAgg.result()
+	}
+	rep.Slots = slotAgg.result()
+	rep.HashTags = hashTags.result()
+	if len(custom) > 0 {
+		rep.Custom = map[string]any{}
+		for i, ag := range custom {
+			rep.Custom[customNames[i]] = ag.Finalize()
+		}
+	}
+
+	if spill != nil {
+		rep.Meta.Spill = spill.result()
+	}
+	if opts.SampleRate < 1 || opts.MaxKeys > 0 || truncated {
+		rep.Meta.Sampling = &report.Sampling{
+			Rate:        opts.SampleRate,
+			MaxKeys:     opts.MaxKeys,
+			SampledKeys: summary.TotalKeys,
+			Truncated:   truncated,
+			ReadBytes:   read,
+			Scale:       scale,
+		}
+		scaleReport(&rep, scale)
+	}
+	opts.stageDone(StageReport, reportStart, summary.TotalKeys, 0, nil)
+
+	if cancelled {
+		return &rep, ctx.Err()
+	}
+
+	// the drift report is built at full scale, after the scaling above
+	if drift != nil {
+		scanStart := time.Now()
+		dbs, err := drift.scanLive(ctx, opts.LiveAddr, opts.LivePassword, newProgressReporter(opts, StageScan, 0))
+		opts.stageDone(StageScan, scanStart, 0, 0, err)
+		if err != nil {
+			return nil, fmt.Errorf("live scan: %w", err)
+		}
+		rep.Drift = drift.result(opts.LiveAddr, dbs, opts.DriftThreshold, scale)
+	}
+	if growth != nil {
+		rep.Growth = growth.result(summary.TotalKeys, summary.TotalSize, summary.TotalMem, scale)
+	}
+	if opts.Reshard > 0 {
+		rep.Reshard = planReshard(rep.Slots.Keys, rep.Slots.Sizes, rep.Slots.Mems, opts.Reshard)
+	} else if !opts.Slots {
+		// the per-slot arrays are most of a small report; the ranges and
+		// top slots summarize them
+		rep.Slots.Keys, rep.Slots.Sizes, rep.Slots.Mems = nil, nil, nil
+	}
+	if opts.MemoryCheck > 0 {
+		rep.MemoryCheck, err = memoryCheck(ctx, opts.LiveAddr, opts.LivePassword, rep.BigKeys, opts.MemoryCheck)
+		if err != nil {
+			return nil, fmt.Errorf("memory check: %w", err)
+		}
+	}
+	if opts.MigrateTarget != "" {
+		plan := planMigration(rep.BigKeys, opts.MigrateTarget, opts.MigrateKeys, opts.MigrateMethod, opts.MigrateChunk)
+		plan.Script, _ = filepath.Abs(opts.MigrateScript)
+		if err := writeMigrationScript(opts.MigrateScript, source, opts.LiveAddr, opts.MigrateTarget, plan); err != nil {
+			return nil, fmt.Errorf("migration script: %v", err)
+		}
+		rep.Migration = plan
+	}
+	return &rep, nil
+}
+
+type ttlBucket struct {
+	Label string
+	Max   time.Duration
+}
+
+var ttlBuckets = []ttlBucket{
+	{Label: "<=1h", Max: time.Hour},
+	{Label: "1h-1d", Max: 24 * time.Hour},
+	{Label: "1d-7d", Max: 7 * 24 * time.Hour},
+	{Label: "7d-30d", Max: 30 * 24 * time.Hour},
+	{Label: "30d-90d", Max: 90 * 24 * time.Hour},
+	{Label: ">90d", Max: 36500 * 24 * time.Hour},
+}
+
+var sizeBuckets = []struct {
+	Label string
+	Max   int64
+}{
+	{Label: "0-1KB", Max: 1 * 1024},
+	{Label: "1KB-10KB", Max: 10 * 1024},
+	{Label: "10KB-100KB", Max: 100 * 1024},
+	{Label: "100KB-1MB", Max: 1 * 1024 * 1024},
+	{Label: "1MB-10MB", Max: 10 * 1024 * 1024},
+	{Label: "10MB-100MB", Max: 100 * 1024 * 1024},
+	{Label: ">100MB", Max: 1<<63 - 1},
+}
+
+type prefixAgg struct {
+	Count   int64
+	Size    int64
+	Mem     int64
+	WithTTL int64
+	TTL     *ttlHist
+}
+
+type bigKeyHeap []report.BigKey
+
+func (h bigKeyHeap) Len() int           { return len(h) }
+func (h bigKeyHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h bigKeyHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *bigKeyHeap) Push(x interface{}) {
+	*h = append(*h, x.(report.BigKey))
+}
+
+func (h *bigKeyHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+func getSize(o parser.RedisObject) int64 {
+	return int64(o.GetSize())
+}
+
+func newTTLCounts() map[string]int64 {
+	counts := map[string]int64{
+		"no-expire": 0,
+		"expired":   0,
+	}
+	for _, b := range ttlBuckets {
+		counts[b.Label] = 0
+	}
+	return counts
+}
+
+// ttlLabel returns the TTL bucket of a key expiring at expiration.
+func ttlLabel(expiration *time.Time, now time.Time) string {
+	switch {
+	case expiration == nil:
+		return "no-expire"
+	case expiration.Before(now):
+		return "expired"
+	}
+	ttl := expiration.Sub(now)
+	for _, b := range ttlBuckets {
+		if ttl <= b.Max {
+			return b.Label
+		}
+	}
+	return ">90d"
+}
+
+func ttlBucketList(counts map[string]int64) []report.Bucket {
+	list := make([]report.Bucket, 0, len(counts))
+	order := []string{"no-expire", "expired"}
+	for _, b := range ttlBuckets {
+		order = append(order, b.Label)
+	}
+	for _, label := range order {
+		if v, ok := counts[label]; ok {
+			list = append(list, report.Bucket{Label: label, Count: v})
+		}
+	}
+	return list
+}
+
+func getSizeBucket(size int64) string {
+	for _, b := range sizeBuckets {
+		if size <= b.Max {
+			return b.Label
+		}
+	}
+	return ">100MB"
+}
+
+// FormatBytes renders a byte count with a binary unit, e.g. "1.50 MB".
+func FormatBytes(bytes int64) string {
+	if bytes < 0 {
+		return "0 B"
+	}
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	v := float64(bytes)
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if v < 10 && i > 0 {
+		return fmt.Sprintf("%.2f %s", v, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
+
+// ParseBytes parses a byte count with an optional binary unit, e.g. "512MB",
+// "2GB" or "1.5 GiB"; a bare number is bytes.
+func ParseBytes(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.Replace(t, "IB", "B", 1), "B")
+	mult := float64(1)
+	for i, u := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(t, u) {
+			mult = float64(int64(1) << (10 * (i + 1)))
+			t = strings.TrimSuffix(t, u)
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * mult), nil
+}
+
+func getElementCount(o parser.RedisObject) int64 {
+	if s, ok := o.(*parser.StreamObject); ok {
+		return int64(s.Length)
+	}
+	return int64(o.GetElemCount())
+}
+
+func applyPrefixes(agg map[string]prefixAgg, key string, size, mem, ttl int64, sep string, maxDepth int) {
+	if sep == "" || maxDepth <= 0 {
+		return
+	}
+	parts := strings.Split(key, sep)
+	if len(parts) == 0 {
+		return
+	}
+	if len(parts) < maxDepth {
+		maxDepth = len(parts)
+	}
+	for i := 1; i <= maxDepth; i++ {
+		p := strings.Join(parts[:i], sep)
+		if i < len(parts) {
+			p = p + sep
+		}
+		a := agg[p]
+		a.add(size, mem, ttl)
+		agg[p] = a
+	}
+}
+
+func applyPrefixesByType(agg map[string]map[string]prefixAgg, objType, key string, size, mem, ttl int64, sep string, maxDepth int) {
+	if sep == "" || maxDepth <= 0 {
+		return
+	}
+	m, ok := agg[objType]
+	if !ok {
+		m = map[string]prefixAgg{}
+		agg[objType] = m
+	}
+	applyPrefixes(m, key, size, mem, ttl, sep, maxDepth)
+}
+
+func prefixStatList(agg map[string]prefixAgg, topN int) []report.PrefixStat {
+	list := make([]report.PrefixStat, 0, len(agg))
+	for p, a := range agg {
+		st := report.PrefixStat{Prefix: p, Count: a.Count, Size: a.Size, EstimatedMem: a.Mem}
+		if a.Count > 0 {
+			st.TTLShare = float64(a.WithTTL) / float64(a.Count)
+		}
+		if a.TTL != nil {
+			st.MedianTTL = a.TTL.median(a.WithTTL)
+		}
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Size > list[j].Size })
+	if topN > 0 && len(list) > topN {
+		list = list[:topN]
+	}
+	return list
+}
+
+// pushBigKey keeps the topN bigkeys by metric and returns the index bk was
+// stored at, or -1 when it did not make the list.
+func pushBigKey(h *bigKeyHeap, bk report.BigKey, topN int, metric func(report.BigKey) float64) int {
+	if topN <= 0 {
+		return -1
+	}
+	if len(*h) < topN {
+		*h = append(*h, bk)
+		return len(*h) - 1
+	}
+	minIdx := 0
+	for i := 1; i < len(*h); i++ {
+		if metric((*h)[i]) < metric((*h)[minIdx]) {
+			minIdx = i
+		}
+	}
+	if metric(bk) > metric((*h)[minIdx]) {
+		(*h)[minIdx] = bk
+		return minIdx
+	}
+	return -1
+}
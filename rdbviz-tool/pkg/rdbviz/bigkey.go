@@ -0,0 +1,188 @@
+package rdbviz
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// bigKeyMetrics are the -bigkey-sort options: the metric bigkeys are selected
+// and ordered by.
+var bigKeyMetrics = map[string]func(bk report.BigKey) float64{
+	"size":             func(bk report.BigKey) float64 { return float64(bk.Size) },
+	"estimated_mem":    func(bk report.BigKey) float64 { return float64(bk.EstimatedMem) },
+	"elements":         func(bk report.BigKey) float64 { return float64(bk.Elements) },
+	"avg_element_size": func(bk report.BigKey) float64 { return bk.AvgElementSize },
+}
+
+func bigKeyMetric(name string) (func(bk report.BigKey) float64, error) {
+	m, ok := bigKeyMetrics[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown bigkey sort %q (size, estimated_mem, elements, avg_element_size)", name)
+	}
+	return m, nil
+}
+
+func avgElementSize(size, elements int64) float64 {
+	if elements <= 0 {
+		return 0
+	}
+	return float64(size) / float64(elements)
+}
+
+const memberNameMax = 64
+
+// largestMember returns the biggest field/member/entry of a collection, sized
+// as field+value for hashes, member+score for zsets and all fields of a
+// message for streams. Lists name the entry by its index.
+func largestMember(o parser.RedisObject) *report.Member {
+	var name string
+	var best int64 = -1
+	switch obj := o.(type) {
+	case *parser.HashObject:
+		for f, v := range obj.Hash {
+			if n := int64(len(f) + len(v)); n > best {
+				name, best = f, n
+			}
+		}
+	case *parser.SetObject:
+		for _, m := range obj.Members {
+			if n := int64(len(m)); n > best {
+				name, best = string(m), n
+			}
+		}
+	case *parser.ZSetObject:
+		for _, e := range obj.Entries {
+			if n := int64(len(e.Member)) + 8; n > best {
+				name, best = e.Member, n
+			}
+		}
+	case *parser.ListObject:
+		for i, v := range obj.Values {
+			if n := int64(len(v)); n > best {
+				name, best = "#"+strconv.Itoa(i), n
+			}
+		}
+	case *parser.StreamObject:
+		for _, e := range obj.Entries {
+			for _, msg := range e.Msgs {
+				var n int64
+				for f, v := range msg.Fields {
+					n += int64(len(f) + len(v))
+				}
+				if n > best {
+					id, _ := msg.Id.MarshalText()
+					name, best = string(id), n
+				}
+			}
+		}
+	default:
+		return nil
+	}
+	if best < 0 {
+		return nil
+	}
+	return &report.Member{Name: truncateName(name), Size: best}
+}
+
+func truncateName(s string) string {
+	if len(s) <= memberNameMax {
+		return s
+	}
+	return s[:memberNameMax] + "..."
+}
+
+// Scores in [2000-01-01, 2100-01-01) are taken as Unix timestamps.
+const (
+	minTimestamp = 946684800
+	maxTimestamp = 4102444800
+)
+
+func scoreStats(o parser.RedisObject) *report.ScoreStat {
+	z, ok := o.(*parser.ZSetObject)
+	if !ok || len(z.Entries) == 0 {
+		return nil
+	}
+	st := &report.ScoreStat{Min: math.Inf(1), Max: math.Inf(-1)}
+	sum := 0.0
+	for _, e := range z.Entries {
+		st.Min = math.Min(st.Min, e.Score)
+		st.Max = math.Max(st.Max, e.Score)
+		sum += e.Score
+	}
+	st.Mean = sum / float64(len(z.Entries))
+	switch {
+	case st.Min >= minTimestamp && st.Max < maxTimestamp:
+		st.Timestamp = "s"
+	case st.Min >= minTimestamp*1000 && st.Max < maxTimestamp*1000:
+		st.Timestamp = "ms"
+	}
+	return st
+}
+
+// typeBigKeys keeps a separate bigkey list per type, so one type with many
+// large keys cannot crowd every other type out of the global list.
+type typeBigKeys struct {
+	topN   int
+	metric func(report.BigKey) float64
+	types  map[string]bigKeyHeap
+}
+
+func newTypeBigKeys(topN int, metric func(report.BigKey) float64) *typeBigKeys {
+	return &typeBigKeys{topN: topN, metric: metric, types: map[string]bigKeyHeap{}}
+}
+
+func (tb *typeBigKeys) observe(o parser.RedisObject, bk report.BigKey) {
+	h := tb.types[bk.Type]
+	if i := pushBigKey(&h, bk, tb.topN, tb.metric); i >= 0 {
+		h[i].LargestMember = largestMember(o)
+		h[i].Scores = scoreStats(o)
+	}
+	tb.types[bk.Type] = h
+}
+
+func (tb *typeBigKeys) result() []report.TypeBigKeys {
+	list := make([]report.TypeBigKeys, 0, len(tb.types))
+	for t, h := range tb.types {
+		sort.Slice(h, func(i, j int) bool { return tb.metric(h[i]) > tb.metric(h[j]) })
+		list = append(list, report.TypeBigKeys{Type: t, BigKeys: h})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Type < list[j].Type })
+	return list
+}
+
+// dbBigKeys keeps a separate bigkey list per DB, for instances where each DB
+// belongs to a different tenant.
+type dbBigKeys struct {
+	topN   int
+	metric func(report.BigKey) float64
+	dbs    map[int]bigKeyHeap
+}
+
+func newDBBigKeys(topN int, metric func(report.BigKey) float64) *dbBigKeys {
+	return &dbBigKeys{topN: topN, metric: metric, dbs: map[int]bigKeyHeap{}}
+}
+
+func (bd *dbBigKeys) observe(o parser.RedisObject, bk report.BigKey) {
+	h := bd.dbs[bk.DB]
+	if i := pushBigKey(&h, bk, bd.topN, bd.metric); i >= 0 {
+		h[i].LargestMember = largestMember(o)
+		h[i].Scores = scoreStats(o)
+	}
+	bd.dbs[bk.DB] = h
+}
+
+func (bd *dbBigKeys) result() []report.DBBigKeys {
+	list := make([]report.DBBigKeys, 0, len(bd.dbs))
+	for d, h := range bd.dbs {
+		sort.Slice(h, func(i, j int) bool { return bd.metric(h[i]) > bd.metric(h[j]) })
+		list = append(list, report.DBBigKeys{DB: d, BigKeys: h})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DB < list[j].DB })
+	return list
+}
@@ -0,0 +1,142 @@
+package rdbviz
+
+import (
+	"math/bits"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/report"
+)
+
+const (
+	bitmapMinSize = 8
+	// bitmapMinZeros is the share of zero bytes above which a binary value is
+	// taken for a bitmap: SETBIT leaves every untouched byte zeroed.
+	bitmapMinZeros = 0.25
+	// bitmapMaxPrintable caps the share of printable ASCII among the non-zero
+	// bytes; random bits make about 37% of bytes printable.
+	bitmapMaxPrintable = 0.6
+)
+
+// bitmapHints are key name segments commonly used for SETBIT/BITFIELD keys.
+var bitmapHints = []string{"bitmap", "bitset", "bits", "bloom", "bf", "online", "active", "dau", "signin", "checkin"}
+
+// looksLikeBitmap tells bitmaps from other binary strings: the value must not
+// be text or a known serialization format, and either be mostly zero bytes
+// with few printable ones or live under a bitmap-sounding key.
+func looksLikeBitmap(key string, v []byte) bool {
+	if len(v) < bitmapMinSize {
+		return false
+	}
+	switch fingerprint(v) {
+	case formatBinary, formatProtobuf, formatMsgpack:
+	default:
+		return false
+	}
+	zeros, printable := 0, 0
+	for _, c := range v {
+		switch {
+		case c == 0:
+			zeros++
+		case c >= 0x20 && c < 0x7f:
+			printable++
+		}
+	}
+	// text padded with NULs is mostly printable where it is not zero
+	if float64(zeros)/float64(len(v)) >= bitmapMinZeros && float64(printable) <= bitmapMaxPrintable*float64(len(v)-zeros) {
+		return true
+	}
+	segments := strings.FieldsFunc(strings.ToLower(key), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, seg := range segments {
+		for _, h := range bitmapHints {
+			if seg == h {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bitmapOffsets returns the number of set bits and the highest set bit
+// offset as GETBIT numbers them (bit 0 is the most significant bit of the
+// first byte), or -1 when no bit is set.
+func bitmapOffsets(v []byte) (int64, int64) {
+	var set int64
+	max := int64(-1)
+	for i, c := range v {
+		if c == 0 {
+			continue
+		}
+		set += int64(bits.OnesCount8(c))
+		max = int64(i)*8 + int64(7-bits.TrailingZeros8(c))
+	}
+	return set, max
+}
+
+// bitmapStats collects string keys that look like bitmaps.
+type bitmapStats struct {
+	topN int
+	r    report.BitmapReport
+}
+
+func newBitmapStats(topN int) *bitmapStats {
+	return &bitmapStats{topN: topN, r: report.BitmapReport{MaxBitOffset: -1, Keys: []report.BitmapKey{}}}
+}
+
+func (bs *bitmapStats) observe(o parser.RedisObject, mem int64) {
+	s, ok := o.(*parser.StringObject)
+	if !ok || !looksLikeBitmap(s.Key, s.Value) {
+		return
+	}
+	set, max := bitmapOffsets(s.Value)
+	k := report.BitmapKey{
+		DB:           s.GetDBIndex(),
+		Key:          s.Key,
+		Size:         int64(len(s.Value)),
+		EstimatedMem: mem,
+		SetBits:      set,
+		MaxBitOffset: max,
+		Density:      float64(set) / float64(len(s.Value)*8),
+	}
+	bs.r.Count++
+	bs.r.Size += k.Size
+	bs.r.EstimatedMem += mem
+	bs.r.SetBits += set
+	if max > bs.r.MaxBitOffset {
+		bs.r.MaxBitOffset = max
+	}
+	bs.push(k)
+}
+
+func (bs *bitmapStats) push(k report.BitmapKey) {
+	if bs.topN <= 0 {
+		return
+	}
+	if len(bs.r.Keys) < bs.topN {
+		bs.r.Keys = append(bs.r.Keys, k)
+		return
+	}
+	minIdx := 0
+	for i := 1; i < len(bs.r.Keys); i++ {
+		if bs.r.Keys[i].Size < bs.r.Keys[minIdx].Size {
+			minIdx = i
+		}
+	}
+	if k.Size > bs.r.Keys[minIdx].Size {
+		bs.r.Keys[minIdx] = k
+	}
+}
+
+func (bs *bitmapStats) result() *report.BitmapReport {
+	if bs.r.Count == 0 {
+		return nil
+	}
+	r := bs.r
+	sort.Slice(r.Keys, func(i, j int) bool { return r.Keys[i].Size > r.Keys[j].Size })
+	return &r
+}
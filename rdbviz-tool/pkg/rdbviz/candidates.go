@@ -0,0 +1,248 @@
+package rdbviz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// Remediation actions suggested for a candidate key.
+const (
+	actionDelete = "delete"
+	actionExpire = "expire"
+	actionEvict  = "evict"
+	actionKeep   = "keep"
+)
+
+const (
+	// candidateDeleteIdle is the idle time, in seconds, past which a key is
+	// suggested for deletion rather than a TTL.
+	candidateDeleteIdle = 30 * 24 * 3600
+	// candidateMinIdle excludes keys used within the last hour.
+	candidateMinIdle = 3600
+)
+
+// CandidatePolicy is a prefix rule from -candidate-policy: keys matching
+// Pattern are always (evict, expire, delete) or never (keep) candidates.
+type CandidatePolicy struct {
+	Pattern string
+	Action  string
+}
+
+// CandidatePolicies is the repeatable -candidate-policy flag.
+type CandidatePolicies []CandidatePolicy
+
+func (p *CandidatePolicies) String() string {
+	parts := make([]string, len(*p))
+	for i, rule := range *p {
+		parts[i] = rule.Pattern + "=" + rule.Action
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p *CandidatePolicies) Set(s string) error {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected pattern=action, got %q", s)
+	}
+	switch action := s[i+1:]; action {
+	case actionDelete, actionExpire, actionEvict, actionKeep:
+		*p = append(*p, CandidatePolicy{Pattern: s[:i], Action: action})
+		return nil
+	}
+	return fmt.Errorf("action must be delete, expire, evict or keep, got %q", s[i+1:])
+}
+
+type candidateAction struct {
+	keys int64
+	size int64
+	mem  int64
+}
+
+// candidateStats ranks keys for eviction or remediation by the memory they
+// would free, weighted up for missing TTLs, long idle times and policy
+// matches and down for LFU hits, in the spirit of MEMORY DOCTOR.
+type candidateStats struct {
+	minSize    int64
+	policies   CandidatePolicies
+	sep        string
+	topN       int
+	sawIdle    bool
+	sawFreq    bool
+	count      int64
+	actions    map[string]*candidateAction
+	namespaces map[string]*report.CandidatePrefix
+	keys       []report.Candidate
+}
+
+func newCandidateStats(minSize int64, policies CandidatePolicies, sep string, topN int) *candidateStats {
+	return &candidateStats{
+		minSize:    minSize,
+		policies:   policies,
+		sep:        sep,
+		topN:       topN,
+		actions:    map[string]*candidateAction{},
+		namespaces: map[string]*report.CandidatePrefix{},
+	}
+}
+
+func (cs *candidateStats) observe(db int, key, objType string, size, mem, ttl, idle, freq int64) {
+	if idle != unknownAccess {
+		cs.sawIdle = true
+	}
+	if freq != unknownAccess {
+		cs.sawFreq = true
+	}
+	policy := ""
+	for _, p := range cs.policies {
+		if GlobMatch(p.Pattern, key) {
+			policy = p.Action
+			break
+		}
+	}
+	action, score, reasons := candidateScore(size, mem, cs.minSize, ttl != noTTL, idle, freq, policy)
+	if action == "" {
+		return
+	}
+	cs.count++
+	a := cs.actions[action]
+	if a == nil {
+		a = &candidateAction{}
+		cs.actions[action] = a
+	}
+	a.keys++
+	a.size += size
+	a.mem += mem
+	ns := namespaceOf(key, cs.sep)
+	n := cs.namespaces[ns]
+	if n == nil {
+		if len(cs.namespaces) >= maxEvictNamespaces {
+			ns = otherPrefix
+			n = cs.namespaces[ns]
+		}
+		if n == nil {
+			n = &report.CandidatePrefix{Prefix: ns}
+			cs.namespaces[ns] = n
+		}
+	}
+	n.Keys++
+	n.Size += size
+	n.EstimatedMem += mem
+
+	c := report.Candidate{DB: db, Key: key, Type: objType, Size: size, EstimatedMem: mem, HasTTL: ttl != noTTL, Action: action, Score: score, Reasons: reasons}
+	if idle != unknownAccess {
+		c.Idle = idle
+	}
+	if freq != unknownAccess {
+		c.Freq = freq
+	}
+	cs.push(c)
+}
+
+// candidateScore decides whether a key is a candidate and what to do with it.
+// Without a policy, a key qualifies when it is at least minSize without a TTL,
+// or idle for over a week; keys used within the last hour never qualify.
+func candidateScore(size, mem, minSize int64, hasTTL bool, idle, freq int64, policy string) (string, float64, []string) {
+	if policy == actionKeep {
+		return "", 0, nil
+	}
+	var reasons []string
+	score := float64(mem)
+	if policy != "" {
+		reasons = append(reasons, "policy")
+		score *= 4
+	}
+	large := size >= minSize
+	if large {
+		reasons = append(reasons, "large")
+	}
+	if !hasTTL {
+		reasons = append(reasons, "no-ttl")
+		score *= 2
+	}
+	if idle != unknownAccess {
+		if idle < candidateMinIdle && policy == "" {
+			return "", 0, nil
+		}
+		if idle >= offloadMinIdle {
+			reasons = append(reasons, "idle")
+		}
+		score *= 1 + float64(idle)/float64(24*3600)
+	}
+	if freq != unknownAccess {
+		if freq <= offloadMaxFreq {
+			reasons = append(reasons, "rarely-accessed")
+		}
+		score /= float64(1 + freq)
+	}
+	switch {
+	case policy != "":
+		return policy, score, reasons
+	case idle >= candidateDeleteIdle:
+		return actionDelete, score, reasons
+	case idle >= offloadMinIdle:
+		if hasTTL {
+			return actionEvict, score, reasons
+		}
+		return actionExpire, score, reasons
+	case large && !hasTTL:
+		return actionExpire, score, reasons
+	}
+	return "", 0, nil
+}
+
+func (cs *candidateStats) push(c report.Candidate) {
+	if cs.topN <= 0 {
+		return
+	}
+	if len(cs.keys) < cs.topN {
+		cs.keys = append(cs.keys, c)
+		return
+	}
+	minIdx := 0
+	for i := 1; i < len(cs.keys); i++ {
+		if cs.keys[i].Score < cs.keys[minIdx].Score {
+			minIdx = i
+		}
+	}
+	if c.Score > cs.keys[minIdx].Score {
+		cs.keys[minIdx] = c
+	}
+}
+
+func (cs *candidateStats) result() *report.CandidateReport {
+	r := &report.CandidateReport{
+		Signals:       []string{"size", "ttl"},
+		MinSize:       cs.minSize,
+		CandidateKeys: cs.count,
+		Actions:       []report.CandidateAction{},
+		Prefixes:      []report.CandidatePrefix{},
+		Keys:          append([]report.Candidate{}, cs.keys...),
+	}
+	if cs.sawIdle {
+		r.Signals = append(r.Signals, "idle")
+	}
+	if cs.sawFreq {
+		r.Signals = append(r.Signals, "freq")
+	}
+	for _, p := range cs.policies {
+		r.Policies = append(r.Policies, p.Pattern+"="+p.Action)
+	}
+	for action, a := range cs.actions {
+		r.Actions = append(r.Actions, report.CandidateAction{Action: action, Keys: a.keys, Size: a.size, EstimatedMem: a.mem})
+		r.Size += a.size
+		r.EstimatedMem += a.mem
+	}
+	sort.Slice(r.Actions, func(i, j int) bool { return r.Actions[i].EstimatedMem > r.Actions[j].EstimatedMem })
+	for _, n := range cs.namespaces {
+		r.Prefixes = append(r.Prefixes, *n)
+	}
+	sort.Slice(r.Prefixes, func(i, j int) bool { return r.Prefixes[i].EstimatedMem > r.Prefixes[j].EstimatedMem })
+	if cs.topN > 0 && len(r.Prefixes) > cs.topN {
+		r.Prefixes = r.Prefixes[:cs.topN]
+	}
+	sort.Slice(r.Keys, func(i, j int) bool { return r.Keys[i].Score > r.Keys[j].Score })
+	return r
+}
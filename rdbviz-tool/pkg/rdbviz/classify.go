@@ -0,0 +1,237 @@
+package rdbviz
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// unclassifiedGroup is where keys the classifier put in no group are listed.
+const unclassifiedGroup = "__unclassified__"
+
+// Classification is what a Classifier says about a key. An empty Group
+// leaves the key unclassified.
+type Classification struct {
+	Group  string
+	Owner  string
+	Labels map[string]string
+}
+
+// Classifier assigns keys to logical groups where separators are not
+// enough: regex rules, lookup tables or a service registry. Classify is
+// called once per analyzed key, from several goroutines at once when
+// Options.Workers is above 1.
+type Classifier interface {
+	Classify(db int, key string) Classification
+}
+
+// ClassifierFunc adapts a function to Classifier.
+type ClassifierFunc func(db int, key string) Classification
+
+// Classify calls f.
+func (f ClassifierFunc) Classify(db int, key string) Classification {
+	return f(db, key)
+}
+
+// ClassRule assigns the keys matching a glob to a group.
+type ClassRule struct {
+	Pattern string
+	Class   Classification
+}
+
+// RuleClassifier classifies a key by the first rule whose pattern it
+// matches.
+type RuleClassifier struct {
+	Source string
+	Rules  []ClassRule
+}
+
+// Classify returns the class of the first matching rule.
+func (rc *RuleClassifier) Classify(db int, key string) Classification {
+	for _, r := range rc.Rules {
+		if GlobMatch(r.Pattern, key) {
+			return r.Class
+		}
+	}
+	return Classification{}
+}
+
+// LoadClassRules reads a rule file, one rule per line:
+//
+//	pattern group [owner] [label=value ...]
+//
+// An owner of - leaves it empty. Blank lines and lines starting with # are
+// skipped.
+func LoadClassRules(path string) (*RuleClassifier, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rc := &RuleClassifier{Source: path}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: want pattern group [owner] [label=value ...]", path, n)
+		}
+		r := ClassRule{Pattern: fields[0], Class: Classification{Group: fields[1]}}
+		rest := fields[2:]
+		if len(rest) > 0 && !strings.Contains(rest[0], "=") {
+			if rest[0] != "-" {
+				r.Class.Owner = rest[0]
+			}
+			rest = rest[1:]
+		}
+		for _, kv := range rest {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok || k == "" {
+				return nil, fmt.Errorf("%s:%d: bad label %q, want label=value", path, n, kv)
+			}
+			if r.Class.Labels == nil {
+				r.Class.Labels = map[string]string{}
+			}
+			r.Class.Labels[k] = v
+		}
+		rc.Rules = append(rc.Rules, r)
+	}
+	return rc, sc.Err()
+}
+
+type classAgg struct {
+	owner string
+	keys  int64
+	size  int64
+	mem   int64
+}
+
+func (a *classAgg) add(k KeyRecord) {
+	a.keys++
+	a.size += k.Size
+	a.mem += k.EstimatedMem
+}
+
+// classStats sums the keys per class group, owner and label value.
+type classStats struct {
+	source       string
+	topN         int
+	totalMem     int64
+	unclassified classAgg
+	groups       map[string]*classAgg
+	labels       map[[2]string]*classAgg
+}
+
+func newClassStats(c Classifier, topN int) *classStats {
+	cs := &classStats{topN: topN, groups: map[string]*classAgg{}, labels: map[[2]string]*classAgg{}}
+	if rc, ok := c.(*RuleClassifier); ok {
+		cs.source = rc.Source
+	}
+	return cs
+}
+
+func (cs *classStats) Observe(k KeyRecord) {
+	cs.totalMem += k.EstimatedMem
+	if k.Class.Group == "" {
+		cs.unclassified.add(k)
+		return
+	}
+	g := cs.groups[k.Class.Group]
+	if g == nil {
+		name := k.Class.Group
+		if len(cs.groups) >= maxEvictNamespaces {
+			name = otherPrefix
+			g = cs.groups[name]
+		}
+		if g == nil {
+			g = &classAgg{}
+			if name != otherPrefix {
+				g.owner = k.Class.Owner
+			}
+			cs.groups[name] = g
+		}
+	}
+	g.add(k)
+	for label, value := range k.Class.Labels {
+		lk := [2]string{label, value}
+		l := cs.labels[lk]
+		if l == nil {
+			if len(cs.labels) >= maxEvictNamespaces {
+				lk = [2]string{label, otherPrefix}
+				l = cs.labels[lk]
+			}
+			if l == nil {
+				l = &classAgg{}
+				cs.labels[lk] = l
+			}
+		}
+		l.add(k)
+	}
+}
+
+func (cs *classStats) Finalize() any { return cs.result() }
+
+func (cs *classStats) result() *report.ClassReport {
+	r := &report.ClassReport{
+		Classifier:       cs.source,
+		UnclassifiedKeys: cs.unclassified.keys,
+		UnclassifiedSize: cs.unclassified.size,
+		UnclassifiedMem:  cs.unclassified.mem,
+		Groups:           []report.ClassGroup{},
+	}
+	owners := map[string]*report.ClassOwner{}
+	for name, g := range cs.groups {
+		r.Groups = append(r.Groups, report.ClassGroup{
+			Group: name, Owner: g.owner, Keys: g.keys, Size: g.size, EstimatedMem: g.mem, Share: ratio(g.mem, cs.totalMem),
+		})
+		if g.owner == "" {
+			continue
+		}
+		o := owners[g.owner]
+		if o == nil {
+			o = &report.ClassOwner{Owner: g.owner}
+			owners[g.owner] = o
+		}
+		o.Groups++
+		o.Keys += g.keys
+		o.Size += g.size
+		o.EstimatedMem += g.mem
+	}
+	if cs.unclassified.keys > 0 {
+		u := cs.unclassified
+		r.Groups = append(r.Groups, report.ClassGroup{
+			Group: unclassifiedGroup, Keys: u.keys, Size: u.size, EstimatedMem: u.mem, Share: ratio(u.mem, cs.totalMem),
+		})
+	}
+	sort.Slice(r.Groups, func(i, j int) bool { return r.Groups[i].EstimatedMem > r.Groups[j].EstimatedMem })
+	if cs.topN > 0 && len(r.Groups) > cs.topN {
+		r.Groups = r.Groups[:cs.topN]
+	}
+
+	for _, o := range owners {
+		o.Share = ratio(o.EstimatedMem, cs.totalMem)
+		r.Owners = append(r.Owners, *o)
+	}
+	sort.Slice(r.Owners, func(i, j int) bool { return r.Owners[i].EstimatedMem > r.Owners[j].EstimatedMem })
+
+	for lk, l := range cs.labels {
+		r.Labels = append(r.Labels, report.ClassLabel{Label: lk[0], Value: lk[1], Keys: l.keys, Size: l.size, EstimatedMem: l.mem})
+	}
+	sort.Slice(r.Labels, func(i, j int) bool {
+		if r.Labels[i].Label != r.Labels[j].Label {
+			return r.Labels[i].Label < r.Labels[j].Label
+		}
+		return r.Labels[i].EstimatedMem > r.Labels[j].EstimatedMem
+	})
+	if cs.topN > 0 && len(r.Labels) > cs.topN {
+		r.Labels = r.Labels[:cs.topN]
+	}
+	return r
+}
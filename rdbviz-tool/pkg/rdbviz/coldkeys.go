@@ -0,0 +1,118 @@
+package rdbviz
+
+import (
+	"sort"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// maxColdNamespaces bounds the per-namespace buckets; keys without
+// separators would otherwise get one each.
+const maxColdNamespaces = 10000
+
+// coldThresholds are the idle times, in seconds, reported as cold.
+var coldThresholds = []struct {
+	Label string
+	Min   int64
+}{
+	{">1d", 24 * 3600},
+	{">7d", 7 * 24 * 3600},
+	{">30d", 30 * 24 * 3600},
+}
+
+type coldAgg struct {
+	count   int64
+	size    int64
+	mem     int64
+	buckets [3]expiryAgg
+}
+
+func (a *coldAgg) add(idle, size, mem int64) {
+	a.count++
+	a.size += size
+	a.mem += mem
+	for i, t := range coldThresholds {
+		if idle > t.Min {
+			a.buckets[i].add(size, mem)
+		}
+	}
+}
+
+func (a *coldAgg) result() []report.ColdBucket {
+	list := make([]report.ColdBucket, len(coldThresholds))
+	for i, t := range coldThresholds {
+		list[i] = report.ColdBucket{
+			Label:        t.Label,
+			MinIdle:      t.Min,
+			Count:        a.buckets[i].count,
+			Size:         a.buckets[i].size,
+			EstimatedMem: a.buckets[i].mem,
+		}
+	}
+	return list
+}
+
+// coldKeys buckets keys by LRU idle time, overall and per first-level
+// namespace.
+type coldKeys struct {
+	sep        string
+	topN       int
+	all        coldAgg
+	namespaces map[string]*coldAgg
+}
+
+func newColdKeys(sep string, topN int) *coldKeys {
+	return &coldKeys{sep: sep, topN: topN, namespaces: map[string]*coldAgg{}}
+}
+
+func (ck *coldKeys) observe(key string, idle, size, mem int64) {
+	if idle == unknownAccess {
+		return
+	}
+	ck.all.add(idle, size, mem)
+	ns := namespaceOf(key, ck.sep)
+	a := ck.namespaces[ns]
+	if a == nil {
+		if len(ck.namespaces) >= maxColdNamespaces {
+			ns = otherPrefix
+			a = ck.namespaces[ns]
+		}
+		if a == nil {
+			a = &coldAgg{}
+			ck.namespaces[ns] = a
+		}
+	}
+	a.add(idle, size, mem)
+}
+
+// result returns nil when no key carried an idle time. Prefixes are ranked by
+// bytes idle for more than a day.
+func (ck *coldKeys) result() *report.ColdKeyReport {
+	if ck.all.count == 0 {
+		return nil
+	}
+	r := &report.ColdKeyReport{
+		KeysWithIdle: ck.all.count,
+		Size:         ck.all.size,
+		EstimatedMem: ck.all.mem,
+		Buckets:      ck.all.result(),
+		Prefixes:     make([]report.ColdPrefix, 0, len(ck.namespaces)),
+	}
+	for p, a := range ck.namespaces {
+		if a.buckets[0].count == 0 {
+			continue
+		}
+		r.Prefixes = append(r.Prefixes, report.ColdPrefix{
+			Prefix:       p,
+			Count:        a.count,
+			Size:         a.size,
+			EstimatedMem: a.mem,
+			Buckets:      a.result(),
+		})
+	}
+	sort.Slice(r.Prefixes, func(i, j int) bool { return r.Prefixes[i].Buckets[0].Size > r.Prefixes[j].Buckets[0].Size })
+	if ck.topN > 0 && len(r.Prefixes) > ck.topN {
+		r.Prefixes = r.Prefixes[:ck.topN]
+	}
+	return r
+}
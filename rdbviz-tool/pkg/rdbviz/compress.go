@@ -0,0 +1,148 @@
+package rdbviz
+
+import (
+	"compress/gzip"
+	"fmt"
+	"sort"
+
+	"github.com/hdt3213/rdb/parser"
+	"github.com/klauspost/compress/zstd"
+
+	"rdbviz-tool/pkg/report"
+)
+
+const (
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+)
+
+// compressMinSize skips values too small for client-side compression to pay
+// off.
+const compressMinSize = 64
+
+// maxCompressNamespaces bounds the per-namespace totals, which count every
+// string, sampled or not; further namespaces are counted under __other__.
+const maxCompressNamespaces = 10000
+
+type countWriter struct{ n int64 }
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+type compressAgg struct {
+	sampled    int64
+	raw        int64
+	compressed int64
+	stringSize int64
+}
+
+// compressStats compresses a sample of string values and extrapolates the
+// per-namespace ratio to all string bytes of that namespace.
+type compressStats struct {
+	algo     string
+	rate     float64
+	sep      string
+	topN     int
+	gz       *gzip.Writer
+	zs       *zstd.Encoder
+	buf      []byte
+	prefixes map[string]*compressAgg
+}
+
+func newCompressStats(algo string, rate float64, sep string, topN int) (*compressStats, error) {
+	cs := &compressStats{algo: algo, rate: rate, sep: sep, topN: topN, prefixes: map[string]*compressAgg{}}
+	switch algo {
+	case compressGzip:
+		cs.gz = gzip.NewWriter(nil)
+	case compressZstd:
+		zs, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		cs.zs = zs
+	default:
+		return nil, fmt.Errorf("unknown compression %q (gzip, zstd)", algo)
+	}
+	return cs, nil
+}
+
+func (cs *compressStats) observe(o parser.RedisObject) {
+	s, ok := o.(*parser.StringObject)
+	if !ok || len(s.Value) < compressMinSize {
+		return
+	}
+	ns := namespaceOf(s.Key, cs.sep)
+	a := cs.prefixes[ns]
+	if a == nil {
+		if len(cs.prefixes) >= maxCompressNamespaces {
+			ns = otherPrefix
+			a = cs.prefixes[ns]
+		}
+		if a == nil {
+			a = &compressAgg{}
+			cs.prefixes[ns] = a
+		}
+	}
+	a.stringSize += int64(len(s.Value))
+	if !sampleKey(s.Key, cs.rate) {
+		return
+	}
+	a.sampled++
+	a.raw += int64(len(s.Value))
+	a.compressed += cs.compressedSize(s.Value)
+}
+
+func (cs *compressStats) compressedSize(v []byte) int64 {
+	if cs.zs != nil {
+		cs.buf = cs.zs.EncodeAll(v, cs.buf[:0])
+		return int64(len(cs.buf))
+	}
+	w := &countWriter{}
+	cs.gz.Reset(w)
+	cs.gz.Write(v)
+	cs.gz.Close()
+	return w.n
+}
+
+func (cs *compressStats) result() *report.CompressionReport {
+	r := &report.CompressionReport{
+		Algorithm:  cs.algo,
+		SampleRate: cs.rate,
+		MinSize:    compressMinSize,
+		Prefixes:   []report.CompressionStat{},
+	}
+	var raw, compressed int64
+	for p, a := range cs.prefixes {
+		if a.sampled == 0 {
+			continue
+		}
+		ratio := float64(a.compressed) / float64(a.raw)
+		st := report.CompressionStat{
+			Prefix:           p,
+			Sampled:          a.sampled,
+			SampledSize:      a.raw,
+			CompressedSize:   a.compressed,
+			Ratio:            ratio,
+			StringSize:       a.stringSize,
+			EstimatedSavings: int64(float64(a.stringSize) * (1 - ratio)),
+		}
+		if st.EstimatedSavings < 0 {
+			st.EstimatedSavings = 0
+		}
+		r.Sampled += a.sampled
+		r.EstimatedSavings += st.EstimatedSavings
+		raw += a.raw
+		compressed += a.compressed
+		r.Prefixes = append(r.Prefixes, st)
+	}
+	if raw > 0 {
+		r.Ratio = float64(compressed) / float64(raw)
+	}
+	sort.Slice(r.Prefixes, func(i, j int) bool { return r.Prefixes[i].EstimatedSavings > r.Prefixes[j].EstimatedSavings })
+	if cs.topN > 0 && len(r.Prefixes) > cs.topN {
+		r.Prefixes = r.Prefixes[:cs.topN]
+	}
+	return r
+}
@@ -0,0 +1,97 @@
+package rdbviz
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// crossDBMaxDB is the highest DB index tracked; DBs are kept as a bitmask.
+const crossDBMaxDB = 63
+
+type crossDBSeen struct {
+	dbs  uint64
+	size int64
+	mem  int64
+}
+
+// crossDBStats finds key names present in more than one logical DB. Names
+// are sampled by hash, so a tracked name is seen in every DB.
+type crossDBStats struct {
+	rate  float64
+	topN  int
+	seen  map[uint64]crossDBSeen
+	names map[uint64]string
+}
+
+func newCrossDBStats(rate float64, topN int) *crossDBStats {
+	return &crossDBStats{rate: rate, topN: topN, seen: map[uint64]crossDBSeen{}, names: map[uint64]string{}}
+}
+
+func (cs *crossDBStats) observe(db int, key string, size, mem int64) {
+	if db < 0 || db > crossDBMaxDB {
+		return
+	}
+	h := hashString(key)
+	if cs.rate < 1 && float64(h) >= cs.rate*math.MaxUint64 {
+		return
+	}
+	s := cs.seen[h]
+	s.dbs |= 1 << uint(db)
+	s.size += size
+	s.mem += mem
+	cs.seen[h] = s
+	if _, ok := cs.names[h]; !ok && bits.OnesCount64(s.dbs) == 2 {
+		cs.names[h] = key
+	}
+}
+
+func (cs *crossDBStats) result() *report.CrossDBReport {
+	r := &report.CrossDBReport{SampleRate: cs.rate, Keys: []report.CrossDBKey{}, Pairs: []report.DBPair{}}
+	pairs := map[[2]int]*report.DBPair{}
+	for h, key := range cs.names {
+		s := cs.seen[h]
+		dbs := make([]int, 0, bits.OnesCount64(s.dbs))
+		for m := s.dbs; m != 0; m &= m - 1 {
+			dbs = append(dbs, bits.TrailingZeros64(m))
+		}
+		r.OverlapKeys++
+		r.Copies += int64(len(dbs))
+		r.CombinedSize += s.size
+		r.CombinedMem += s.mem
+		r.Keys = append(r.Keys, report.CrossDBKey{Key: key, DBs: dbs, Size: s.size, EstimatedMem: s.mem})
+		for i := range dbs {
+			for j := i + 1; j < len(dbs); j++ {
+				p := pairs[[2]int{dbs[i], dbs[j]}]
+				if p == nil {
+					p = &report.DBPair{A: dbs[i], B: dbs[j]}
+					pairs[[2]int{dbs[i], dbs[j]}] = p
+				}
+				p.Keys++
+				p.Size += s.size
+			}
+		}
+	}
+	for _, p := range pairs {
+		r.Pairs = append(r.Pairs, *p)
+	}
+	if cs.rate < 1 {
+		// only a hash-chosen share of key names was tracked
+		r.OverlapKeys = scaleCount(r.OverlapKeys, 1/cs.rate)
+		r.Copies = scaleCount(r.Copies, 1/cs.rate)
+		r.CombinedSize = scaleCount(r.CombinedSize, 1/cs.rate)
+		r.CombinedMem = scaleCount(r.CombinedMem, 1/cs.rate)
+		for i := range r.Pairs {
+			r.Pairs[i].Keys = scaleCount(r.Pairs[i].Keys, 1/cs.rate)
+			r.Pairs[i].Size = scaleCount(r.Pairs[i].Size, 1/cs.rate)
+		}
+	}
+	sort.Slice(r.Pairs, func(i, j int) bool { return r.Pairs[i].Keys > r.Pairs[j].Keys })
+	sort.Slice(r.Keys, func(i, j int) bool { return r.Keys[i].Size > r.Keys[j].Size })
+	if cs.topN > 0 && len(r.Keys) > cs.topN {
+		r.Keys = r.Keys[:cs.topN]
+	}
+	return r
+}
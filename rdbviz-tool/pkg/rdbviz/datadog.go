@@ -0,0 +1,166 @@
+package rdbviz
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// datadogBatch is the number of series submitted per request, well under
+// the intake's payload limit.
+const datadogBatch = 1000
+
+// DatadogWriter submits a report to Datadog through its HTTP API: the
+// series of MetricsWriter as gauges named "rdbviz.keys",
+// "rdbviz.type.estimated_memory_bytes" and so on, tagged by instance,
+// shard, DB, type and prefix, and an "analysis complete" event with the
+// summary and the largest prefixes.
+type DatadogWriter struct {
+	APIKey string
+	// Site is the Datadog site, e.g. "datadoghq.eu"; empty for
+	// "datadoghq.com". A URL, e.g. of a proxy, is the API base as is.
+	Site string
+	// Tags are added to every gauge and to the event, e.g. "env:prod".
+	Tags []string
+	// Client sends the requests; nil for one with a 30s timeout.
+	Client *http.Client
+}
+
+type datadogSeries struct {
+	Metric string         `json:"metric"`
+	Type   int            `json:"type"`
+	Points []datadogPoint `json:"points"`
+	Tags   []string       `json:"tags,omitempty"`
+}
+
+type datadogPoint struct {
+	Timestamp int64 `json:"timestamp"`
+	Value     int64 `json:"value"`
+}
+
+type datadogEvent struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	AlertType      string   `json:"alert_type"`
+	AggregationKey string   `json:"aggregation_key,omitempty"`
+	DateHappened   int64    `json:"date_happened"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// datadogGauge is the type of a gauge in the v2 series API.
+const datadogGauge = 3
+
+// WriteReport submits the gauges of rep, then the event.
+func (w DatadogWriter) WriteReport(rep *Report) error {
+	if w.APIKey == "" {
+		return errors.New("datadog: no API key")
+	}
+	now := time.Now().Unix()
+	tags := w.tags(rep)
+	var series []datadogSeries
+	reportGauges(rep, func(name string, v int64, group, value string) {
+		st := tags
+		if group != "" {
+			st = append(tags[:len(tags):len(tags)], group+":"+value)
+			name = group + "." + name
+		}
+		series = append(series, datadogSeries{
+			Metric: "rdbviz." + name,
+			Type:   datadogGauge,
+			Points: []datadogPoint{{Timestamp: now, Value: v}},
+			Tags:   st,
+		})
+	})
+	for len(series) > 0 {
+		n := min(len(series), datadogBatch)
+		if err := w.post("/api/v2/series", map[string]any{"series": series[:n]}); err != nil {
+			return err
+		}
+		series = series[n:]
+	}
+	return w.post("/api/v1/events", w.event(rep, tags, now))
+}
+
+func (w DatadogWriter) tags(rep *Report) []string {
+	tags := append([]string(nil), w.Tags...)
+	if rep.Meta.Instance != "" {
+		tags = append(tags, "instance:"+rep.Meta.Instance)
+	}
+	if rep.Meta.Shard != "" {
+		tags = append(tags, "shard:"+rep.Meta.Shard)
+	}
+	return tags
+}
+
+// event summarizes rep in Datadog's event markdown.
+func (w DatadogWriter) event(rep *Report, tags []string, now int64) datadogEvent {
+	name := rep.Meta.Instance
+	if name == "" {
+		name = rep.Meta.Source
+	}
+	if rep.Meta.Shard != "" {
+		name += "/" + rep.Meta.Shard
+	}
+	s := rep.Summary
+	var b strings.Builder
+	b.WriteString("%%% \n")
+	fmt.Fprintf(&b, "**%d** keys, **%s** estimated memory, %s serialized, %d expired, %d without TTL.\n\n",
+		s.TotalKeys, FormatBytes(s.TotalMem), FormatBytes(s.TotalSize), s.Expired, s.NoTTL)
+	if len(rep.Prefixes) > 0 {
+		b.WriteString("| Prefix | Keys | Estimated memory |\n|---|---:|---:|\n")
+		for i, p := range rep.Prefixes {
+			if i == 10 {
+				break
+			}
+			fmt.Fprintf(&b, "| `%s` | %d | %s |\n", p.Prefix, p.Count, FormatBytes(p.EstimatedMem))
+		}
+	}
+	b.WriteString("\n %%%")
+	return datadogEvent{
+		Title:          "rdbviz analysis of " + name + " complete",
+		Text:           b.String(),
+		AlertType:      "info",
+		AggregationKey: "rdbviz:" + name,
+		DateHappened:   now,
+		Tags:           tags,
+	}
+}
+
+func (w DatadogWriter) post(path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	base := w.Site
+	switch {
+	case base == "":
+		base = "https://api.datadoghq.com"
+	case !strings.Contains(base, "://"):
+		base = "https://api." + base
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(base, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", w.APIKey)
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("datadog: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("datadog: %s: %s: %s", path, res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package rdbviz
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/report"
+)
+
+type dbAgg struct {
+	keys      int64
+	size      int64
+	mem       int64
+	typeCount map[string]int64
+	typeSize  map[string]int64
+	typeMem   map[string]int64
+	ttlCounts map[string]int64
+	prefixes  map[string]prefixAgg
+	bigKeys   bigKeyHeap
+}
+
+// dbStats repeats the headline sections for every logical DB: instances
+// shared between applications usually give each its own DB.
+type dbStats struct {
+	now       time.Time
+	sep       string
+	maxDepth  int
+	prefixLen int
+	// pruneMinKeys prunes thin prefixes as -prefix-depth auto does; 0 keeps all
+	pruneMinKeys int64
+	topN         int
+	metric       func(report.BigKey) float64
+	fold         *prefixFold
+	dbs          map[int]*dbAgg
+}
+
+func newDBStats(now time.Time, sep string, maxDepth, prefixLen int, pruneMinKeys int64, topN int, metric func(report.BigKey) float64, maxEntries int) *dbStats {
+	return &dbStats{
+		now:          now,
+		sep:          sep,
+		maxDepth:     maxDepth,
+		prefixLen:    prefixLen,
+		pruneMinKeys: pruneMinKeys,
+		topN:         topN,
+		metric:       metric,
+		fold:         &prefixFold{maxEntries: maxEntries},
+		dbs:          map[int]*dbAgg{},
+	}
+}
+
+func (ds *dbStats) observe(o parser.RedisObject, bk report.BigKey, ttl int64) {
+	a := ds.dbs[bk.DB]
+	if a == nil {
+		a = &dbAgg{
+			typeCount: map[string]int64{},
+			typeSize:  map[string]int64{},
+			typeMem:   map[string]int64{},
+			ttlCounts: newTTLCounts(),
+			prefixes:  map[string]prefixAgg{},
+		}
+		ds.dbs[bk.DB] = a
+	}
+	a.keys++
+	a.size += bk.Size
+	a.mem += bk.EstimatedMem
+	a.typeCount[bk.Type]++
+	a.typeSize[bk.Type] += bk.Size
+	a.typeMem[bk.Type] += bk.EstimatedMem
+	a.ttlCounts[ttlLabel(bk.Expiration, ds.now)]++
+	if ds.prefixLen > 0 {
+		applyFixedPrefix(a.prefixes, bk.Key, bk.Size, bk.EstimatedMem, ttl, ds.prefixLen)
+	} else {
+		applyPrefixes(a.prefixes, bk.Key, bk.Size, bk.EstimatedMem, ttl, ds.sep, ds.maxDepth)
+	}
+	ds.fold.capPrefixes(a.prefixes)
+	if i := pushBigKey(&a.bigKeys, bk, ds.topN, ds.metric); i >= 0 {
+		a.bigKeys[i].LargestMember = largestMember(o)
+		a.bigKeys[i].Scores = scoreStats(o)
+	}
+}
+
+func (ds *dbStats) result() []report.DBReport {
+	list := make([]report.DBReport, 0, len(ds.dbs))
+	for db, a := range ds.dbs {
+		types := make([]report.TypeStat, 0, len(a.typeCount))
+		for t, c := range a.typeCount {
+			types = append(types, report.TypeStat{Type: t, Count: c, Size: a.typeSize[t], EstimatedMem: a.typeMem[t]})
+		}
+		sort.Slice(types, func(i, j int) bool { return types[i].Size > types[j].Size })
+		if ds.pruneMinKeys > 0 {
+			prunePrefixes(a.prefixes, ds.sep, ds.pruneMinKeys)
+		}
+		sort.Slice(a.bigKeys, func(i, j int) bool { return ds.metric(a.bigKeys[i]) > ds.metric(a.bigKeys[j]) })
+		list = append(list, report.DBReport{
+			DB:           db,
+			Keys:         a.keys,
+			Size:         a.size,
+			EstimatedMem: a.mem,
+			Types:        types,
+			TTLBuckets:   ttlBucketList(a.ttlCounts),
+			Prefixes:     prefixStatList(a.prefixes, ds.topN),
+			BigKeys:      a.bigKeys,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DB < list[j].DB })
+	return list
+}
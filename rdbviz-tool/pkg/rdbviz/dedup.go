@@ -0,0 +1,133 @@
+package rdbviz
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/memmodel"
+	"rdbviz-tool/pkg/report"
+)
+
+const dedupExampleKeys = 5
+
+// maxDedupValues bounds the distinct values tracked in memory (about 240
+// bytes each). Past it the values seen once are dropped.
+const maxDedupValues = 200000
+
+type dedupValue struct {
+	hash uint64
+	size int
+}
+
+type dedupGroup struct {
+	count int64
+	mem   int64
+	keys  []string
+}
+
+// dedupStats groups string values by content hash. Values are sampled by hash
+// rather than by key, so every copy of a tracked value is seen.
+type dedupStats struct {
+	mm      memmodel.Model
+	minSize int
+	rate    float64
+	topN    int
+	values  map[dedupValue]*dedupGroup
+	runs    []*spillRun
+	dropped int64
+	// full is set once dropping the values seen once no longer makes room
+	full bool
+}
+
+func newDedupStats(mm memmodel.Model, minSize int64, rate float64, topN int) *dedupStats {
+	return &dedupStats{mm: mm, minSize: int(minSize), rate: rate, topN: topN, values: map[dedupValue]*dedupGroup{}}
+}
+
+func (ds *dedupStats) observe(db int, o parser.RedisObject) {
+	s, ok := o.(*parser.StringObject)
+	if !ok || len(s.Value) < ds.minSize {
+		return
+	}
+	h := hashBytes(s.Value)
+	if ds.rate < 1 && float64(h) >= ds.rate*math.MaxUint64 {
+		return
+	}
+	v := dedupValue{hash: h, size: len(s.Value)}
+	g := ds.values[v]
+	if g == nil {
+		if len(ds.values) >= maxDedupValues && !ds.makeRoom() {
+			ds.dropped++
+			return
+		}
+		g = &dedupGroup{mem: ds.mm.EstimateString(s.Value)}
+		ds.values[v] = g
+	}
+	g.count++
+	if len(g.keys) < dedupExampleKeys {
+		g.keys = append(g.keys, strconv.Itoa(db)+":"+s.Key)
+	}
+}
+
+// makeRoom drops the values seen once, reporting whether that freed a
+// quarter of the map; once it does not, new values are no longer tracked.
+func (ds *dedupStats) makeRoom() bool {
+	if ds.full {
+		return false
+	}
+	for v, g := range ds.values {
+		if g.count < 2 {
+			delete(ds.values, v)
+			ds.dropped++
+		}
+	}
+	ds.full = len(ds.values) > maxDedupValues*3/4
+	return !ds.full
+}
+
+// result lists the duplicated values, merging spilled runs if any. Groups
+// are trimmed to topN as they come, so a merge of many runs stays bounded.
+func (ds *dedupStats) result() (*report.DedupReport, error) {
+	r := &report.DedupReport{MinSize: int64(ds.minSize), SampleRate: ds.rate, Dropped: ds.dropped, Groups: []report.DupGroup{}}
+	trim := func() {
+		sort.Slice(r.Groups, func(i, j int) bool { return r.Groups[i].MemSavings > r.Groups[j].MemSavings })
+		if ds.topN > 0 && len(r.Groups) > ds.topN {
+			r.Groups = r.Groups[:ds.topN]
+		}
+	}
+	err := ds.each(func(v dedupValue, g *dedupGroup) {
+		if g.count < 2 {
+			return
+		}
+		dg := report.DupGroup{
+			Hash:       strconv.FormatUint(v.hash, 16),
+			ValueSize:  int64(v.size),
+			Count:      g.count,
+			Savings:    (g.count - 1) * int64(v.size),
+			MemSavings: (g.count - 1) * g.mem,
+			Keys:       g.keys,
+		}
+		r.DuplicateGroups++
+		r.DuplicateKeys += g.count - 1
+		r.Savings += dg.Savings
+		r.MemSavings += dg.MemSavings
+		r.Groups = append(r.Groups, dg)
+		if ds.topN > 0 && len(r.Groups) >= 2*ds.topN {
+			trim()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ds.rate < 1 {
+		// only a hash-chosen share of distinct values was tracked
+		r.DuplicateGroups = scaleCount(r.DuplicateGroups, 1/ds.rate)
+		r.DuplicateKeys = scaleCount(r.DuplicateKeys, 1/ds.rate)
+		r.Savings = scaleCount(r.Savings, 1/ds.rate)
+		r.MemSavings = scaleCount(r.MemSavings, 1/ds.rate)
+	}
+	trim()
+	return r, nil
+}
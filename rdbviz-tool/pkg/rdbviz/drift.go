@@ -0,0 +1,136 @@
+package rdbviz
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// maxDriftNamespaces bounds the namespaces compared; further ones are
+// counted under __other__ on both sides.
+const maxDriftNamespaces = 10000
+
+// driftScanCount is the COUNT hint passed to SCAN.
+const driftScanCount = 1000
+
+// driftStats counts keys per first-level namespace in the dump so they can be
+// compared with a SCAN of a live instance.
+type driftStats struct {
+	sep  string
+	topN int
+	dbs  map[int]bool
+	rdb  map[string]int64
+	live map[string]int64
+}
+
+func newDriftStats(sep string, topN int) *driftStats {
+	return &driftStats{sep: sep, topN: topN, dbs: map[int]bool{}, rdb: map[string]int64{}, live: map[string]int64{}}
+}
+
+func (ds *driftStats) observe(db int, key string) {
+	ds.dbs[db] = true
+	ds.rdb[ds.namespace(key)]++
+}
+
+func (ds *driftStats) namespace(key string) string {
+	ns := namespaceOf(key, ds.sep)
+	if _, ok := ds.rdb[ns]; ok {
+		return ns
+	}
+	if _, ok := ds.live[ns]; ok {
+		return ns
+	}
+	if len(ds.rdb)+len(ds.live) >= maxDriftNamespaces {
+		return otherPrefix
+	}
+	return ns
+}
+
+// scanLive SCANs every DB present in the dump on addr, reporting the number
+// of scanned keys to progress.
+func (ds *driftStats) scanLive(ctx context.Context, addr, password string, progress *progressReporter) ([]int, error) {
+	c, err := dialRedis(ctx, addr, password)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	dbs := make([]int, 0, len(ds.dbs))
+	for db := range ds.dbs {
+		dbs = append(dbs, db)
+	}
+	sort.Ints(dbs)
+	var scanned int64
+	for _, db := range dbs {
+		if _, err := c.do("SELECT", strconv.Itoa(db)); err != nil {
+			return nil, fmt.Errorf("select %d: %v", db, err)
+		}
+		err := c.scan(driftScanCount, func(key string) {
+			ds.live[ds.namespace(key)]++
+			scanned++
+			progress.tick(db, scanned, 0)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scan db %d: %v", db, err)
+		}
+	}
+	return dbs, nil
+}
+
+// result compares the namespaces. Dump counts are multiplied by scale so a
+// sampled run is compared at full size. A namespace drifts when its live
+// count differs from the dump's by more than threshold of the dump's count.
+func (ds *driftStats) result(addr string, dbs []int, threshold, scale float64) *report.DriftReport {
+	r := &report.DriftReport{
+		Addr:       addr,
+		ScannedAt:  time.Now().Format(time.RFC3339),
+		DBs:        dbs,
+		Threshold:  threshold,
+		Namespaces: []report.DriftPrefix{},
+	}
+	seen := map[string]bool{}
+	add := func(ns string) {
+		if seen[ns] {
+			return
+		}
+		seen[ns] = true
+		p := report.DriftPrefix{Prefix: ns, RDBKeys: scaleCount(ds.rdb[ns], scale), LiveKeys: ds.live[ns]}
+		p.Delta = p.LiveKeys - p.RDBKeys
+		p.Change = float64(p.Delta) / math.Max(float64(p.RDBKeys), 1)
+		p.Drifted = math.Abs(p.Change) > threshold
+		r.RDBKeys += p.RDBKeys
+		r.LiveKeys += p.LiveKeys
+		if p.Drifted {
+			r.Drifted++
+		}
+		r.Namespaces = append(r.Namespaces, p)
+	}
+	for ns := range ds.rdb {
+		add(ns)
+	}
+	for ns := range ds.live {
+		add(ns)
+	}
+	sort.Slice(r.Namespaces, func(i, j int) bool {
+		a, b := r.Namespaces[i], r.Namespaces[j]
+		if a.Drifted != b.Drifted {
+			return a.Drifted
+		}
+		return abs64(a.Delta) > abs64(b.Delta)
+	})
+	if ds.topN > 0 && len(r.Namespaces) > ds.topN {
+		r.Namespaces = r.Namespaces[:ds.topN]
+	}
+	return r
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
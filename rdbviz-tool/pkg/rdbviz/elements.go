@@ -0,0 +1,64 @@
+package rdbviz
+
+import (
+	"sort"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/report"
+)
+
+var elementBuckets = []struct {
+	Label string
+	Max   int64
+}{
+	{Label: "0-10", Max: 10},
+	{Label: "11-100", Max: 100},
+	{Label: "101-1K", Max: 1000},
+	{Label: "1K-10K", Max: 10000},
+	{Label: "10K-100K", Max: 100000},
+	{Label: "100K-1M", Max: 1000000},
+	{Label: ">1M", Max: 1<<63 - 1},
+}
+
+// elementStats buckets collections of each type by element count.
+type elementStats struct {
+	types map[string][]report.ElementBucket
+}
+
+func newElementStats() *elementStats {
+	return &elementStats{types: map[string][]report.ElementBucket{}}
+}
+
+func (es *elementStats) observe(objType string, elements, size, mem int64) {
+	switch objType {
+	case parser.HashType, parser.ListType, parser.SetType, parser.ZSetType, parser.StreamType:
+	default:
+		return
+	}
+	buckets, ok := es.types[objType]
+	if !ok {
+		buckets = make([]report.ElementBucket, len(elementBuckets))
+		for i, b := range elementBuckets {
+			buckets[i].Label = b.Label
+		}
+		es.types[objType] = buckets
+	}
+	for i, b := range elementBuckets {
+		if elements <= b.Max {
+			buckets[i].Count++
+			buckets[i].Size += size
+			buckets[i].EstimatedMem += mem
+			return
+		}
+	}
+}
+
+func (es *elementStats) result() []report.ElementHistogram {
+	list := make([]report.ElementHistogram, 0, len(es.types))
+	for t, buckets := range es.types {
+		list = append(list, report.ElementHistogram{Type: t, Buckets: buckets})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Type < list[j].Type })
+	return list
+}
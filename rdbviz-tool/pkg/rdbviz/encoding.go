@@ -0,0 +1,197 @@
+package rdbviz
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/hdt3213/rdb/model"
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/memmodel"
+	"rdbviz-tool/pkg/report"
+)
+
+// Default conversion thresholds of Redis 7.
+const (
+	maxListpackEntries = 128
+	maxListpackValue   = 64
+	maxIntsetEntries   = 512
+)
+
+type encodingKey struct {
+	objType  string
+	encoding string
+}
+
+type encodingStats struct {
+	mm         memmodel.Model
+	topN       int
+	encodings  map[encodingKey]*report.EncodingStat
+	suboptimal map[string]*report.SuboptimalTypeStat
+	keys       []report.SuboptimalKey
+}
+
+func newEncodingStats(mm memmodel.Model, topN int) *encodingStats {
+	return &encodingStats{
+		mm:         mm,
+		topN:       topN,
+		encodings:  map[encodingKey]*report.EncodingStat{},
+		suboptimal: map[string]*report.SuboptimalTypeStat{},
+	}
+}
+
+func (es *encodingStats) observe(o parser.RedisObject, size, mem int64) {
+	k := encodingKey{objType: o.GetType(), encoding: o.GetEncoding()}
+	st := es.encodings[k]
+	if st == nil {
+		st = &report.EncodingStat{Type: k.objType, Encoding: k.encoding}
+		es.encodings[k] = st
+	}
+	st.Count++
+	st.Size += size
+	st.EstimatedMem += mem
+
+	suggested, compact := es.compactForm(o)
+	if compact == nil {
+		return
+	}
+	after := es.mm.Estimate(compact)
+	if after >= mem {
+		return
+	}
+	ts := es.suboptimal[k.objType]
+	if ts == nil {
+		ts = &report.SuboptimalTypeStat{Type: k.objType}
+		es.suboptimal[k.objType] = ts
+	}
+	ts.Count++
+	ts.EstimatedMem += mem
+	ts.Savings += mem - after
+
+	es.push(report.SuboptimalKey{
+		DB:           o.GetDBIndex(),
+		Key:          o.GetKey(),
+		Type:         k.objType,
+		Encoding:     k.encoding,
+		Suggested:    suggested,
+		Elements:     int64(o.GetElemCount()),
+		EstimatedMem: mem,
+		Savings:      mem - after,
+	})
+}
+
+// compactForm returns the encoding a hashtable/skiplist collection would get
+// under the default thresholds and a copy of o re-encoded that way, or nil
+// when o is already compact or too large.
+func (es *encodingStats) compactForm(o parser.RedisObject) (string, parser.RedisObject) {
+	switch obj := o.(type) {
+	case *parser.HashObject:
+		if obj.Encoding != model.HashEncoding || len(obj.Hash) > maxListpackEntries {
+			return "", nil
+		}
+		for f, v := range obj.Hash {
+			if len(f) > maxListpackValue || len(v) > maxListpackValue {
+				return "", nil
+			}
+		}
+		cp := *obj
+		cp.BaseObject = withEncoding(obj.BaseObject, model.ListPackEncoding)
+		return model.ListPackEncoding, &cp
+	case *parser.SetObject:
+		if obj.Encoding != model.SetEncoding {
+			return "", nil
+		}
+		enc := ""
+		if len(obj.Members) <= maxIntsetEntries && allIntegers(obj.Members) {
+			enc = model.IntSetEncoding
+		} else if len(obj.Members) <= maxListpackEntries && allShort(obj.Members) {
+			enc = model.ListPackEncoding
+		}
+		if enc == "" {
+			return "", nil
+		}
+		cp := *obj
+		cp.BaseObject = withEncoding(obj.BaseObject, enc)
+		return enc, &cp
+	case *parser.ZSetObject:
+		if obj.Encoding != model.ZSetEncoding && obj.Encoding != model.ZSet2Encoding || len(obj.Entries) > maxListpackEntries {
+			return "", nil
+		}
+		for _, e := range obj.Entries {
+			if len(e.Member) > maxListpackValue {
+				return "", nil
+			}
+		}
+		cp := *obj
+		cp.BaseObject = withEncoding(obj.BaseObject, model.ListPackEncoding)
+		return model.ListPackEncoding, &cp
+	}
+	return "", nil
+}
+
+func withEncoding(b *model.BaseObject, encoding string) *model.BaseObject {
+	cp := *b
+	cp.Encoding = encoding
+	return &cp
+}
+
+func allIntegers(vs [][]byte) bool {
+	for _, v := range vs {
+		if _, err := strconv.ParseInt(string(v), 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func allShort(vs [][]byte) bool {
+	for _, v := range vs {
+		if len(v) > maxListpackValue {
+			return false
+		}
+	}
+	return true
+}
+
+func (es *encodingStats) push(k report.SuboptimalKey) {
+	if es.topN <= 0 {
+		return
+	}
+	if len(es.keys) < es.topN {
+		es.keys = append(es.keys, k)
+		return
+	}
+	minIdx := 0
+	for i := 1; i < len(es.keys); i++ {
+		if es.keys[i].Savings < es.keys[minIdx].Savings {
+			minIdx = i
+		}
+	}
+	if k.Savings > es.keys[minIdx].Savings {
+		es.keys[minIdx] = k
+	}
+}
+
+func (es *encodingStats) result() *report.EncodingReport {
+	r := &report.EncodingReport{
+		Encodings:  make([]report.EncodingStat, 0, len(es.encodings)),
+		Suboptimal: make([]report.SuboptimalTypeStat, 0, len(es.suboptimal)),
+		Keys:       make([]report.SuboptimalKey, len(es.keys)),
+	}
+	for _, st := range es.encodings {
+		r.Encodings = append(r.Encodings, *st)
+	}
+	sort.Slice(r.Encodings, func(i, j int) bool {
+		if r.Encodings[i].Type != r.Encodings[j].Type {
+			return r.Encodings[i].Type < r.Encodings[j].Type
+		}
+		return r.Encodings[i].Count > r.Encodings[j].Count
+	})
+	for _, ts := range es.suboptimal {
+		r.Suboptimal = append(r.Suboptimal, *ts)
+	}
+	sort.Slice(r.Suboptimal, func(i, j int) bool { return r.Suboptimal[i].Savings > r.Suboptimal[j].Savings })
+	copy(r.Keys, es.keys)
+	sort.Slice(r.Keys, func(i, j int) bool { return r.Keys[i].Savings > r.Keys[j].Savings })
+	return r
+}
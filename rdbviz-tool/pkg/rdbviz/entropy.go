@@ -0,0 +1,151 @@
+package rdbviz
+
+import (
+	"math"
+	"sort"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// entropyMaxBytes bounds the work per value; the head of a value is
+// representative enough to tell text from compressed or encrypted data.
+const entropyMaxBytes = 64 * 1024
+
+// maxEntropyNamespaces bounds the per-namespace histograms; keys without
+// separators would otherwise get one each.
+const maxEntropyNamespaces = 10000
+
+// Mean entropy thresholds in bits per byte.
+const (
+	entropyHigh = 7.5
+	entropyLow  = 6
+)
+
+var entropyBuckets = []struct {
+	Label string
+	Max   float64
+}{
+	{Label: "0-2", Max: 2},
+	{Label: "2-4", Max: 4},
+	{Label: "4-6", Max: 6},
+	{Label: "6-7", Max: 7},
+	{Label: "7-7.5", Max: 7.5},
+	{Label: "7.5-8", Max: 8},
+}
+
+type entropyAgg struct {
+	sampled int64
+	size    int64
+	sum     float64
+	buckets []int64
+}
+
+// entropyStats computes Shannon entropy of sampled string values per
+// namespace, telling data that is already compressed or encrypted apart from
+// text worth compressing.
+type entropyStats struct {
+	rate     float64
+	sep      string
+	topN     int
+	prefixes map[string]*entropyAgg
+}
+
+func newEntropyStats(rate float64, sep string, topN int) *entropyStats {
+	return &entropyStats{rate: rate, sep: sep, topN: topN, prefixes: map[string]*entropyAgg{}}
+}
+
+func (es *entropyStats) observe(o parser.RedisObject) {
+	s, ok := o.(*parser.StringObject)
+	// short values look low-entropy regardless of content
+	if !ok || len(s.Value) < compressMinSize || !sampleKey(s.Key, es.rate) {
+		return
+	}
+	ns := namespaceOf(s.Key, es.sep)
+	a := es.prefixes[ns]
+	if a == nil {
+		if len(es.prefixes) >= maxEntropyNamespaces {
+			ns = otherPrefix
+			a = es.prefixes[ns]
+		}
+		if a == nil {
+			a = &entropyAgg{buckets: make([]int64, len(entropyBuckets))}
+			es.prefixes[ns] = a
+		}
+	}
+	e := shannonEntropy(s.Value)
+	a.sampled++
+	a.size += int64(len(s.Value))
+	a.sum += e
+	for i, b := range entropyBuckets {
+		if e <= b.Max {
+			a.buckets[i]++
+			break
+		}
+	}
+}
+
+// shannonEntropy returns the entropy of v in bits per byte (0-8).
+func shannonEntropy(v []byte) float64 {
+	if len(v) > entropyMaxBytes {
+		v = v[:entropyMaxBytes]
+	}
+	var freq [256]int
+	for _, c := range v {
+		freq[c]++
+	}
+	n := float64(len(v))
+	e := 0.0
+	for _, f := range freq {
+		if f == 0 {
+			continue
+		}
+		p := float64(f) / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+func entropyClass(mean float64) string {
+	switch {
+	case mean >= entropyHigh:
+		return "incompressible"
+	case mean < entropyLow:
+		return "compressible"
+	}
+	return "mixed"
+}
+
+func (es *entropyStats) result() *report.EntropyReport {
+	r := &report.EntropyReport{
+		SampleRate: es.rate,
+		MinSize:    compressMinSize,
+		Buckets:    make([]report.Bucket, len(entropyBuckets)),
+		Prefixes:   make([]report.EntropyStat, 0, len(es.prefixes)),
+	}
+	for i, b := range entropyBuckets {
+		r.Buckets[i].Label = b.Label
+	}
+	for p, a := range es.prefixes {
+		st := report.EntropyStat{
+			Prefix:      p,
+			Sampled:     a.sampled,
+			SampledSize: a.size,
+			Mean:        a.sum / float64(a.sampled),
+			Buckets:     make([]report.Bucket, len(entropyBuckets)),
+		}
+		st.Class = entropyClass(st.Mean)
+		for i, b := range entropyBuckets {
+			st.Buckets[i] = report.Bucket{Label: b.Label, Count: a.buckets[i]}
+			r.Buckets[i].Count += a.buckets[i]
+		}
+		r.Sampled += a.sampled
+		r.Prefixes = append(r.Prefixes, st)
+	}
+	sort.Slice(r.Prefixes, func(i, j int) bool { return r.Prefixes[i].SampledSize > r.Prefixes[j].SampledSize })
+	if es.topN > 0 && len(r.Prefixes) > es.topN {
+		r.Prefixes = r.Prefixes[:es.topN]
+	}
+	return r
+}
@@ -0,0 +1,197 @@
+package rdbviz
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// maxEvictNamespaces bounds the per-namespace histograms (about 9 KiB each).
+const maxEvictNamespaces = 1000
+
+type evictBucket struct {
+	count int64
+	size  int64
+	mem   int64
+}
+
+func (b *evictBucket) add(size, mem int64) {
+	b.count++
+	b.size += size
+	b.mem += mem
+}
+
+// evictHist orders a namespace's keys the way each policy picks victims:
+// log2 buckets of idle time and remaining TTL, and the 8 bit LFU counter.
+type evictHist struct {
+	lru  [41]evictBucket
+	vlru [41]evictBucket
+	lfu  [256]evictBucket
+	vttl [41]evictBucket
+}
+
+func log2Bucket(v int64) int {
+	if v < 0 {
+		v = 0
+	}
+	b := bits.Len64(uint64(v))
+	if b > 40 {
+		b = 40
+	}
+	return b
+}
+
+type evictPolicy struct {
+	name string
+	// needs names the access signal the policy depends on, if any
+	needs string
+	// buckets returns the histogram in eviction order
+	buckets func(h *evictHist) []evictBucket
+}
+
+func reversed(b []evictBucket) []evictBucket {
+	r := make([]evictBucket, len(b))
+	for i, v := range b {
+		r[len(b)-1-i] = v
+	}
+	return r
+}
+
+var evictPolicies = []evictPolicy{
+	{"allkeys-lru", "idle", func(h *evictHist) []evictBucket { return reversed(h.lru[:]) }},
+	{"volatile-lru", "idle", func(h *evictHist) []evictBucket { return reversed(h.vlru[:]) }},
+	{"allkeys-lfu", "freq", func(h *evictHist) []evictBucket { return h.lfu[:] }},
+	{"volatile-ttl", "", func(h *evictHist) []evictBucket { return h.vttl[:] }},
+}
+
+// evictionSim replays maxmemory eviction against the snapshot. It evicts in
+// exact policy order, which real Redis only approximates by sampling
+// maxmemory-samples keys at a time.
+type evictionSim struct {
+	sep        string
+	topN       int
+	sawIdle    bool
+	sawFreq    bool
+	used       int64
+	namespaces map[string]*evictHist
+}
+
+func newEvictionSim(sep string, topN int) *evictionSim {
+	return &evictionSim{sep: sep, topN: topN, namespaces: map[string]*evictHist{}}
+}
+
+func (es *evictionSim) observe(key string, size, mem, ttl, idle, freq int64) {
+	es.used += mem
+	ns := namespaceOf(key, es.sep)
+	h := es.namespaces[ns]
+	if h == nil {
+		if len(es.namespaces) >= maxEvictNamespaces {
+			ns = otherPrefix
+			h = es.namespaces[ns]
+		}
+		if h == nil {
+			h = &evictHist{}
+			es.namespaces[ns] = h
+		}
+	}
+	if idle != unknownAccess {
+		es.sawIdle = true
+		h.lru[log2Bucket(idle)].add(size, mem)
+		if ttl != noTTL {
+			h.vlru[log2Bucket(idle)].add(size, mem)
+		}
+	}
+	if freq != unknownAccess {
+		es.sawFreq = true
+		h.lfu[freq&0xff].add(size, mem)
+	}
+	if ttl != noTTL {
+		h.vttl[log2Bucket(ttl)].add(size, mem)
+	}
+}
+
+// result evicts until the estimated memory fits target. scale is the
+// sampling factor: target is a full-dataset figure while the histograms
+// hold sampled keys, so the amount to free is scaled down to match.
+func (es *evictionSim) result(target int64, scale float64) *report.EvictionReport {
+	r := &report.EvictionReport{
+		MaxMemory: target,
+		UsedMem:   es.used,
+		Policies:  make([]report.EvictionPolicy, 0, len(evictPolicies)),
+	}
+	need := es.used - int64(math.Round(float64(target)/scale))
+	if need < 0 {
+		need = 0
+	}
+	r.NeedToFree = need
+	for _, p := range evictPolicies {
+		r.Policies = append(r.Policies, es.simulate(p, need))
+	}
+	return r
+}
+
+func (es *evictionSim) simulate(p evictPolicy, need int64) report.EvictionPolicy {
+	out := report.EvictionPolicy{Policy: p.name, Available: true, Prefixes: []report.EvictionPrefix{}}
+	if (p.needs == "idle" && !es.sawIdle) || (p.needs == "freq" && !es.sawFreq) {
+		out.Available = false
+		return out
+	}
+	if need == 0 {
+		return out
+	}
+
+	// find the bucket where freed memory reaches need, and how much of it
+	// goes
+	var total []evictBucket
+	for _, h := range es.namespaces {
+		b := p.buckets(h)
+		if total == nil {
+			total = make([]evictBucket, len(b))
+		}
+		for i := range b {
+			total[i].mem += b[i].mem
+		}
+	}
+	cut, frac := len(total), 1.0
+	var freed int64
+	for i, b := range total {
+		if freed+b.mem >= need && b.mem > 0 {
+			cut, frac = i, float64(need-freed)/float64(b.mem)
+			break
+		}
+		freed += b.mem
+	}
+	out.OOM = cut == len(total)
+
+	for ns, h := range es.namespaces {
+		var e report.EvictionPrefix
+		for i, b := range p.buckets(h) {
+			e.EligibleKeys += b.count
+			switch {
+			case i < cut:
+				e.EvictedKeys += b.count
+				e.EvictedSize += b.size
+				e.EvictedMem += b.mem
+			case i == cut:
+				e.EvictedKeys += int64(math.Round(float64(b.count) * frac))
+				e.EvictedSize += int64(math.Round(float64(b.size) * frac))
+				e.EvictedMem += int64(math.Round(float64(b.mem) * frac))
+			}
+		}
+		if e.EvictedMem == 0 {
+			continue
+		}
+		e.Prefix = ns
+		out.EvictedKeys += e.EvictedKeys
+		out.EvictedSize += e.EvictedSize
+		out.EvictedMem += e.EvictedMem
+		out.Prefixes = append(out.Prefixes, e)
+	}
+	sort.Slice(out.Prefixes, func(i, j int) bool { return out.Prefixes[i].EvictedMem > out.Prefixes[j].EvictedMem })
+	if es.topN > 0 && len(out.Prefixes) > es.topN {
+		out.Prefixes = out.Prefixes[:es.topN]
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+package rdbviz
+
+import (
+	"sort"
+	"time"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// expiryHorizon limits the hourly and per-minute timelines; expiry storms
+// that matter are the ones coming up soon, and it bounds the minute map.
+const expiryHorizon = 30 * 24 * time.Hour
+
+type expiryAgg struct {
+	count int64
+	size  int64
+	mem   int64
+}
+
+func (a *expiryAgg) add(size, mem int64) {
+	a.count++
+	a.size += size
+	a.mem += mem
+}
+
+// expiryTimeline buckets future expirations by absolute hour and day and
+// counts them per minute to find mass-expiry spikes.
+type expiryTimeline struct {
+	now        time.Time
+	spikeShare float64
+	topN       int
+	hours      map[int64]*expiryAgg
+	days       map[int64]*expiryAgg
+	minutes    map[int64]int64
+}
+
+func newExpiryTimeline(now time.Time, spikeShare float64, topN int) *expiryTimeline {
+	return &expiryTimeline{
+		now:        now,
+		spikeShare: spikeShare,
+		topN:       topN,
+		hours:      map[int64]*expiryAgg{},
+		days:       map[int64]*expiryAgg{},
+		minutes:    map[int64]int64{},
+	}
+}
+
+func (et *expiryTimeline) observe(expiration *time.Time, size, mem int64) {
+	if expiration == nil || expiration.Before(et.now) {
+		return
+	}
+	t := expiration.UTC()
+	day := t.Truncate(24 * time.Hour).Unix()
+	d := et.days[day]
+	if d == nil {
+		d = &expiryAgg{}
+		et.days[day] = d
+	}
+	d.add(size, mem)
+	if t.Sub(et.now) > expiryHorizon {
+		return
+	}
+	hour := t.Truncate(time.Hour).Unix()
+	h := et.hours[hour]
+	if h == nil {
+		h = &expiryAgg{}
+		et.hours[hour] = h
+	}
+	h.add(size, mem)
+	et.minutes[t.Truncate(time.Minute).Unix()]++
+}
+
+func timeBuckets(m map[int64]*expiryAgg) []report.TimeBucket {
+	list := make([]report.TimeBucket, 0, len(m))
+	for ts, a := range m {
+		list = append(list, report.TimeBucket{
+			Time:         time.Unix(ts, 0).UTC().Format(time.RFC3339),
+			Count:        a.count,
+			Size:         a.size,
+			EstimatedMem: a.mem,
+		})
+	}
+	// RFC3339 in UTC sorts chronologically as a string
+	sort.Slice(list, func(i, j int) bool { return list[i].Time < list[j].Time })
+	return list
+}
+
+// result flags minutes in which at least spikeShare of totalKeys expire.
+func (et *expiryTimeline) result(totalKeys int64) *report.ExpiryTimeline {
+	r := &report.ExpiryTimeline{
+		HorizonHours: int(expiryHorizon / time.Hour),
+		SpikeShare:   et.spikeShare,
+		Hourly:       timeBuckets(et.hours),
+		Daily:        timeBuckets(et.days),
+		Spikes:       []report.ExpirySpike{},
+	}
+	if totalKeys == 0 {
+		return r
+	}
+	for ts, n := range et.minutes {
+		share := float64(n) / float64(totalKeys)
+		if share < et.spikeShare || n < 2 {
+			continue
+		}
+		r.Spikes = append(r.Spikes, report.ExpirySpike{
+			Minute: time.Unix(ts, 0).UTC().Format(time.RFC3339),
+			Count:  n,
+			Share:  share,
+		})
+	}
+	sort.Slice(r.Spikes, func(i, j int) bool { return r.Spikes[i].Count > r.Spikes[j].Count })
+	if et.topN > 0 && len(r.Spikes) > et.topN {
+		r.Spikes = r.Spikes[:et.topN]
+	}
+	return r
+}
@@ -0,0 +1,247 @@
+package rdbviz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/memmodel"
+	"rdbviz-tool/pkg/report"
+)
+
+// maxFormatNamespaces bounds the per-namespace counts; keys without
+// separators would otherwise get one each.
+const maxFormatNamespaces = 10000
+
+const (
+	formatJSON     = "json"
+	formatMsgpack  = "msgpack"
+	formatProtobuf = "protobuf"
+	formatJava     = "java-serialized"
+	formatPHP      = "php-serialize"
+	formatPickle   = "pickle"
+	formatGzip     = "gzip"
+	formatZstd     = "zstd"
+	formatLZ4      = "lz4"
+	formatHLL      = "hyperloglog"
+	formatNumber   = "number"
+	formatText     = "text"
+	formatBinary   = "binary"
+)
+
+// riskyFormats deserialize into arbitrary objects and are a common remote
+// code execution vector when an attacker can write to the cache.
+var riskyFormats = map[string]bool{
+	formatJava:   true,
+	formatPHP:    true,
+	formatPickle: true,
+}
+
+// fingerprint guesses the serialization format of v from magic bytes and
+// cheap structural checks. The order matters: text formats are tried after
+// the binary magics, protobuf last as almost anything short parses as one.
+func fingerprint(v []byte) string {
+	switch {
+	case len(v) == 0:
+		return formatText
+	case bytes.HasPrefix(v, []byte{0xac, 0xed, 0x00, 0x05}):
+		return formatJava
+	case len(v) >= 2 && v[0] == 0x80 && v[1] >= 2 && v[1] <= 5 && v[len(v)-1] == '.':
+		return formatPickle
+	case bytes.HasPrefix(v, []byte{0x1f, 0x8b}):
+		return formatGzip
+	case bytes.HasPrefix(v, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return formatZstd
+	case bytes.HasPrefix(v, []byte{0x04, 0x22, 0x4d, 0x18}):
+		return formatLZ4
+	case bytes.HasPrefix(v, []byte("HYLL")):
+		return formatHLL
+	case isPHPSerialized(v):
+		return formatPHP
+	case memmodel.IsSharedInt(v):
+		return formatNumber
+	case looksLikeJSON(v) && json.Valid(v):
+		return formatJSON
+	case utf8.Valid(v) && isPrintable(v):
+		return formatText
+	case isMsgpack(v):
+		return formatMsgpack
+	case isProtobuf(v):
+		return formatProtobuf
+	}
+	return formatBinary
+}
+
+func isPrintable(v []byte) bool {
+	for _, c := range v {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// isPHPSerialized matches the type prefixes of PHP serialize(): a:N:{,
+// O:N:", s:N:", i:N; and b:0/1;.
+func isPHPSerialized(v []byte) bool {
+	if len(v) < 4 || v[1] != ':' {
+		return false
+	}
+	switch v[0] {
+	case 'a', 'O', 's', 'C':
+		i := 2
+		for i < len(v) && v[i] >= '0' && v[i] <= '9' {
+			i++
+		}
+		return i > 2 && i+1 < len(v) && v[i] == ':' && (v[i+1] == '{' || v[i+1] == '"')
+	case 'i', 'd', 'b':
+		return v[len(v)-1] == ';'
+	}
+	return false
+}
+
+// isMsgpack accepts values that start with a msgpack map or array header.
+func isMsgpack(v []byte) bool {
+	c := v[0]
+	return c >= 0x80 && c <= 0x9f || c == 0xdc || c == 0xdd || c == 0xde || c == 0xdf
+}
+
+// isProtobuf checks that v parses as a sequence of well-formed protobuf
+// fields consuming every byte.
+func isProtobuf(v []byte) bool {
+	fields := 0
+	for len(v) > 0 {
+		tag, n := binary.Uvarint(v)
+		if n <= 0 || tag>>3 == 0 {
+			return false
+		}
+		v = v[n:]
+		switch tag & 7 {
+		case 0:
+			if _, n = binary.Uvarint(v); n <= 0 {
+				return false
+			}
+			v = v[n:]
+		case 1:
+			if len(v) < 8 {
+				return false
+			}
+			v = v[8:]
+		case 2:
+			l, n := binary.Uvarint(v)
+			if n <= 0 || uint64(len(v)-n) < l {
+				return false
+			}
+			v = v[n+int(l):]
+		case 5:
+			if len(v) < 4 {
+				return false
+			}
+			v = v[4:]
+		default:
+			return false
+		}
+		fields++
+	}
+	return fields > 0
+}
+
+type formatAgg struct {
+	sampled int64
+	counts  map[string]*report.FormatCount
+}
+
+func (a *formatAgg) add(format string, size int64) {
+	c := a.counts[format]
+	if c == nil {
+		c = &report.FormatCount{Format: format, Risky: riskyFormats[format]}
+		a.counts[format] = c
+	}
+	c.Count++
+	c.Size += size
+}
+
+func (a *formatAgg) list() []report.FormatCount {
+	list := make([]report.FormatCount, 0, len(a.counts))
+	for _, c := range a.counts {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Count > list[j].Count })
+	return list
+}
+
+// formatStats fingerprints sampled string values overall and per namespace.
+type formatStats struct {
+	rate     float64
+	sep      string
+	topN     int
+	total    formatAgg
+	prefixes map[string]*formatAgg
+}
+
+func newFormatStats(rate float64, sep string, topN int) *formatStats {
+	return &formatStats{
+		rate:     rate,
+		sep:      sep,
+		topN:     topN,
+		total:    formatAgg{counts: map[string]*report.FormatCount{}},
+		prefixes: map[string]*formatAgg{},
+	}
+}
+
+func (fs *formatStats) observe(o parser.RedisObject) {
+	s, ok := o.(*parser.StringObject)
+	if !ok || !sampleKey(s.Key, fs.rate) {
+		return
+	}
+	ns := namespaceOf(s.Key, fs.sep)
+	a := fs.prefixes[ns]
+	if a == nil {
+		if len(fs.prefixes) >= maxFormatNamespaces {
+			ns = otherPrefix
+			a = fs.prefixes[ns]
+		}
+		if a == nil {
+			a = &formatAgg{counts: map[string]*report.FormatCount{}}
+			fs.prefixes[ns] = a
+		}
+	}
+	f := fingerprint(s.Value)
+	size := int64(len(s.Value))
+	a.sampled++
+	a.add(f, size)
+	fs.total.sampled++
+	fs.total.add(f, size)
+}
+
+func (fs *formatStats) result() *report.FormatReport {
+	r := &report.FormatReport{
+		SampleRate: fs.rate,
+		Sampled:    fs.total.sampled,
+		Formats:    fs.total.list(),
+		Prefixes:   make([]report.FormatPrefixStat, 0, len(fs.prefixes)),
+	}
+	for p, a := range fs.prefixes {
+		st := report.FormatPrefixStat{Prefix: p, Sampled: a.sampled, Formats: a.list()}
+		for _, c := range st.Formats {
+			if c.Risky {
+				st.Risky += c.Count
+			}
+		}
+		r.Prefixes = append(r.Prefixes, st)
+	}
+	sort.Slice(r.Prefixes, func(i, j int) bool {
+		if r.Prefixes[i].Risky != r.Prefixes[j].Risky {
+			return r.Prefixes[i].Risky > r.Prefixes[j].Risky
+		}
+		return r.Prefixes[i].Sampled > r.Prefixes[j].Sampled
+	})
+	if fs.topN > 0 && len(r.Prefixes) > fs.topN {
+		r.Prefixes = r.Prefixes[:fs.topN]
+	}
+	return r
+}
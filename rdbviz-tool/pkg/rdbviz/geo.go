@@ -0,0 +1,133 @@
+package rdbviz
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// GEOADD stores members with a 52 bit interleaved geohash as score; latitude
+// is limited to the Web Mercator range.
+const (
+	geoStep   = 26
+	geoLatMax = 85.05112878
+	// geoMinTop requires some member to use the high bits: real coordinates
+	// spread over the whole hash range, unlike counters or IDs.
+	geoMinTop = 1 << 48
+	// Unix microseconds fall in the geohash range too. Sets whose scores
+	// all lie from a year before the analysis to a month after it are taken
+	// for the timestamps of a timeline, rate limiter or delay queue; that
+	// band is under 1% of the geohash range, but it moves over the map with
+	// time, so a geo set lying entirely in it is missed.
+	geoTimeBefore = 365 * 24 * time.Hour
+	geoTimeAfter  = 30 * 24 * time.Hour
+)
+
+// isGeoZSet reports whether every score of z is an integer geohash and the
+// scores are not Unix microseconds around now.
+func isGeoZSet(z *parser.ZSetObject, now time.Time) bool {
+	if len(z.Entries) == 0 {
+		return false
+	}
+	top, times := false, true
+	oldest, latest := float64(now.Add(-geoTimeBefore).UnixMicro()), float64(now.Add(geoTimeAfter).UnixMicro())
+	for _, e := range z.Entries {
+		if e.Score < 0 || e.Score >= 1<<(2*geoStep) || e.Score != math.Trunc(e.Score) {
+			return false
+		}
+		if e.Score >= geoMinTop {
+			top = true
+		}
+		if e.Score < oldest || e.Score > latest {
+			times = false
+		}
+	}
+	return top && !times
+}
+
+// geoDecode returns the centre of the geohash cell.
+func geoDecode(score float64) (lon, lat float64) {
+	h := uint64(score)
+	var latBits, lonBits uint64
+	for i := 0; i < geoStep; i++ {
+		latBits |= (h >> (2 * i) & 1) << i
+		lonBits |= (h >> (2*i + 1) & 1) << i
+	}
+	cell := float64(uint64(1) << geoStep)
+	lat = -geoLatMax + (float64(latBits)+0.5)/cell*2*geoLatMax
+	lon = -180 + (float64(lonBits)+0.5)/cell*360
+	return lon, lat
+}
+
+// geoStats collects sorted sets that hold GEOADD data.
+type geoStats struct {
+	topN int
+	now  time.Time
+	r    report.GeoReport
+}
+
+func newGeoStats(now time.Time, topN int) *geoStats {
+	return &geoStats{topN: topN, now: now, r: report.GeoReport{Keys: []report.GeoKey{}}}
+}
+
+func (gs *geoStats) observe(o parser.RedisObject, size, mem int64) {
+	z, ok := o.(*parser.ZSetObject)
+	if !ok || !isGeoZSet(z, gs.now) {
+		return
+	}
+	k := report.GeoKey{
+		DB:           z.GetDBIndex(),
+		Key:          z.Key,
+		Members:      int64(len(z.Entries)),
+		Size:         size,
+		EstimatedMem: mem,
+		MinLon:       180,
+		MaxLon:       -180,
+		MinLat:       90,
+		MaxLat:       -90,
+	}
+	for _, e := range z.Entries {
+		lon, lat := geoDecode(e.Score)
+		k.MinLon = math.Min(k.MinLon, lon)
+		k.MaxLon = math.Max(k.MaxLon, lon)
+		k.MinLat = math.Min(k.MinLat, lat)
+		k.MaxLat = math.Max(k.MaxLat, lat)
+	}
+	gs.r.Count++
+	gs.r.Members += k.Members
+	gs.r.Size += size
+	gs.r.EstimatedMem += mem
+	gs.push(k)
+}
+
+func (gs *geoStats) push(k report.GeoKey) {
+	if gs.topN <= 0 {
+		return
+	}
+	if len(gs.r.Keys) < gs.topN {
+		gs.r.Keys = append(gs.r.Keys, k)
+		return
+	}
+	minIdx := 0
+	for i := 1; i < len(gs.r.Keys); i++ {
+		if gs.r.Keys[i].Size < gs.r.Keys[minIdx].Size {
+			minIdx = i
+		}
+	}
+	if k.Size > gs.r.Keys[minIdx].Size {
+		gs.r.Keys[minIdx] = k
+	}
+}
+
+func (gs *geoStats) result() *report.GeoReport {
+	if gs.r.Count == 0 {
+		return nil
+	}
+	r := gs.r
+	sort.Slice(r.Keys, func(i, j int) bool { return r.Keys[i].Size > r.Keys[j].Size })
+	return &r
+}
@@ -0,0 +1,65 @@
+package rdbviz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hdt3213/rdb/model"
+	"github.com/hdt3213/rdb/parser"
+)
+
+// geoEncode is the score GEOADD stores for lon, lat.
+func geoEncode(lon, lat float64) float64 {
+	cell := float64(uint64(1) << geoStep)
+	lonBits := uint64((lon + 180) / 360 * cell)
+	latBits := uint64((lat + geoLatMax) / (2 * geoLatMax) * cell)
+	var h uint64
+	for i := 0; i < geoStep; i++ {
+		h |= (latBits >> i & 1) << (2 * i)
+		h |= (lonBits >> i & 1) << (2*i + 1)
+	}
+	return float64(h)
+}
+
+func zset(scores ...float64) *parser.ZSetObject {
+	z := &model.ZSetObject{BaseObject: &model.BaseObject{Key: "z"}}
+	for _, s := range scores {
+		z.Entries = append(z.Entries, &model.ZSetEntry{Member: "m", Score: s})
+	}
+	return z
+}
+
+func TestIsGeoZSet(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	micros := func(d time.Duration) float64 { return float64(now.Add(d).UnixMicro()) }
+	cases := []struct {
+		name string
+		z    *parser.ZSetObject
+		want bool
+	}{
+		{"cities", zset(geoEncode(-74.006, 40.7128), geoEncode(-0.1276, 51.5072), geoEncode(116.4074, 39.9042), geoEncode(151.2093, -33.8688)), true},
+		{"new york", zset(geoEncode(-74.006, 40.7128), geoEncode(-73.9855, 40.758)), true},
+		{"san francisco", zset(geoEncode(-122.4194, 37.7749), geoEncode(-122.2711, 37.8044)), true},
+		{"timeline", zset(micros(-72*time.Hour), micros(-time.Hour), micros(-time.Minute)), false},
+		{"rate limiter", zset(micros(-30*time.Second), micros(-2*time.Second), micros(0)), false},
+		{"delay queue", zset(micros(time.Hour), micros(7*24*time.Hour)), false},
+		{"millisecond timeline", zset(float64(now.UnixMilli()), float64(now.UnixMilli()+1000)), false},
+		{"counters", zset(1, 2, 3), false},
+		{"fractional", zset(geoEncode(2.35, 48.85) + 0.5), false},
+	}
+	for _, c := range cases {
+		if got := isGeoZSet(c.z, now); got != c.want {
+			t.Errorf("%s: isGeoZSet = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestGeoDecodeRoundTrip(t *testing.T) {
+	lon, lat := geoDecode(geoEncode(-122.4194, 37.7749))
+	if d := lon + 122.4194; d < -1e-4 || d > 1e-4 {
+		t.Errorf("lon %v", lon)
+	}
+	if d := lat - 37.7749; d < -1e-4 || d > 1e-4 {
+		t.Errorf("lat %v", lat)
+	}
+}
@@ -0,0 +1,119 @@
+package rdbviz
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// LoadAllowlist reads one glob pattern per line; blank lines and lines
+// starting with # are skipped.
+func LoadAllowlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var patterns []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, sc.Err()
+}
+
+type governanceAgg struct {
+	keys   int64
+	size   int64
+	mem    int64
+	sample string
+}
+
+// governanceStats checks every key against an allowlist of approved
+// patterns. Keys matching none are grouped by first-level namespace as
+// unregistered; per-pattern hits show allowlist entries that no longer match
+// anything.
+type governanceStats struct {
+	patterns   []string
+	sep        string
+	topN       int
+	hits       []governanceAgg
+	allowed    governanceAgg
+	rejected   governanceAgg
+	namespaces map[string]*governanceAgg
+}
+
+func newGovernanceStats(patterns []string, sep string, topN int) *governanceStats {
+	return &governanceStats{
+		patterns:   patterns,
+		sep:        sep,
+		topN:       topN,
+		hits:       make([]governanceAgg, len(patterns)),
+		namespaces: map[string]*governanceAgg{},
+	}
+}
+
+func (gs *governanceStats) observe(key string, size, mem int64) {
+	for i, p := range gs.patterns {
+		if GlobMatch(p, key) {
+			gs.hits[i].add(key, size, mem)
+			gs.allowed.add(key, size, mem)
+			return
+		}
+	}
+	gs.rejected.add(key, size, mem)
+	ns := namespaceOf(key, gs.sep)
+	a := gs.namespaces[ns]
+	if a == nil {
+		if len(gs.namespaces) >= maxEvictNamespaces {
+			ns = otherPrefix
+			a = gs.namespaces[ns]
+		}
+		if a == nil {
+			a = &governanceAgg{}
+			gs.namespaces[ns] = a
+		}
+	}
+	a.add(key, size, mem)
+}
+
+func (a *governanceAgg) add(key string, size, mem int64) {
+	if a.keys == 0 {
+		a.sample = key
+	}
+	a.keys++
+	a.size += size
+	a.mem += mem
+}
+
+func (gs *governanceStats) result() *report.GovernanceReport {
+	r := &report.GovernanceReport{
+		Patterns:         make([]report.AllowPattern, len(gs.patterns)),
+		AllowedKeys:      gs.allowed.keys,
+		AllowedSize:      gs.allowed.size,
+		AllowedMem:       gs.allowed.mem,
+		UnregisteredKeys: gs.rejected.keys,
+		UnregisteredSize: gs.rejected.size,
+		UnregisteredMem:  gs.rejected.mem,
+		Unregistered:     make([]report.UnregisteredNamespace, 0, len(gs.namespaces)),
+	}
+	for i, p := range gs.patterns {
+		h := gs.hits[i]
+		r.Patterns[i] = report.AllowPattern{Pattern: p, Keys: h.keys, Size: h.size, EstimatedMem: h.mem}
+	}
+	for ns, a := range gs.namespaces {
+		r.Unregistered = append(r.Unregistered, report.UnregisteredNamespace{Prefix: ns, Keys: a.keys, Size: a.size, EstimatedMem: a.mem, Sample: a.sample})
+	}
+	sort.Slice(r.Unregistered, func(i, j int) bool { return r.Unregistered[i].Size > r.Unregistered[j].Size })
+	if gs.topN > 0 && len(r.Unregistered) > gs.topN {
+		r.Unregistered = r.Unregistered[:gs.topN]
+	}
+	return r
+}
@@ -0,0 +1,157 @@
+package rdbviz
+
+import (
+	"context"
+	"os"
+	"sort"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/memmodel"
+	"rdbviz-tool/pkg/report"
+)
+
+// growthMinBaseKeys keeps tiny prefixes out of the relative ranking, where a
+// handful of new keys would otherwise show as a huge increase.
+const growthMinBaseKeys = 100
+
+// growthStats compares the prefix table of the dump with the same table built
+// from an older dump of the instance (-baseline).
+type growthStats struct {
+	path  string
+	topN  int
+	scale float64
+	base  map[string]prefixAgg
+	cur   map[string]prefixAgg
+	keys  int64
+	size  int64
+	mem   int64
+}
+
+// loadBaseline builds the prefix table of the opts.Baseline dump with the
+// same prefix settings and key sample as the main run, so both sides line up.
+func loadBaseline(ctx context.Context, opts Options, mm memmodel.Model, maxDepth int) (*growthStats, error) {
+	f, err := os.Open(opts.Baseline)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	sep, prefixLen, sampleRate := opts.PrefixSep, opts.PrefixLen, opts.SampleRate
+	gs := &growthStats{path: opts.Baseline, topN: opts.TopN, scale: 1 / sampleRate, base: map[string]prefixAgg{}}
+	fold := &prefixFold{maxEntries: opts.PrefixMaxEntries}
+	progress := newProgressReporter(opts, StageBaseline, stat.Size())
+	dec := parser.NewDecoder(f)
+	err = dec.Parse(func(o parser.RedisObject) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		key := o.GetKey()
+		if key == "" || !sampleKey(key, sampleRate) {
+			return true
+		}
+		progress.tick(o.GetDBIndex(), gs.keys, int64(dec.GetReadCount()))
+		size := getSize(o)
+		mem := mm.Estimate(o)
+		gs.keys++
+		gs.size += size
+		gs.mem += mem
+		if prefixLen > 0 {
+			applyFixedPrefix(gs.base, key, size, mem, noTTL, prefixLen)
+		} else {
+			applyPrefixes(gs.base, key, size, mem, noTTL, sep, maxDepth)
+		}
+		fold.capPrefixes(gs.base)
+		return true
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+// snapshot keeps the counts of the current prefix table before it is pruned.
+func (gs *growthStats) snapshot(agg map[string]prefixAgg) {
+	gs.cur = make(map[string]prefixAgg, len(agg))
+	for p, a := range agg {
+		gs.cur[p] = prefixAgg{Count: a.Count, Size: a.Size, Mem: a.Mem}
+	}
+}
+
+// result ranks prefixes by absolute and relative memory growth. The current
+// side is multiplied by scale and the baseline by its sample rate, so sampled
+// or truncated runs are compared at full size.
+func (gs *growthStats) result(keys, size, mem int64, scale float64) *report.GrowthReport {
+	r := &report.GrowthReport{
+		Baseline:     gs.path,
+		BaseKeys:     scaleCount(gs.keys, gs.scale),
+		BaseSize:     scaleCount(gs.size, gs.scale),
+		BaseMem:      scaleCount(gs.mem, gs.scale),
+		Keys:         scaleCount(keys, scale),
+		Size:         scaleCount(size, scale),
+		EstimatedMem: scaleCount(mem, scale),
+		ByAbsolute:   []report.PrefixGrowth{},
+		ByRelative:   []report.PrefixGrowth{},
+	}
+	r.KeyDelta = r.Keys - r.BaseKeys
+	r.SizeDelta = r.Size - r.BaseSize
+	r.MemDelta = r.EstimatedMem - r.BaseMem
+
+	all := make([]report.PrefixGrowth, 0, len(gs.cur)+len(gs.base))
+	add := func(p string) {
+		b, c := gs.base[p], gs.cur[p]
+		g := report.PrefixGrowth{
+			Prefix:       p,
+			BaseKeys:     scaleCount(b.Count, gs.scale),
+			BaseSize:     scaleCount(b.Size, gs.scale),
+			BaseMem:      scaleCount(b.Mem, gs.scale),
+			Keys:         scaleCount(c.Count, scale),
+			Size:         scaleCount(c.Size, scale),
+			EstimatedMem: scaleCount(c.Mem, scale),
+			New:          b.Count == 0,
+		}
+		g.KeyDelta = g.Keys - g.BaseKeys
+		g.SizeDelta = g.Size - g.BaseSize
+		g.MemDelta = g.EstimatedMem - g.BaseMem
+		g.KeyGrowth = ratio(g.KeyDelta, g.BaseKeys)
+		g.SizeGrowth = ratio(g.SizeDelta, g.BaseSize)
+		g.MemGrowth = ratio(g.MemDelta, g.BaseMem)
+		if r.MemDelta > 0 {
+			g.Share = float64(g.MemDelta) / float64(r.MemDelta)
+		}
+		all = append(all, g)
+	}
+	for p := range gs.cur {
+		add(p)
+	}
+	for p := range gs.base {
+		if _, ok := gs.cur[p]; !ok {
+			add(p)
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].MemDelta > all[j].MemDelta })
+	for _, g := range all {
+		if g.MemDelta <= 0 || (gs.topN > 0 && len(r.ByAbsolute) >= gs.topN) {
+			break
+		}
+		r.ByAbsolute = append(r.ByAbsolute, g)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].MemGrowth > all[j].MemGrowth })
+	for _, g := range all {
+		if g.MemGrowth <= 0 || (gs.topN > 0 && len(r.ByRelative) >= gs.topN) {
+			break
+		}
+		if g.New || g.BaseKeys < growthMinBaseKeys {
+			continue
+		}
+		r.ByRelative = append(r.ByRelative, g)
+	}
+	return r
+}
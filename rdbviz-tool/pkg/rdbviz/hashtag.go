@@ -0,0 +1,162 @@
+package rdbviz
+
+import (
+	"sort"
+	"strings"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// maxHashTags bounds the tags tracked individually; keys with further tags
+// only count toward the totals.
+const maxHashTags = 100000
+
+// maxTagPrefixes bounds the namespaces tracked per tag; further ones are
+// counted under __other__.
+const maxTagPrefixes = 8
+
+type hashTagAgg struct {
+	keys     int64
+	size     int64
+	mem      int64
+	prefixes []report.HashTagPrefix
+}
+
+// addPrefix counts a key of namespace ns under the tag.
+func (a *hashTagAgg) addPrefix(ns string, size int64) {
+	for i := range a.prefixes {
+		if a.prefixes[i].Prefix == ns {
+			a.prefixes[i].Keys++
+			a.prefixes[i].Size += size
+			return
+		}
+	}
+	if len(a.prefixes) >= maxTagPrefixes {
+		ns = otherPrefix
+		for i := range a.prefixes {
+			if a.prefixes[i].Prefix == ns {
+				a.prefixes[i].Keys++
+				a.prefixes[i].Size += size
+				return
+			}
+		}
+	}
+	a.prefixes = append(a.prefixes, report.HashTagPrefix{Prefix: ns, Keys: 1, Size: size})
+}
+
+// hashTagStats reports {hash tag} usage. Every key sharing a tag lands in
+// the same slot, so a tag holding a large share of the data pins it to one
+// node no matter how the cluster is resharded. A tag shared by keys of
+// different first-level namespaces, e.g. user:{42} and order:{42}, is a
+// collision: unrelated data ends up co-located by accident.
+type hashTagStats struct {
+	hotShare  float64
+	sep       string
+	topN      int
+	keys      int64
+	size      int64
+	mem       int64
+	totalSize int64
+	untracked int64
+	tags      map[string]*hashTagAgg
+}
+
+func newHashTagStats(hotShare float64, sep string, topN int) *hashTagStats {
+	return &hashTagStats{hotShare: hotShare, sep: sep, topN: topN, tags: map[string]*hashTagAgg{}}
+}
+
+func (hs *hashTagStats) observe(key string, size, mem int64) {
+	hs.totalSize += size
+	tag, ok := hashTag(key)
+	if !ok {
+		return
+	}
+	hs.keys++
+	hs.size += size
+	hs.mem += mem
+	a := hs.tags[tag]
+	if a == nil {
+		if len(hs.tags) >= maxHashTags {
+			hs.untracked++
+			return
+		}
+		a = &hashTagAgg{}
+		hs.tags[tag] = a
+	}
+	a.keys++
+	a.size += size
+	a.mem += mem
+	if hs.sep != "" {
+		a.addPrefix(tagNamespace(key, hs.sep), size)
+	}
+}
+
+// tagNamespace is the first-level namespace of a tagged key. Keys starting
+// with their tag, like {user:42}:cart, are grouped by the tag itself.
+func tagNamespace(key, sep string) string {
+	if strings.HasPrefix(key, "{") {
+		return "{}"
+	}
+	return namespaceOf(key, sep)
+}
+
+func (hs *hashTagStats) result() *report.HashTagReport {
+	if hs.keys == 0 {
+		return nil
+	}
+	r := &report.HashTagReport{
+		TaggedKeys:   hs.keys,
+		TaggedSize:   hs.size,
+		TaggedMem:    hs.mem,
+		DistinctTags: int64(len(hs.tags)),
+		Untracked:    hs.untracked,
+		HotShare:     hs.hotShare,
+		Collisions:   []report.HashTagCollision{},
+	}
+	list := make([]report.HashTagStat, 0, len(hs.tags))
+	for tag, a := range hs.tags {
+		slot := int(crc16(tag) % clusterSlots)
+		st := report.HashTagStat{
+			Tag:          tag,
+			Slot:         slot,
+			Keys:         a.keys,
+			Size:         a.size,
+			EstimatedMem: a.mem,
+		}
+		if len(a.prefixes) > 1 {
+			r.CollidingTags++
+			r.CollidingKeys += a.keys
+			r.CollidingSize += a.size
+			prefixes := append([]report.HashTagPrefix{}, a.prefixes...)
+			sort.Slice(prefixes, func(i, j int) bool { return prefixes[i].Size > prefixes[j].Size })
+			r.Collisions = append(r.Collisions, report.HashTagCollision{Tag: tag, Slot: slot, Keys: a.keys, Size: a.size, EstimatedMem: a.mem, Prefixes: prefixes})
+		}
+		if hs.totalSize > 0 {
+			st.Share = float64(a.size) / float64(hs.totalSize)
+		}
+		st.Hot = st.Share >= hs.hotShare
+		list = append(list, st)
+	}
+	sort.Slice(r.Collisions, func(i, j int) bool { return r.Collisions[i].Size > r.Collisions[j].Size })
+	if hs.topN > 0 && len(r.Collisions) > hs.topN {
+		r.Collisions = r.Collisions[:hs.topN]
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Size > list[j].Size })
+	hot := 0
+	for hot < len(list) && list[hot].Hot {
+		hot++
+	}
+	r.Hot = hs.top(list[:hot])
+	r.TopBySize = hs.top(list)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Keys > list[j].Keys })
+	r.TopByKeys = hs.top(list)
+	return r
+}
+
+func (hs *hashTagStats) top(list []report.HashTagStat) []report.HashTagStat {
+	n := len(list)
+	if hs.topN > 0 && n > hs.topN {
+		n = hs.topN
+	}
+	return append([]report.HashTagStat{}, list[:n]...)
+}
@@ -0,0 +1,69 @@
+package rdbviz
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hll is a small HyperLogLog counter used for distinct-value estimates where
+// exact sets would not fit in memory.
+type hll struct {
+	p   uint8
+	reg []uint8
+}
+
+func newHLL(p uint8) *hll {
+	return &hll{p: p, reg: make([]uint8, 1<<p)}
+}
+
+func hashString(s string) uint64 {
+	return hashBytes([]byte(s))
+}
+
+func hashBytes(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	// splitmix64 finalizer: FNV alone leaves the high bits poorly mixed
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (h *hll) add(s string) {
+	x := hashString(s)
+	idx := x >> (64 - h.p)
+	rho := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rho > h.reg[idx] {
+		h.reg[idx] = rho
+	}
+}
+
+func (h *hll) merge(o *hll) {
+	for i, v := range o.reg {
+		if v > h.reg[i] {
+			h.reg[i] = v
+		}
+	}
+}
+
+func (h *hll) estimate() int64 {
+	m := float64(len(h.reg))
+	sum := 0.0
+	zeros := 0
+	for _, v := range h.reg {
+		sum += math.Ldexp(1, -int(v))
+		if v == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(e))
+}
@@ -0,0 +1,131 @@
+package rdbviz
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/report"
+)
+
+const (
+	// jsonMaxFields bounds distinct field names tracked per namespace, so
+	// documents keyed by IDs do not grow the map without limit.
+	jsonMaxFields = 1000
+	jsonTopFields = 20
+	// maxJSONNamespaces bounds the namespaces profiled, each with up to
+	// jsonMaxFields fields; further ones are counted under __other__.
+	maxJSONNamespaces = 1000
+)
+
+type jsonField struct {
+	count int64
+	size  int64
+}
+
+type jsonAgg struct {
+	sampled   int64
+	documents int64
+	size      int64
+	fields    map[string]*jsonField
+}
+
+// jsonStats detects JSON documents among sampled string values and profiles
+// the top-level fields of JSON objects per namespace.
+type jsonStats struct {
+	rate     float64
+	sep      string
+	topN     int
+	prefixes map[string]*jsonAgg
+}
+
+func newJSONStats(rate float64, sep string, topN int) *jsonStats {
+	return &jsonStats{rate: rate, sep: sep, topN: topN, prefixes: map[string]*jsonAgg{}}
+}
+
+func (js *jsonStats) observe(o parser.RedisObject) {
+	s, ok := o.(*parser.StringObject)
+	if !ok || len(s.Value) == 0 || !sampleKey(s.Key, js.rate) {
+		return
+	}
+	ns := namespaceOf(s.Key, js.sep)
+	a := js.prefixes[ns]
+	if a == nil {
+		if len(js.prefixes) >= maxJSONNamespaces {
+			ns = otherPrefix
+			a = js.prefixes[ns]
+		}
+		if a == nil {
+			a = &jsonAgg{fields: map[string]*jsonField{}}
+			js.prefixes[ns] = a
+		}
+	}
+	a.sampled++
+	if !looksLikeJSON(s.Value) || !json.Valid(s.Value) {
+		return
+	}
+	a.documents++
+	a.size += int64(len(s.Value))
+
+	var doc map[string]json.RawMessage
+	if json.Unmarshal(s.Value, &doc) != nil {
+		return
+	}
+	for name, raw := range doc {
+		f := a.fields[name]
+		if f == nil {
+			if len(a.fields) >= jsonMaxFields {
+				continue
+			}
+			f = &jsonField{}
+			a.fields[name] = f
+		}
+		f.count++
+		f.size += int64(len(name) + len(raw))
+	}
+}
+
+func looksLikeJSON(v []byte) bool {
+	v = bytes.TrimLeft(v, " \t\r\n")
+	return len(v) > 0 && (v[0] == '{' || v[0] == '[')
+}
+
+func (js *jsonStats) result() *report.JSONReport {
+	r := &report.JSONReport{SampleRate: js.rate, Prefixes: []report.JSONPrefixStat{}}
+	for p, a := range js.prefixes {
+		r.Sampled += a.sampled
+		r.Documents += a.documents
+		if a.documents == 0 {
+			continue
+		}
+		st := report.JSONPrefixStat{
+			Prefix:     p,
+			Sampled:    a.sampled,
+			Documents:  a.documents,
+			Size:       a.size,
+			AvgDocSize: float64(a.size) / float64(a.documents),
+			Fields:     make([]report.JSONField, 0, len(a.fields)),
+		}
+		for name, f := range a.fields {
+			st.Fields = append(st.Fields, report.JSONField{
+				Name:     name,
+				Count:    f.count,
+				Size:     f.size,
+				AvgSize:  float64(f.size) / float64(f.count),
+				Presence: float64(f.count) / float64(a.documents),
+			})
+		}
+		sort.Slice(st.Fields, func(i, j int) bool { return st.Fields[i].Size > st.Fields[j].Size })
+		if len(st.Fields) > jsonTopFields {
+			st.Fields = st.Fields[:jsonTopFields]
+		}
+		r.Prefixes = append(r.Prefixes, st)
+	}
+	sort.Slice(r.Prefixes, func(i, j int) bool { return r.Prefixes[i].Size > r.Prefixes[j].Size })
+	if js.topN > 0 && len(r.Prefixes) > js.topN {
+		r.Prefixes = r.Prefixes[:js.topN]
+	}
+	return r
+}
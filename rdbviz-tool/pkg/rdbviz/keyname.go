@@ -0,0 +1,88 @@
+package rdbviz
+
+import (
+	"sort"
+
+	"rdbviz-tool/pkg/memmodel"
+	"rdbviz-tool/pkg/report"
+)
+
+var keyLenBuckets = []struct {
+	Label string
+	Max   int
+}{
+	{Label: "1-16", Max: 16},
+	{Label: "17-32", Max: 32},
+	{Label: "33-64", Max: 64},
+	{Label: "65-128", Max: 128},
+	{Label: "129-256", Max: 256},
+	{Label: "257-512", Max: 512},
+	{Label: "513-1024", Max: 1024},
+	{Label: ">1024", Max: int(^uint(0) >> 1)},
+}
+
+type keyNameStats struct {
+	mm       memmodel.Model
+	topN     int
+	keys     int64
+	keyBytes int64
+	keyMem   int64
+	totalMem int64
+	buckets  []int64
+	longest  []report.LongKey
+}
+
+func newKeyNameStats(mm memmodel.Model, topN int) *keyNameStats {
+	return &keyNameStats{mm: mm, topN: topN, buckets: make([]int64, len(keyLenBuckets))}
+}
+
+func (ks *keyNameStats) observe(db int, key, objType string, mem int64) {
+	n := len(key)
+	ks.keys++
+	ks.keyBytes += int64(n)
+	ks.keyMem += ks.mm.SDS(n)
+	ks.totalMem += mem
+	for i, b := range keyLenBuckets {
+		if n <= b.Max {
+			ks.buckets[i]++
+			break
+		}
+	}
+
+	if ks.topN <= 0 {
+		return
+	}
+	lk := report.LongKey{DB: db, Key: key, Type: objType, Length: n}
+	if len(ks.longest) < ks.topN {
+		ks.longest = append(ks.longest, lk)
+		return
+	}
+	minIdx := 0
+	for i := 1; i < len(ks.longest); i++ {
+		if ks.longest[i].Length < ks.longest[minIdx].Length {
+			minIdx = i
+		}
+	}
+	if n > ks.longest[minIdx].Length {
+		ks.longest[minIdx] = lk
+	}
+}
+
+func (ks *keyNameStats) result() *report.KeyNameReport {
+	r := &report.KeyNameReport{
+		TotalKeyBytes: ks.keyBytes,
+		KeyMem:        ks.keyMem,
+		ValueMem:      ks.totalMem - ks.keyMem,
+		Buckets:       make([]report.Bucket, len(keyLenBuckets)),
+		Longest:       make([]report.LongKey, len(ks.longest)),
+	}
+	if ks.keys > 0 {
+		r.AvgLength = float64(ks.keyBytes) / float64(ks.keys)
+	}
+	for i, b := range keyLenBuckets {
+		r.Buckets[i] = report.Bucket{Label: b.Label, Count: ks.buckets[i]}
+	}
+	copy(r.Longest, ks.longest)
+	sort.Slice(r.Longest, func(i, j int) bool { return r.Longest[i].Length > r.Longest[j].Length })
+	return r
+}
@@ -0,0 +1,22 @@
+package rdbviz
+
+import (
+	"io"
+	"log/slog"
+	"math"
+)
+
+// LevelTrace is the level of per-key diagnostics, such as records skipped
+// or values that did not decode; there can be one per key, too many for
+// slog.LevelDebug.
+const LevelTrace = slog.LevelDebug - 4
+
+// quietLogger stands in for a nil Options.Logger and logs nothing.
+var quietLogger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.Level(math.MaxInt32)}))
+
+func (o Options) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return quietLogger
+}
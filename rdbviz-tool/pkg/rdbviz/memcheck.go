@@ -0,0 +1,85 @@
+package rdbviz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// memoryCheck runs MEMORY USAGE on a live instance for the first n bigkeys
+// and compares the result with the serialized size and the memory model.
+// SAMPLES 0 makes Redis walk every element, so large keys are measured
+// exactly rather than extrapolated from five.
+func memoryCheck(ctx context.Context, addr, password string, bigKeys []report.BigKey, n int) (*report.MemoryCheck, error) {
+	c, err := dialRedis(ctx, addr, password)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	if n > len(bigKeys) {
+		n = len(bigKeys)
+	}
+	r := &report.MemoryCheck{
+		Addr:      addr,
+		CheckedAt: time.Now().Format(time.RFC3339),
+		Keys:      []report.MemoryCheckKey{},
+		Types:     []report.MemoryCheckType{},
+	}
+	types := map[string]*report.MemoryCheckType{}
+	db := -1
+	for _, bk := range bigKeys[:n] {
+		if bk.DB != db {
+			if _, err := c.do("SELECT", strconv.Itoa(bk.DB)); err != nil {
+				return nil, fmt.Errorf("select %d: %v", bk.DB, err)
+			}
+			db = bk.DB
+		}
+		reply, err := c.do("MEMORY", "USAGE", bk.Key, "SAMPLES", "0")
+		if err != nil {
+			return nil, fmt.Errorf("memory usage %q: %v", bk.Key, err)
+		}
+		live, ok := reply.(int64)
+		if !ok {
+			// deleted or expired since the snapshot
+			r.Missing++
+			continue
+		}
+		k := report.MemoryCheckKey{DB: bk.DB, Key: bk.Key, Type: bk.Type, Size: bk.Size, EstimatedMem: bk.EstimatedMem, LiveMem: live}
+		k.SizeRatio = ratio(live, bk.Size)
+		k.ModelRatio = ratio(live, bk.EstimatedMem)
+		r.Keys = append(r.Keys, k)
+		r.Checked++
+		r.Size += bk.Size
+		r.EstimatedMem += bk.EstimatedMem
+		r.LiveMem += live
+		t := types[bk.Type]
+		if t == nil {
+			t = &report.MemoryCheckType{Type: bk.Type}
+			types[bk.Type] = t
+		}
+		t.Keys++
+		t.Size += bk.Size
+		t.EstimatedMem += bk.EstimatedMem
+		t.LiveMem += live
+	}
+	r.SizeRatio = ratio(r.LiveMem, r.Size)
+	r.ModelRatio = ratio(r.LiveMem, r.EstimatedMem)
+	for _, t := range types {
+		t.SizeRatio = ratio(t.LiveMem, t.Size)
+		t.ModelRatio = ratio(t.LiveMem, t.EstimatedMem)
+		r.Types = append(r.Types, *t)
+	}
+	sort.Slice(r.Types, func(i, j int) bool { return r.Types[i].LiveMem > r.Types[j].LiveMem })
+	return r, nil
+}
+
+func ratio(a, b int64) float64 {
+	if b <= 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
@@ -0,0 +1,192 @@
+package rdbviz
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// Merge combines the per-shard reports at paths into one cluster report
+// without parsing the dumps again, keeping topN prefixes and bigkeys.
+// Cancelling ctx stops loading the reports.
+func Merge(ctx context.Context, paths []string, topN int) (*Report, error) {
+	shards := make([]*shard, 0, len(paths))
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		s, err := loadShard(p)
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, s)
+	}
+	rep, err := mergeReports(shards, topN, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// mergedBigKeySort is the bigkey sort shared by all shards, size otherwise.
+func mergedBigKeySort(shards []*shard) string {
+	sortBy := shards[0].rep.Meta.BigKeySort
+	for _, s := range shards[1:] {
+		if s.rep.Meta.BigKeySort != sortBy {
+			return "size"
+		}
+	}
+	if sortBy == "" {
+		return "size"
+	}
+	return sortBy
+}
+
+// mergeReports sums the shard reports. Each shard only carries its own top
+// prefixes, so a prefix missing from a shard's table counts as zero there and
+// merged prefix totals are lower bounds. Median TTLs and size percentiles
+// cannot be combined and are left out.
+func mergeReports(shards []*shard, topN int, generatedAt string) (report.Report, error) {
+	rep := shardReport(shards, generatedAt)
+	rep.Meta.BigKeySort = mergedBigKeySort(shards)
+	metric, err := bigKeyMetric(rep.Meta.BigKeySort)
+	if err != nil {
+		return rep, err
+	}
+	rep.Meta.PrefixMode = shards[0].rep.Meta.PrefixMode
+	rep.Meta.PrefixLen = shards[0].rep.Meta.PrefixLen
+	rep.Meta.MemAllocator = shards[0].rep.Meta.MemAllocator
+
+	types := map[string]*report.TypeStat{}
+	var ttlBuckets, sizeBuckets [][]report.Bucket
+	var prefixes [][]report.PrefixStat
+	byType := map[string][][]report.PrefixStat{}
+	typeMem := map[string]int64{}
+	var bigKeys []report.BigKey
+	typeBig := map[string][]report.BigKey{}
+	dbBig := map[int][]report.BigKey{}
+	for _, s := range shards {
+		for _, t := range s.rep.Types {
+			m := types[t.Type]
+			if m == nil {
+				m = &report.TypeStat{Type: t.Type}
+				types[t.Type] = m
+			}
+			m.Count += t.Count
+			m.Size += t.Size
+			m.EstimatedMem += t.EstimatedMem
+		}
+		ttlBuckets = append(ttlBuckets, s.rep.TTLBuckets)
+		sizeBuckets = append(sizeBuckets, s.rep.SizeBuckets)
+		prefixes = append(prefixes, s.rep.Prefixes)
+		for _, g := range s.rep.PrefixesByType {
+			byType[g.Type] = append(byType[g.Type], g.Prefixes)
+			typeMem[g.Type] += g.EstimatedMem
+		}
+		bigKeys = append(bigKeys, s.rep.BigKeys...)
+		for _, g := range s.rep.BigKeysByType {
+			typeBig[g.Type] = append(typeBig[g.Type], g.BigKeys...)
+		}
+		for _, g := range s.rep.BigKeysByDB {
+			dbBig[g.DB] = append(dbBig[g.DB], g.BigKeys...)
+		}
+	}
+
+	for _, t := range types {
+		rep.Types = append(rep.Types, *t)
+	}
+	sort.Slice(rep.Types, func(i, j int) bool { return rep.Types[i].Size > rep.Types[j].Size })
+	rep.TTLBuckets = mergeBuckets(ttlBuckets)
+	rep.SizeBuckets = mergeBuckets(sizeBuckets)
+	rep.Prefixes = mergePrefixes(prefixes, topN)
+	for t, lists := range byType {
+		rep.PrefixesByType = append(rep.PrefixesByType, report.PrefixTypeGroup{Type: t, EstimatedMem: typeMem[t], Prefixes: mergePrefixes(lists, topN)})
+	}
+	sort.Slice(rep.PrefixesByType, func(i, j int) bool { return rep.PrefixesByType[i].Type < rep.PrefixesByType[j].Type })
+
+	rep.BigKeys = rankBigKeys(bigKeys, topN, metric)
+	for t, keys := range typeBig {
+		rep.BigKeysByType = append(rep.BigKeysByType, report.TypeBigKeys{Type: t, BigKeys: rankBigKeys(keys, topN, metric)})
+	}
+	sort.Slice(rep.BigKeysByType, func(i, j int) bool { return rep.BigKeysByType[i].Type < rep.BigKeysByType[j].Type })
+	if len(dbBig) > 1 {
+		for db, keys := range dbBig {
+			rep.BigKeysByDB = append(rep.BigKeysByDB, report.DBBigKeys{DB: db, BigKeys: rankBigKeys(keys, topN, metric)})
+		}
+		sort.Slice(rep.BigKeysByDB, func(i, j int) bool { return rep.BigKeysByDB[i].DB < rep.BigKeysByDB[j].DB })
+	}
+	return rep, nil
+}
+
+// mergeBuckets sums histogram buckets by label, in the order of the first
+// list that has them.
+func mergeBuckets(lists [][]report.Bucket) []report.Bucket {
+	out := []report.Bucket{}
+	index := map[string]int{}
+	for _, list := range lists {
+		for _, b := range list {
+			i, ok := index[b.Label]
+			if !ok {
+				i = len(out)
+				index[b.Label] = i
+				out = append(out, report.Bucket{Label: b.Label})
+			}
+			out[i].Count += b.Count
+		}
+	}
+	return out
+}
+
+// mergePrefixes sums prefix tables by prefix. The TTL share is weighted by
+// key count; the largest keys are re-ranked by size, keeping as many per
+// prefix as the shards did.
+func mergePrefixes(lists [][]report.PrefixStat, topN int) []report.PrefixStat {
+	merged := map[string]*report.PrefixStat{}
+	withTTL := map[string]float64{}
+	maxTopKeys := 0
+	for _, list := range lists {
+		for _, p := range list {
+			m := merged[p.Prefix]
+			if m == nil {
+				m = &report.PrefixStat{Prefix: p.Prefix}
+				merged[p.Prefix] = m
+			}
+			m.Count += p.Count
+			m.Size += p.Size
+			m.EstimatedMem += p.EstimatedMem
+			withTTL[p.Prefix] += p.TTLShare * float64(p.Count)
+			m.TopKeys = append(m.TopKeys, p.TopKeys...)
+			if len(p.TopKeys) > maxTopKeys {
+				maxTopKeys = len(p.TopKeys)
+			}
+		}
+	}
+	out := make([]report.PrefixStat, 0, len(merged))
+	for p, m := range merged {
+		if m.Count > 0 {
+			m.TTLShare = withTTL[p] / float64(m.Count)
+		}
+		sort.Slice(m.TopKeys, func(i, j int) bool { return m.TopKeys[i].Size > m.TopKeys[j].Size })
+		if len(m.TopKeys) > maxTopKeys {
+			m.TopKeys = m.TopKeys[:maxTopKeys]
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Size > out[j].Size })
+	if topN > 0 && len(out) > topN {
+		out = out[:topN]
+	}
+	return out
+}
+
+// rankBigKeys sorts bigkeys from several shards by metric and keeps topN.
+func rankBigKeys(keys []report.BigKey, topN int, metric func(report.BigKey) float64) []report.BigKey {
+	out := append([]report.BigKey{}, keys...)
+	sort.SliceStable(out, func(i, j int) bool { return metric(out[i]) > metric(out[j]) })
+	if topN > 0 && len(out) > topN {
+		out = out[:topN]
+	}
+	return out
+}
@@ -0,0 +1,282 @@
+package rdbviz
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/report"
+)
+
+const (
+	migrateMethodMigrate = "migrate"
+	migrateMethodDump    = "dump-restore"
+	migrateChunked       = "chunked"
+	// migrateChunkBytes caps the element bytes per chunked command so it
+	// stays well below the shell's argument limits.
+	migrateChunkBytes = 1 << 20
+	// dumpOverhead is the RDB version and CRC64 trailer DUMP adds to a value.
+	dumpOverhead = 10
+)
+
+// planMigration selects the bigkeys matching pattern. Lists, hashes, sets and
+// sorted sets with more than chunk elements are copied in chunks from the
+// snapshot, since MIGRATE and RESTORE block both instances for the whole key;
+// everything else is moved whole with method.
+func planMigration(bigKeys []report.BigKey, target, pattern, method string, chunk int64) *report.MigrationPlan {
+	p := &report.MigrationPlan{
+		Target:        target,
+		Method:        method,
+		Pattern:       pattern,
+		ChunkElements: chunk,
+		Keys:          []report.MigrationKey{},
+	}
+	for _, bk := range bigKeys {
+		if !GlobMatch(pattern, bk.Key) {
+			continue
+		}
+		k := report.MigrationKey{DB: bk.DB, Key: bk.Key, Type: bk.Type, Elements: bk.Elements, Size: bk.Size, Expiration: bk.Expiration, Method: method, TransferBytes: bk.Size + dumpOverhead}
+		if chunk > 0 && bk.Elements > chunk && chunkable(bk.Type) {
+			k.Method = migrateChunked
+			p.ChunkedKeys++
+		}
+		p.Size += bk.Size
+		p.Keys = append(p.Keys, k)
+	}
+	return p
+}
+
+func chunkable(objType string) bool {
+	switch objType {
+	case "list", "hash", "set", "zset":
+		return true
+	}
+	return false
+}
+
+// writeMigrationScript writes plan as a bash script of redis-cli calls. Keys
+// moved whole come first, in plan order; chunked keys follow in dump order,
+// read from rdbPath in a second pass. Every key is copied, so the source keeps
+// its data until it is deleted by hand. TransferBytes of chunked keys is
+// updated to the element bytes actually written.
+func writeMigrationScript(path, rdbPath, src, dst string, plan *report.MigrationPlan) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	srcHost, srcPort := splitAddr(src)
+	dstHost, dstPort := splitAddr(dst)
+	fmt.Fprintf(w, `#!/usr/bin/env bash
+# Migration plan generated by rdbviz-tool from %s
+# %d keys, %s serialized. Keys are copied: delete them on the source once
+# the target has been verified.
+set -euo pipefail
+SRC_HOST=${SRC_HOST:-%s}
+SRC_PORT=${SRC_PORT:-%s}
+DST_HOST=${DST_HOST:-%s}
+DST_PORT=${DST_PORT:-%s}
+TIMEOUT=${TIMEOUT:-60000}
+src() { redis-cli -h "$SRC_HOST" -p "$SRC_PORT" ${SRC_AUTH:+-a "$SRC_AUTH" --no-auth-warning} "$@"; }
+dst() { redis-cli -h "$DST_HOST" -p "$DST_PORT" ${DST_AUTH:+-a "$DST_AUTH" --no-auth-warning} "$@"; }
+migrate() { src -n "$1" MIGRATE "$DST_HOST" "$DST_PORT" "" "$1" "$TIMEOUT" COPY REPLACE ${DST_AUTH:+AUTH "$DST_AUTH"} KEYS "$2"; }
+dump_restore() {
+	local ttl
+	ttl=$(src -n "$1" PTTL "$2")
+	[ "$ttl" -gt 0 ] || ttl=0
+	dst -n "$1" DEL "$2" >/dev/null
+	src -n "$1" --raw DUMP "$2" | head -c -1 | dst -n "$1" -x RESTORE "$2" "$ttl"
+}
+`, rdbPath, len(plan.Keys), FormatBytes(plan.Size), srcHost, srcPort, dstHost, dstPort)
+
+	chunked := map[string]*report.MigrationKey{}
+	for i := range plan.Keys {
+		k := &plan.Keys[i]
+		if k.Method == migrateChunked {
+			chunked[migrateID(k.DB, k.Key)] = k
+			continue
+		}
+		writeWholeKey(w, k)
+	}
+	if len(chunked) > 0 {
+		if err := writeChunkedKeys(w, rdbPath, chunked, plan); err != nil {
+			return err
+		}
+	}
+	for _, k := range plan.Keys {
+		plan.TransferBytes += k.TransferBytes
+	}
+	return w.Flush()
+}
+
+func writeWholeKey(w *bufio.Writer, k *report.MigrationKey) {
+	fn := "migrate"
+	if k.Method == migrateMethodDump {
+		fn = "dump_restore"
+	}
+	fmt.Fprintf(w, "\n# db%d %s, %s\n%s %d %s\n", k.DB, k.Type, FormatBytes(k.Size), fn, k.DB, shellQuote(k.Key))
+}
+
+func writeChunkedKeys(w *bufio.Writer, rdbPath string, chunked map[string]*report.MigrationKey, plan *report.MigrationPlan) error {
+	f, err := os.Open(rdbPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return parser.NewDecoder(f).Parse(func(o parser.RedisObject) bool {
+		k := chunked[migrateID(o.GetDBIndex(), o.GetKey())]
+		if k == nil {
+			return true
+		}
+		cmd, args := ElementArgs(o)
+		if hasNUL(args) {
+			// NUL bytes cannot be passed as shell arguments
+			k.Method = plan.Method
+			plan.ChunkedKeys--
+			writeWholeKey(w, k)
+			return true
+		}
+		fmt.Fprintf(w, "\n# db%d %s, %d elements, %s, chunked from the snapshot\n", k.DB, k.Type, k.Elements, FormatBytes(k.Size))
+		fmt.Fprintf(w, "dst -n %d DEL %s >/dev/null\n", k.DB, shellQuote(k.Key))
+		k.TransferBytes = 0
+		n := 0
+		var chunkBytes int64
+		flush := func(end int) {
+			fmt.Fprintf(w, "dst -n %d %s %s", k.DB, cmd, shellQuote(k.Key))
+			for _, a := range args[n:end] {
+				w.WriteByte(' ')
+				w.WriteString(shellQuote(a))
+			}
+			w.WriteString(" >/dev/null\n")
+			k.Chunks++
+			n, chunkBytes = end, 0
+		}
+		step := ArgStep(cmd)
+		for i := 0; i < len(args); i += step {
+			for _, a := range args[i : i+step] {
+				chunkBytes += int64(len(a))
+				k.TransferBytes += int64(len(a))
+			}
+			if int64((i+step-n)/step) >= plan.ChunkElements || chunkBytes >= migrateChunkBytes {
+				flush(i + step)
+			}
+		}
+		if n < len(args) {
+			flush(len(args))
+		}
+		if k.Expiration != nil {
+			fmt.Fprintf(w, "dst -n %d PEXPIREAT %s %d >/dev/null\n", k.DB, shellQuote(k.Key), k.Expiration.UnixMilli())
+		}
+		return true
+	})
+}
+
+// ElementArgs returns the write command for a list, set, hash or sorted set
+// and its element arguments, flattened (field value, score member).
+func ElementArgs(o parser.RedisObject) (string, []string) {
+	var cmd string
+	var args []string
+	switch obj := o.(type) {
+	case *parser.ListObject:
+		cmd = "RPUSH"
+		for _, v := range obj.Values {
+			args = append(args, string(v))
+		}
+	case *parser.SetObject:
+		cmd = "SADD"
+		for _, m := range obj.Members {
+			args = append(args, string(m))
+		}
+	case *parser.HashObject:
+		cmd = "HSET"
+		for f, v := range obj.Hash {
+			args = append(args, f, string(v))
+		}
+	case *parser.ZSetObject:
+		cmd = "ZADD"
+		for _, e := range obj.Entries {
+			args = append(args, strconv.FormatFloat(e.Score, 'g', -1, 64), e.Member)
+		}
+	}
+	return cmd, args
+}
+
+// ArgStep is the number of arguments per element: hash fields and sorted set
+// members take two.
+func ArgStep(cmd string) int {
+	if cmd == "HSET" || cmd == "ZADD" {
+		return 2
+	}
+	return 1
+}
+
+func hasNUL(args []string) bool {
+	for _, a := range args {
+		if strings.IndexByte(a, 0) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func migrateID(db int, key string) string {
+	return strconv.Itoa(db) + "\x00" + key
+}
+
+// splitAddr splits host:port, defaulting to the local default instance.
+func splitAddr(addr string) (string, string) {
+	host, port := addr, "6379"
+	if i := strings.LastIndex(addr, ":"); i >= 0 {
+		host, port = addr[:i], addr[i+1:]
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return host, port
+}
+
+// shellQuote quotes s for bash, using $'...' with hex escapes when s holds
+// anything beyond plain printable characters.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	plain, printable := true, true
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x7f {
+			printable = false
+		}
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_-.:/@%+=,", c) >= 0) {
+			plain = false
+		}
+	}
+	if plain {
+		return s
+	}
+	if printable {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	var b bytes.Buffer
+	b.WriteString("$'")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' || c == '\'':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
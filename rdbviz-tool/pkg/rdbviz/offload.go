@@ -0,0 +1,180 @@
+package rdbviz
+
+import (
+	"sort"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// access metadata that is not present in the dump is passed as -1
+const unknownAccess = -1
+
+const (
+	offloadMinIdle = 7 * 24 * 3600
+	offloadMaxFreq = 5
+	// maxOffloadNamespaces bounds the per-namespace totals; keys without
+	// separators would otherwise get one each.
+	maxOffloadNamespaces = 10000
+)
+
+type offloadAgg struct {
+	minSize    int64
+	sep        string
+	topN       int
+	sawIdle    bool
+	sawFreq    bool
+	count      int64
+	savings    int64
+	memSavings int64
+	keys       []report.OffloadCandidate
+	namespaces map[string]*report.OffloadNamespace
+}
+
+func newOffloadAgg(minSize int64, sep string, topN int) *offloadAgg {
+	return &offloadAgg{
+		minSize:    minSize,
+		sep:        sep,
+		topN:       topN,
+		namespaces: map[string]*report.OffloadNamespace{},
+	}
+}
+
+func (a *offloadAgg) observe(db int, key, objType, encoding string, size, mem int64, hasTTL bool, idle, freq int64) {
+	ns := a.namespace(key)
+	n := a.namespaces[ns]
+	if n == nil {
+		if len(a.namespaces) >= maxOffloadNamespaces {
+			ns = otherPrefix
+			n = a.namespaces[ns]
+		}
+		if n == nil {
+			n = &report.OffloadNamespace{Prefix: ns}
+			a.namespaces[ns] = n
+		}
+	}
+	n.TotalSize += size
+
+	if idle != unknownAccess {
+		a.sawIdle = true
+	}
+	if freq != unknownAccess {
+		a.sawFreq = true
+	}
+
+	score, reasons, ok := offloadScore(size, a.minSize, hasTTL, idle, freq)
+	if !ok {
+		return
+	}
+	a.count++
+	a.savings += size
+	a.memSavings += mem
+	n.Count++
+	n.Size += size
+	n.EstimatedMem += mem
+
+	c := report.OffloadCandidate{
+		DB:           db,
+		Key:          key,
+		Type:         objType,
+		Size:         size,
+		EstimatedMem: mem,
+		Score:        score,
+		Reasons:      reasons,
+		Encoding:     encoding,
+	}
+	if idle != unknownAccess {
+		c.Idle = idle
+	}
+	if freq != unknownAccess {
+		c.Freq = freq
+	}
+	a.push(c)
+}
+
+// offloadScore ranks a key for offloading. Large keys without TTL qualify;
+// when LRU/LFU metadata is present, recently used or frequently hit keys are
+// excluded and long-idle ones are boosted.
+func offloadScore(size, minSize int64, hasTTL bool, idle, freq int64) (float64, []string, bool) {
+	if hasTTL || size < minSize {
+		return 0, nil, false
+	}
+	reasons := []string{"no-ttl", "large"}
+	score := float64(size)
+	if idle != unknownAccess {
+		if idle < offloadMinIdle {
+			return 0, nil, false
+		}
+		reasons = append(reasons, "idle")
+		score *= 1 + float64(idle)/float64(24*3600)
+	}
+	if freq != unknownAccess {
+		if freq > offloadMaxFreq {
+			return 0, nil, false
+		}
+		reasons = append(reasons, "rarely-accessed")
+		score /= float64(1 + freq)
+	}
+	return score, reasons, true
+}
+
+func (a *offloadAgg) namespace(key string) string {
+	return namespaceOf(key, a.sep)
+}
+
+func (a *offloadAgg) push(c report.OffloadCandidate) {
+	if a.topN <= 0 {
+		return
+	}
+	if len(a.keys) < a.topN {
+		a.keys = append(a.keys, c)
+		return
+	}
+	minIdx := 0
+	for i := 1; i < len(a.keys); i++ {
+		if a.keys[i].Score < a.keys[minIdx].Score {
+			minIdx = i
+		}
+	}
+	if c.Score > a.keys[minIdx].Score {
+		a.keys[minIdx] = c
+	}
+}
+
+func (a *offloadAgg) result() *report.OffloadReport {
+	signals := []string{"size", "ttl"}
+	if a.sawIdle {
+		signals = append(signals, "idle")
+	}
+	if a.sawFreq {
+		signals = append(signals, "freq")
+	}
+
+	keys := make([]report.OffloadCandidate, len(a.keys))
+	copy(keys, a.keys)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Score > keys[j].Score })
+
+	namespaces := make([]report.OffloadNamespace, 0, len(a.namespaces))
+	for _, n := range a.namespaces {
+		if n.Count == 0 {
+			continue
+		}
+		if n.TotalSize > 0 {
+			n.Share = float64(n.Size) / float64(n.TotalSize)
+		}
+		namespaces = append(namespaces, *n)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Size > namespaces[j].Size })
+	if a.topN > 0 && len(namespaces) > a.topN {
+		namespaces = namespaces[:a.topN]
+	}
+
+	return &report.OffloadReport{
+		Signals:             signals,
+		MinSize:             a.minSize,
+		CandidateKeys:       a.count,
+		ProjectedSavings:    a.savings,
+		ProjectedMemSavings: a.memSavings,
+		Keys:                keys,
+		Namespaces:          namespaces,
+	}
+}
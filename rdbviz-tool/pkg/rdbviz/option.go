@@ -0,0 +1,105 @@
+package rdbviz
+
+import (
+	"log/slog"
+	"time"
+
+	"rdbviz-tool/pkg/memmodel"
+)
+
+// Option sets one part of the Options an Analyzer is built with. Fields
+// without a With function can be set by an Option of one's own:
+//
+//	rdbviz.NewAnalyzer(rdbviz.WithTopN(100), func(o *rdbviz.Options) { o.Slots = true })
+type Option func(*Options)
+
+// NewAnalyzer returns an Analyzer with the CLI defaults changed by options,
+// applied in order, after validating the result.
+func NewAnalyzer(options ...Option) (*Analyzer, error) {
+	opts := DefaultOptions()
+	for _, o := range options {
+		o(&opts)
+	}
+	return New(opts)
+}
+
+// WithPrefixSeparator sets the separator keys are split into prefixes on
+// (-prefix-sep, default ":").
+func WithPrefixSeparator(sep string) Option {
+	return func(o *Options) { o.PrefixSep = sep }
+}
+
+// WithPrefixDepth sets how many segments prefixes keep (-prefix-depth,
+// default 3).
+func WithPrefixDepth(depth int) Option {
+	return func(o *Options) {
+		o.PrefixDepth = depth
+		o.PrefixAutoDepth = false
+	}
+}
+
+// WithAutoPrefixDepth splits prefixes while they group more than minKeys
+// keys (-prefix-depth auto -prefix-min-keys).
+func WithAutoPrefixDepth(minKeys int64) Option {
+	return func(o *Options) {
+		o.PrefixAutoDepth = true
+		o.PrefixMinKeys = minKeys
+	}
+}
+
+// WithTopN sets the size of the top lists (-topn, default 50).
+func WithTopN(n int) Option {
+	return func(o *Options) { o.TopN = n }
+}
+
+// WithMemoryModel sets the memory model estimated_mem is computed with
+// (-allocator, default jemalloc).
+func WithMemoryModel(m memmodel.Model) Option {
+	return func(o *Options) { o.Allocator = m.Allocator }
+}
+
+// WithSampling analyzes a fraction of the keys and at most maxKeys of them,
+// 0 for no limit (-sample, -max-keys).
+func WithSampling(rate float64, maxKeys int64) Option {
+	return func(o *Options) {
+		o.SampleRate = rate
+		o.MaxKeys = maxKeys
+	}
+}
+
+// WithWorkers sets how many goroutines prepare keys for the aggregation
+// (-workers, default GOMAXPROCS).
+func WithWorkers(n int) Option {
+	return func(o *Options) { o.Workers = n }
+}
+
+// WithProgress passes the progress of the analysis to fn at most once per
+// interval (-progress). Without it nothing is reported.
+func WithProgress(interval time.Duration, fn func(Progress)) Option {
+	return func(o *Options) {
+		o.Progress = interval
+		o.OnProgress = fn
+	}
+}
+
+// WithPartialOnCancel keeps the report of the keys read so far when the
+// context is cancelled during the parse (-partial-on-interrupt).
+func WithPartialOnCancel() Option {
+	return func(o *Options) { o.PartialOnCancel = true }
+}
+
+// WithClassifier assigns every key a group, owner and labels (-classify).
+func WithClassifier(c Classifier) Option {
+	return func(o *Options) { o.Classifier = c }
+}
+
+// WithLogger sends the analysis diagnostics to l, see Options.Logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) { o.Logger = l }
+}
+
+// WithStages passes every stage of the analysis to fn as it ends, see
+// Options.OnStage.
+func WithStages(fn func(StageTiming)) Option {
+	return func(o *Options) { o.OnStage = fn }
+}
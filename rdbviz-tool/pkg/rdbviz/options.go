@@ -0,0 +1,238 @@
+package rdbviz
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"rdbviz-tool/pkg/memmodel"
+)
+
+// Options configures an analysis. Every field mirrors an rdbviz-tool flag of
+// the same name, and validation errors name the flag; DefaultOptions returns
+// the CLI defaults.
+type Options struct {
+	// Prefix grouping (-prefix-sep, -prefix-depth, -prefix-min-keys,
+	// -prefix-len). PrefixAutoDepth splits prefixes while they group more
+	// than PrefixMinKeys keys instead of stopping at PrefixDepth.
+	PrefixSep       string
+	PrefixDepth     int
+	PrefixAutoDepth bool
+	PrefixMinKeys   int64
+	PrefixLen       int
+	// Size of the top lists (-topn).
+	TopN int
+	// OnProgress, when set, receives the progress of the analysis at most
+	// once per Progress interval; 0 disables it (-progress). Nothing is
+	// reported when OnProgress is nil.
+	OnProgress func(Progress)
+	Progress   time.Duration
+	// OnStage, when set, receives every stage of the analysis as it ends,
+	// e.g. to trace it; it is called on the analyzing goroutine.
+	OnStage func(StageTiming)
+	// Workers is how many goroutines compute key sizes, memory and classes
+	// while the decoder reads ahead (-workers); 1 runs the analysis on the
+	// calling goroutine only.
+	Workers int
+	// ReadBuffer is the size of the buffer the dump is read through, 0 for
+	// the decoder's own 4 KB (-read-buffer). ReadAhead fills a second buffer
+	// of the same size on its own goroutine while the first is parsed, for
+	// dumps on slow network filesystems (-read-ahead).
+	ReadBuffer int
+	ReadAhead  bool
+	// MaxReadRate caps how fast the dump is read, in bytes per second; 0 for
+	// no limit (-max-read-rate).
+	MaxReadRate int64
+	// MaxMem, when positive, caps the estimated size of the prefix tables
+	// and dedup hashes: past it they are spilled to temporary files in
+	// SpillDir (the system default when empty) and merged at the end
+	// (-max-mem, -spill-dir).
+	MaxMem   int64
+	SpillDir string
+	// Logger receives diagnostics: the dump's aux fields, spills and the
+	// parse totals at debug level, and per-key oddities such as skipped
+	// records or undecodable values at LevelTrace. Nil logs nothing.
+	Logger *slog.Logger
+	// PartialOnCancel keeps the report of the keys read so far when the
+	// context is cancelled during the parse (-partial-on-interrupt).
+	PartialOnCancel bool
+	// Instance and Shard label the report's meta with the Redis instance and
+	// shard the dump came from, which serve -history groups runs by
+	// (-instance, -shard).
+	Instance string
+	Shard    string
+
+	SuffixDepth      int  // -suffix-depth
+	Patterns         bool // -patterns
+	PatternMax       int  // -pattern-max
+	PrefixTopKeys    int  // -prefix-top-keys
+	PrefixMaxEntries int  // -prefix-max-entries
+	// PrefixChildren estimates the distinct next segments under each listed
+	// prefix with a HyperLogLog (-prefix-children).
+	PrefixChildren bool
+	// PrefixSketch, when positive, counts each prefix table in a SpaceSaving
+	// sketch of that many prefixes instead of an exact map, bounding memory
+	// at the cost of approximate totals (-prefix-sketch).
+	PrefixSketch int
+
+	BigKeysByType bool   // -bigkeys-by-type
+	BigKeysByDB   bool   // -bigkeys-by-db
+	BigKeySort    string // -bigkey-sort
+
+	Allocator  string  // -allocator
+	SampleRate float64 // -sample
+	MaxKeys    int64   // -max-keys
+	PerDB      bool    // -per-db
+
+	Slots            bool    // -slots
+	HotSlotFactor    float64 // -hot-slot-factor
+	HashTagHot       float64 // -hashtag-hot
+	Reshard          int     // -reshard
+	BalanceTolerance float64 // -balance-tolerance, for AnalyzeShards
+
+	TTLRules          TTLRules          // -ttl-rule
+	MaxMemory         int64             // -maxmemory
+	OffloadMinSize    int64             // -offload-min-size
+	CandidateMinSize  int64             // -candidate-min-size
+	CandidatePolicies CandidatePolicies // -candidate-policy
+	// Allowlist holds the approved key patterns read from -allowlist, see
+	// LoadAllowlist.
+	Allowlist []string
+	// Classifier, when set, assigns every key a group, owner and labels,
+	// reported as classes; -classify loads a RuleClassifier, see
+	// LoadClassRules.
+	Classifier  Classifier
+	ExpirySpike float64 // -expiry-spike
+
+	DedupMinSize   int64   // -dedup-min-size
+	DedupSample    float64 // -dedup-sample
+	Compress       string  // -compress
+	CompressSample float64 // -compress-sample
+	EntropySample  float64 // -entropy-sample
+	JSONSample     float64 // -json-sample
+	FormatSample   float64 // -format-sample
+	CrossDBSample  float64 // -crossdb-sample, with PerDB
+
+	// Baseline is an older dump of the same instance to rank prefix growth
+	// against (-baseline).
+	Baseline string
+
+	LiveAddr       string  // -live-addr
+	LivePassword   string  // -live-password
+	Drift          bool    // -drift
+	DriftThreshold float64 // -drift-threshold
+	MemoryCheck    int     // -memory-check
+
+	MigrateTarget string // -migrate-target
+	MigrateScript string // -migrate-script
+	MigrateKeys   string // -migrate-keys
+	MigrateMethod string // -migrate-method
+	MigrateChunk  int64  // -migrate-chunk
+}
+
+// DefaultOptions returns the options rdbviz-tool runs with when no flags are
+// given.
+func DefaultOptions() Options {
+	return Options{
+		PrefixSep:        ":",
+		PrefixDepth:      3,
+		PrefixMinKeys:    100,
+		TopN:             50,
+		Workers:          runtime.GOMAXPROCS(0),
+		Progress:         5 * time.Second,
+		ReadBuffer:       1 << 20,
+		Patterns:         true,
+		PatternMax:       10000,
+		PrefixTopKeys:    5,
+		PrefixMaxEntries: 1000000,
+		PrefixChildren:   true,
+		BigKeysByType:    true,
+		BigKeysByDB:      true,
+		BigKeySort:       "size",
+		Allocator:        memmodel.Jemalloc,
+		SampleRate:       1,
+		HotSlotFactor:    10,
+		HashTagHot:       0.01,
+		BalanceTolerance: 0.05,
+		OffloadMinSize:   100 * 1024,
+		CandidateMinSize: 10 * 1024,
+		ExpirySpike:      0.01,
+		DedupMinSize:     1024,
+		DedupSample:      0.01,
+		CompressSample:   0.01,
+		EntropySample:    0.01,
+		JSONSample:       0.01,
+		FormatSample:     0.01,
+		CrossDBSample:    0.1,
+		Drift:            true,
+		DriftThreshold:   0.1,
+		MigrateScript:    "migrate.sh",
+		MigrateKeys:      "*",
+		MigrateMethod:    migrateMethodMigrate,
+		MigrateChunk:     10000,
+	}
+}
+
+// Validate checks the options for values the analysis cannot run with.
+func (o Options) Validate() error {
+	if o.Allocator != memmodel.Jemalloc && o.Allocator != memmodel.Libc {
+		return errors.New("-allocator must be jemalloc or libc")
+	}
+	if _, err := bigKeyMetric(o.BigKeySort); err != nil {
+		return err
+	}
+	switch {
+	case o.Workers < 1:
+		return errors.New("-workers must be at least 1")
+	case o.PrefixSketch < 0:
+		return errors.New("-prefix-sketch must not be negative")
+	case o.PrefixSketch > 0 && o.PrefixSketch < o.TopN:
+		return errors.New("-prefix-sketch must be at least -topn")
+	case o.ReadBuffer < 0:
+		return errors.New("-read-buffer must not be negative")
+	case o.ReadAhead && o.ReadBuffer == 0:
+		return errors.New("-read-ahead needs -read-buffer")
+	case o.MaxReadRate < 0:
+		return errors.New("-max-read-rate must not be negative")
+	case o.MaxMem < 0:
+		return errors.New("-max-mem must not be negative")
+	case o.SampleRate <= 0 || o.SampleRate > 1:
+		return errors.New("-sample must be in (0, 1]")
+	case o.CompressSample <= 0 || o.CompressSample > 1:
+		return errors.New("-compress-sample must be in (0, 1]")
+	case o.HashTagHot <= 0 || o.HashTagHot > 1:
+		return errors.New("-hashtag-hot must be in (0, 1]")
+	case o.HotSlotFactor <= 0:
+		return errors.New("-hot-slot-factor must be positive")
+	case o.EntropySample < 0 || o.EntropySample > 1:
+		return errors.New("-entropy-sample must be in [0, 1]")
+	case o.JSONSample < 0 || o.JSONSample > 1:
+		return errors.New("-json-sample must be in [0, 1]")
+	case o.FormatSample < 0 || o.FormatSample > 1:
+		return errors.New("-format-sample must be in [0, 1]")
+	case o.CrossDBSample < 0 || o.CrossDBSample > 1:
+		return errors.New("-crossdb-sample must be in [0, 1]")
+	case o.MemoryCheck < 0:
+		return errors.New("-memory-check must not be negative")
+	case o.MemoryCheck > 0 && o.LiveAddr == "":
+		return errors.New("-memory-check needs -live-addr")
+	case o.Reshard < 0 || o.Reshard > clusterSlots:
+		return fmt.Errorf("-reshard must be between 0 and %d", clusterSlots)
+	case o.BalanceTolerance < 0:
+		return errors.New("-balance-tolerance must not be negative")
+	case o.MigrateMethod != migrateMethodMigrate && o.MigrateMethod != migrateMethodDump:
+		return errors.New("-migrate-method must be migrate or dump-restore")
+	case o.MigrateChunk < 0:
+		return errors.New("-migrate-chunk must not be negative")
+	case o.DriftThreshold < 0:
+		return errors.New("-drift-threshold must not be negative")
+	case o.DedupSample <= 0 || o.DedupSample > 1:
+		return errors.New("-dedup-sample must be in (0, 1]")
+	}
+	if o.Compress != "" && o.Compress != compressGzip && o.Compress != compressZstd {
+		return fmt.Errorf("unknown compression %q (gzip, zstd)", o.Compress)
+	}
+	return nil
+}
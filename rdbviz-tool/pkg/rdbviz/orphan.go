@@ -0,0 +1,70 @@
+package rdbviz
+
+import (
+	"sort"
+	"strings"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// orphanStats collects keys without the prefix separator. They belong to no
+// namespace, so prefix tables show each as its own group, and they are often
+// leftovers from debugging or from a bug building key names.
+type orphanStats struct {
+	sep     string
+	topN    int
+	keys    int64
+	size    int64
+	mem     int64
+	types   map[string]int64
+	samples []report.OrphanKey
+}
+
+func newOrphanStats(sep string, topN int) *orphanStats {
+	return &orphanStats{sep: sep, topN: topN, types: map[string]int64{}}
+}
+
+func (st *orphanStats) observe(db int, key, objType string, size, mem int64) {
+	if st.sep == "" || strings.Contains(key, st.sep) {
+		return
+	}
+	st.keys++
+	st.size += size
+	st.mem += mem
+	st.types[objType]++
+	st.push(report.OrphanKey{DB: db, Key: key, Type: objType, Size: size, EstimatedMem: mem})
+}
+
+func (st *orphanStats) push(k report.OrphanKey) {
+	if st.topN <= 0 {
+		return
+	}
+	if len(st.samples) < st.topN {
+		st.samples = append(st.samples, k)
+		return
+	}
+	minIdx := 0
+	for i := 1; i < len(st.samples); i++ {
+		if st.samples[i].Size < st.samples[minIdx].Size {
+			minIdx = i
+		}
+	}
+	if k.Size > st.samples[minIdx].Size {
+		st.samples[minIdx] = k
+	}
+}
+
+func (st *orphanStats) result() *report.OrphanReport {
+	if st.keys == 0 {
+		return nil
+	}
+	r := &report.OrphanReport{
+		Keys:         st.keys,
+		Size:         st.size,
+		EstimatedMem: st.mem,
+		Types:        st.types,
+		Samples:      append([]report.OrphanKey{}, st.samples...),
+	}
+	sort.Slice(r.Samples, func(i, j int) bool { return r.Samples[i].Size > r.Samples[j].Size })
+	return r
+}
@@ -0,0 +1,259 @@
+package rdbviz
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLPWriter exports an analysis to an OpenTelemetry collector over
+// OTLP/HTTP with the JSON encoding: a trace with a root "rdbviz.analyze"
+// span and a child span per stage, and metrics for the duration of the
+// analysis and of each stage, the parse throughput and the gauges of
+// MetricsWriter ("rdbviz.keys", "rdbviz.type.estimated_memory_bytes" with
+// a "type" attribute, and so on).
+//
+// Pass RecordStage as Options.OnStage, then write the report. An
+// OTLPWriter keeps the stages of one analysis: use one per analysis.
+type OTLPWriter struct {
+	// Endpoint is the base URL of the collector, e.g.
+	// "http://localhost:4318"; /v1/traces and /v1/metrics are appended.
+	Endpoint string
+	// Headers are sent with every request, e.g. an API key of the backend.
+	Headers map[string]string
+	// ServiceName is the service.name of the resource; empty for "rdbviz".
+	ServiceName string
+	// Attributes are added to the resource, e.g. "deployment.environment".
+	Attributes map[string]string
+	// Client sends the requests; nil for one with a 30s timeout.
+	Client *http.Client
+
+	stages []StageTiming
+}
+
+// RecordStage keeps s for the trace and the metrics.
+func (w *OTLPWriter) RecordStage(s StageTiming) {
+	w.stages = append(w.stages, s)
+}
+
+// WriteReport exports the trace of the recorded stages, then the metrics.
+func (w *OTLPWriter) WriteReport(rep *Report) error {
+	if len(w.stages) == 0 {
+		return errors.New("otlp: no stages recorded, is RecordStage set as Options.OnStage?")
+	}
+	resource := otlpResource{Attributes: w.resourceAttributes(rep)}
+	scope := otlpScope{Name: "rdbviz"}
+	start, end := w.stages[0].Start, w.stages[len(w.stages)-1].End
+
+	traceID, rootID := otlpID(16), otlpID(8)
+	spans := []otlpSpan{{
+		TraceID: traceID, SpanID: rootID, Name: "rdbviz.analyze", Kind: otlpSpanInternal,
+		Start: otlpTime(start), End: otlpTime(end),
+		Attributes: []otlpAttribute{
+			otlpString("rdbviz.source", rep.Meta.Source),
+			otlpInt("rdbviz.keys", rep.Summary.TotalKeys),
+		},
+	}}
+	for _, s := range w.stages {
+		span := otlpSpan{
+			TraceID: traceID, SpanID: otlpID(8), ParentSpanID: rootID, Name: "rdbviz." + s.Stage, Kind: otlpSpanInternal,
+			Start: otlpTime(s.Start), End: otlpTime(s.End),
+			Attributes: []otlpAttribute{otlpInt("rdbviz.keys", s.Keys)},
+		}
+		if s.Bytes > 0 {
+			span.Attributes = append(span.Attributes, otlpInt("rdbviz.bytes_read", s.Bytes))
+		}
+		if s.Err != nil {
+			span.Status = &otlpStatus{Code: otlpStatusError, Message: s.Err.Error()}
+		}
+		spans = append(spans, span)
+	}
+	traces := map[string]any{"resourceSpans": []any{map[string]any{
+		"resource":   resource,
+		"scopeSpans": []any{map[string]any{"scope": scope, "spans": spans}},
+	}}}
+	if err := w.post("/v1/traces", traces); err != nil {
+		return err
+	}
+
+	now := otlpTime(time.Now())
+	var metrics []otlpMetric
+	gauge := func(name, unit, desc string, p otlpPoint) {
+		p.Time = now
+		for i := range metrics {
+			if metrics[i].Name == name {
+				metrics[i].Gauge.DataPoints = append(metrics[i].Gauge.DataPoints, p)
+				return
+			}
+		}
+		metrics = append(metrics, otlpMetric{Name: name, Unit: unit, Description: desc, Gauge: &otlpGauge{DataPoints: []otlpPoint{p}}})
+	}
+	seconds := func(d time.Duration) *float64 {
+		v := d.Seconds()
+		return &v
+	}
+	gauge("rdbviz.analysis.duration", "s", "Duration of the analysis.", otlpPoint{Double: seconds(end.Sub(start))})
+	for _, s := range w.stages {
+		gauge("rdbviz.stage.duration", "s", "Duration of each stage of the analysis.",
+			otlpPoint{Double: seconds(s.Duration()), Attributes: []otlpAttribute{otlpString("stage", s.Stage)}})
+		if s.Stage == StageParse && s.Duration() > 0 {
+			rate := float64(s.Bytes) / s.Duration().Seconds()
+			gauge("rdbviz.analysis.throughput", "By/s", "Bytes of the dump parsed per second.", otlpPoint{Double: &rate})
+			keyRate := float64(s.Keys) / s.Duration().Seconds()
+			gauge("rdbviz.analysis.key_rate", "{key}/s", "Keys analyzed per second.", otlpPoint{Double: &keyRate})
+		}
+	}
+	reportGauges(rep, func(name string, v int64, group, value string) {
+		p := otlpPoint{Int: strconv.FormatInt(v, 10)}
+		if group != "" {
+			p.Attributes = []otlpAttribute{otlpString(group, value)}
+			name = group + "." + name
+		}
+		gauge("rdbviz."+name, "", "", p)
+	})
+	return w.post("/v1/metrics", map[string]any{"resourceMetrics": []any{map[string]any{
+		"resource":     resource,
+		"scopeMetrics": []any{map[string]any{"scope": scope, "metrics": metrics}},
+	}}})
+}
+
+func (w *OTLPWriter) resourceAttributes(rep *Report) []otlpAttribute {
+	name := w.ServiceName
+	if name == "" {
+		name = "rdbviz"
+	}
+	attrs := []otlpAttribute{otlpString("service.name", name)}
+	keys := make([]string, 0, len(w.Attributes))
+	for k := range w.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs = append(attrs, otlpString(k, w.Attributes[k]))
+	}
+	if rep.Meta.Instance != "" {
+		attrs = append(attrs, otlpString("rdbviz.instance", rep.Meta.Instance))
+	}
+	if rep.Meta.Shard != "" {
+		attrs = append(attrs, otlpString("rdbviz.shard", rep.Meta.Shard))
+	}
+	return attrs
+}
+
+func (w *OTLPWriter) post(path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(w.Endpoint, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("otlp: %s: %s: %s", path, res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// The OTLP/JSON messages, as far as they are used here. 64-bit integers
+// are strings in the proto3 JSON mapping, IDs are hex.
+
+const (
+	otlpSpanInternal = 1
+	otlpStatusError  = 2
+)
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Int    string  `json:"intValue,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Unit        string     `json:"unit,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Gauge       *otlpGauge `json:"gauge"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpPoint `json:"dataPoints"`
+}
+
+type otlpPoint struct {
+	Time       string          `json:"timeUnixNano"`
+	Int        string          `json:"asInt,omitempty"`
+	Double     *float64        `json:"asDouble,omitempty"`
+	Attributes []otlpAttribute `json:"attributes,omitempty"`
+}
+
+func otlpString(key, v string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{String: &v}}
+}
+
+func otlpInt(key string, v int64) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{Int: strconv.FormatInt(v, 10)}}
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpID returns a random ID of n bytes.
+func otlpID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
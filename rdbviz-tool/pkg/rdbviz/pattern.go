@@ -0,0 +1,171 @@
+package rdbviz
+
+import (
+	"sort"
+	"strings"
+
+	"rdbviz-tool/pkg/report"
+)
+
+const (
+	placeholderID   = "{id}"
+	placeholderUUID = "{uuid}"
+	placeholderHash = "{hash}"
+	placeholderTag  = "{tag}"
+)
+
+type patternAgg struct {
+	count   int64
+	size    int64
+	mem     int64
+	example string
+	values  *hll
+}
+
+// patternStats collapses IDs inside key names to placeholders and tracks
+// per-pattern counts, sizes and the cardinality of the first placeholder.
+type patternStats struct {
+	sep      string
+	max      int
+	patterns map[string]*patternAgg
+	overflow patternAgg
+}
+
+func newPatternStats(sep string, max int) *patternStats {
+	return &patternStats{sep: sep, max: max, patterns: map[string]*patternAgg{}}
+}
+
+func (ps *patternStats) observe(key string, size, mem int64) {
+	pattern, value := normalizeKey(key, ps.sep)
+	a := ps.patterns[pattern]
+	if a == nil {
+		if ps.max > 0 && len(ps.patterns) >= ps.max {
+			ps.overflow.count++
+			ps.overflow.size += size
+			ps.overflow.mem += mem
+			return
+		}
+		a = &patternAgg{example: key}
+		if value != "" {
+			a.values = newHLL(10)
+		}
+		ps.patterns[pattern] = a
+	}
+	a.count++
+	a.size += size
+	a.mem += mem
+	if a.values != nil {
+		a.values.add(value)
+	}
+}
+
+// normalizeKey replaces numeric IDs, UUIDs and hex hashes (bare or wrapped in
+// a {hash tag}) in the segments of key with placeholders. It returns the
+// pattern and the first replaced value.
+func normalizeKey(key, sep string) (string, string) {
+	var parts []string
+	if sep == "" {
+		parts = []string{key}
+	} else {
+		parts = strings.Split(key, sep)
+	}
+	first := ""
+	changed := false
+	for i, p := range parts {
+		ph := placeholderFor(p)
+		if ph == "" {
+			continue
+		}
+		if !changed {
+			first = p
+			changed = true
+		}
+		parts[i] = ph
+	}
+	if !changed {
+		return key, ""
+	}
+	return strings.Join(parts, sep), first
+}
+
+func placeholderFor(s string) string {
+	switch {
+	case s == "":
+		return ""
+	case isDigits(s):
+		return placeholderID
+	case isUUID(s):
+		return placeholderUUID
+	case len(s) >= 8 && isHex(s) && hasDigit(s):
+		return placeholderHash
+	case len(s) > 2 && s[0] == '{' && s[len(s)-1] == '}' && placeholderFor(s[1:len(s)-1]) != "":
+		return placeholderTag
+	}
+	return ""
+}
+
+func hasDigit(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i : i+1]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (ps *patternStats) result(topN int) []report.PatternStat {
+	list := make([]report.PatternStat, 0, len(ps.patterns)+1)
+	for p, a := range ps.patterns {
+		st := report.PatternStat{Pattern: p, Count: a.count, Size: a.size, EstimatedMem: a.mem, Example: a.example}
+		if a.values != nil {
+			st.Cardinality = a.values.estimate()
+		}
+		list = append(list, st)
+	}
+	if ps.overflow.count > 0 {
+		list = append(list, report.PatternStat{Pattern: otherPrefix, Count: ps.overflow.count, Size: ps.overflow.size, EstimatedMem: ps.overflow.mem})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Size > list[j].Size })
+	if topN > 0 && len(list) > topN {
+		list = list[:topN]
+	}
+	return list
+}
@@ -0,0 +1,153 @@
+package rdbviz
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hdt3213/rdb/parser"
+)
+
+// pipelineDepth is how many keys per worker may wait between the decoder,
+// the workers and the aggregation.
+const pipelineDepth = 64
+
+// dumpDecoder is the part of the rdb decoder parseDump drives.
+type dumpDecoder interface {
+	Parse(cb func(parser.RedisObject) bool) error
+	GetReadCount() int
+}
+
+// parseDump runs the decoder over the dump, passes aux fields to onAux and
+// every key to analyze to prepare, which computes its size, memory and
+// class, then to consume in dump order. consume returning false ends the
+// parse. truncated reports a stop at MaxKeys, cancelled one by ctx.
+//
+// With one worker everything runs on the calling goroutine. With more, the
+// decoder runs on its own goroutine and feeds opts.Workers goroutines running
+// prepare through a bounded channel, while consume, and with it every
+// aggregator, stays on the calling goroutine and sees the keys in the same
+// order as a serial run, so the report does not depend on the worker count.
+// A panic in prepare or consume ends the parse with an error either way, as
+// the decoder turns its own panics and those of a serial run into one.
+func parseDump(ctx context.Context, dec dumpDecoder, sniffer *accessSniffer, opts Options, onAux func(*parser.AuxObject),
+	prepare func(o parser.RedisObject, idle, freq int64) KeyRecord, consume func(rec KeyRecord, read int64) bool) (truncated, cancelled bool, err error) {
+	var keys int64
+	each := func(emit func(o parser.RedisObject, idle, freq, read int64) bool) error {
+		return dec.Parse(func(o parser.RedisObject) bool {
+			idle, freq := sniffer.next(int64(dec.GetReadCount()))
+			switch obj := o.(type) {
+			case *parser.AuxObject:
+				onAux(obj)
+				return true
+			case *parser.DBSizeObject:
+				return true
+			}
+			key := o.GetKey()
+			if key == "" {
+				opts.logger().Log(ctx, LevelTrace, "skipped record without key", "type", o.GetType(), "offset", dec.GetReadCount())
+				return true
+			}
+			if ctx.Err() != nil {
+				cancelled = true
+				return false
+			}
+			if opts.MaxKeys > 0 && keys >= opts.MaxKeys {
+				truncated = true
+				return false
+			}
+			if !sampleKey(key, opts.SampleRate) {
+				return true
+			}
+			keys++
+			return emit(o, idle, freq, int64(dec.GetReadCount()))
+		})
+	}
+
+	if opts.Workers <= 1 {
+		err = each(func(o parser.RedisObject, idle, freq, read int64) bool {
+			return consume(prepare(o, idle, freq), read)
+		})
+		return truncated, cancelled, err
+	}
+
+	type job struct {
+		o          parser.RedisObject
+		idle, freq int64
+		read       int64
+		rec        KeyRecord
+		err        error // a panic of prepare
+		done       chan struct{}
+	}
+	// every job goes to the workers and, in dump order, to the aggregation,
+	// which waits for it to be prepared
+	jobs := make(chan *job, opts.Workers*pipelineDepth)
+	ordered := make(chan *job, opts.Workers*pipelineDepth)
+	stop := make(chan struct{})
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		err = each(func(o parser.RedisObject, idle, freq, read int64) bool {
+			j := &job{o: o, idle: idle, freq: freq, read: read, done: make(chan struct{})}
+			select {
+			case jobs <- j:
+			case <-stop:
+				return false
+			}
+			select {
+			case ordered <- j:
+				return true
+			case <-stop:
+				return false
+			}
+		})
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				func() {
+					defer close(j.done)
+					defer recovered(&j.err)
+					j.rec = prepare(j.o, j.idle, j.freq)
+				}()
+			}
+		}()
+	}
+	stopped := false
+	var failed error
+	for j := range ordered {
+		if stopped {
+			continue
+		}
+		<-j.done
+		more, jerr := false, j.err
+		if jerr == nil {
+			func() {
+				defer recovered(&jerr)
+				more = consume(j.rec, j.read)
+			}()
+		}
+		if jerr != nil {
+			failed = jerr
+		}
+		if !more {
+			stopped = true
+			close(stop)
+		}
+	}
+	wg.Wait()
+	if failed != nil {
+		err = failed
+	}
+	return truncated, cancelled, err
+}
+
+// recovered turns a panic into *err, worded as the decoder words its own.
+func recovered(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("panic: %v", r)
+	}
+}
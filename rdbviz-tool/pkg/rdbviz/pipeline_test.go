@@ -0,0 +1,74 @@
+package rdbviz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hdt3213/rdb/model"
+	"github.com/hdt3213/rdb/parser"
+)
+
+// fakeDecoder hands out n string keys, key:0 to key:n-1, and recovers
+// panics of cb as the rdb decoder does.
+type fakeDecoder struct {
+	n    int
+	read int
+}
+
+func (d *fakeDecoder) Parse(cb func(parser.RedisObject) bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	for i := 0; i < d.n; i++ {
+		d.read++
+		o := &model.StringObject{BaseObject: &model.BaseObject{Key: fmt.Sprintf("key:%d", i)}, Value: []byte("v")}
+		if !cb(o) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (d *fakeDecoder) GetReadCount() int { return d.read }
+
+func TestParseDumpRecoversPanics(t *testing.T) {
+	prepare := func(o parser.RedisObject, idle, freq int64) KeyRecord { return KeyRecord{Key: o.GetKey()} }
+	consume := func(KeyRecord, int64) bool { return true }
+	boom := func(rec KeyRecord) {
+		if rec.Key == "key:500" {
+			panic("aggregator bug")
+		}
+	}
+	cases := []struct {
+		name    string
+		prepare func(o parser.RedisObject, idle, freq int64) KeyRecord
+		consume func(rec KeyRecord, read int64) bool
+	}{
+		{"prepare", func(o parser.RedisObject, idle, freq int64) KeyRecord {
+			rec := prepare(o, idle, freq)
+			boom(rec)
+			return rec
+		}, consume},
+		{"consume", prepare, func(rec KeyRecord, read int64) bool {
+			boom(rec)
+			return true
+		}},
+	}
+	for _, c := range cases {
+		for _, workers := range []int{1, 4} {
+			t.Run(fmt.Sprintf("%s/workers=%d", c.name, workers), func(t *testing.T) {
+				opts := DefaultOptions()
+				opts.Workers = workers
+				_, _, err := parseDump(context.Background(), &fakeDecoder{n: 2000}, &accessSniffer{}, opts,
+					func(*parser.AuxObject) {}, c.prepare, c.consume)
+				if err == nil || !strings.Contains(err.Error(), "panic: aggregator bug") {
+					t.Fatalf("got err %v, want the panic", err)
+				}
+			})
+		}
+	}
+}
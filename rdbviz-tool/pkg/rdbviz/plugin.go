@@ -0,0 +1,57 @@
+package rdbviz
+
+import (
+	"fmt"
+	"plugin"
+	"sort"
+	"strings"
+)
+
+// PluginSymbol is the variable a Go plugin exports for LoadPlugin:
+//
+//	var Aggregators = map[string]func() rdbviz.Aggregator{
+//		"hash_fields": func() rdbviz.Aggregator { return &hashFields{} },
+//	}
+const PluginSymbol = "Aggregators"
+
+// LoadPlugin loads the aggregators of a plugin, so their sections are part
+// of every report built afterwards: a WebAssembly module for a path ending
+// in .wasm, see LoadWASMPlugin, else a Go plugin built with
+// -buildmode=plugin exporting PluginSymbol, each of whose entries is
+// registered as by RegisterAggregator.
+//
+// A Go plugin must be built against the same version of this package and
+// with the same Go toolchain as the binary loading it, which needs cgo; Go
+// plugins are only supported on Linux, FreeBSD and macOS. WebAssembly
+// modules work everywhere.
+func LoadPlugin(path string) error {
+	if strings.HasSuffix(path, ".wasm") {
+		return LoadWASMPlugin(path)
+	}
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	sym, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", path, err)
+	}
+	aggs, ok := sym.(*map[string]func() Aggregator)
+	if !ok {
+		return fmt.Errorf("plugin %s: %s is a %T, not a map[string]func() rdbviz.Aggregator", path, PluginSymbol, sym)
+	}
+	if len(*aggs) == 0 {
+		return fmt.Errorf("plugin %s registers no aggregator", path)
+	}
+	names := make([]string, 0, len(*aggs))
+	for name := range *aggs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := registerAggregator(name, (*aggs)[name]); err != nil {
+			return fmt.Errorf("plugin %s: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package rdbviz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"rdbviz-tool/pkg/testkit"
+)
+
+func TestLoadWASMPlugin(t *testing.T) {
+	wasm := filepath.Join(t.TempDir(), "type_sizes.wasm")
+	build := exec.Command("go", "build", "-buildmode=c-shared", "-o", wasm, ".")
+	build.Dir = "testdata/wasmplugin"
+	build.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("cannot build the plugin (needs Go 1.24 or later): %v\n%s", err, out)
+	}
+	if err := LoadPlugin(wasm); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := testkit.SampleRDB().Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 4} {
+		opts := DefaultOptions()
+		opts.Workers = workers
+		rep, err := Analyze(context.Background(), bytes.NewReader(dump), opts, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(rep.Custom["type_sizes"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]struct{ Keys, Size int64 }
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("custom section %s: %v", data, err)
+		}
+		for _, ts := range rep.Types {
+			if g := got[ts.Type]; g.Keys != ts.Count || g.Size != ts.Size {
+				t.Errorf("workers=%d %s: plugin counted %d keys, %d bytes; report has %d, %d", workers, ts.Type, g.Keys, g.Size, ts.Count, ts.Size)
+			}
+		}
+	}
+
+	if err := LoadPlugin(wasm); err == nil {
+		t.Error("loading the plugin twice succeeded")
+	}
+}
+
+func TestLoadWASMPluginNotAPlugin(t *testing.T) {
+	// an empty module: magic and version only
+	path := filepath.Join(t.TempDir(), "empty.wasm")
+	if err := os.WriteFile(path, []byte("\x00asm\x01\x00\x00\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadPlugin(path); err == nil {
+		t.Fatal("module without the rdbviz exports loaded")
+	}
+}
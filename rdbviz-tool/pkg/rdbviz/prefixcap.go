@@ -0,0 +1,68 @@
+package rdbviz
+
+import (
+	"sort"
+
+	"rdbviz-tool/pkg/report"
+)
+
+const otherPrefix = "__other__"
+
+// prefixFold tracks what was folded into the __other__ bucket across all
+// capped prefix maps.
+type prefixFold struct {
+	maxEntries int
+	prefixes   int64
+	keys       int64
+	size       int64
+	mem        int64
+}
+
+// capPrefixes keeps agg bounded: once it holds more than maxEntries prefixes,
+// the smallest quarter (by size) is folded into __other__. Folding in batches
+// keeps the sort off the per-key path.
+func (f *prefixFold) capPrefixes(agg map[string]prefixAgg) {
+	if f.maxEntries <= 0 || len(agg) <= f.maxEntries {
+		return
+	}
+	type entry struct {
+		prefix string
+		agg    prefixAgg
+	}
+	entries := make([]entry, 0, len(agg))
+	for p, a := range agg {
+		if p == otherPrefix {
+			continue
+		}
+		entries = append(entries, entry{prefix: p, agg: a})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].agg.Size < entries[j].agg.Size })
+
+	keep := f.maxEntries - f.maxEntries/4
+	if keep < 1 {
+		keep = 1
+	}
+	other := agg[otherPrefix]
+	for _, e := range entries[:len(entries)-keep+1] {
+		other.merge(e.agg)
+		f.prefixes++
+		f.keys += e.agg.Count
+		f.size += e.agg.Size
+		f.mem += e.agg.Mem
+		delete(agg, e.prefix)
+	}
+	agg[otherPrefix] = other
+}
+
+func (f *prefixFold) result() *report.PrefixFold {
+	if f.prefixes == 0 {
+		return nil
+	}
+	return &report.PrefixFold{
+		MaxEntries:     f.maxEntries,
+		FoldedPrefixes: f.prefixes,
+		FoldedCount:    f.keys,
+		FoldedSize:     f.size,
+		FoldedMem:      f.mem,
+	}
+}
@@ -0,0 +1,82 @@
+package rdbviz
+
+import (
+	"sort"
+	"strings"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// maxChildPrefixes bounds the prefixes whose children are counted; at 1 KB
+// per HyperLogLog that is about 10 MB.
+const maxChildPrefixes = 10000
+
+// prefixChildren estimates, per separator prefix, how many distinct next
+// segments follow it: "user:" over a million IDs has a million children,
+// "cache:" over three fixed sub-namespaces has three, whatever their key
+// counts. Once maxChildPrefixes are tracked, the smallest quarter by size is
+// dropped; dumps list keys in hash order, so the large prefixes show up early
+// and keep their counters.
+type prefixChildren struct {
+	sep      string
+	maxDepth int
+	prefixes map[string]*childCounter
+}
+
+type childCounter struct {
+	size     int64
+	children *hll
+}
+
+func newPrefixChildren(sep string, maxDepth int) *prefixChildren {
+	return &prefixChildren{sep: sep, maxDepth: maxDepth, prefixes: map[string]*childCounter{}}
+}
+
+func (pc *prefixChildren) observe(key string, size int64) {
+	if pc.sep == "" || pc.maxDepth <= 0 {
+		return
+	}
+	parts := strings.Split(key, pc.sep)
+	depth := len(parts) - 1
+	if depth > pc.maxDepth {
+		depth = pc.maxDepth
+	}
+	for i := 1; i <= depth; i++ {
+		prefix := strings.Join(parts[:i], pc.sep) + pc.sep
+		c := pc.prefixes[prefix]
+		if c == nil {
+			if len(pc.prefixes) >= maxChildPrefixes {
+				pc.compact()
+			}
+			c = &childCounter{children: newHLL(10)}
+			pc.prefixes[prefix] = c
+		}
+		c.size += size
+		c.children.add(parts[i])
+	}
+}
+
+// compact drops the smallest quarter of the tracked prefixes by size.
+func (pc *prefixChildren) compact() {
+	type entry struct {
+		prefix string
+		size   int64
+	}
+	entries := make([]entry, 0, len(pc.prefixes))
+	for p, c := range pc.prefixes {
+		entries = append(entries, entry{p, c.size})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].size < entries[j].size })
+	for _, e := range entries[:len(entries)/4] {
+		delete(pc.prefixes, e.prefix)
+	}
+}
+
+// attach sets Children on the listed prefixes still tracked.
+func (pc *prefixChildren) attach(list []report.PrefixStat) {
+	for i := range list {
+		if c := pc.prefixes[list[i].Prefix]; c != nil {
+			list[i].Children = c.children.estimate()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package rdbviz
+
+import "strings"
+
+// autoPrefixMaxDepth bounds how deep auto mode aggregates before pruning.
+const autoPrefixMaxDepth = 16
+
+// prunePrefixes drops prefixes that split a namespace too thin: a prefix
+// below the first level is kept only while it and all its ancestors group
+// more than minKeys keys.
+func prunePrefixes(agg map[string]prefixAgg, sep string, minKeys int64) {
+	keep := make(map[string]bool, len(agg))
+	var kept func(p string) bool
+	kept = func(p string) bool {
+		if v, ok := keep[p]; ok {
+			return v
+		}
+		v := true
+		if parent, ok := parentPrefix(p, sep); ok {
+			v = agg[p].Count > minKeys && kept(parent)
+		}
+		keep[p] = v
+		return v
+	}
+	for p := range agg {
+		if !kept(p) {
+			delete(agg, p)
+		}
+	}
+}
+
+// namespaceOf returns the first-level prefix of key, or key itself when it
+// has no separator.
+func namespaceOf(key, sep string) string {
+	if sep == "" {
+		return key
+	}
+	if i := strings.Index(key, sep); i >= 0 {
+		return key[:i+len(sep)]
+	}
+	return key
+}
+
+func parentPrefix(p, sep string) (string, bool) {
+	trimmed := strings.TrimSuffix(p, sep)
+	i := strings.LastIndex(trimmed, sep)
+	if i < 0 {
+		return "", false
+	}
+	return trimmed[:i+len(sep)], true
+}
+
+// applyFixedPrefix groups keys without separators by their first n
+// characters.
+func applyFixedPrefix(agg map[string]prefixAgg, key string, size, mem, ttl int64, n int) {
+	if n <= 0 {
+		return
+	}
+	p := fixedPrefix(key, n)
+	a := agg[p]
+	a.add(size, mem, ttl)
+	agg[p] = a
+}
+
+// fixedPrefix returns the first n characters of key.
+func fixedPrefix(key string, n int) string {
+	i := 0
+	for j := range key {
+		if i == n {
+			return key[:j]
+		}
+		i++
+	}
+	return key
+}
+
+func typePrefixes(agg map[string]map[string]prefixAgg, objType string) map[string]prefixAgg {
+	m, ok := agg[objType]
+	if !ok {
+		m = map[string]prefixAgg{}
+		agg[objType] = m
+	}
+	return m
+}
@@ -0,0 +1,58 @@
+package rdbviz
+
+import (
+	"sort"
+	"strings"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// maxTopKeyGroups bounds the groups whose largest keys are tracked.
+const maxTopKeyGroups = 10000
+
+// prefixTopKeys keeps the n largest keys of each first-level group (the
+// namespace, or the fixed-length prefix with -prefix-len). Deeper prefixes
+// are given the tracked keys of their group that fall under them, so they can
+// list fewer than n.
+type prefixTopKeys struct {
+	n      int
+	groups map[string][]report.PrefixKey
+}
+
+func newPrefixTopKeys(n int) *prefixTopKeys {
+	return &prefixTopKeys{n: n, groups: map[string][]report.PrefixKey{}}
+}
+
+func (pt *prefixTopKeys) observe(group string, k report.PrefixKey) {
+	keys, ok := pt.groups[group]
+	if !ok && len(pt.groups) >= maxTopKeyGroups {
+		return
+	}
+	if len(keys) < pt.n {
+		pt.groups[group] = append(keys, k)
+		return
+	}
+	minIdx := 0
+	for i := 1; i < len(keys); i++ {
+		if keys[i].Size < keys[minIdx].Size {
+			minIdx = i
+		}
+	}
+	if k.Size > keys[minIdx].Size {
+		keys[minIdx] = k
+	}
+}
+
+// attach sets TopKeys on every prefix in list; group maps a prefix to the
+// group its keys were tracked under.
+func (pt *prefixTopKeys) attach(list []report.PrefixStat, group func(prefix string) string) {
+	for i := range list {
+		p := &list[i]
+		for _, k := range pt.groups[group(p.Prefix)] {
+			if strings.HasPrefix(k.Key, p.Prefix) {
+				p.TopKeys = append(p.TopKeys, k)
+			}
+		}
+		sort.Slice(p.TopKeys, func(a, b int) bool { return p.TopKeys[a].Size > p.TopKeys[b].Size })
+	}
+}
@@ -0,0 +1,34 @@
+package rdbviz
+
+import (
+	"sort"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// prefixMix inverts the per-type and per-encoding prefix tables for the given
+// prefixes, listing the type and encoding mix of each.
+func prefixMix(prefixes []report.PrefixStat, byType, byEncoding map[string]map[string]prefixAgg) []report.PrefixMix {
+	list := make([]report.PrefixMix, 0, len(prefixes))
+	for _, p := range prefixes {
+		m := report.PrefixMix{
+			Prefix:    p.Prefix,
+			Types:     mixEntries(p.Prefix, byType),
+			Encodings: mixEntries(p.Prefix, byEncoding),
+		}
+		m.MixedTypes = len(m.Types) > 1
+		list = append(list, m)
+	}
+	return list
+}
+
+func mixEntries(prefix string, groups map[string]map[string]prefixAgg) []report.MixEntry {
+	entries := []report.MixEntry{}
+	for name, pm := range groups {
+		if a, ok := pm[prefix]; ok {
+			entries = append(entries, report.MixEntry{Name: name, Count: a.Count, Size: a.Size})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Count > entries[j].Count })
+	return entries
+}
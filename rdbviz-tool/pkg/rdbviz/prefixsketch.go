@@ -0,0 +1,150 @@
+package rdbviz
+
+import (
+	"container/heap"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// spaceSaving keeps at most k prefixes of a table, the largest by size
+// (Metwally et al., weighted by bytes). A prefix arriving while the table is
+// full replaces the smallest one and takes over its count, size and memory,
+// which become its error: the listed totals are upper bounds, and the true
+// ones are at least the listed ones minus the error. Any prefix holding more
+// than 1/k of the bytes is guaranteed to be kept.
+type spaceSaving struct {
+	k int
+	h sketchHeap
+}
+
+type sketchEntry struct {
+	prefix string
+	agg    prefixAgg
+	err    report.PrefixError
+}
+
+// sketchHeap is a min-heap by size that tracks each prefix's position.
+type sketchHeap struct {
+	entries []sketchEntry
+	index   map[string]int
+}
+
+func (h *sketchHeap) Len() int { return len(h.entries) }
+func (h *sketchHeap) Less(i, j int) bool {
+	return h.entries[i].agg.Size < h.entries[j].agg.Size
+}
+func (h *sketchHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.index[h.entries[i].prefix] = i
+	h.index[h.entries[j].prefix] = j
+}
+func (h *sketchHeap) Push(x any) {
+	e := x.(sketchEntry)
+	h.index[e.prefix] = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+func (h *sketchHeap) Pop() any {
+	e := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	delete(h.index, e.prefix)
+	return e
+}
+
+func newSpaceSaving(k int) *spaceSaving {
+	return &spaceSaving{k: k, h: sketchHeap{index: map[string]int{}}}
+}
+
+func (s *spaceSaving) add(prefix string, a prefixAgg) {
+	if i, ok := s.h.index[prefix]; ok {
+		s.h.entries[i].agg.merge(a)
+		heap.Fix(&s.h, i)
+		return
+	}
+	if len(s.h.entries) < s.k {
+		heap.Push(&s.h, sketchEntry{prefix: prefix, agg: a})
+		return
+	}
+	min := s.h.entries[0]
+	delete(s.h.index, min.prefix)
+	// the TTL fields only cover the keys seen since the prefix was tracked
+	e := sketchEntry{
+		prefix: prefix,
+		agg:    prefixAgg{Count: min.agg.Count, Size: min.agg.Size, Mem: min.agg.Mem},
+		err:    report.PrefixError{Count: min.agg.Count, Size: min.agg.Size, EstimatedMem: min.agg.Mem},
+	}
+	e.agg.merge(a)
+	s.h.entries[0] = e
+	s.h.index[prefix] = 0
+	heap.Fix(&s.h, 0)
+}
+
+// absorb moves the entries of agg into the sketch and empties agg.
+func (s *spaceSaving) absorb(agg map[string]prefixAgg) {
+	for p, a := range agg {
+		s.add(p, a)
+		delete(agg, p)
+	}
+}
+
+func (s *spaceSaving) table() map[string]prefixAgg {
+	m := make(map[string]prefixAgg, len(s.h.entries))
+	for _, e := range s.h.entries {
+		m[e.prefix] = e.agg
+	}
+	return m
+}
+
+// annotate sets the error of the listed prefixes that took over another.
+func (s *spaceSaving) annotate(list []report.PrefixStat) {
+	for i := range list {
+		if j, ok := s.h.index[list[i].Prefix]; ok && s.h.entries[j].err.Count > 0 {
+			e := s.h.entries[j].err
+			list[i].Error = &e
+		}
+	}
+}
+
+// prefixSketch holds a sketch per prefix table. The tables of prefixStats
+// then only hold the prefixes of the key being observed.
+type prefixSketch struct {
+	k          int
+	all        *spaceSaving
+	expired    *spaceSaving
+	byType     map[string]*spaceSaving
+	byEncoding map[string]*spaceSaving
+}
+
+func newPrefixSketch(k int) *prefixSketch {
+	return &prefixSketch{
+		k:          k,
+		all:        newSpaceSaving(k),
+		expired:    newSpaceSaving(k),
+		byType:     map[string]*spaceSaving{},
+		byEncoding: map[string]*spaceSaving{},
+	}
+}
+
+func (ps *prefixSketch) group(sketches map[string]*spaceSaving, name string) *spaceSaving {
+	s, ok := sketches[name]
+	if !ok {
+		s = newSpaceSaving(ps.k)
+		sketches[name] = s
+	}
+	return s
+}
+
+// unsketch replaces the tables of p with the content of its sketches.
+func (p *prefixStats) unsketch() {
+	ps := p.sketch
+	if ps == nil {
+		return
+	}
+	p.prefixes = ps.all.table()
+	p.expired = ps.expired.table()
+	for t, s := range ps.byType {
+		p.byType[t] = s.table()
+	}
+	for enc, s := range ps.byEncoding {
+		p.byEncoding[enc] = s.table()
+	}
+}
@@ -0,0 +1,102 @@
+package rdbviz
+
+import "time"
+
+// Stages of an analysis reported in Progress.Stage.
+const (
+	StageBaseline = "baseline" // parsing the -baseline dump
+	StageParse    = "parse"    // parsing the dump
+	StageScan     = "scan"     // SCANning the live instance for drift
+	StageReport   = "report"   // building the report from the tables, only in StageTiming
+)
+
+// Progress is a snapshot of a running analysis, passed to
+// Options.OnProgress.
+type Progress struct {
+	Stage string
+	// DB is the DB of the last key parsed, or the DB being scanned.
+	DB int
+	// Keys counts the keys analyzed so far in this stage, or scanned.
+	Keys int64
+	// BytesRead and TotalBytes locate the parse in the dump; TotalBytes is
+	// 0 when the size is unknown, as for Analyze or a live scan.
+	BytesRead  int64
+	TotalBytes int64
+	Elapsed    time.Duration
+	// ETA extrapolates the rest of the stage from the bytes read so far, 0
+	// when it cannot be estimated.
+	ETA time.Duration
+}
+
+// Percent is the share of the dump read so far, 0 when its size is unknown.
+func (p Progress) Percent() float64 {
+	if p.TotalBytes <= 0 {
+		return 0
+	}
+	return float64(p.BytesRead) / float64(p.TotalBytes) * 100
+}
+
+// StageTiming is a finished stage of an analysis, passed to
+// Options.OnStage. Keys and Bytes are what the stage analyzed and read,
+// when it reads a dump; Err is why it stopped the analysis, if it did.
+type StageTiming struct {
+	Stage string
+	Start time.Time
+	End   time.Time
+	Keys  int64
+	Bytes int64
+	Err   error
+}
+
+// Duration is how long the stage took.
+func (s StageTiming) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// stageDone passes a stage that started at start and just ended to
+// OnStage.
+func (o Options) stageDone(stage string, start time.Time, keys, bytes int64, err error) {
+	if o.OnStage != nil {
+		o.OnStage(StageTiming{Stage: stage, Start: start, End: time.Now(), Keys: keys, Bytes: bytes, Err: err})
+	}
+}
+
+// progressReporter rate-limits the progress of one stage to the configured
+// interval.
+type progressReporter struct {
+	fn    func(Progress)
+	every time.Duration
+	stage string
+	total int64
+	start time.Time
+	last  time.Time
+}
+
+// newProgressReporter returns nil when progress is disabled; a nil reporter
+// ignores ticks.
+func newProgressReporter(opts Options, stage string, total int64) *progressReporter {
+	if opts.OnProgress == nil || opts.Progress <= 0 {
+		return nil
+	}
+	now := time.Now()
+	return &progressReporter{fn: opts.OnProgress, every: opts.Progress, stage: stage, total: total, start: now, last: now}
+}
+
+func (r *progressReporter) tick(db int, keys, read int64) {
+	if r == nil || time.Since(r.last) < r.every {
+		return
+	}
+	r.last = time.Now()
+	p := Progress{
+		Stage:      r.stage,
+		DB:         db,
+		Keys:       keys,
+		BytesRead:  read,
+		TotalBytes: r.total,
+		Elapsed:    r.last.Sub(r.start),
+	}
+	if r.total > 0 && read > 0 && read < r.total {
+		p.ETA = time.Duration(float64(p.Elapsed) * float64(r.total-read) / float64(read))
+	}
+	r.fn(p)
+}
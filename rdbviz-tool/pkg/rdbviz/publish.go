@@ -0,0 +1,303 @@
+package rdbviz
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gceTokenURL is where the GCE metadata server hands out the access token
+// of the instance's service account.
+const gceTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// PublishWriter uploads the report.json, and the page of HTMLWriter when
+// PageDir is set, to object storage: an S3 bucket, or an S3-compatible
+// store, for "s3://bucket/prefix/", a Google Cloud Storage bucket for
+// "gs://bucket/prefix/". The objects are named after the report's meta,
+// prefix/instance[/shard]/20060102T150405Z.json and .html with the time the
+// report was generated; a report without an instance goes by the dump's
+// file name.
+type PublishWriter struct {
+	URL     string
+	PageDir string
+	// AccessKeyID, SecretAccessKey and SessionToken are the S3
+	// credentials, as in AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_SESSION_TOKEN. Region is the bucket's; empty for us-east-1.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	// Endpoint is the base URL of an S3-compatible store, e.g. MinIO,
+	// addressed path-style, or of a Cloud Storage emulator; empty for AWS
+	// and Google Cloud Storage.
+	Endpoint string
+	// Token is the OAuth2 access token for gs://; empty to get the service
+	// account's from the metadata server, as on GCE, GKE or Cloud Run,
+	// unless Endpoint is set.
+	Token string
+	// Client sends the requests; nil for one with a 5m timeout.
+	Client *http.Client
+}
+
+type publishObject struct {
+	key         string
+	contentType string
+	data        []byte
+}
+
+// WriteReport uploads the report, then the page.
+func (w PublishWriter) WriteReport(rep *Report) error {
+	scheme, bucket, _, err := w.target()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := w.objectName(rep)
+	objects := []publishObject{{name + ".json", "application/json", append(data, '\n')}}
+	if w.PageDir != "" {
+		page, err := HTMLWriter{PageDir: w.PageDir}.Page(rep)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, publishObject{name + ".html", "text/html; charset=utf-8", page})
+	}
+	put := w.putS3
+	if scheme == "gs" {
+		token := w.Token
+		if token == "" && w.Endpoint == "" {
+			if token, err = w.gceToken(); err != nil {
+				return fmt.Errorf("publish: gs: no token: %w", err)
+			}
+		}
+		put = func(bucket string, o publishObject) error { return w.putGCS(bucket, o, token) }
+	}
+	for _, o := range objects {
+		if err := put(bucket, o); err != nil {
+			return fmt.Errorf("publish %s://%s/%s: %w", scheme, bucket, o.key, err)
+		}
+	}
+	return nil
+}
+
+// Objects returns the URLs of the objects WriteReport uploads for rep,
+// the report first.
+func (w PublishWriter) Objects(rep *Report) []string {
+	scheme, bucket, _, err := w.target()
+	if err != nil {
+		return nil
+	}
+	base := scheme + "://" + bucket + "/" + w.objectName(rep)
+	urls := []string{base + ".json"}
+	if w.PageDir != "" {
+		urls = append(urls, base+".html")
+	}
+	return urls
+}
+
+// target splits URL into its scheme, bucket and key prefix, which ends in
+// "/" unless empty.
+func (w PublishWriter) target() (scheme, bucket, prefix string, err error) {
+	scheme, rest, ok := strings.Cut(w.URL, "://")
+	if !ok || (scheme != "s3" && scheme != "gs") {
+		return "", "", "", fmt.Errorf("publish: %q is not an s3:// or gs:// URL", w.URL)
+	}
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", "", fmt.Errorf("publish: %q has no bucket", w.URL)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return scheme, bucket, prefix, nil
+}
+
+// objectName is the key of the objects of rep without the extension.
+func (w PublishWriter) objectName(rep *Report) string {
+	_, _, prefix, _ := w.target()
+	name := rep.Meta.Instance
+	if name == "" {
+		base := filepath.Base(rep.Meta.Source)
+		name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		name = "report"
+	}
+	if rep.Meta.Shard != "" {
+		name += "/" + rep.Meta.Shard
+	}
+	at, err := time.Parse(time.RFC3339, rep.Meta.GeneratedAt)
+	if err != nil {
+		at = time.Now()
+	}
+	return prefix + name + "/" + at.UTC().Format("20060102T150405Z")
+}
+
+func (w PublishWriter) client() *http.Client {
+	if w.Client != nil {
+		return w.Client
+	}
+	return &http.Client{Timeout: 5 * time.Minute}
+}
+
+// putS3 uploads o with a request signed with AWS Signature Version 4:
+// virtual-hosted on AWS, path-style on Endpoint and for buckets with dots,
+// which the wildcard certificate does not cover.
+func (w PublishWriter) putS3(bucket string, o publishObject) error {
+	if w.AccessKeyID == "" || w.SecretAccessKey == "" {
+		return errors.New("no S3 credentials")
+	}
+	region := w.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	u := &url.URL{Scheme: "https", Host: bucket + ".s3." + region + ".amazonaws.com", Path: "/" + o.key}
+	switch {
+	case w.Endpoint != "":
+		base, err := url.Parse(strings.TrimSuffix(w.Endpoint, "/"))
+		if err != nil {
+			return err
+		}
+		u = base.JoinPath(bucket, o.key)
+	case strings.Contains(bucket, "."):
+		u = &url.URL{Scheme: "https", Host: "s3." + region + ".amazonaws.com", Path: "/" + bucket + "/" + o.key}
+	}
+	u.RawPath = s3Escape(u.Path)
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(o.data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", o.contentType)
+	sum := sha256.Sum256(o.data)
+	w.signV4(req, hex.EncodeToString(sum[:]), region, time.Now())
+	return w.do(req)
+}
+
+// signV4 signs req for S3, whose body hashes to payloadHash. Every header
+// set so far is signed, with the host.
+func (w PublishWriter) signV4(req *http.Request, payloadHash, region string, now time.Time) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	day := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if w.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", w.SessionToken)
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	request := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonical.String(), signed, payloadHash}, "\n")
+	requestHash := sha256.Sum256([]byte(request))
+	scope := day + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := []byte("AWS4" + w.SecretAccessKey)
+	for _, part := range []string{day, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		w.AccessKeyID, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape encodes a path as S3 signs it: everything but the unreserved
+// characters of RFC 3986 and "/".
+func s3Escape(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// putGCS uploads o through the XML API of Cloud Storage.
+func (w PublishWriter) putGCS(bucket string, o publishObject, token string) error {
+	base := w.Endpoint
+	if base == "" {
+		base = "https://storage.googleapis.com"
+	}
+	u, err := url.Parse(strings.TrimSuffix(base, "/"))
+	if err != nil {
+		return err
+	}
+	u = u.JoinPath(bucket, o.key)
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(o.data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", o.contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return w.do(req)
+}
+
+func (w PublishWriter) gceToken() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, gceTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server: %s", res.Status)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tok); err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
+
+func (w PublishWriter) do(req *http.Request) error {
+	res, err := w.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
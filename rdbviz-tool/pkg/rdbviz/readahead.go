@@ -0,0 +1,130 @@
+package rdbviz
+
+import (
+	"bufio"
+	"io"
+	"time"
+)
+
+// dumpReader throttles r to Options.MaxReadRate and buffers it by
+// Options.ReadBuffer, on a read-ahead goroutine with Options.ReadAhead. The
+// returned stop must be called once the dump has been read; it waits for the
+// read-ahead goroutine to exit.
+func dumpReader(r io.Reader, opts Options) (io.Reader, func()) {
+	if opts.MaxReadRate > 0 {
+		r = &throttledReader{r: r, rate: opts.MaxReadRate}
+	}
+	switch {
+	case opts.ReadBuffer <= 0:
+		return r, func() {}
+	case opts.ReadAhead:
+		ra := newReadAhead(r, opts.ReadBuffer)
+		return ra, ra.stop
+	default:
+		return bufio.NewReaderSize(r, opts.ReadBuffer), func() {}
+	}
+}
+
+// readAhead double-buffers a reader: a goroutine fills one buffer while the
+// decoder consumes the other, so a slow network filesystem's latency
+// overlaps with the parse instead of adding to it.
+type readAhead struct {
+	free    chan []byte
+	filled  chan readChunk
+	done    chan struct{}
+	stopped chan struct{}
+	held    []byte // the buffer cur points into
+	cur     []byte
+	err     error
+}
+
+type readChunk struct {
+	buf []byte
+	n   int
+	err error
+}
+
+func newReadAhead(r io.Reader, size int) *readAhead {
+	ra := &readAhead{
+		free:    make(chan []byte, 2),
+		filled:  make(chan readChunk, 2),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	ra.free <- make([]byte, size)
+	ra.free <- make([]byte, size)
+	go ra.run(r)
+	return ra
+}
+
+func (ra *readAhead) run(r io.Reader) {
+	defer close(ra.stopped)
+	for {
+		var buf []byte
+		select {
+		case buf = <-ra.free:
+		case <-ra.done:
+			return
+		}
+		n, err := io.ReadFull(r, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		select {
+		case ra.filled <- readChunk{buf: buf, n: n, err: err}:
+		case <-ra.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (ra *readAhead) Read(p []byte) (int, error) {
+	for len(ra.cur) == 0 {
+		if ra.err != nil {
+			return 0, ra.err
+		}
+		if ra.held != nil {
+			ra.free <- ra.held
+			ra.held = nil
+		}
+		c := <-ra.filled
+		ra.held, ra.cur, ra.err = c.buf, c.buf[:c.n], c.err
+	}
+	n := copy(p, ra.cur)
+	ra.cur = ra.cur[n:]
+	return n, nil
+}
+
+func (ra *readAhead) stop() {
+	close(ra.done)
+	<-ra.stopped
+}
+
+// throttledReader keeps reads at or below rate bytes per second, so a dump on
+// a production host's volume does not starve Redis of IOPS. Reads are cut
+// to a tenth of a second's worth and time not spent reading is not banked,
+// so a slow stretch of parsing is not followed by a burst.
+type throttledReader struct {
+	r    io.Reader
+	rate int64
+	next time.Time
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if limit := int(max(t.rate/10, 4096)); len(p) > limit {
+		p = p[:limit]
+	}
+	if wait := time.Until(t.next); wait > 0 {
+		time.Sleep(wait)
+	}
+	n, err := t.r.Read(p)
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	t.next = t.next.Add(time.Duration(float64(n) / float64(t.rate) * float64(time.Second)))
+	return n, err
+}
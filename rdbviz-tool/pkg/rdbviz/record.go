@@ -0,0 +1,56 @@
+package rdbviz
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/hdt3213/rdb/parser"
+)
+
+// KeyRecord is one analyzed key as the built-in aggregators see it.
+type KeyRecord struct {
+	DB       int
+	Key      string
+	Type     string
+	Encoding string
+	// Size is the serialized size in the dump, EstimatedMem the memory
+	// model's estimate of what the key takes in a running instance.
+	Size         int64
+	EstimatedMem int64
+	Elements     int64
+	// Expiration is nil for keys without a TTL.
+	Expiration *time.Time
+	// Idle is the LRU idle time in seconds and Freq the LFU counter, -1
+	// when the dump was saved without them.
+	Idle int64
+	Freq int64
+	// Class is what Options.Classifier said about the key, empty without
+	// one.
+	Class Classification
+	// Object is the decoded key with its value, for metrics that need more
+	// than the fields above.
+	Object parser.RedisObject
+}
+
+// Analyze parses a dump read from r and builds its report, calling onKey for
+// every analyzed key: keys skipped by SampleRate or past MaxKeys are not
+// passed. An error from onKey stops the parse and is returned as is.
+// onKey may be nil. Cancelling ctx stops the analysis as for
+// Analyzer.AnalyzeFile.
+//
+// When r has a Size method, as *bytes.Reader does, progress reports a
+// percentage and a MaxKeys cut is extrapolated as for a file. Otherwise the
+// size is unknown, so progress is reported in bytes read only and a MaxKeys
+// cut is not extrapolated to the rest of the dump.
+func Analyze(ctx context.Context, r io.Reader, opts Options, onKey func(KeyRecord) error) (*Report, error) {
+	a, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	if s, ok := r.(interface{ Size() int64 }); ok {
+		size = s.Size()
+	}
+	return a.analyze(ctx, r, "", size, onKey)
+}
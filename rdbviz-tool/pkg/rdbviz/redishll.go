@@ -0,0 +1,195 @@
+package rdbviz
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"math"
+	"sort"
+
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// Redis HyperLogLog layout (hyperloglog.c): a 16 byte header ("HYLL",
+// encoding, 3 unused bytes, 8 byte cached cardinality) followed by 2^14
+// six-bit registers, either dense or run-length encoded ("sparse").
+const (
+	redisHLLHeader    = 16
+	redisHLLRegisters = 1 << 14
+	redisHLLQ         = 64 - 14
+	redisHLLDense     = 0
+	redisHLLSparse    = 1
+)
+
+func isRedisHLL(v []byte) bool {
+	return len(v) >= redisHLLHeader && bytes.HasPrefix(v, []byte("HYLL")) && v[4] <= redisHLLSparse
+}
+
+// redisHLLCount returns the cardinality of a Redis HLL value: the cached one
+// when valid, otherwise the estimate computed from the registers the same way
+// PFCOUNT does. ok is false when the registers are malformed.
+func redisHLLCount(v []byte) (int64, bool) {
+	if v[15]&0x80 == 0 {
+		return int64(binary.LittleEndian.Uint64(v[8:16])), true
+	}
+	var hist [redisHLLQ + 2]int
+	regs := v[redisHLLHeader:]
+	if v[4] == redisHLLDense {
+		if len(regs) < redisHLLRegisters*6/8 {
+			return 0, false
+		}
+		for i := 0; i < redisHLLRegisters; i++ {
+			b := i * 6 / 8
+			fb := uint(i*6) & 7
+			b0 := uint(regs[b])
+			b1 := uint(0)
+			if b+1 < len(regs) {
+				b1 = uint(regs[b+1])
+			}
+			r := ((b0 >> fb) | (b1 << (8 - fb))) & 63
+			if r > redisHLLQ+1 {
+				// a run of zeros is at most Q+1 long; PFADD never writes more
+				return 0, false
+			}
+			hist[r]++
+		}
+	} else {
+		idx := 0
+		for i := 0; i < len(regs); i++ {
+			op := regs[i]
+			switch {
+			case op&0xc0 == 0: // ZERO
+				n := int(op&0x3f) + 1
+				hist[0] += n
+				idx += n
+			case op&0xc0 == 0x40: // XZERO
+				if i+1 >= len(regs) {
+					return 0, false
+				}
+				n := int(op&0x3f)<<8 | int(regs[i+1]) + 1
+				i++
+				hist[0] += n
+				idx += n
+			default: // VAL
+				n := int(op&3) + 1
+				hist[int(op>>2&0x1f)+1] += n
+				idx += n
+			}
+		}
+		if idx != redisHLLRegisters {
+			return 0, false
+		}
+	}
+	return int64(math.Round(ertlEstimate(hist[:]))), true
+}
+
+// ertlEstimate is the improved estimator of Otmar Ertl used by Redis.
+func ertlEstimate(hist []int) float64 {
+	m := float64(redisHLLRegisters)
+	z := m * hllTau((m-float64(hist[redisHLLQ+1]))/m)
+	for j := redisHLLQ; j >= 1; j-- {
+		z += float64(hist[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(hist[0])/m)
+	return 0.5 / math.Ln2 * m * m / z
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zl := z
+		z += x * y
+		y += y
+		if zl == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		zl := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zl == z {
+			return z / 3
+		}
+	}
+}
+
+// hllStats collects string values that are Redis HyperLogLogs.
+type hllStats struct {
+	topN int
+	log  *slog.Logger
+	r    report.HLLReport
+}
+
+func newHLLStats(topN int, log *slog.Logger) *hllStats {
+	return &hllStats{topN: topN, log: log, r: report.HLLReport{Keys: []report.HLLKey{}}}
+}
+
+func (hs *hllStats) observe(o parser.RedisObject, mem int64) {
+	s, ok := o.(*parser.StringObject)
+	if !ok || !isRedisHLL(s.Value) {
+		return
+	}
+	k := report.HLLKey{DB: s.GetDBIndex(), Key: s.Key, Size: int64(len(s.Value)), EstimatedMem: mem, Encoding: "dense"}
+	if s.Value[4] == redisHLLSparse {
+		k.Encoding = "sparse"
+		hs.r.Sparse++
+	} else {
+		hs.r.Dense++
+	}
+	card, ok := redisHLLCount(s.Value)
+	if !ok {
+		hs.log.Log(context.Background(), LevelTrace, "invalid HyperLogLog", "db", k.DB, "key", k.Key, "encoding", k.Encoding)
+		hs.r.Invalid++
+		return
+	}
+	k.Cardinality = card
+	hs.r.Count++
+	hs.r.Size += k.Size
+	hs.r.EstimatedMem += mem
+	hs.push(k)
+}
+
+func (hs *hllStats) push(k report.HLLKey) {
+	if hs.topN <= 0 {
+		return
+	}
+	if len(hs.r.Keys) < hs.topN {
+		hs.r.Keys = append(hs.r.Keys, k)
+		return
+	}
+	minIdx := 0
+	for i := 1; i < len(hs.r.Keys); i++ {
+		if hs.r.Keys[i].Cardinality < hs.r.Keys[minIdx].Cardinality {
+			minIdx = i
+		}
+	}
+	if k.Cardinality > hs.r.Keys[minIdx].Cardinality {
+		hs.r.Keys[minIdx] = k
+	}
+}
+
+func (hs *hllStats) result() *report.HLLReport {
+	if hs.r.Count == 0 && hs.r.Invalid == 0 {
+		return nil
+	}
+	r := hs.r
+	sort.Slice(r.Keys, func(i, j int) bool { return r.Keys[i].Cardinality > r.Keys[j].Cardinality })
+	return &r
+}
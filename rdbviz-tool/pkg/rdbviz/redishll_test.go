@@ -0,0 +1,23 @@
+package rdbviz
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedisHLLCountOutOfRangeRegisters(t *testing.T) {
+	v := append([]byte("HYLL"), redisHLLDense, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x80)
+	v = append(v, bytes.Repeat([]byte{0xff}, redisHLLRegisters*6/8)...)
+	if _, ok := redisHLLCount(v); ok {
+		t.Fatal("dense HLL with registers of 63 counted as valid")
+	}
+}
+
+func TestRedisHLLCountEmpty(t *testing.T) {
+	v := append([]byte("HYLL"), redisHLLDense, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x80)
+	v = append(v, make([]byte, redisHLLRegisters*6/8)...)
+	n, ok := redisHLLCount(v)
+	if !ok || n != 0 {
+		t.Fatalf("empty dense HLL: got %d, %v; want 0, true", n, ok)
+	}
+}
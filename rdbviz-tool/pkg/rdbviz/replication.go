@@ -0,0 +1,27 @@
+package rdbviz
+
+import (
+	"fmt"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// replicationNote explains the replication aux fields of a dump: a master
+// with a backlog, or a replica, records its replication ID and offset, so a
+// backup can be matched against INFO replication of the source. It is empty
+// when the dump carries neither.
+func replicationNote(meta report.Meta) string {
+	if meta.ReplID == "" && meta.ReplOffset == "" {
+		return ""
+	}
+	note := fmt.Sprintf("snapshot taken at replication offset %s of replication ID %s", meta.ReplOffset, meta.ReplID)
+	switch meta.ReplStreamDB {
+	case "", "-1":
+	default:
+		note += fmt.Sprintf(", with DB %s selected in the replication stream", meta.ReplStreamDB)
+	}
+	if meta.AOFBase == "1" {
+		note += "; this is the base of an AOF, later writes are in the AOF increments"
+	}
+	return note
+}
@@ -0,0 +1,117 @@
+package rdbviz
+
+import (
+	"math"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// planReshard splits the slot space into n contiguous ranges, one per target
+// node, so that the largest node holds as little estimated memory as
+// possible. The largest range is found by binary search over a greedy
+// fill; it is compared against the even split by slot count that
+// CLUSTER ADDSLOTSRANGE setups usually start from.
+func planReshard(keys, sizes, mems []int64, n int) *report.ReshardPlan {
+	var total, largest int64
+	for _, m := range mems {
+		total += m
+		if m > largest {
+			largest = m
+		}
+	}
+	mean := float64(total) / float64(n)
+	r := &report.ReshardPlan{
+		Shards:  n,
+		MeanMem: int64(math.Round(mean)),
+		Nodes:   make([]report.ReshardNode, n),
+	}
+
+	lo, hi := largest, total
+	for lo < hi {
+		limit := lo + (hi-lo)/2
+		if reshardRanges(mems, limit) <= n {
+			hi = limit
+		} else {
+			lo = limit + 1
+		}
+	}
+
+	slot := 0
+	for i := range r.Nodes {
+		node := &r.Nodes[i]
+		node.Node = i
+		node.Start = slot
+		// every node gets at least one slot, the last one all that remain
+		for slot < len(mems) {
+			last := i == n-1
+			if !last && node.Slots > 0 && (node.EstimatedMem+mems[slot] > lo || len(mems)-slot <= n-1-i) {
+				break
+			}
+			node.Slots++
+			node.Keys += keys[slot]
+			node.Size += sizes[slot]
+			node.EstimatedMem += mems[slot]
+			slot++
+		}
+		node.End = slot - 1
+	}
+	for i := range r.Nodes {
+		if r.Nodes[i].EstimatedMem > r.MaxMem {
+			r.MaxMem = r.Nodes[i].EstimatedMem
+		}
+		if mean > 0 {
+			r.Nodes[i].Deviation = float64(r.Nodes[i].EstimatedMem)/mean - 1
+		}
+	}
+
+	slot = 0
+	for i := 0; i < n; i++ {
+		width := len(mems) / n
+		if i < len(mems)%n {
+			width++
+		}
+		var m int64
+		for _, v := range mems[slot : slot+width] {
+			m += v
+		}
+		if m > r.EvenMaxMem {
+			r.EvenMaxMem = m
+		}
+		slot += width
+	}
+	if mean > 0 {
+		r.Imbalance = float64(r.MaxMem)/mean - 1
+		r.EvenImbalance = float64(r.EvenMaxMem)/mean - 1
+	}
+	return r
+}
+
+// reshardRanges is the number of contiguous ranges a greedy fill needs when
+// no range may hold more than limit.
+func reshardRanges(mems []int64, limit int64) int {
+	ranges := 1
+	var cur int64
+	for _, m := range mems {
+		if cur+m > limit {
+			ranges++
+			cur = 0
+		}
+		cur += m
+	}
+	return ranges
+}
+
+// shardSlots sums the per-slot data of all shards.
+func shardSlots(shards []*shard) (keys, sizes, mems []int64) {
+	keys = make([]int64, clusterSlots)
+	sizes = make([]int64, clusterSlots)
+	mems = make([]int64, clusterSlots)
+	for _, s := range shards {
+		for i := 0; i < clusterSlots; i++ {
+			keys[i] += s.rep.Slots.Keys[i]
+			sizes[i] += s.rep.Slots.Sizes[i]
+			mems[i] += s.rep.Slots.Mems[i]
+		}
+	}
+	return keys, sizes, mems
+}
@@ -0,0 +1,151 @@
+package rdbviz
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// respTimeout bounds connecting and every single command.
+const respTimeout = 30 * time.Second
+
+// respConn is a minimal RESP2 client, enough for the read-only commands the
+// live checks send one at a time.
+type respConn struct {
+	ctx  context.Context
+	stop func() bool
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// dialRedis connects to addr and authenticates when password is set.
+// Cancelling ctx interrupts the command in flight.
+func dialRedis(ctx context.Context, addr, password string) (*respConn, error) {
+	d := net.Dialer{Timeout: respTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &respConn{ctx: ctx, conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	// a deadline in the past fails the blocked read or write at once
+	c.stop = context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	if password != "" {
+		if _, err := c.do("AUTH", password); err != nil {
+			c.close()
+			return nil, fmt.Errorf("auth: %v", err)
+		}
+	}
+	return c, nil
+}
+
+func (c *respConn) close() error {
+	c.stop()
+	return c.conn.Close()
+}
+
+// do sends one command and returns its reply: string for simple and bulk
+// strings, int64, []interface{} or nil. Error replies come back as errors.
+func (c *respConn) do(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(respTimeout))
+	// checked after setting the deadline, which a cancellation from now on
+	// overrides
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	WriteCommand(c.w, args...)
+	if err := c.w.Flush(); err != nil {
+		return nil, c.cause(err)
+	}
+	reply, err := c.read()
+	return reply, c.cause(err)
+}
+
+// cause reports an I/O error caused by cancellation as the context's error.
+func (c *respConn) cause(err error) error {
+	if err != nil && c.ctx.Err() != nil {
+		return c.ctx.Err()
+	}
+	return err
+}
+
+// WriteCommand writes args as a RESP array of bulk strings.
+func WriteCommand(w io.Writer, args ...string) {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+	}
+}
+
+func (c *respConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, errors.New(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply type %q", kind)
+}
+
+// scan walks the selected DB with SCAN and calls fn for every key returned.
+// SCAN may return a key more than once while the keyspace is rehashing.
+func (c *respConn) scan(count int, fn func(key string)) error {
+	cursor := "0"
+	for {
+		reply, err := c.do("SCAN", cursor, "COUNT", strconv.Itoa(count))
+		if err != nil {
+			return err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return fmt.Errorf("unexpected SCAN reply %v", reply)
+		}
+		cursor, _ = parts[0].(string)
+		keys, _ := parts[1].([]interface{})
+		for _, k := range keys {
+			if s, ok := k.(string); ok {
+				fn(s)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
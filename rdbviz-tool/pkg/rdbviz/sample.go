@@ -0,0 +1,380 @@
+package rdbviz
+
+import (
+	"math"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// sampleKey picks keys by hash so repeated runs over the same dump analyze
+// the same subset.
+func sampleKey(key string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	return float64(hashString(key)) < rate*math.MaxUint64
+}
+
+func scaleCount(v int64, factor float64) int64 {
+	return int64(math.Round(float64(v) * factor))
+}
+
+// scaleReport extrapolates counters and sizes of a sampled or truncated run to
+// the whole dump. Per-key lists (bigkeys, candidates) are left as observed.
+func scaleReport(r *report.Report, factor float64) {
+	if factor == 1 {
+		return
+	}
+	s := &r.Summary
+	s.TotalKeys = scaleCount(s.TotalKeys, factor)
+	s.TotalSize = scaleCount(s.TotalSize, factor)
+	s.TotalMem = scaleCount(s.TotalMem, factor)
+	s.WithTTL = scaleCount(s.WithTTL, factor)
+	s.NoTTL = scaleCount(s.NoTTL, factor)
+	s.Expired = scaleCount(s.Expired, factor)
+	s.ExpiredSize = scaleCount(s.ExpiredSize, factor)
+	s.ExpiredMem = scaleCount(s.ExpiredMem, factor)
+	for db, v := range s.DBKeys {
+		s.DBKeys[db] = scaleCount(v, factor)
+	}
+	for db, v := range s.DBSize {
+		s.DBSize[db] = scaleCount(v, factor)
+	}
+	for db, v := range s.DBMem {
+		s.DBMem[db] = scaleCount(v, factor)
+	}
+	for t, v := range s.TypeCounts {
+		s.TypeCounts[t] = int(scaleCount(int64(v), factor))
+	}
+	for i := range r.Types {
+		r.Types[i].Count = scaleCount(r.Types[i].Count, factor)
+		r.Types[i].Size = scaleCount(r.Types[i].Size, factor)
+		r.Types[i].EstimatedMem = scaleCount(r.Types[i].EstimatedMem, factor)
+	}
+	scaleBuckets(r.TTLBuckets, factor)
+	scaleBuckets(r.SizeBuckets, factor)
+	scalePrefixes(r.Prefixes, factor)
+	scalePrefixes(r.ExpiredPrefixes, factor)
+	for i := range r.PrefixSizePercentiles {
+		r.PrefixSizePercentiles[i].Count = scaleCount(r.PrefixSizePercentiles[i].Count, factor)
+		r.PrefixSizePercentiles[i].Size = scaleCount(r.PrefixSizePercentiles[i].Size, factor)
+	}
+	for _, m := range r.PrefixMix {
+		scaleMix(m.Types, factor)
+		scaleMix(m.Encodings, factor)
+	}
+	for i := range r.PrefixesByType {
+		r.PrefixesByType[i].EstimatedMem = scaleCount(r.PrefixesByType[i].EstimatedMem, factor)
+		scalePrefixes(r.PrefixesByType[i].Prefixes, factor)
+	}
+	for i := range r.Suffixes {
+		r.Suffixes[i].Count = scaleCount(r.Suffixes[i].Count, factor)
+		r.Suffixes[i].Size = scaleCount(r.Suffixes[i].Size, factor)
+		r.Suffixes[i].EstimatedMem = scaleCount(r.Suffixes[i].EstimatedMem, factor)
+	}
+	for i := range r.Patterns {
+		r.Patterns[i].Count = scaleCount(r.Patterns[i].Count, factor)
+		r.Patterns[i].Size = scaleCount(r.Patterns[i].Size, factor)
+		r.Patterns[i].EstimatedMem = scaleCount(r.Patterns[i].EstimatedMem, factor)
+		r.Patterns[i].Cardinality = scaleCount(r.Patterns[i].Cardinality, factor)
+	}
+	if f := r.PrefixFold; f != nil {
+		f.FoldedCount = scaleCount(f.FoldedCount, factor)
+		f.FoldedSize = scaleCount(f.FoldedSize, factor)
+		f.FoldedMem = scaleCount(f.FoldedMem, factor)
+	}
+	if e := r.Encodings; e != nil {
+		for i := range e.Encodings {
+			e.Encodings[i].Count = scaleCount(e.Encodings[i].Count, factor)
+			e.Encodings[i].Size = scaleCount(e.Encodings[i].Size, factor)
+			e.Encodings[i].EstimatedMem = scaleCount(e.Encodings[i].EstimatedMem, factor)
+		}
+		for i := range e.Suboptimal {
+			e.Suboptimal[i].Count = scaleCount(e.Suboptimal[i].Count, factor)
+			e.Suboptimal[i].EstimatedMem = scaleCount(e.Suboptimal[i].EstimatedMem, factor)
+			e.Suboptimal[i].Savings = scaleCount(e.Suboptimal[i].Savings, factor)
+		}
+	}
+	if k := r.KeyNames; k != nil {
+		k.TotalKeyBytes = scaleCount(k.TotalKeyBytes, factor)
+		k.KeyMem = scaleCount(k.KeyMem, factor)
+		k.ValueMem = scaleCount(k.ValueMem, factor)
+		scaleBuckets(k.Buckets, factor)
+	}
+	for _, h := range r.Elements {
+		for i := range h.Buckets {
+			h.Buckets[i].Count = scaleCount(h.Buckets[i].Count, factor)
+			h.Buckets[i].Size = scaleCount(h.Buckets[i].Size, factor)
+			h.Buckets[i].EstimatedMem = scaleCount(h.Buckets[i].EstimatedMem, factor)
+		}
+	}
+	if o := r.Offload; o != nil {
+		o.CandidateKeys = scaleCount(o.CandidateKeys, factor)
+		o.ProjectedSavings = scaleCount(o.ProjectedSavings, factor)
+		o.ProjectedMemSavings = scaleCount(o.ProjectedMemSavings, factor)
+		for i := range o.Namespaces {
+			o.Namespaces[i].Count = scaleCount(o.Namespaces[i].Count, factor)
+			o.Namespaces[i].Size = scaleCount(o.Namespaces[i].Size, factor)
+			o.Namespaces[i].EstimatedMem = scaleCount(o.Namespaces[i].EstimatedMem, factor)
+			o.Namespaces[i].TotalSize = scaleCount(o.Namespaces[i].TotalSize, factor)
+		}
+	}
+	if o := r.Orphans; o != nil {
+		o.Keys = scaleCount(o.Keys, factor)
+		o.Size = scaleCount(o.Size, factor)
+		o.EstimatedMem = scaleCount(o.EstimatedMem, factor)
+		for t, v := range o.Types {
+			o.Types[t] = scaleCount(v, factor)
+		}
+	}
+	if g := r.Governance; g != nil {
+		g.AllowedKeys = scaleCount(g.AllowedKeys, factor)
+		g.AllowedSize = scaleCount(g.AllowedSize, factor)
+		g.AllowedMem = scaleCount(g.AllowedMem, factor)
+		g.UnregisteredKeys = scaleCount(g.UnregisteredKeys, factor)
+		g.UnregisteredSize = scaleCount(g.UnregisteredSize, factor)
+		g.UnregisteredMem = scaleCount(g.UnregisteredMem, factor)
+		for i := range g.Patterns {
+			g.Patterns[i].Keys = scaleCount(g.Patterns[i].Keys, factor)
+			g.Patterns[i].Size = scaleCount(g.Patterns[i].Size, factor)
+			g.Patterns[i].EstimatedMem = scaleCount(g.Patterns[i].EstimatedMem, factor)
+		}
+		for i := range g.Unregistered {
+			g.Unregistered[i].Keys = scaleCount(g.Unregistered[i].Keys, factor)
+			g.Unregistered[i].Size = scaleCount(g.Unregistered[i].Size, factor)
+			g.Unregistered[i].EstimatedMem = scaleCount(g.Unregistered[i].EstimatedMem, factor)
+		}
+	}
+	if c := r.Classes; c != nil {
+		c.UnclassifiedKeys = scaleCount(c.UnclassifiedKeys, factor)
+		c.UnclassifiedSize = scaleCount(c.UnclassifiedSize, factor)
+		c.UnclassifiedMem = scaleCount(c.UnclassifiedMem, factor)
+		for i := range c.Groups {
+			c.Groups[i].Keys = scaleCount(c.Groups[i].Keys, factor)
+			c.Groups[i].Size = scaleCount(c.Groups[i].Size, factor)
+			c.Groups[i].EstimatedMem = scaleCount(c.Groups[i].EstimatedMem, factor)
+		}
+		for i := range c.Owners {
+			c.Owners[i].Keys = scaleCount(c.Owners[i].Keys, factor)
+			c.Owners[i].Size = scaleCount(c.Owners[i].Size, factor)
+			c.Owners[i].EstimatedMem = scaleCount(c.Owners[i].EstimatedMem, factor)
+		}
+		for i := range c.Labels {
+			c.Labels[i].Keys = scaleCount(c.Labels[i].Keys, factor)
+			c.Labels[i].Size = scaleCount(c.Labels[i].Size, factor)
+			c.Labels[i].EstimatedMem = scaleCount(c.Labels[i].EstimatedMem, factor)
+		}
+	}
+	if c := r.Candidates; c != nil {
+		c.CandidateKeys = scaleCount(c.CandidateKeys, factor)
+		c.Size = scaleCount(c.Size, factor)
+		c.EstimatedMem = scaleCount(c.EstimatedMem, factor)
+		for i := range c.Actions {
+			c.Actions[i].Keys = scaleCount(c.Actions[i].Keys, factor)
+			c.Actions[i].Size = scaleCount(c.Actions[i].Size, factor)
+			c.Actions[i].EstimatedMem = scaleCount(c.Actions[i].EstimatedMem, factor)
+		}
+		for i := range c.Prefixes {
+			c.Prefixes[i].Keys = scaleCount(c.Prefixes[i].Keys, factor)
+			c.Prefixes[i].Size = scaleCount(c.Prefixes[i].Size, factor)
+			c.Prefixes[i].EstimatedMem = scaleCount(c.Prefixes[i].EstimatedMem, factor)
+		}
+	}
+	for i := range r.DBs {
+		d := &r.DBs[i]
+		d.Keys = scaleCount(d.Keys, factor)
+		d.Size = scaleCount(d.Size, factor)
+		d.EstimatedMem = scaleCount(d.EstimatedMem, factor)
+		for j := range d.Types {
+			d.Types[j].Count = scaleCount(d.Types[j].Count, factor)
+			d.Types[j].Size = scaleCount(d.Types[j].Size, factor)
+			d.Types[j].EstimatedMem = scaleCount(d.Types[j].EstimatedMem, factor)
+		}
+		scaleBuckets(d.TTLBuckets, factor)
+		scalePrefixes(d.Prefixes, factor)
+	}
+	if c := r.CrossDB; c != nil {
+		c.OverlapKeys = scaleCount(c.OverlapKeys, factor)
+		c.Copies = scaleCount(c.Copies, factor)
+		c.CombinedSize = scaleCount(c.CombinedSize, factor)
+		c.CombinedMem = scaleCount(c.CombinedMem, factor)
+		for i := range c.Pairs {
+			c.Pairs[i].Keys = scaleCount(c.Pairs[i].Keys, factor)
+			c.Pairs[i].Size = scaleCount(c.Pairs[i].Size, factor)
+		}
+	}
+	if d := r.Dedup; d != nil {
+		d.DuplicateGroups = scaleCount(d.DuplicateGroups, factor)
+		d.DuplicateKeys = scaleCount(d.DuplicateKeys, factor)
+		d.Savings = scaleCount(d.Savings, factor)
+		d.MemSavings = scaleCount(d.MemSavings, factor)
+	}
+	if h := r.HyperLogLogs; h != nil {
+		h.Count = scaleCount(h.Count, factor)
+		h.Size = scaleCount(h.Size, factor)
+		h.EstimatedMem = scaleCount(h.EstimatedMem, factor)
+		h.Dense = scaleCount(h.Dense, factor)
+		h.Sparse = scaleCount(h.Sparse, factor)
+		h.Invalid = scaleCount(h.Invalid, factor)
+	}
+	if b := r.Bitmaps; b != nil {
+		b.Count = scaleCount(b.Count, factor)
+		b.Size = scaleCount(b.Size, factor)
+		b.EstimatedMem = scaleCount(b.EstimatedMem, factor)
+		b.SetBits = scaleCount(b.SetBits, factor)
+	}
+	if g := r.Geo; g != nil {
+		g.Count = scaleCount(g.Count, factor)
+		g.Members = scaleCount(g.Members, factor)
+		g.Size = scaleCount(g.Size, factor)
+		g.EstimatedMem = scaleCount(g.EstimatedMem, factor)
+	}
+	if t := r.ExpiryTimeline; t != nil {
+		scaleTimeBuckets(t.Hourly, factor)
+		scaleTimeBuckets(t.Daily, factor)
+		for i := range t.Spikes {
+			t.Spikes[i].Count = scaleCount(t.Spikes[i].Count, factor)
+		}
+	}
+	if c := r.ColdKeys; c != nil {
+		c.KeysWithIdle = scaleCount(c.KeysWithIdle, factor)
+		c.Size = scaleCount(c.Size, factor)
+		c.EstimatedMem = scaleCount(c.EstimatedMem, factor)
+		scaleColdBuckets(c.Buckets, factor)
+		for i := range c.Prefixes {
+			c.Prefixes[i].Count = scaleCount(c.Prefixes[i].Count, factor)
+			c.Prefixes[i].Size = scaleCount(c.Prefixes[i].Size, factor)
+			c.Prefixes[i].EstimatedMem = scaleCount(c.Prefixes[i].EstimatedMem, factor)
+			scaleColdBuckets(c.Prefixes[i].Buckets, factor)
+		}
+	}
+	if e := r.Eviction; e != nil {
+		e.UsedMem = scaleCount(e.UsedMem, factor)
+		e.NeedToFree = scaleCount(e.NeedToFree, factor)
+		for i := range e.Policies {
+			p := &e.Policies[i]
+			p.EvictedKeys = scaleCount(p.EvictedKeys, factor)
+			p.EvictedSize = scaleCount(p.EvictedSize, factor)
+			p.EvictedMem = scaleCount(p.EvictedMem, factor)
+			for j := range p.Prefixes {
+				p.Prefixes[j].EligibleKeys = scaleCount(p.Prefixes[j].EligibleKeys, factor)
+				p.Prefixes[j].EvictedKeys = scaleCount(p.Prefixes[j].EvictedKeys, factor)
+				p.Prefixes[j].EvictedSize = scaleCount(p.Prefixes[j].EvictedSize, factor)
+				p.Prefixes[j].EvictedMem = scaleCount(p.Prefixes[j].EvictedMem, factor)
+			}
+		}
+	}
+	if w := r.TTLWhatIf; w != nil {
+		for i := range w.Rules {
+			w.Rules[i].MatchedKeys = scaleCount(w.Rules[i].MatchedKeys, factor)
+			w.Rules[i].NoTTLKeys = scaleCount(w.Rules[i].NoTTLKeys, factor)
+			w.Rules[i].Size = scaleCount(w.Rules[i].Size, factor)
+			w.Rules[i].EstimatedMem = scaleCount(w.Rules[i].EstimatedMem, factor)
+		}
+		for i := range w.Projection {
+			p := &w.Projection[i]
+			p.BaselineKeys = scaleCount(p.BaselineKeys, factor)
+			p.BaselineSize = scaleCount(p.BaselineSize, factor)
+			p.BaselineMem = scaleCount(p.BaselineMem, factor)
+			p.WhatIfKeys = scaleCount(p.WhatIfKeys, factor)
+			p.WhatIfSize = scaleCount(p.WhatIfSize, factor)
+			p.WhatIfMem = scaleCount(p.WhatIfMem, factor)
+		}
+	}
+	if s := r.Slots; s != nil {
+		s.MeanSlotSize = scaleCount(s.MeanSlotSize, factor)
+		s.MaxSlotSize = scaleCount(s.MaxSlotSize, factor)
+		for i := range s.Ranges {
+			s.Ranges[i].Keys = scaleCount(s.Ranges[i].Keys, factor)
+			s.Ranges[i].Size = scaleCount(s.Ranges[i].Size, factor)
+			s.Ranges[i].EstimatedMem = scaleCount(s.Ranges[i].EstimatedMem, factor)
+		}
+		for i := range s.TopSlots {
+			s.TopSlots[i].Keys = scaleCount(s.TopSlots[i].Keys, factor)
+			s.TopSlots[i].Size = scaleCount(s.TopSlots[i].Size, factor)
+			s.TopSlots[i].EstimatedMem = scaleCount(s.TopSlots[i].EstimatedMem, factor)
+		}
+		for i := range s.Keys {
+			s.Keys[i] = scaleCount(s.Keys[i], factor)
+			s.Sizes[i] = scaleCount(s.Sizes[i], factor)
+			s.Mems[i] = scaleCount(s.Mems[i], factor)
+		}
+		if h := s.HotSlots; h != nil {
+			h.KeysWithFreq = scaleCount(h.KeysWithFreq, factor)
+			for i := range h.Slots {
+				h.Slots[i].Keys = scaleCount(h.Slots[i].Keys, factor)
+				h.Slots[i].Size = scaleCount(h.Slots[i].Size, factor)
+				h.Slots[i].Hits = scaleCount(h.Slots[i].Hits, factor)
+			}
+		}
+	}
+	if h := r.HashTags; h != nil {
+		h.TaggedKeys = scaleCount(h.TaggedKeys, factor)
+		h.TaggedSize = scaleCount(h.TaggedSize, factor)
+		h.TaggedMem = scaleCount(h.TaggedMem, factor)
+		h.Untracked = scaleCount(h.Untracked, factor)
+		for _, list := range [][]report.HashTagStat{h.Hot, h.TopByKeys, h.TopBySize} {
+			for i := range list {
+				list[i].Keys = scaleCount(list[i].Keys, factor)
+				list[i].Size = scaleCount(list[i].Size, factor)
+				list[i].EstimatedMem = scaleCount(list[i].EstimatedMem, factor)
+			}
+		}
+		h.CollidingKeys = scaleCount(h.CollidingKeys, factor)
+		h.CollidingSize = scaleCount(h.CollidingSize, factor)
+		for i := range h.Collisions {
+			c := &h.Collisions[i]
+			c.Keys = scaleCount(c.Keys, factor)
+			c.Size = scaleCount(c.Size, factor)
+			c.EstimatedMem = scaleCount(c.EstimatedMem, factor)
+			for j := range c.Prefixes {
+				c.Prefixes[j].Keys = scaleCount(c.Prefixes[j].Keys, factor)
+				c.Prefixes[j].Size = scaleCount(c.Prefixes[j].Size, factor)
+			}
+		}
+	}
+	if c := r.Compression; c != nil {
+		c.EstimatedSavings = scaleCount(c.EstimatedSavings, factor)
+		for i := range c.Prefixes {
+			c.Prefixes[i].StringSize = scaleCount(c.Prefixes[i].StringSize, factor)
+			c.Prefixes[i].EstimatedSavings = scaleCount(c.Prefixes[i].EstimatedSavings, factor)
+		}
+	}
+}
+
+func scaleBuckets(buckets []report.Bucket, factor float64) {
+	for i := range buckets {
+		buckets[i].Count = scaleCount(buckets[i].Count, factor)
+	}
+}
+
+func scaleMix(entries []report.MixEntry, factor float64) {
+	for i := range entries {
+		entries[i].Count = scaleCount(entries[i].Count, factor)
+		entries[i].Size = scaleCount(entries[i].Size, factor)
+	}
+}
+
+func scaleTimeBuckets(buckets []report.TimeBucket, factor float64) {
+	for i := range buckets {
+		buckets[i].Count = scaleCount(buckets[i].Count, factor)
+		buckets[i].Size = scaleCount(buckets[i].Size, factor)
+		buckets[i].EstimatedMem = scaleCount(buckets[i].EstimatedMem, factor)
+	}
+}
+
+func scaleColdBuckets(buckets []report.ColdBucket, factor float64) {
+	for i := range buckets {
+		buckets[i].Count = scaleCount(buckets[i].Count, factor)
+		buckets[i].Size = scaleCount(buckets[i].Size, factor)
+		buckets[i].EstimatedMem = scaleCount(buckets[i].EstimatedMem, factor)
+	}
+}
+
+func scalePrefixes(prefixes []report.PrefixStat, factor float64) {
+	for i := range prefixes {
+		prefixes[i].Count = scaleCount(prefixes[i].Count, factor)
+		prefixes[i].Size = scaleCount(prefixes[i].Size, factor)
+		prefixes[i].EstimatedMem = scaleCount(prefixes[i].EstimatedMem, factor)
+	}
+}
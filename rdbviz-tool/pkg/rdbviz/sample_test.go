@@ -0,0 +1,26 @@
+package rdbviz
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestSampleKeySequentialKeys(t *testing.T) {
+	const n = 200000
+	for _, format := range []string{"user:%d", "session:%d", "%d"} {
+		for _, rate := range []float64{0.01, 0.05, 0.5} {
+			kept := 0
+			for i := 0; i < n; i++ {
+				if sampleKey(fmt.Sprintf(format, i), rate) {
+					kept++
+				}
+			}
+			// 5 standard deviations of a binomial draw
+			want := rate * n
+			if tol := 5 * math.Sqrt(n*rate*(1-rate)); math.Abs(float64(kept)-want) > tol {
+				t.Errorf("%s at %v: kept %d keys, want %.0f±%.0f", format, rate, kept, want, tol)
+			}
+		}
+	}
+}
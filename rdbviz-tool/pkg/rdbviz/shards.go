@@ -0,0 +1,277 @@
+package rdbviz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// shard is one node's report, loaded for cross-shard analysis.
+type shard struct {
+	name string
+	rep  report.Report
+	mem  int64
+}
+
+func loadShards(ctx context.Context, paths []string) ([]*shard, error) {
+	shards := make([]*shard, 0, len(paths))
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		s, err := loadShard(p)
+		if err != nil {
+			return nil, err
+		}
+		if s.rep.Slots == nil || len(s.rep.Slots.Mems) != clusterSlots {
+			return nil, fmt.Errorf("%s: no slot data, regenerate it with -slots", p)
+		}
+		s.mem = s.rep.Summary.TotalMem
+		shards = append(shards, s)
+	}
+	return shards, nil
+}
+
+// AnalyzeShards compares the reports of all shards of a cluster, written with
+// slot data, and plans slot moves that balance their estimated memory.
+// Cancelling ctx stops loading the reports.
+func AnalyzeShards(ctx context.Context, paths []string, opts Options) (*Report, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	shards, err := loadShards(ctx, paths)
+	if err != nil {
+		return nil, err
+	}
+	rep := shardReport(shards, time.Now().Format(time.RFC3339))
+	// coverage first: balancing moves slot data between the loaded shards
+	rep.SlotCoverage = slotCoverage(shards, opts.TopN)
+	if opts.Reshard > 0 {
+		keys, sizes, mems := shardSlots(shards)
+		rep.Reshard = planReshard(keys, sizes, mems, opts.Reshard)
+	}
+	rep.ShardBalance = balanceShards(shards, opts.BalanceTolerance)
+	return &rep, nil
+}
+
+// loadShard reads a report, named after its file.
+func loadShard(path string) (*shard, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := &shard{name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	if err := json.NewDecoder(f).Decode(&s.rep); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+// shardReport sums the shards into a report that carries the cross-shard
+// sections.
+func shardReport(shards []*shard, generatedAt string) report.Report {
+	sources := make([]string, len(shards))
+	summary := report.Summary{
+		DBKeys:     map[int]int64{},
+		DBSize:     map[int]int64{},
+		DBMem:      map[int]int64{},
+		TypeCounts: map[string]int{},
+		NowISO:     generatedAt,
+	}
+	for i, s := range shards {
+		sources[i] = s.rep.Meta.Source
+		sum := s.rep.Summary
+		summary.TotalKeys += sum.TotalKeys
+		summary.TotalSize += sum.TotalSize
+		summary.TotalMem += sum.TotalMem
+		summary.WithTTL += sum.WithTTL
+		summary.NoTTL += sum.NoTTL
+		summary.Expired += sum.Expired
+		summary.ExpiredSize += sum.ExpiredSize
+		summary.ExpiredMem += sum.ExpiredMem
+		for db, n := range sum.DBKeys {
+			summary.DBKeys[db] += n
+		}
+		for db, n := range sum.DBSize {
+			summary.DBSize[db] += n
+		}
+		for db, n := range sum.DBMem {
+			summary.DBMem[db] += n
+		}
+		for t, n := range sum.TypeCounts {
+			summary.TypeCounts[t] += n
+		}
+	}
+	summary.DBCount = len(summary.DBKeys)
+	return report.Report{
+		Meta:           report.Meta{Source: strings.Join(sources, ","), GeneratedAt: generatedAt},
+		Summary:        summary,
+		Types:          []report.TypeStat{},
+		TTLBuckets:     []report.Bucket{},
+		SizeBuckets:    []report.Bucket{},
+		Prefixes:       []report.PrefixStat{},
+		PrefixesByType: []report.PrefixTypeGroup{},
+		BigKeys:        []report.BigKey{},
+	}
+}
+
+// balanceShards plans slot moves from shards above the mean estimated memory
+// to shards below it until every shard is within tolerance of the mean.
+// Slots are taken from the top of the donor's slot space downwards, so moves
+// come out as contiguous ranges; slots holding no keys on any shard do not
+// break a range.
+func balanceShards(shards []*shard, tolerance float64) *report.ShardBalance {
+	var total int64
+	for _, s := range shards {
+		total += s.mem
+	}
+	mean := float64(total) / float64(len(shards))
+	r := &report.ShardBalance{
+		Tolerance: tolerance,
+		MeanMem:   int64(math.Round(mean)),
+		Shards:    make([]report.ShardStat, len(shards)),
+		Moves:     []report.SlotMove{},
+	}
+
+	owned := make([][]int, len(shards))
+	after := make([]int64, len(shards))
+	var used [clusterSlots]bool
+	for i, s := range shards {
+		for slot := clusterSlots - 1; slot >= 0; slot-- {
+			if s.rep.Slots.Keys[slot] > 0 {
+				owned[i] = append(owned[i], slot)
+				used[slot] = true
+			}
+		}
+		after[i] = s.mem
+	}
+
+	limit := tolerance * mean
+	for iter := 0; iter < 2*len(shards); iter++ {
+		from, to := 0, 0
+		for i := range shards {
+			if after[i] > after[from] {
+				from = i
+			}
+			if after[i] < after[to] {
+				to = i
+			}
+		}
+		if float64(after[from])-mean <= limit && mean-float64(after[to]) <= limit {
+			break
+		}
+		want := int64(math.Min(float64(after[from])-mean, mean-float64(after[to])))
+		moved := balanceMove(shards, owned, &used, from, to, want, r)
+		if moved == 0 {
+			break
+		}
+		after[from] -= moved
+		after[to] += moved
+	}
+
+	for i, s := range shards {
+		r.Shards[i] = report.ShardStat{
+			Name:         s.name,
+			Keys:         s.rep.Summary.TotalKeys,
+			Size:         s.rep.Summary.TotalSize,
+			EstimatedMem: s.mem,
+			Slots:        s.rep.Slots.UsedSlots,
+			AfterMem:     after[i],
+		}
+		if mean > 0 {
+			r.Shards[i].Deviation = float64(s.mem)/mean - 1
+		}
+	}
+	return r
+}
+
+// balanceMove moves up to want bytes of estimated memory from shard from to
+// shard to, appending one SlotMove per contiguous run of slots, and returns
+// the memory moved. Slots larger than twice the remaining amount are left.
+// The slot data moves along so later moves can pass it on.
+func balanceMove(shards []*shard, owned [][]int, used *[clusterSlots]bool, from, to int, want int64, r *report.ShardBalance) int64 {
+	src, dst := shards[from].rep.Slots, shards[to].rep.Slots
+	var moved int64
+	var mv *report.SlotMove
+	keep := owned[from][:0]
+	for _, slot := range owned[from] {
+		m := src.Mems[slot]
+		if moved >= want || m > 2*(want-moved) {
+			keep = append(keep, slot)
+			continue
+		}
+		if mv == nil || !emptyBetween(used, slot, mv.Start) {
+			r.Moves = append(r.Moves, report.SlotMove{From: shards[from].name, To: shards[to].name, Start: slot, End: slot})
+			mv = &r.Moves[len(r.Moves)-1]
+		}
+		mv.Start = slot
+		mv.Slots++
+		mv.Keys += src.Keys[slot]
+		mv.Size += src.Sizes[slot]
+		mv.EstimatedMem += m
+		moved += m
+		owned[to] = append(owned[to], slot)
+		dst.Keys[slot], dst.Sizes[slot], dst.Mems[slot] = src.Keys[slot], src.Sizes[slot], m
+		src.Keys[slot], src.Sizes[slot], src.Mems[slot] = 0, 0, 0
+	}
+	owned[from] = keep
+	sort.Sort(sort.Reverse(sort.IntSlice(owned[to])))
+	return moved
+}
+
+// emptyBetween reports whether no shard holds keys in the slots strictly
+// between lo and hi.
+func emptyBetween(used *[clusterSlots]bool, lo, hi int) bool {
+	for s := lo + 1; s < hi; s++ {
+		if used[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// slotCoverage checks slot ownership across shards. Ownership is inferred
+// from keys: a slot holding keys on several shards is a conflict (a
+// half-finished migration or a client bypassing cluster routing), and runs of
+// slots without keys anywhere are listed so they can be checked against
+// CLUSTER SLOTS.
+func slotCoverage(shards []*shard, topN int) *report.SlotCoverage {
+	r := &report.SlotCoverage{EmptyRanges: []report.SlotSpan{}, Conflicts: []report.SlotConflict{}}
+	for slot := 0; slot < clusterSlots; slot++ {
+		var c report.SlotConflict
+		for _, s := range shards {
+			if n := s.rep.Slots.Keys[slot]; n > 0 {
+				c.Shards = append(c.Shards, s.name)
+				c.Keys = append(c.Keys, n)
+			}
+		}
+		switch len(c.Shards) {
+		case 0:
+			r.EmptySlots++
+			if n := len(r.EmptyRanges); n > 0 && r.EmptyRanges[n-1].End == slot-1 {
+				r.EmptyRanges[n-1].End = slot
+			} else {
+				r.EmptyRanges = append(r.EmptyRanges, report.SlotSpan{Start: slot, End: slot})
+			}
+		case 1:
+			r.CoveredSlots++
+		default:
+			r.CoveredSlots++
+			r.ConflictSlots++
+			if topN <= 0 || len(r.Conflicts) < topN {
+				c.Slot = slot
+				r.Conflicts = append(r.Conflicts, c)
+			}
+		}
+	}
+	return r
+}
@@ -0,0 +1,207 @@
+package rdbviz
+
+import (
+	"math"
+	"sort"
+
+	"rdbviz-tool/pkg/report"
+)
+
+const (
+	clusterSlots = 16384
+	slotRange    = 1024
+)
+
+var crc16Table [256]uint16
+
+func init() {
+	// CRC16-CCITT (XMODEM), polynomial 0x1021, as used by Redis Cluster
+	for i := range crc16Table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// hashTag returns the part of key Redis Cluster hashes: the content of the
+// first {...} when it is non-empty, otherwise the whole key.
+func hashTag(key string) (string, bool) {
+	for i := 0; i < len(key); i++ {
+		if key[i] != '{' {
+			continue
+		}
+		for j := i + 1; j < len(key); j++ {
+			if key[j] == '}' {
+				if j == i+1 {
+					return key, false
+				}
+				return key[i+1 : j], true
+			}
+		}
+		return key, false
+	}
+	return key, false
+}
+
+func keySlot(key string) int {
+	tag, _ := hashTag(key)
+	return int(crc16(tag) % clusterSlots)
+}
+
+// lfuLogFactor and lfuInitVal are the Redis defaults (lfu-log-factor 10,
+// LFU_INIT_VAL 5) used to turn LFU counters back into hit counts.
+const (
+	lfuLogFactor = 10
+	lfuInitVal   = 5
+)
+
+// lfuHits estimates how many accesses it takes to reach LFU counter c: above
+// the initial value each increment happens with probability
+// 1/((c-LFU_INIT_VAL)*lfu-log-factor+1). Counter decay is ignored.
+func lfuHits(c int64) float64 {
+	if c <= lfuInitVal {
+		return float64(c)
+	}
+	n := c - lfuInitVal
+	// sum of ((i-init)*factor+1) for i in [init, c)
+	return float64(lfuInitVal) + float64(lfuLogFactor*n*(n-1)/2+n)
+}
+
+// slotStats aggregates keys by cluster hash slot.
+type slotStats struct {
+	topN      int
+	hotFactor float64
+	keys      [clusterSlots]int64
+	sizes     [clusterSlots]int64
+	mems      [clusterSlots]int64
+	hits      *[clusterSlots]float64
+	freqKeys  int64
+}
+
+func newSlotStats(hotFactor float64, topN int) *slotStats {
+	return &slotStats{topN: topN, hotFactor: hotFactor}
+}
+
+func (ss *slotStats) observe(key string, size, mem, freq int64) {
+	s := keySlot(key)
+	ss.keys[s]++
+	ss.sizes[s] += size
+	ss.mems[s] += mem
+	if freq == unknownAccess {
+		return
+	}
+	if ss.hits == nil {
+		ss.hits = &[clusterSlots]float64{}
+	}
+	ss.hits[s] += lfuHits(freq)
+	ss.freqKeys++
+}
+
+func (ss *slotStats) result() *report.SlotReport {
+	r := &report.SlotReport{
+		Keys:     ss.keys[:],
+		Sizes:    ss.sizes[:],
+		Mems:     ss.mems[:],
+		Ranges:   make([]report.SlotRange, 0, clusterSlots/slotRange),
+		TopSlots: []report.SlotStat{},
+	}
+	var total, sumSq float64
+	for s := 0; s < clusterSlots; s++ {
+		if ss.keys[s] > 0 {
+			r.UsedSlots++
+		}
+		if ss.sizes[s] > r.MaxSlotSize {
+			r.MaxSlotSize = ss.sizes[s]
+		}
+		x := float64(ss.sizes[s])
+		total += x
+		sumSq += x * x
+		if s%slotRange == 0 {
+			r.Ranges = append(r.Ranges, report.SlotRange{Start: s, End: s + slotRange - 1})
+		}
+		g := &r.Ranges[len(r.Ranges)-1]
+		g.Keys += ss.keys[s]
+		g.Size += ss.sizes[s]
+		g.EstimatedMem += ss.mems[s]
+		ss.push(r, s)
+	}
+	mean := total / clusterSlots
+	r.MeanSlotSize = int64(math.Round(mean))
+	if mean > 0 {
+		r.SizeCV = math.Sqrt(math.Max(sumSq/clusterSlots-mean*mean, 0)) / mean
+		r.MaxToMean = float64(r.MaxSlotSize) / mean
+	}
+	sort.Slice(r.TopSlots, func(i, j int) bool { return r.TopSlots[i].Size > r.TopSlots[j].Size })
+	if ss.hits != nil {
+		r.HotSlots = ss.hotSlots(total)
+	}
+	return r
+}
+
+// hotSlots returns the slots whose share of estimated hits is at least
+// hotFactor times the share an even spread over the used slots would give.
+func (ss *slotStats) hotSlots(totalSize float64) *report.HotSlots {
+	h := &report.HotSlots{KeysWithFreq: ss.freqKeys, Factor: ss.hotFactor, Slots: []report.HotSlot{}}
+	var totalHits float64
+	used := 0
+	for s := 0; s < clusterSlots; s++ {
+		totalHits += ss.hits[s]
+		if ss.keys[s] > 0 {
+			used++
+		}
+	}
+	if totalHits == 0 || used == 0 {
+		return h
+	}
+	threshold := ss.hotFactor / float64(used)
+	for s := 0; s < clusterSlots; s++ {
+		share := ss.hits[s] / totalHits
+		if share < threshold {
+			continue
+		}
+		hs := report.HotSlot{Slot: s, Keys: ss.keys[s], Size: ss.sizes[s], Hits: int64(math.Round(ss.hits[s])), AccessShare: share}
+		if totalSize > 0 {
+			hs.SizeShare = float64(ss.sizes[s]) / totalSize
+		}
+		h.Slots = append(h.Slots, hs)
+	}
+	sort.Slice(h.Slots, func(i, j int) bool { return h.Slots[i].AccessShare > h.Slots[j].AccessShare })
+	if ss.topN > 0 && len(h.Slots) > ss.topN {
+		h.Slots = h.Slots[:ss.topN]
+	}
+	return h
+}
+
+func (ss *slotStats) push(r *report.SlotReport, s int) {
+	if ss.topN <= 0 || ss.keys[s] == 0 {
+		return
+	}
+	st := report.SlotStat{Slot: s, Keys: ss.keys[s], Size: ss.sizes[s], EstimatedMem: ss.mems[s]}
+	if len(r.TopSlots) < ss.topN {
+		r.TopSlots = append(r.TopSlots, st)
+		return
+	}
+	minIdx := 0
+	for i := 1; i < len(r.TopSlots); i++ {
+		if r.TopSlots[i].Size < r.TopSlots[minIdx].Size {
+			minIdx = i
+		}
+	}
+	if st.Size > r.TopSlots[minIdx].Size {
+		r.TopSlots[minIdx] = st
+	}
+}
@@ -0,0 +1,609 @@
+package rdbviz
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// Spilling bounds the two maps that grow with the keyspace rather than with
+// the report, the prefix tables and the dedup hashes. Once their estimated
+// size passes Options.MaxMem, their entries are written sorted to a run file
+// in Options.SpillDir and the maps start over; at the end the runs and what
+// is left in memory are merged one entry at a time, keeping only what the
+// report lists.
+const (
+	// spillCheckEvery is how many keys pass between two size estimates.
+	spillCheckEvery = 1024
+	// Estimated bytes of one map entry, key and value included.
+	prefixEntryBytes = 200
+	dedupEntryBytes  = 240
+)
+
+// spiller decides when to spill and records it for the report.
+type spiller struct {
+	log   *slog.Logger
+	dir   string
+	limit int64
+	pfx   *prefixStats
+	dedup *dedupStats
+	seen  int64
+	info  report.Spill
+}
+
+// newSpiller returns nil when MaxMem is 0. The prefix tables are not spilled
+// with auto prefix depth or a baseline, which both need them whole, nor
+// when a sketch already bounds them.
+func newSpiller(opts Options, pfx *prefixStats, dedup *dedupStats) *spiller {
+	if opts.MaxMem <= 0 {
+		return nil
+	}
+	s := &spiller{log: opts.logger(), dir: opts.SpillDir, limit: opts.MaxMem, dedup: dedup, info: report.Spill{MaxMem: opts.MaxMem, Tables: []string{}}}
+	if !pfx.autoPrune && opts.Baseline == "" && pfx.sketch == nil {
+		s.pfx = pfx
+		s.info.Tables = append(s.info.Tables, "prefixes")
+	}
+	if dedup != nil {
+		s.info.Tables = append(s.info.Tables, "dedup")
+	}
+	return s
+}
+
+func (s *spiller) usage() int64 {
+	var n int64
+	if s.pfx != nil {
+		n += s.pfx.entries() * prefixEntryBytes
+	}
+	if s.dedup != nil {
+		n += int64(len(s.dedup.values)) * dedupEntryBytes
+	}
+	return n
+}
+
+// observe is called once per key and spills every table once their
+// estimated size reaches the limit.
+func (s *spiller) observe() error {
+	s.seen++
+	if s.seen%spillCheckEvery != 0 || s.usage() < s.limit {
+		return nil
+	}
+	s.info.Spills++
+	s.log.Debug("spilling aggregation tables", "estimated", s.usage(), "limit", s.limit, "spill", s.info.Spills)
+	if s.pfx != nil {
+		n, err := s.pfx.spill(s.dir)
+		s.info.SpilledBytes += n
+		if err != nil {
+			return err
+		}
+	}
+	if s.dedup != nil {
+		n, err := s.dedup.spill(s.dir)
+		s.info.SpilledBytes += n
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *spiller) result() *report.Spill {
+	info := s.info
+	return &info
+}
+
+// cleanup removes the run files; it is safe on a nil spiller.
+func (s *spiller) cleanup() {
+	if s == nil {
+		return
+	}
+	if s.pfx != nil {
+		removeRuns(s.pfx.runs)
+	}
+	if s.dedup != nil {
+		removeRuns(s.dedup.runs)
+	}
+}
+
+// spillRun is one run file, holding a section of sorted records per table.
+type spillRun struct {
+	path     string
+	sections map[string]spillSection
+}
+
+type spillSection struct {
+	off int64
+	n   int
+}
+
+func removeRuns(runs []*spillRun) {
+	for _, r := range runs {
+		os.Remove(r.path)
+	}
+}
+
+// spillWriter writes the records of a run as varints and counts its bytes.
+type spillWriter struct {
+	f   *os.File
+	w   *bufio.Writer
+	off int64
+	buf [binary.MaxVarintLen64]byte
+}
+
+// createRun creates a run file in dir and registers it in runs right away,
+// so it is removed even if writing it fails.
+func createRun(dir, pattern string, runs *[]*spillRun) (*spillWriter, *spillRun, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	run := &spillRun{path: f.Name(), sections: map[string]spillSection{}}
+	*runs = append(*runs, run)
+	return &spillWriter{f: f, w: bufio.NewWriterSize(f, 1<<16)}, run, nil
+}
+
+func (sw *spillWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(sw.buf[:], v)
+	sw.w.Write(sw.buf[:n])
+	sw.off += int64(n)
+}
+
+func (sw *spillWriter) varint(v int64) {
+	n := binary.PutVarint(sw.buf[:], v)
+	sw.w.Write(sw.buf[:n])
+	sw.off += int64(n)
+}
+
+func (sw *spillWriter) str(s string) {
+	sw.uvarint(uint64(len(s)))
+	sw.w.WriteString(s)
+	sw.off += int64(len(s))
+}
+
+// close flushes the run; a bufio.Writer keeps its first error, so this is
+// the only place write errors need checking.
+func (sw *spillWriter) close() error {
+	if err := sw.w.Flush(); err != nil {
+		sw.f.Close()
+		return err
+	}
+	return sw.f.Close()
+}
+
+// spillReader reads back one section of a run. Its first error sticks and
+// ends the section.
+type spillReader struct {
+	f    *os.File
+	r    *bufio.Reader
+	left int
+	err  error
+}
+
+func openSection(run *spillRun, table string) (*spillReader, error) {
+	sec, ok := run.sections[table]
+	if !ok {
+		return &spillReader{}, nil
+	}
+	f, err := os.Open(run.path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(sec.off, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &spillReader{f: f, r: bufio.NewReaderSize(f, 1<<16), left: sec.n}, nil
+}
+
+// more reports whether a record is left to read, closing the file after
+// the last one.
+func (sr *spillReader) more() bool {
+	if sr.left > 0 && sr.err == nil {
+		sr.left--
+		return true
+	}
+	if sr.f != nil {
+		sr.f.Close()
+		sr.f = nil
+	}
+	return false
+}
+
+func (sr *spillReader) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(sr.r)
+	sr.err = err
+	return v
+}
+
+func (sr *spillReader) varint() int64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(sr.r)
+	sr.err = err
+	return v
+}
+
+func (sr *spillReader) str() string {
+	n := sr.uvarint()
+	if sr.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	_, sr.err = io.ReadFull(sr.r, b)
+	return string(b)
+}
+
+func writePrefixAgg(sw *spillWriter, prefix string, a prefixAgg) {
+	sw.str(prefix)
+	sw.varint(a.Count)
+	sw.varint(a.Size)
+	sw.varint(a.Mem)
+	sw.varint(a.WithTTL)
+	if a.TTL == nil {
+		sw.uvarint(0)
+		return
+	}
+	sw.uvarint(1)
+	for _, v := range a.TTL {
+		sw.uvarint(uint64(v))
+	}
+}
+
+func (sr *spillReader) prefixAgg() (string, prefixAgg) {
+	prefix := sr.str()
+	a := prefixAgg{Count: sr.varint(), Size: sr.varint(), Mem: sr.varint(), WithTTL: sr.varint()}
+	if sr.uvarint() == 1 {
+		a.TTL = &ttlHist{}
+		for i := range a.TTL {
+			a.TTL[i] = uint32(sr.uvarint())
+		}
+	}
+	return prefix, a
+}
+
+// tables names every prefix table of p for its run sections.
+func (p *prefixStats) tables() map[string]map[string]prefixAgg {
+	t := map[string]map[string]prefixAgg{"all": p.prefixes, "expired": p.expired}
+	for typ, pm := range p.byType {
+		t["type:"+typ] = pm
+	}
+	for enc, pm := range p.byEncoding {
+		t["encoding:"+enc] = pm
+	}
+	return t
+}
+
+func (p *prefixStats) entries() int64 {
+	var n int64
+	for _, pm := range p.tables() {
+		n += int64(len(pm))
+	}
+	return n
+}
+
+// spill writes every prefix table to a new run and empties them.
+func (p *prefixStats) spill(dir string) (int64, error) {
+	sw, run, err := createRun(dir, "rdbviz-prefixes-*.spill", &p.runs)
+	if err != nil {
+		return 0, err
+	}
+	for name, pm := range p.tables() {
+		if len(pm) == 0 {
+			continue
+		}
+		run.sections[name] = spillSection{off: sw.off, n: len(pm)}
+		for _, prefix := range sortedKeys(pm) {
+			writePrefixAgg(sw, prefix, pm[prefix])
+		}
+	}
+	if err := sw.close(); err != nil {
+		return sw.off, err
+	}
+	p.prefixes = map[string]prefixAgg{}
+	p.expired = map[string]prefixAgg{}
+	p.byType = map[string]map[string]prefixAgg{}
+	p.byEncoding = map[string]map[string]prefixAgg{}
+	return sw.off, nil
+}
+
+// unspill merges the runs back into the tables, keeping what result lists:
+// the top prefixes of every table, and in the per-type and per-encoding
+// tables also those of the overall top list, for the mix.
+func (p *prefixStats) unspill() error {
+	if len(p.runs) == 0 {
+		return nil
+	}
+	all, err := p.mergeTable("all", p.prefixes, nil)
+	if err != nil {
+		return err
+	}
+	expired, err := p.mergeTable("expired", p.expired, nil)
+	if err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for name := range p.tables() {
+		names[name] = true
+	}
+	for _, run := range p.runs {
+		for name := range run.sections {
+			names[name] = true
+		}
+	}
+	byType := map[string]map[string]prefixAgg{}
+	byEncoding := map[string]map[string]prefixAgg{}
+	for name := range names {
+		dst := byType
+		group, ok := strings.CutPrefix(name, "type:")
+		if !ok {
+			dst = byEncoding
+			if group, ok = strings.CutPrefix(name, "encoding:"); !ok {
+				continue
+			}
+		}
+		pm, err := p.mergeTable(name, p.tables()[name], all)
+		if err != nil {
+			return err
+		}
+		dst[group] = pm
+	}
+	p.prefixes, p.expired, p.byType, p.byEncoding = all, expired, byType, byEncoding
+	return nil
+}
+
+// prefixCursor walks the records of one table in prefix order, from a run
+// or from the in-memory map.
+type prefixCursor struct {
+	sr     *spillReader
+	sorted []string
+	mem    map[string]prefixAgg
+	prefix string
+	agg    prefixAgg
+	ok     bool
+}
+
+func (c *prefixCursor) next() error {
+	if c.sr == nil {
+		c.ok = len(c.sorted) > 0
+		if c.ok {
+			c.prefix, c.sorted = c.sorted[0], c.sorted[1:]
+			c.agg = c.mem[c.prefix]
+		}
+		return nil
+	}
+	c.ok = c.sr.more()
+	if c.ok {
+		c.prefix, c.agg = c.sr.prefixAgg()
+	}
+	return c.sr.err
+}
+
+// mergeTable merges table across the runs and mem, keeping its topN
+// prefixes by size plus those in wanted.
+func (p *prefixStats) mergeTable(table string, mem map[string]prefixAgg, wanted map[string]prefixAgg) (map[string]prefixAgg, error) {
+	cursors := make([]*prefixCursor, 0, len(p.runs)+1)
+	defer func() {
+		for _, c := range cursors {
+			if c.sr != nil && c.sr.f != nil {
+				c.sr.f.Close()
+			}
+		}
+	}()
+	for _, run := range p.runs {
+		sr, err := openSection(run, table)
+		if err != nil {
+			return nil, err
+		}
+		cursors = append(cursors, &prefixCursor{sr: sr})
+	}
+	cursors = append(cursors, &prefixCursor{sorted: sortedKeys(mem), mem: mem})
+	for _, c := range cursors {
+		if err := c.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	type entry struct {
+		prefix string
+		agg    prefixAgg
+	}
+	var top []entry
+	trim := func() {
+		sort.Slice(top, func(i, j int) bool { return top[i].agg.Size > top[j].agg.Size })
+		top = top[:p.topN]
+	}
+	kept := map[string]prefixAgg{}
+	for {
+		min := ""
+		found := false
+		for _, c := range cursors {
+			if c.ok && (!found || c.prefix < min) {
+				min, found = c.prefix, true
+			}
+		}
+		if !found {
+			break
+		}
+		var agg prefixAgg
+		for _, c := range cursors {
+			if c.ok && c.prefix == min {
+				agg.merge(c.agg)
+				if err := c.next(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if _, ok := wanted[min]; ok || p.topN <= 0 {
+			kept[min] = agg
+			continue
+		}
+		top = append(top, entry{min, agg})
+		if len(top) >= 2*p.topN {
+			trim()
+		}
+	}
+	if len(top) > p.topN {
+		trim()
+	}
+	for _, e := range top {
+		kept[e.prefix] = e.agg
+	}
+	return kept, nil
+}
+
+func sortedKeys(m map[string]prefixAgg) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func dedupLess(a, b dedupValue) bool {
+	if a.hash != b.hash {
+		return a.hash < b.hash
+	}
+	return a.size < b.size
+}
+
+// spill writes the tracked values to a new run and empties the map.
+func (ds *dedupStats) spill(dir string) (int64, error) {
+	sw, run, err := createRun(dir, "rdbviz-dedup-*.spill", &ds.runs)
+	if err != nil {
+		return 0, err
+	}
+	values := make([]dedupValue, 0, len(ds.values))
+	for v := range ds.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return dedupLess(values[i], values[j]) })
+	run.sections["values"] = spillSection{n: len(values)}
+	for _, v := range values {
+		g := ds.values[v]
+		sw.uvarint(v.hash)
+		sw.uvarint(uint64(v.size))
+		sw.varint(g.count)
+		sw.varint(g.mem)
+		sw.uvarint(uint64(len(g.keys)))
+		for _, k := range g.keys {
+			sw.str(k)
+		}
+	}
+	if err := sw.close(); err != nil {
+		return sw.off, err
+	}
+	ds.values = map[dedupValue]*dedupGroup{}
+	ds.full = false
+	return sw.off, nil
+}
+
+// dedupCursor walks the values of a run or of the in-memory map in
+// (hash, size) order.
+type dedupCursor struct {
+	sr     *spillReader
+	sorted []dedupValue
+	mem    map[dedupValue]*dedupGroup
+	value  dedupValue
+	group  *dedupGroup
+	ok     bool
+}
+
+func (c *dedupCursor) next() error {
+	if c.sr == nil {
+		c.ok = len(c.sorted) > 0
+		if c.ok {
+			c.value, c.sorted = c.sorted[0], c.sorted[1:]
+			c.group = c.mem[c.value]
+		}
+		return nil
+	}
+	c.ok = c.sr.more()
+	if !c.ok {
+		return c.sr.err
+	}
+	sr := c.sr
+	c.value = dedupValue{hash: sr.uvarint(), size: int(sr.uvarint())}
+	c.group = &dedupGroup{count: sr.varint(), mem: sr.varint()}
+	for n := sr.uvarint(); n > 0 && sr.err == nil; n-- {
+		c.group.keys = append(c.group.keys, sr.str())
+	}
+	return sr.err
+}
+
+// each calls fn for every distinct value, merging the runs and the map when
+// values were spilled. Example keys stay in the order they were seen.
+func (ds *dedupStats) each(fn func(dedupValue, *dedupGroup)) error {
+	if len(ds.runs) == 0 {
+		for v, g := range ds.values {
+			fn(v, g)
+		}
+		return nil
+	}
+	cursors := make([]*dedupCursor, 0, len(ds.runs)+1)
+	defer func() {
+		for _, c := range cursors {
+			if c.sr != nil && c.sr.f != nil {
+				c.sr.f.Close()
+			}
+		}
+	}()
+	for _, run := range ds.runs {
+		sr, err := openSection(run, "values")
+		if err != nil {
+			return err
+		}
+		cursors = append(cursors, &dedupCursor{sr: sr})
+	}
+	sorted := make([]dedupValue, 0, len(ds.values))
+	for v := range ds.values {
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return dedupLess(sorted[i], sorted[j]) })
+	cursors = append(cursors, &dedupCursor{sorted: sorted, mem: ds.values})
+	for _, c := range cursors {
+		if err := c.next(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		var min dedupValue
+		found := false
+		for _, c := range cursors {
+			if c.ok && (!found || dedupLess(c.value, min)) {
+				min, found = c.value, true
+			}
+		}
+		if !found {
+			return nil
+		}
+		g := &dedupGroup{}
+		for _, c := range cursors {
+			if !c.ok || c.value != min {
+				continue
+			}
+			g.count += c.group.count
+			g.mem = c.group.mem
+			for _, k := range c.group.keys {
+				if len(g.keys) < dedupExampleKeys {
+					g.keys = append(g.keys, k)
+				}
+			}
+			if err := c.next(); err != nil {
+				return err
+			}
+		}
+		fn(min, g)
+	}
+}
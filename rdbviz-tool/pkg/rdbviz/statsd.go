@@ -0,0 +1,128 @@
+package rdbviz
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// statsdPacket is the payload size gauges are batched up to, small enough
+// for one datagram on any network.
+const statsdPacket = 1432
+
+// StatsDWriter pushes the totals, types, DBs and top prefixes of a report
+// as gauges to a StatsD server over UDP, the same series as MetricsWriter.
+//
+// Plain StatsD has no tags, so the instance, shard, DB, type and prefix go
+// into the metric name, e.g. "rdbviz.order-cache.prefix.user_.keys". With
+// DogStatsD they are tags instead ("rdbviz.prefix.keys" tagged
+// "prefix:user:"), along with Tags.
+type StatsDWriter struct {
+	// Addr is the host:port of the server.
+	Addr string
+	// Prefix starts every metric name; empty for "rdbviz".
+	Prefix    string
+	DogStatsD bool
+	// Tags are added to every gauge with DogStatsD, e.g. "env:prod".
+	Tags []string
+}
+
+// WriteReport sends the gauges of rep. UDP does not tell whether they
+// arrived; only resolving Addr and sending can fail.
+func (w StatsDWriter) WriteReport(rep *Report) error {
+	conn, err := net.Dial("udp", w.Addr)
+	if err != nil {
+		return fmt.Errorf("statsd: %w", err)
+	}
+	defer conn.Close()
+	var buf []byte
+	for _, line := range w.Lines(rep) {
+		if len(buf) > 0 && len(buf)+1+len(line) > statsdPacket {
+			if _, err := conn.Write(buf); err != nil {
+				return fmt.Errorf("statsd: %w", err)
+			}
+			buf = buf[:0]
+		}
+		if len(buf) > 0 {
+			buf = append(buf, '\n')
+		}
+		buf = append(buf, line...)
+	}
+	if len(buf) > 0 {
+		if _, err := conn.Write(buf); err != nil {
+			return fmt.Errorf("statsd: %w", err)
+		}
+	}
+	return nil
+}
+
+// Lines returns the gauges of rep, one StatsD line each; Addr is not used.
+func (w StatsDWriter) Lines(rep *Report) []string {
+	prefix := w.Prefix
+	if prefix == "" {
+		prefix = "rdbviz"
+	}
+	var base []string
+	if w.DogStatsD {
+		base = append(base, w.Tags...)
+		if rep.Meta.Instance != "" {
+			base = append(base, "instance:"+statsdTag(rep.Meta.Instance))
+		}
+		if rep.Meta.Shard != "" {
+			base = append(base, "shard:"+statsdTag(rep.Meta.Shard))
+		}
+	} else {
+		for _, s := range []string{rep.Meta.Instance, rep.Meta.Shard} {
+			if s != "" {
+				prefix += "." + statsdName(s)
+			}
+		}
+	}
+
+	var lines []string
+	// gauge adds name, under group.value for plain StatsD or tagged
+	// group:value for DogStatsD when group is set.
+	gauge := func(name string, v int64, group, value string) {
+		tags := base
+		switch {
+		case group == "":
+		case w.DogStatsD:
+			tags = append(tags[:len(tags):len(tags)], group+":"+statsdTag(value))
+			name = group + "." + name
+		default:
+			name = group + "." + statsdName(value) + "." + name
+		}
+		line := prefix + "." + name + ":" + strconv.FormatInt(v, 10) + "|g"
+		if len(tags) > 0 {
+			line += "|#" + strings.Join(tags, ",")
+		}
+		lines = append(lines, line)
+	}
+
+	reportGauges(rep, gauge)
+	return lines
+}
+
+// statsdName makes s one segment of a metric name: anything but letters,
+// digits, - and _ becomes _.
+func statsdName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// statsdTag makes s a tag value: the separators of the DogStatsD format
+// and whitespace become _.
+func statsdTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '|', ',', '#', '@', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
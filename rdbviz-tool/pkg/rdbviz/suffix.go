@@ -0,0 +1,41 @@
+package rdbviz
+
+import (
+	"sort"
+	"strings"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// applySuffixes aggregates the key under its last 1..maxDepth segments, e.g.
+// "12345:profile" counts towards ":profile".
+func applySuffixes(agg map[string]prefixAgg, key string, size, mem, ttl int64, sep string, maxDepth int) {
+	if sep == "" || maxDepth <= 0 {
+		return
+	}
+	parts := strings.Split(key, sep)
+	if len(parts) < maxDepth {
+		maxDepth = len(parts)
+	}
+	for i := 1; i <= maxDepth; i++ {
+		s := strings.Join(parts[len(parts)-i:], sep)
+		if i < len(parts) {
+			s = sep + s
+		}
+		a := agg[s]
+		a.add(size, mem, ttl)
+		agg[s] = a
+	}
+}
+
+func suffixList(agg map[string]prefixAgg, topN int) []report.SuffixStat {
+	list := make([]report.SuffixStat, 0, len(agg))
+	for s, a := range agg {
+		list = append(list, report.SuffixStat{Suffix: s, Count: a.Count, Size: a.Size, EstimatedMem: a.Mem})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Size > list[j].Size })
+	if topN > 0 && len(list) > topN {
+		list = list[:topN]
+	}
+	return list
+}
@@ -0,0 +1,198 @@
+package rdbviz
+
+import (
+	"math"
+	"sort"
+
+	"rdbviz-tool/pkg/report"
+)
+
+type centroid struct {
+	mean  float64
+	count float64
+}
+
+// tdigest is a merging t-digest (Dunning): a small sorted set of centroids
+// that keeps quantile estimates accurate at the tails, where long-tail key
+// sizes live, with memory bounded by the compression.
+type tdigest struct {
+	compression float64
+	centroids   []centroid
+	buf         []centroid
+	count       float64
+	min, max    float64
+}
+
+func newTDigest(compression float64) *tdigest {
+	return &tdigest{compression: compression, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+func (t *tdigest) add(x float64) {
+	t.buf = append(t.buf, centroid{mean: x, count: 1})
+	t.count++
+	t.min = math.Min(t.min, x)
+	t.max = math.Max(t.max, x)
+	if len(t.buf) >= int(5*t.compression) {
+		t.compress()
+	}
+}
+
+// k is the k1 scale function; centroids may only merge while they span at
+// most one unit of k, which makes them small near q=0 and q=1.
+func (t *tdigest) k(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (t *tdigest) compress() {
+	if len(t.buf) == 0 {
+		return
+	}
+	all := append(t.centroids, t.buf...)
+	t.buf = t.buf[:0]
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	cur := all[0]
+	soFar := 0.0
+	kLeft := t.k(0)
+	for _, c := range all[1:] {
+		q := (soFar + cur.count + c.count) / t.count
+		if t.k(q)-kLeft <= 1 {
+			cur.mean += (c.mean - cur.mean) * c.count / (cur.count + c.count)
+			cur.count += c.count
+			continue
+		}
+		soFar += cur.count
+		merged = append(merged, cur)
+		kLeft = t.k(soFar / t.count)
+		cur = c
+	}
+	t.centroids = append(merged, cur)
+}
+
+// quantile interpolates linearly between centroid centres, and between the
+// outer centroids and the observed min/max.
+func (t *tdigest) quantile(q float64) float64 {
+	t.compress()
+	n := len(t.centroids)
+	switch n {
+	case 0:
+		return 0
+	case 1:
+		return t.centroids[0].mean
+	}
+	target := q * t.count
+	cum := 0.0
+	prevCenter, prevMean := 0.0, t.min
+	for _, c := range t.centroids {
+		center := cum + c.count/2
+		if target < center {
+			if center == prevCenter {
+				return c.mean
+			}
+			return prevMean + (c.mean-prevMean)*(target-prevCenter)/(center-prevCenter)
+		}
+		cum += c.count
+		prevCenter, prevMean = center, c.mean
+	}
+	if t.count == prevCenter {
+		return t.max
+	}
+	return prevMean + (t.max-prevMean)*(target-prevCenter)/(t.count-prevCenter)
+}
+
+func (t *tdigest) percentiles() *report.Percentiles {
+	if t.count == 0 {
+		return nil
+	}
+	return &report.Percentiles{
+		P50:  int64(math.Round(t.quantile(0.5))),
+		P90:  int64(math.Round(t.quantile(0.9))),
+		P99:  int64(math.Round(t.quantile(0.99))),
+		P999: int64(math.Round(t.quantile(0.999))),
+		Max:  int64(t.max),
+	}
+}
+
+const (
+	digestCompression       = 100
+	prefixDigestCompression = 50
+	// maxPrefixDigests bounds per-namespace digests; keys without separators
+	// would otherwise get one each.
+	maxPrefixDigests = 10000
+)
+
+type prefixDigest struct {
+	size   int64
+	digest *tdigest
+}
+
+// sizePercentiles tracks key size distributions overall, per type and per
+// first-level namespace.
+type sizePercentiles struct {
+	sep      string
+	topN     int
+	all      *tdigest
+	types    map[string]*tdigest
+	prefixes map[string]*prefixDigest
+}
+
+func newSizePercentiles(sep string, topN int) *sizePercentiles {
+	return &sizePercentiles{
+		sep:      sep,
+		topN:     topN,
+		all:      newTDigest(digestCompression),
+		types:    map[string]*tdigest{},
+		prefixes: map[string]*prefixDigest{},
+	}
+}
+
+func (sp *sizePercentiles) observe(key, objType string, size int64) {
+	x := float64(size)
+	sp.all.add(x)
+	td := sp.types[objType]
+	if td == nil {
+		td = newTDigest(digestCompression)
+		sp.types[objType] = td
+	}
+	td.add(x)
+
+	ns := namespaceOf(key, sp.sep)
+	pd := sp.prefixes[ns]
+	if pd == nil {
+		if len(sp.prefixes) >= maxPrefixDigests {
+			ns = otherPrefix
+			pd = sp.prefixes[ns]
+		}
+		if pd == nil {
+			pd = &prefixDigest{digest: newTDigest(prefixDigestCompression)}
+			sp.prefixes[ns] = pd
+		}
+	}
+	pd.size += size
+	pd.digest.add(x)
+}
+
+func (sp *sizePercentiles) typePercentiles(objType string) *report.Percentiles {
+	if td, ok := sp.types[objType]; ok {
+		return td.percentiles()
+	}
+	return nil
+}
+
+func (sp *sizePercentiles) prefixPercentiles() []report.PrefixPercentiles {
+	list := make([]report.PrefixPercentiles, 0, len(sp.prefixes))
+	for p, pd := range sp.prefixes {
+		list = append(list, report.PrefixPercentiles{
+			Prefix:      p,
+			Count:       int64(pd.digest.count),
+			Size:        pd.size,
+			Percentiles: pd.digest.percentiles(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Size > list[j].Size })
+	if sp.topN > 0 && len(list) > sp.topN {
+		list = list[:sp.topN]
+	}
+	return list
+}
@@ -0,0 +1,59 @@
+// Command typesizes is a WebAssembly plugin of rdbviz that sums the keys and
+// bytes of each type:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o type_sizes.wasm .
+package main
+
+import (
+	"encoding/json"
+	"unsafe"
+)
+
+type typeSize struct {
+	Keys int64 `json:"keys"`
+	Size int64 `json:"size"`
+}
+
+var (
+	buf    []byte
+	result []byte
+	types  = map[string]*typeSize{}
+)
+
+//go:wasmexport rdbviz_abi_version
+func abiVersion() int32 { return 1 }
+
+//go:wasmexport rdbviz_alloc
+func alloc(size int32) int32 {
+	if int(size) > cap(buf) {
+		buf = make([]byte, size)
+	}
+	return int32(uintptr(unsafe.Pointer(unsafe.SliceData(buf))))
+}
+
+//go:wasmexport rdbviz_observe
+func observe(ptr, n int32) {
+	var rec struct {
+		Type string `json:"type"`
+		Size int64  `json:"size"`
+	}
+	if err := json.Unmarshal(buf[:n], &rec); err != nil {
+		panic(err)
+	}
+	t := types[rec.Type]
+	if t == nil {
+		t = &typeSize{}
+		types[rec.Type] = t
+	}
+	t.Keys++
+	t.Size += rec.Size
+}
+
+//go:wasmexport rdbviz_finalize
+func finalize() int64 {
+	result, _ = json.Marshal(types)
+	ptr := uintptr(unsafe.Pointer(unsafe.SliceData(result)))
+	return int64(ptr)<<32 | int64(len(result))
+}
+
+func main() {}
@@ -0,0 +1,81 @@
+package rdbviz
+
+import (
+	"math"
+	"math/bits"
+)
+
+// noTTL is passed as the remaining TTL of keys without expiration.
+const noTTL = -1
+
+// ttlHist is a log2 histogram of remaining TTLs in seconds: bucket b holds
+// TTLs in [2^(b-1), 2^b). It is only allocated for prefixes that have keys
+// with a TTL.
+type ttlHist [40]uint32
+
+func (h *ttlHist) add(ttl int64) {
+	if ttl < 0 {
+		ttl = 0
+	}
+	b := bits.Len64(uint64(ttl))
+	if b >= len(h) {
+		b = len(h) - 1
+	}
+	h[b]++
+}
+
+func (h *ttlHist) merge(o *ttlHist) {
+	for i, v := range o {
+		h[i] += v
+	}
+}
+
+// median estimates the median TTL of n keys, interpolating geometrically
+// inside the bucket holding it.
+func (h *ttlHist) median(n int64) int64 {
+	target := float64(n) / 2
+	var seen float64
+	for b, v := range h {
+		if v == 0 {
+			continue
+		}
+		if seen+float64(v) < target {
+			seen += float64(v)
+			continue
+		}
+		if b == 0 {
+			return 0
+		}
+		lo := math.Ldexp(1, b-1)
+		frac := (target - seen) / float64(v)
+		return int64(math.Round(lo * math.Pow(2, frac)))
+	}
+	return 0
+}
+
+func (a *prefixAgg) add(size, mem, ttl int64) {
+	a.Count++
+	a.Size += size
+	a.Mem += mem
+	if ttl == noTTL {
+		return
+	}
+	a.WithTTL++
+	if a.TTL == nil {
+		a.TTL = &ttlHist{}
+	}
+	a.TTL.add(ttl)
+}
+
+func (a *prefixAgg) merge(o prefixAgg) {
+	a.Count += o.Count
+	a.Size += o.Size
+	a.Mem += o.Mem
+	a.WithTTL += o.WithTTL
+	if o.TTL != nil {
+		if a.TTL == nil {
+			a.TTL = &ttlHist{}
+		}
+		a.TTL.merge(o.TTL)
+	}
+}
@@ -0,0 +1,158 @@
+package rdbviz
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// TTLRule is a hypothetical "EXPIRE every key matching Pattern with TTL".
+type TTLRule struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// TTLRules is the repeatable -ttl-rule flag, e.g. "session:*=24h".
+type TTLRules []TTLRule
+
+func (r *TTLRules) String() string {
+	parts := make([]string, len(*r))
+	for i, rule := range *r {
+		parts[i] = rule.Pattern + "=" + rule.TTL.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *TTLRules) Set(s string) error {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected pattern=ttl, got %q", s)
+	}
+	ttl, err := parseTTL(s[i+1:])
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive, got %q", s[i+1:])
+	}
+	*r = append(*r, TTLRule{Pattern: s[:i], TTL: ttl})
+	return nil
+}
+
+// parseTTL accepts Go durations plus a "d" suffix for days.
+func parseTTL(s string) (time.Duration, error) {
+	if d, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(d, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ttl %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// ttlHorizons are the points in time the keyspace is projected at.
+var ttlHorizons = []struct {
+	Label string
+	After time.Duration
+}{
+	{"now", 0},
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+	{"1d", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+type ttlRuleAgg struct {
+	matched int64
+	noTTL   int64
+	size    int64
+	mem     int64
+}
+
+// ttlWhatIf projects how much of the keyspace is left at each horizon, with
+// the current TTLs and with the rules applied. It assumes no writes after the
+// snapshot and that rules only shorten TTLs: keys already expiring sooner
+// than their rule keep their TTL. The first matching rule wins.
+type ttlWhatIf struct {
+	rules    TTLRules
+	agg      []ttlRuleAgg
+	baseline []expiryAgg
+	whatIf   []expiryAgg
+}
+
+func newTTLWhatIf(rules TTLRules) *ttlWhatIf {
+	return &ttlWhatIf{
+		rules:    rules,
+		agg:      make([]ttlRuleAgg, len(rules)),
+		baseline: make([]expiryAgg, len(ttlHorizons)),
+		whatIf:   make([]expiryAgg, len(ttlHorizons)),
+	}
+}
+
+// observe takes the remaining TTL in seconds, or noTTL.
+func (tw *ttlWhatIf) observe(key string, size, mem, ttl int64) {
+	projected := ttl
+	for i, rule := range tw.rules {
+		if !GlobMatch(rule.Pattern, key) {
+			continue
+		}
+		a := &tw.agg[i]
+		a.matched++
+		a.size += size
+		a.mem += mem
+		secs := int64(rule.TTL / time.Second)
+		if ttl == noTTL {
+			a.noTTL++
+			projected = secs
+		} else if ttl > secs {
+			projected = secs
+		}
+		break
+	}
+	for i, h := range ttlHorizons {
+		after := int64(h.After / time.Second)
+		if ttl == noTTL || ttl > after {
+			tw.baseline[i].add(size, mem)
+		}
+		if projected == noTTL || projected > after {
+			tw.whatIf[i].add(size, mem)
+		}
+	}
+}
+
+func (tw *ttlWhatIf) result() *report.TTLWhatIf {
+	r := &report.TTLWhatIf{
+		Rules:      make([]report.TTLRuleStat, len(tw.rules)),
+		Projection: make([]report.TTLProjection, len(ttlHorizons)),
+	}
+	for i, rule := range tw.rules {
+		a := tw.agg[i]
+		r.Rules[i] = report.TTLRuleStat{
+			Pattern:      rule.Pattern,
+			TTL:          int64(rule.TTL / time.Second),
+			MatchedKeys:  a.matched,
+			NoTTLKeys:    a.noTTL,
+			Size:         a.size,
+			EstimatedMem: a.mem,
+		}
+	}
+	for i, h := range ttlHorizons {
+		b, w := tw.baseline[i], tw.whatIf[i]
+		r.Projection[i] = report.TTLProjection{
+			Horizon:      h.Label,
+			Seconds:      int64(h.After / time.Second),
+			BaselineKeys: b.count,
+			BaselineSize: b.size,
+			BaselineMem:  b.mem,
+			WhatIfKeys:   w.count,
+			WhatIfSize:   w.size,
+			WhatIfMem:    w.mem,
+		}
+	}
+	return r
+}
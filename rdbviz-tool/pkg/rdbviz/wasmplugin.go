@@ -0,0 +1,218 @@
+package rdbviz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WASMPluginABI is the version of the interface between LoadWASMPlugin and a
+// module. The module exports, besides its memory:
+//
+//	rdbviz_abi_version() i32           returns WASMPluginABI
+//	rdbviz_alloc(size i32) i32         a buffer of size bytes for the host
+//	rdbviz_observe(ptr i32, len i32)   one key, as the JSON of WASMKeyRecord
+//	rdbviz_finalize() i64              the section's JSON, ptr<<32 | len
+//
+// The host writes each key into a buffer from rdbviz_alloc, which it does
+// not use again once rdbviz_observe returns, so a module may hand out the
+// same buffer every time. Modules may import WASI (wasi_snapshot_preview1);
+// a reactor's _initialize runs before the first call. Each analysis gets a
+// fresh instance.
+const WASMPluginABI = 1
+
+// WASMKeyRecord is the JSON a WebAssembly plugin receives for each key: a
+// KeyRecord without the decoded value. ExpiresAt is in Unix milliseconds,
+// Idle and Freq are -1 when the dump was saved without them.
+type WASMKeyRecord struct {
+	DB           int               `json:"db"`
+	Key          string            `json:"key"`
+	Type         string            `json:"type"`
+	Encoding     string            `json:"encoding"`
+	Size         int64             `json:"size"`
+	EstimatedMem int64             `json:"estimated_mem"`
+	Elements     int64             `json:"elements"`
+	ExpiresAt    int64             `json:"expires_at,omitempty"`
+	Idle         int64             `json:"idle"`
+	Freq         int64             `json:"freq"`
+	Group        string            `json:"group,omitempty"`
+	Owner        string            `json:"owner,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// LoadWASMPlugin compiles the WebAssembly module at path, checks it
+// implements WASMPluginABI and registers it as the aggregator named after
+// the file, e.g. hash_fields for hash_fields.wasm.
+func LoadWASMPlugin(path string) error {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	rt := wazero.NewRuntime(ctx)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		rt.Close(ctx)
+		return err
+	}
+	compiled, err := rt.CompileModule(ctx, code)
+	if err != nil {
+		rt.Close(ctx)
+		return fmt.Errorf("plugin %s: %w", path, err)
+	}
+	p := &wasmPlugin{name: strings.TrimSuffix(filepath.Base(path), ".wasm"), rt: rt, compiled: compiled}
+	// instantiate once to fail now rather than in every analysis
+	agg, err := p.instantiate()
+	if err != nil {
+		rt.Close(ctx)
+		return fmt.Errorf("plugin %s: %w", path, err)
+	}
+	agg.close()
+	if err := registerAggregator(p.name, p.newAggregator); err != nil {
+		rt.Close(ctx)
+		return fmt.Errorf("plugin %s: %w", path, err)
+	}
+	return nil
+}
+
+// wasmPlugin is a compiled module; its runtime lives as long as the
+// process, as registered aggregators do.
+type wasmPlugin struct {
+	name     string
+	rt       wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+func (p *wasmPlugin) newAggregator() Aggregator {
+	agg, err := p.instantiate()
+	if err != nil {
+		return &wasmAggregator{name: p.name, err: err}
+	}
+	return agg
+}
+
+func (p *wasmPlugin) instantiate() (*wasmAggregator, error) {
+	ctx := context.Background()
+	cfg := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithStderr(os.Stderr)
+	mod, err := p.rt.InstantiateModule(ctx, p.compiled, cfg)
+	if err != nil {
+		return nil, err
+	}
+	a := &wasmAggregator{name: p.name, mod: mod}
+	fns := map[string]*api.Function{
+		"rdbviz_abi_version": &a.version,
+		"rdbviz_alloc":       &a.alloc,
+		"rdbviz_observe":     &a.observe,
+		"rdbviz_finalize":    &a.finalize,
+	}
+	for name, fn := range fns {
+		if *fn = mod.ExportedFunction(name); *fn == nil {
+			mod.Close(ctx)
+			return nil, fmt.Errorf("module does not export %s", name)
+		}
+	}
+	res, err := a.version.Call(ctx)
+	if err != nil {
+		mod.Close(ctx)
+		return nil, err
+	}
+	if v := uint32(res[0]); v != WASMPluginABI {
+		mod.Close(ctx)
+		return nil, fmt.Errorf("module implements ABI %d, want %d", v, WASMPluginABI)
+	}
+	// an analysis that fails before Finalize leaves the instance open
+	runtime.SetFinalizer(a, (*wasmAggregator).close)
+	return a, nil
+}
+
+// wasmAggregator runs one analysis's keys through a module instance. A
+// failing call panics, which ends the parse with its error.
+type wasmAggregator struct {
+	name                              string
+	mod                               api.Module
+	version, alloc, observe, finalize api.Function
+	err                               error // of instantiate, reported by Finalize
+}
+
+func (a *wasmAggregator) Observe(rec KeyRecord) {
+	if a.mod == nil {
+		return
+	}
+	r := WASMKeyRecord{
+		DB:           rec.DB,
+		Key:          rec.Key,
+		Type:         rec.Type,
+		Encoding:     rec.Encoding,
+		Size:         rec.Size,
+		EstimatedMem: rec.EstimatedMem,
+		Elements:     rec.Elements,
+		Idle:         rec.Idle,
+		Freq:         rec.Freq,
+		Group:        rec.Class.Group,
+		Owner:        rec.Class.Owner,
+		Labels:       rec.Class.Labels,
+	}
+	if rec.Expiration != nil {
+		r.ExpiresAt = rec.Expiration.UnixMilli()
+	}
+	data, err := json.Marshal(r)
+	if err == nil {
+		err = a.call(data)
+	}
+	if err != nil {
+		panic(fmt.Errorf("wasm plugin %s: %w", a.name, err))
+	}
+}
+
+func (a *wasmAggregator) call(data []byte) error {
+	ctx := context.Background()
+	res, err := a.alloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+	ptr := uint32(res[0])
+	if !a.mod.Memory().Write(ptr, data) {
+		return fmt.Errorf("rdbviz_alloc returned %d, out of memory for %d bytes", ptr, len(data))
+	}
+	_, err = a.observe.Call(ctx, uint64(ptr), uint64(len(data)))
+	return err
+}
+
+// Finalize returns the module's JSON, or {"error": ...} when it fails, and
+// closes the instance.
+func (a *wasmAggregator) Finalize() any {
+	if a.mod == nil {
+		return map[string]string{"error": a.err.Error()}
+	}
+	defer a.close()
+	res, err := a.finalize.Call(context.Background())
+	if err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+	ptr, n := uint32(res[0]>>32), uint32(res[0])
+	data, ok := a.mod.Memory().Read(ptr, n)
+	if !ok {
+		return map[string]string{"error": fmt.Sprintf("rdbviz_finalize returned %d bytes at %d, out of memory", n, ptr)}
+	}
+	if !json.Valid(data) {
+		return map[string]string{"error": "rdbviz_finalize returned invalid JSON"}
+	}
+	return json.RawMessage(append([]byte(nil), data...))
+}
+
+func (a *wasmAggregator) close() {
+	if a.mod != nil {
+		a.mod.Close(context.Background())
+		a.mod = nil
+	}
+}
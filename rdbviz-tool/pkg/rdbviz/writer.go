@@ -0,0 +1,277 @@
+package rdbviz
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReportWriter writes a finished report to one destination.
+type ReportWriter interface {
+	WriteReport(rep *Report) error
+}
+
+// MultiWriter fans a report out to every writer. All writers run; the
+// errors of those that failed are joined.
+func MultiWriter(writers ...ReportWriter) ReportWriter {
+	return multiWriter(writers)
+}
+
+type multiWriter []ReportWriter
+
+func (mw multiWriter) WriteReport(rep *Report) error {
+	var errs []error
+	for _, w := range mw {
+		if err := w.WriteReport(rep); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// JSONWriter writes the report.json the rdbviz page loads.
+type JSONWriter struct {
+	Path string
+}
+
+// WriteReport writes rep as indented JSON, creating the directory.
+func (w JSONWriter) WriteReport(rep *Report) error {
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(w.Path, append(data, '\n'))
+}
+
+// HTMLWriter writes the rdbviz page as one self-contained file with the
+// report embedded, for sharing without a server. PageDir holds the page's
+// index.html, style.css and app.js; the page still loads Vue and ECharts
+// from their CDNs.
+type HTMLWriter struct {
+	Path    string
+	PageDir string
+}
+
+// WriteReport inlines the stylesheet, the script and rep into index.html.
+func (w HTMLWriter) WriteReport(rep *Report) error {
+	html, err := w.Page(rep)
+	if err != nil {
+		return err
+	}
+	return writeFile(w.Path, html)
+}
+
+// Page returns the page of rep; Path is not used.
+func (w HTMLWriter) Page(rep *Report) ([]byte, error) {
+	page, err := os.ReadFile(filepath.Join(w.PageDir, "index.html"))
+	if err != nil {
+		return nil, err
+	}
+	css, err := os.ReadFile(filepath.Join(w.PageDir, "style.css"))
+	if err != nil {
+		return nil, err
+	}
+	js, err := os.ReadFile(filepath.Join(w.PageDir, "app.js"))
+	if err != nil {
+		return nil, err
+	}
+	// json.Marshal escapes <, > and &, so the data cannot close the tag
+	data, err := json.Marshal(rep)
+	if err != nil {
+		return nil, err
+	}
+	const cssTag = `<link rel="stylesheet" href="./style.css" />`
+	const jsTag = `<script src="./app.js"></script>`
+	if !bytes.Contains(page, []byte(cssTag)) || !bytes.Contains(page, []byte(jsTag)) {
+		return nil, fmt.Errorf("%s: stylesheet or script tag not found", filepath.Join(w.PageDir, "index.html"))
+	}
+	html := strings.Replace(string(page), cssTag, "<style>\n"+string(css)+"</style>", 1)
+	// the in-browser analysis needs the page's wasm files, so leave it out
+	html = strings.Replace(html, "  <script src=\"./rdbviz.js\"></script>\n", "", 1)
+	html = strings.Replace(html, jsTag, "<script>window.RDBVIZ_REPORT = "+string(data)+";</script>\n  <script>\n"+string(js)+"</script>", 1)
+	return []byte(html), nil
+}
+
+// CSVWriter writes the main tables as CSV files into Dir: types.csv,
+// prefixes.csv and bigkeys.csv.
+type CSVWriter struct {
+	Dir string
+}
+
+// WriteReport writes one file per table.
+func (w CSVWriter) WriteReport(rep *Report) error {
+	types := [][]string{{"type", "count", "size", "estimated_mem"}}
+	for _, t := range rep.Types {
+		types = append(types, []string{t.Type, itoa(t.Count), itoa(t.Size), itoa(t.EstimatedMem)})
+	}
+	prefixes := [][]string{{"prefix", "count", "size", "estimated_mem", "ttl_share"}}
+	for _, p := range rep.Prefixes {
+		prefixes = append(prefixes, []string{p.Prefix, itoa(p.Count), itoa(p.Size), itoa(p.EstimatedMem), strconv.FormatFloat(p.TTLShare, 'f', 4, 64)})
+	}
+	bigKeys := [][]string{{"db", "key", "type", "encoding", "size", "estimated_mem", "elements", "expiration"}}
+	for _, b := range rep.BigKeys {
+		exp := ""
+		if b.Expiration != nil {
+			exp = b.Expiration.UTC().Format("2006-01-02T15:04:05Z")
+		}
+		bigKeys = append(bigKeys, []string{strconv.Itoa(b.DB), b.Key, b.Type, b.Encoding, itoa(b.Size), itoa(b.EstimatedMem), itoa(b.Elements), exp})
+	}
+	for name, rows := range map[string][][]string{"types.csv": types, "prefixes.csv": prefixes, "bigkeys.csv": bigKeys} {
+		var buf bytes.Buffer
+		cw := csv.NewWriter(&buf)
+		cw.WriteAll(rows)
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(w.Dir, name), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MetricsWriter writes the totals, types, DBs and top prefixes in the
+// Prometheus text format, e.g. for the node_exporter textfile collector.
+// Every series carries Instance as its instance label when set.
+type MetricsWriter struct {
+	Path     string
+	Instance string
+}
+
+// WriteReport writes the metrics file.
+func (w MetricsWriter) WriteReport(rep *Report) error {
+	return writeFile(w.Path, w.Metrics(rep))
+}
+
+// Metrics returns the metrics of rep in the text format; Path is not used.
+func (w MetricsWriter) Metrics(rep *Report) []byte {
+	var b strings.Builder
+	base := ""
+	if w.Instance != "" {
+		base = "instance=" + strconv.Quote(w.Instance)
+	}
+	labels := func(extra ...string) string {
+		all := extra
+		if base != "" {
+			all = append([]string{base}, extra...)
+		}
+		if len(all) == 0 {
+			return ""
+		}
+		return "{" + strings.Join(all, ",") + "}"
+	}
+	metric := func(name, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+
+	s := rep.Summary
+	metric("rdbviz_keys", "Keys in the dump.")
+	fmt.Fprintf(&b, "rdbviz_keys%s %d\n", labels(), s.TotalKeys)
+	metric("rdbviz_size_bytes", "Serialized size of all keys.")
+	fmt.Fprintf(&b, "rdbviz_size_bytes%s %d\n", labels(), s.TotalSize)
+	metric("rdbviz_estimated_memory_bytes", "Estimated memory of all keys.")
+	fmt.Fprintf(&b, "rdbviz_estimated_memory_bytes%s %d\n", labels(), s.TotalMem)
+	metric("rdbviz_keys_expired", "Keys whose TTL passed before the analysis.")
+	fmt.Fprintf(&b, "rdbviz_keys_expired%s %d\n", labels(), s.Expired)
+	metric("rdbviz_keys_without_ttl", "Keys without a TTL.")
+	fmt.Fprintf(&b, "rdbviz_keys_without_ttl%s %d\n", labels(), s.NoTTL)
+
+	dbs := make([]int, 0, len(s.DBKeys))
+	for db := range s.DBKeys {
+		dbs = append(dbs, db)
+	}
+	sort.Ints(dbs)
+	metric("rdbviz_db_keys", "Keys per DB.")
+	for _, db := range dbs {
+		fmt.Fprintf(&b, "rdbviz_db_keys%s %d\n", labels("db="+strconv.Quote(strconv.Itoa(db))), s.DBKeys[db])
+	}
+	metric("rdbviz_db_estimated_memory_bytes", "Estimated memory per DB.")
+	for _, db := range dbs {
+		fmt.Fprintf(&b, "rdbviz_db_estimated_memory_bytes%s %d\n", labels("db="+strconv.Quote(strconv.Itoa(db))), s.DBMem[db])
+	}
+
+	metric("rdbviz_type_keys", "Keys per type.")
+	for _, t := range rep.Types {
+		fmt.Fprintf(&b, "rdbviz_type_keys%s %d\n", labels("type="+strconv.Quote(t.Type)), t.Count)
+	}
+	metric("rdbviz_type_estimated_memory_bytes", "Estimated memory per type.")
+	for _, t := range rep.Types {
+		fmt.Fprintf(&b, "rdbviz_type_estimated_memory_bytes%s %d\n", labels("type="+strconv.Quote(t.Type)), t.EstimatedMem)
+	}
+
+	metric("rdbviz_prefix_keys", "Keys per top prefix.")
+	for _, p := range rep.Prefixes {
+		fmt.Fprintf(&b, "rdbviz_prefix_keys%s %d\n", labels("prefix="+strconv.Quote(p.Prefix)), p.Count)
+	}
+	metric("rdbviz_prefix_estimated_memory_bytes", "Estimated memory per top prefix.")
+	for _, p := range rep.Prefixes {
+		fmt.Fprintf(&b, "rdbviz_prefix_estimated_memory_bytes%s %d\n", labels("prefix="+strconv.Quote(p.Prefix)), p.EstimatedMem)
+	}
+	return []byte(b.String())
+}
+
+// reportGauges calls gauge for each of the series MetricsWriter writes,
+// naming the series by what it counts and the label that tells it apart,
+// e.g. ("keys", n, "type", "hash"); group is empty for the totals.
+func reportGauges(rep *Report, gauge func(name string, v int64, group, value string)) {
+	s := rep.Summary
+	gauge("keys", s.TotalKeys, "", "")
+	gauge("size_bytes", s.TotalSize, "", "")
+	gauge("estimated_memory_bytes", s.TotalMem, "", "")
+	gauge("keys_expired", s.Expired, "", "")
+	gauge("keys_without_ttl", s.NoTTL, "", "")
+	dbs := make([]int, 0, len(s.DBKeys))
+	for db := range s.DBKeys {
+		dbs = append(dbs, db)
+	}
+	sort.Ints(dbs)
+	for _, db := range dbs {
+		gauge("keys", s.DBKeys[db], "db", strconv.Itoa(db))
+		gauge("estimated_memory_bytes", s.DBMem[db], "db", strconv.Itoa(db))
+	}
+	for _, t := range rep.Types {
+		gauge("keys", t.Count, "type", t.Type)
+		gauge("estimated_memory_bytes", t.EstimatedMem, "type", t.Type)
+	}
+	for _, p := range rep.Prefixes {
+		gauge("keys", p.Count, "prefix", p.Prefix)
+		gauge("estimated_memory_bytes", p.EstimatedMem, "prefix", p.Prefix)
+	}
+}
+
+// writeFile writes data to path through a temporary file in the same
+// directory, so readers never see a partial file.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func itoa(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
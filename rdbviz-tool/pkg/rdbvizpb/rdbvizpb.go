@@ -0,0 +1,5 @@
+// Package rdbvizpb is the gRPC API of serve -grpc, generated from
+// analysis.proto with buf, protoc-gen-go and protoc-gen-go-grpc.
+package rdbvizpb
+
+//go:generate buf generate
@@ -0,0 +1,1159 @@
+// Package report defines the JSON report produced by rdbviz-tool.
+package report
+
+import "time"
+
+type Meta struct {
+	Source       string            `json:"source"`
+	GeneratedAt  string            `json:"generated_at"`
+	Instance     string            `json:"instance,omitempty"`
+	Shard        string            `json:"shard,omitempty"`
+	RedisVersion string            `json:"redis_version,omitempty"`
+	RedisBits    string            `json:"redis_bits,omitempty"`
+	CTime        string            `json:"ctime,omitempty"`
+	UsedMem      string            `json:"used_mem,omitempty"`
+	AOFBase      string            `json:"aof_base,omitempty"`
+	ReplID       string            `json:"repl_id,omitempty"`
+	ReplOffset   string            `json:"repl_offset,omitempty"`
+	ReplStreamDB string            `json:"repl_stream_db,omitempty"`
+	Replication  string            `json:"replication,omitempty"`
+	Aux          map[string]string `json:"aux,omitempty"`
+	Sampling     *Sampling         `json:"sampling,omitempty"`
+	Spill        *Spill            `json:"spill,omitempty"`
+	MemAllocator string            `json:"mem_allocator,omitempty"`
+	PrefixMode   string            `json:"prefix_mode,omitempty"`
+	PrefixLen    int               `json:"prefix_len,omitempty"`
+	PrefixSketch int               `json:"prefix_sketch,omitempty"`
+	BigKeySort   string            `json:"bigkey_sort,omitempty"`
+}
+
+type Summary struct {
+	TotalKeys       int64          `json:"total_keys"`
+	TotalSize       int64          `json:"total_size"`
+	TotalMem        int64          `json:"estimated_mem"`
+	DBCount         int            `json:"db_count"`
+	DBKeys          map[int]int64  `json:"db_keys"`
+	DBSize          map[int]int64  `json:"db_size"`
+	DBMem           map[int]int64  `json:"db_estimated_mem"`
+	WithTTL         int64          `json:"with_ttl"`
+	NoTTL           int64          `json:"no_ttl"`
+	Expired         int64          `json:"expired"`
+	ExpiredSize     int64          `json:"expired_size"`
+	ExpiredMem      int64          `json:"expired_estimated_mem"`
+	SizePercentiles *Percentiles   `json:"size_percentiles,omitempty"`
+	NowISO          string         `json:"now"`
+	TypeCounts      map[string]int `json:"type_counts"`
+}
+
+type TypeStat struct {
+	Type            string       `json:"type"`
+	Count           int64        `json:"count"`
+	Size            int64        `json:"size"`
+	EstimatedMem    int64        `json:"estimated_mem"`
+	SizePercentiles *Percentiles `json:"size_percentiles,omitempty"`
+}
+
+// Percentiles are key size percentiles in bytes, estimated with a t-digest.
+type Percentiles struct {
+	P50  int64 `json:"p50"`
+	P90  int64 `json:"p90"`
+	P99  int64 `json:"p99"`
+	P999 int64 `json:"p999"`
+	Max  int64 `json:"max"`
+}
+
+// PrefixPercentiles are the key size percentiles of a first-level namespace.
+type PrefixPercentiles struct {
+	Prefix      string       `json:"prefix"`
+	Count       int64        `json:"count"`
+	Size        int64        `json:"size"`
+	Percentiles *Percentiles `json:"percentiles"`
+}
+
+type Bucket struct {
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+// PrefixStat aggregates the keys under a prefix. TTLShare is the fraction of
+// them carrying a TTL and MedianTTL their estimated median remaining TTL in
+// seconds.
+type PrefixStat struct {
+	Prefix       string       `json:"prefix"`
+	Count        int64        `json:"count"`
+	Size         int64        `json:"size"`
+	EstimatedMem int64        `json:"estimated_mem"`
+	TTLShare     float64      `json:"ttl_share"`
+	MedianTTL    int64        `json:"median_ttl,omitempty"`
+	Children     int64        `json:"children,omitempty"`
+	TopKeys      []PrefixKey  `json:"top_keys,omitempty"`
+	Error        *PrefixError `json:"error,omitempty"`
+}
+
+// PrefixError bounds the overestimate of a prefix counted by -prefix-sketch:
+// its true totals are at least the listed ones minus these.
+type PrefixError struct {
+	Count        int64 `json:"count"`
+	Size         int64 `json:"size"`
+	EstimatedMem int64 `json:"estimated_mem"`
+}
+
+// PrefixKey is one of the largest keys under a prefix.
+type PrefixKey struct {
+	DB           int    `json:"db"`
+	Key          string `json:"key"`
+	Type         string `json:"type"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+type MixEntry struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+// PrefixMix is the type and encoding mix of a top prefix. MixedTypes flags
+// prefixes holding more than one type, which is often a naming bug.
+type PrefixMix struct {
+	Prefix     string     `json:"prefix"`
+	Types      []MixEntry `json:"types"`
+	Encodings  []MixEntry `json:"encodings"`
+	MixedTypes bool       `json:"mixed_types"`
+}
+
+type SuffixStat struct {
+	Suffix       string `json:"suffix"`
+	Count        int64  `json:"count"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// PatternStat groups keys whose names only differ in IDs, UUIDs or hashes,
+// e.g. "order:{id}:items". Cardinality estimates the distinct values of the
+// first placeholder.
+type PatternStat struct {
+	Pattern      string `json:"pattern"`
+	Count        int64  `json:"count"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+	Cardinality  int64  `json:"cardinality"`
+	Example      string `json:"example,omitempty"`
+}
+
+type PrefixTypeGroup struct {
+	Type         string       `json:"type"`
+	EstimatedMem int64        `json:"estimated_mem"`
+	Prefixes     []PrefixStat `json:"prefixes"`
+}
+
+// PrefixFold describes prefixes folded into the __other__ bucket after the
+// prefix maps hit their size cap. Counts add up over every prefix level.
+type PrefixFold struct {
+	MaxEntries     int   `json:"max_entries"`
+	FoldedPrefixes int64 `json:"folded_prefixes"`
+	FoldedCount    int64 `json:"folded_count"`
+	FoldedSize     int64 `json:"folded_size"`
+	FoldedMem      int64 `json:"folded_mem"`
+}
+
+type EncodingStat struct {
+	Type         string `json:"type"`
+	Encoding     string `json:"encoding"`
+	Count        int64  `json:"count"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// SuboptimalTypeStat sums collections per type that are stored as
+// hashtable/skiplist although they fit a compact encoding.
+type SuboptimalTypeStat struct {
+	Type         string `json:"type"`
+	Count        int64  `json:"count"`
+	EstimatedMem int64  `json:"estimated_mem"`
+	Savings      int64  `json:"savings"`
+}
+
+type SuboptimalKey struct {
+	DB           int    `json:"db"`
+	Key          string `json:"key"`
+	Type         string `json:"type"`
+	Encoding     string `json:"encoding"`
+	Suggested    string `json:"suggested"`
+	Elements     int64  `json:"elements"`
+	EstimatedMem int64  `json:"estimated_mem"`
+	Savings      int64  `json:"savings"`
+}
+
+type EncodingReport struct {
+	Encodings  []EncodingStat       `json:"encodings"`
+	Suboptimal []SuboptimalTypeStat `json:"suboptimal"`
+	Keys       []SuboptimalKey      `json:"suboptimal_keys"`
+}
+
+type ElementBucket struct {
+	Label        string `json:"label"`
+	Count        int64  `json:"count"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// ElementHistogram buckets the collections of one type by element count.
+type ElementHistogram struct {
+	Type    string          `json:"type"`
+	Buckets []ElementBucket `json:"buckets"`
+}
+
+type LongKey struct {
+	DB     int    `json:"db"`
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+	Length int    `json:"length"`
+}
+
+// KeyNameReport shows how much memory goes to key names: their length
+// distribution, raw bytes, and estimated RAM of the key sds strings versus
+// everything else.
+type KeyNameReport struct {
+	TotalKeyBytes int64     `json:"total_key_bytes"`
+	AvgLength     float64   `json:"avg_length"`
+	KeyMem        int64     `json:"key_mem"`
+	ValueMem      int64     `json:"value_mem"`
+	Buckets       []Bucket  `json:"length_buckets"`
+	Longest       []LongKey `json:"longest"`
+}
+
+// Member is a single field, member or entry inside a collection. Name is
+// truncated to keep the report small.
+type Member struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// ScoreStat summarizes the scores of a sorted set. Timestamp is set when all
+// scores fall in a plausible Unix time range (seconds or milliseconds).
+type ScoreStat struct {
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	Mean      float64 `json:"mean"`
+	Timestamp string  `json:"timestamp,omitempty"`
+}
+
+type BigKey struct {
+	DB             int        `json:"db"`
+	Key            string     `json:"key"`
+	Type           string     `json:"type"`
+	Size           int64      `json:"size"`
+	EstimatedMem   int64      `json:"estimated_mem"`
+	Encoding       string     `json:"encoding"`
+	Elements       int64      `json:"elements"`
+	AvgElementSize float64    `json:"avg_element_size"`
+	LargestMember  *Member    `json:"largest_member,omitempty"`
+	Scores         *ScoreStat `json:"scores,omitempty"`
+	Expiration     *time.Time `json:"expiration,omitempty"`
+}
+
+// TypeBigKeys is the bigkey list of one type.
+type TypeBigKeys struct {
+	Type    string   `json:"type"`
+	BigKeys []BigKey `json:"bigkeys"`
+}
+
+// DBBigKeys is the bigkey list of one DB.
+type DBBigKeys struct {
+	DB      int      `json:"db"`
+	BigKeys []BigKey `json:"bigkeys"`
+}
+
+type Report struct {
+	Meta                  Meta                `json:"meta"`
+	Summary               Summary             `json:"summary"`
+	Types                 []TypeStat          `json:"types"`
+	TTLBuckets            []Bucket            `json:"ttl_buckets"`
+	SizeBuckets           []Bucket            `json:"size_buckets"`
+	Prefixes              []PrefixStat        `json:"prefixes"`
+	PrefixesByType        []PrefixTypeGroup   `json:"prefixes_by_type"`
+	BigKeys               []BigKey            `json:"bigkeys"`
+	BigKeysByType         []TypeBigKeys       `json:"bigkeys_by_type,omitempty"`
+	BigKeysByDB           []DBBigKeys         `json:"bigkeys_by_db,omitempty"`
+	Suffixes              []SuffixStat        `json:"suffixes,omitempty"`
+	PrefixFold            *PrefixFold         `json:"prefix_fold,omitempty"`
+	Patterns              []PatternStat       `json:"patterns,omitempty"`
+	Encodings             *EncodingReport     `json:"encodings,omitempty"`
+	KeyNames              *KeyNameReport      `json:"key_names,omitempty"`
+	Elements              []ElementHistogram  `json:"element_histograms,omitempty"`
+	ExpiredPrefixes       []PrefixStat        `json:"expired_prefixes,omitempty"`
+	PrefixMix             []PrefixMix         `json:"prefix_mix,omitempty"`
+	PrefixSizePercentiles []PrefixPercentiles `json:"prefix_size_percentiles,omitempty"`
+	Offload               *OffloadReport      `json:"offload,omitempty"`
+	Candidates            *CandidateReport    `json:"candidates,omitempty"`
+	Governance            *GovernanceReport   `json:"governance,omitempty"`
+	Classes               *ClassReport        `json:"classes,omitempty"`
+	Orphans               *OrphanReport       `json:"orphans,omitempty"`
+	Dedup                 *DedupReport        `json:"dedup,omitempty"`
+	Compression           *CompressionReport  `json:"compression,omitempty"`
+	Entropy               *EntropyReport      `json:"entropy,omitempty"`
+	JSON                  *JSONReport         `json:"json,omitempty"`
+	Formats               *FormatReport       `json:"formats,omitempty"`
+	HyperLogLogs          *HLLReport          `json:"hyperloglogs,omitempty"`
+	Bitmaps               *BitmapReport       `json:"bitmaps,omitempty"`
+	Geo                   *GeoReport          `json:"geo,omitempty"`
+	ExpiryTimeline        *ExpiryTimeline     `json:"expiry_timeline,omitempty"`
+	ColdKeys              *ColdKeyReport      `json:"cold_keys,omitempty"`
+	Eviction              *EvictionReport     `json:"eviction,omitempty"`
+	TTLWhatIf             *TTLWhatIf          `json:"ttl_what_if,omitempty"`
+	Slots                 *SlotReport         `json:"slots,omitempty"`
+	HashTags              *HashTagReport      `json:"hash_tags,omitempty"`
+	ShardBalance          *ShardBalance       `json:"shard_balance,omitempty"`
+	SlotCoverage          *SlotCoverage       `json:"slot_coverage,omitempty"`
+	Reshard               *ReshardPlan        `json:"reshard,omitempty"`
+	CrossDB               *CrossDBReport      `json:"cross_db,omitempty"`
+	DBs                   []DBReport          `json:"dbs,omitempty"`
+	Drift                 *DriftReport        `json:"drift,omitempty"`
+	Growth                *GrowthReport       `json:"growth,omitempty"`
+	MemoryCheck           *MemoryCheck        `json:"memory_check,omitempty"`
+	Migration             *MigrationPlan      `json:"migration,omitempty"`
+	// Custom holds the sections of aggregators registered by library users,
+	// keyed by name.
+	Custom map[string]any `json:"custom,omitempty"`
+}
+
+type Sampling struct {
+	Rate        float64 `json:"rate"`
+	MaxKeys     int64   `json:"max_keys,omitempty"`
+	SampledKeys int64   `json:"sampled_keys"`
+	Truncated   bool    `json:"truncated"`
+	ReadBytes   int64   `json:"read_bytes"`
+	Scale       float64 `json:"scale"`
+}
+
+// Spill records the aggregation tables written to disk to stay under
+// -max-mem.
+type Spill struct {
+	MaxMem       int64    `json:"max_mem"`
+	Spills       int      `json:"spills"`
+	SpilledBytes int64    `json:"spilled_bytes"`
+	Tables       []string `json:"tables"`
+}
+
+type OffloadCandidate struct {
+	DB           int      `json:"db"`
+	Key          string   `json:"key"`
+	Type         string   `json:"type"`
+	Size         int64    `json:"size"`
+	EstimatedMem int64    `json:"estimated_mem"`
+	Idle         int64    `json:"idle_seconds,omitempty"`
+	Freq         int64    `json:"freq,omitempty"`
+	Score        float64  `json:"score"`
+	Reasons      []string `json:"reasons"`
+	Encoding     string   `json:"encoding"`
+}
+
+type OffloadNamespace struct {
+	Prefix       string  `json:"prefix"`
+	Count        int64   `json:"count"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	TotalSize    int64   `json:"total_size"`
+	Share        float64 `json:"share"`
+}
+
+type OffloadReport struct {
+	Signals             []string           `json:"signals"`
+	MinSize             int64              `json:"min_size"`
+	CandidateKeys       int64              `json:"candidate_keys"`
+	ProjectedSavings    int64              `json:"projected_savings"`
+	ProjectedMemSavings int64              `json:"projected_mem_savings"`
+	Keys                []OffloadCandidate `json:"keys"`
+	Namespaces          []OffloadNamespace `json:"namespaces"`
+}
+
+// DupGroup is a set of string keys holding byte-identical values. Keys lists
+// up to five of them as "db:key".
+type DupGroup struct {
+	Hash       string   `json:"hash"`
+	ValueSize  int64    `json:"value_size"`
+	Count      int64    `json:"count"`
+	Savings    int64    `json:"savings"`
+	MemSavings int64    `json:"mem_savings"`
+	Keys       []string `json:"keys"`
+}
+
+// DedupReport lists the duplicated string values. Dropped counts the values
+// left untracked to bound memory; copies of them are missed, so the totals
+// are lower bounds when it is set.
+type DedupReport struct {
+	MinSize         int64      `json:"min_size"`
+	SampleRate      float64    `json:"sample_rate"`
+	DuplicateGroups int64      `json:"duplicate_groups"`
+	DuplicateKeys   int64      `json:"duplicate_keys"`
+	Savings         int64      `json:"savings"`
+	MemSavings      int64      `json:"mem_savings"`
+	Dropped         int64      `json:"dropped,omitempty"`
+	Groups          []DupGroup `json:"groups"`
+}
+
+// CompressionStat is the sampled compression ratio of string values under a
+// namespace. EstimatedSavings applies the ratio to all of its string bytes.
+type CompressionStat struct {
+	Prefix           string  `json:"prefix"`
+	Sampled          int64   `json:"sampled"`
+	SampledSize      int64   `json:"sampled_size"`
+	CompressedSize   int64   `json:"compressed_size"`
+	Ratio            float64 `json:"ratio"`
+	StringSize       int64   `json:"string_size"`
+	EstimatedSavings int64   `json:"estimated_savings"`
+}
+
+type CompressionReport struct {
+	Algorithm        string            `json:"algorithm"`
+	SampleRate       float64           `json:"sample_rate"`
+	MinSize          int64             `json:"min_size"`
+	Sampled          int64             `json:"sampled"`
+	Ratio            float64           `json:"ratio"`
+	EstimatedSavings int64             `json:"estimated_savings"`
+	Prefixes         []CompressionStat `json:"prefixes"`
+}
+
+// EntropyStat is the Shannon entropy (bits per byte) of sampled string values
+// under a namespace. Class is "incompressible" for already compressed or
+// encrypted data, "compressible" for text-like data and "mixed" otherwise.
+type EntropyStat struct {
+	Prefix      string   `json:"prefix"`
+	Sampled     int64    `json:"sampled"`
+	SampledSize int64    `json:"sampled_size"`
+	Mean        float64  `json:"mean"`
+	Class       string   `json:"class"`
+	Buckets     []Bucket `json:"buckets"`
+}
+
+type EntropyReport struct {
+	SampleRate float64       `json:"sample_rate"`
+	MinSize    int64         `json:"min_size"`
+	Sampled    int64         `json:"sampled"`
+	Buckets    []Bucket      `json:"buckets"`
+	Prefixes   []EntropyStat `json:"prefixes"`
+}
+
+// JSONField is a top-level field of the JSON objects under a namespace. Size
+// counts the field name and its raw value; Presence is the share of documents
+// that have it.
+type JSONField struct {
+	Name     string  `json:"name"`
+	Count    int64   `json:"count"`
+	Size     int64   `json:"size"`
+	AvgSize  float64 `json:"avg_size"`
+	Presence float64 `json:"presence"`
+}
+
+type JSONPrefixStat struct {
+	Prefix     string      `json:"prefix"`
+	Sampled    int64       `json:"sampled"`
+	Documents  int64       `json:"documents"`
+	Size       int64       `json:"size"`
+	AvgDocSize float64     `json:"avg_doc_size"`
+	Fields     []JSONField `json:"fields"`
+}
+
+type JSONReport struct {
+	SampleRate float64          `json:"sample_rate"`
+	Sampled    int64            `json:"sampled"`
+	Documents  int64            `json:"documents"`
+	Prefixes   []JSONPrefixStat `json:"prefixes"`
+}
+
+// FormatCount is the number of sampled values fingerprinted as a format.
+// Risky marks formats that deserialize into arbitrary objects (Java
+// serialization, PHP serialize, pickle).
+type FormatCount struct {
+	Format string `json:"format"`
+	Count  int64  `json:"count"`
+	Size   int64  `json:"size"`
+	Risky  bool   `json:"risky,omitempty"`
+}
+
+type FormatPrefixStat struct {
+	Prefix  string        `json:"prefix"`
+	Sampled int64         `json:"sampled"`
+	Risky   int64         `json:"risky"`
+	Formats []FormatCount `json:"formats"`
+}
+
+type FormatReport struct {
+	SampleRate float64            `json:"sample_rate"`
+	Sampled    int64              `json:"sampled"`
+	Formats    []FormatCount      `json:"formats"`
+	Prefixes   []FormatPrefixStat `json:"prefixes"`
+}
+
+// HLLKey is a string key holding a Redis HyperLogLog with its cardinality as
+// PFCOUNT would return it.
+type HLLKey struct {
+	DB           int    `json:"db"`
+	Key          string `json:"key"`
+	Encoding     string `json:"encoding"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+	Cardinality  int64  `json:"cardinality"`
+}
+
+type HLLReport struct {
+	Count        int64    `json:"count"`
+	Size         int64    `json:"size"`
+	EstimatedMem int64    `json:"estimated_mem"`
+	Dense        int64    `json:"dense"`
+	Sparse       int64    `json:"sparse"`
+	Invalid      int64    `json:"invalid,omitempty"`
+	Keys         []HLLKey `json:"keys"`
+}
+
+// BitmapKey is a string key that looks like a SETBIT/BITFIELD bitmap.
+// Density is the share of set bits.
+type BitmapKey struct {
+	DB           int     `json:"db"`
+	Key          string  `json:"key"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	SetBits      int64   `json:"set_bits"`
+	MaxBitOffset int64   `json:"max_bit_offset"`
+	Density      float64 `json:"density"`
+}
+
+type BitmapReport struct {
+	Count        int64       `json:"count"`
+	Size         int64       `json:"size"`
+	EstimatedMem int64       `json:"estimated_mem"`
+	SetBits      int64       `json:"set_bits"`
+	MaxBitOffset int64       `json:"max_bit_offset"`
+	Keys         []BitmapKey `json:"keys"`
+}
+
+// GeoKey is a sorted set holding GEOADD data, with the bounding box of its
+// members.
+type GeoKey struct {
+	DB           int     `json:"db"`
+	Key          string  `json:"key"`
+	Members      int64   `json:"members"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	MinLon       float64 `json:"min_lon"`
+	MaxLon       float64 `json:"max_lon"`
+	MinLat       float64 `json:"min_lat"`
+	MaxLat       float64 `json:"max_lat"`
+}
+
+type GeoReport struct {
+	Count        int64    `json:"count"`
+	Members      int64    `json:"members"`
+	Size         int64    `json:"size"`
+	EstimatedMem int64    `json:"estimated_mem"`
+	Keys         []GeoKey `json:"keys"`
+}
+
+// TimeBucket aggregates keys expiring in an absolute hour or day; Time is the
+// start of the bucket in UTC.
+type TimeBucket struct {
+	Time         string `json:"time"`
+	Count        int64  `json:"count"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// ExpirySpike is a minute in which Share of all keys expire at once.
+type ExpirySpike struct {
+	Minute string  `json:"minute"`
+	Count  int64   `json:"count"`
+	Share  float64 `json:"share"`
+}
+
+type ExpiryTimeline struct {
+	HorizonHours int           `json:"horizon_hours"`
+	SpikeShare   float64       `json:"spike_share"`
+	Hourly       []TimeBucket  `json:"hourly"`
+	Daily        []TimeBucket  `json:"daily"`
+	Spikes       []ExpirySpike `json:"spikes"`
+}
+
+// ColdBucket aggregates keys whose LRU idle time is at least MinIdle seconds.
+type ColdBucket struct {
+	Label        string `json:"label"`
+	MinIdle      int64  `json:"min_idle_seconds"`
+	Count        int64  `json:"count"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+type ColdPrefix struct {
+	Prefix       string       `json:"prefix"`
+	Count        int64        `json:"count"`
+	Size         int64        `json:"size"`
+	EstimatedMem int64        `json:"estimated_mem"`
+	Buckets      []ColdBucket `json:"buckets"`
+}
+
+// ColdKeyReport is only present when the dump carries LRU idle times, i.e.
+// it was saved under an LRU maxmemory-policy.
+type ColdKeyReport struct {
+	KeysWithIdle int64        `json:"keys_with_idle"`
+	Size         int64        `json:"size"`
+	EstimatedMem int64        `json:"estimated_mem"`
+	Buckets      []ColdBucket `json:"buckets"`
+	Prefixes     []ColdPrefix `json:"prefixes"`
+}
+
+// EvictionPrefix is what one namespace loses under a policy; EligibleKeys
+// counts the keys the policy may evict (volatile-* only consider keys with a
+// TTL).
+type EvictionPrefix struct {
+	Prefix       string `json:"prefix"`
+	EligibleKeys int64  `json:"eligible_keys"`
+	EvictedKeys  int64  `json:"evicted_keys"`
+	EvictedSize  int64  `json:"evicted_size"`
+	EvictedMem   int64  `json:"evicted_mem"`
+}
+
+// EvictionPolicy is unavailable when the dump lacks the access data it
+// needs, and OOM when evicting every eligible key still does not fit, in
+// which case Redis would reject writes.
+type EvictionPolicy struct {
+	Policy      string           `json:"policy"`
+	Available   bool             `json:"available"`
+	OOM         bool             `json:"oom,omitempty"`
+	EvictedKeys int64            `json:"evicted_keys"`
+	EvictedSize int64            `json:"evicted_size"`
+	EvictedMem  int64            `json:"evicted_mem"`
+	Prefixes    []EvictionPrefix `json:"prefixes"`
+}
+
+type EvictionReport struct {
+	MaxMemory  int64            `json:"maxmemory"`
+	UsedMem    int64            `json:"used_estimated_mem"`
+	NeedToFree int64            `json:"need_to_free"`
+	Policies   []EvictionPolicy `json:"policies"`
+}
+
+// TTLRuleStat describes the keys a -ttl-rule pattern matched; TTL is in
+// seconds.
+type TTLRuleStat struct {
+	Pattern      string `json:"pattern"`
+	TTL          int64  `json:"ttl_seconds"`
+	MatchedKeys  int64  `json:"matched_keys"`
+	NoTTLKeys    int64  `json:"no_ttl_keys"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// TTLProjection is the keyspace left Seconds after the snapshot with the
+// current TTLs (Baseline) and with the rules applied (WhatIf).
+type TTLProjection struct {
+	Horizon      string `json:"horizon"`
+	Seconds      int64  `json:"seconds"`
+	BaselineKeys int64  `json:"baseline_keys"`
+	BaselineSize int64  `json:"baseline_size"`
+	BaselineMem  int64  `json:"baseline_mem"`
+	WhatIfKeys   int64  `json:"what_if_keys"`
+	WhatIfSize   int64  `json:"what_if_size"`
+	WhatIfMem    int64  `json:"what_if_mem"`
+}
+
+type TTLWhatIf struct {
+	Rules      []TTLRuleStat   `json:"rules"`
+	Projection []TTLProjection `json:"projection"`
+}
+
+type SlotStat struct {
+	Slot         int   `json:"slot"`
+	Keys         int64 `json:"keys"`
+	Size         int64 `json:"size"`
+	EstimatedMem int64 `json:"estimated_mem"`
+}
+
+// SlotRange aggregates the slots Start..End inclusive.
+type SlotRange struct {
+	Start        int   `json:"start"`
+	End          int   `json:"end"`
+	Keys         int64 `json:"keys"`
+	Size         int64 `json:"size"`
+	EstimatedMem int64 `json:"estimated_mem"`
+}
+
+// SlotReport distributes keys over the 16384 Redis Cluster hash slots. Keys,
+// Sizes and Mems are indexed by slot, present with -slots or -reshard only. SizeCV is the coefficient of variation
+// of slot sizes and MaxToMean the largest slot relative to the mean.
+type SlotReport struct {
+	UsedSlots    int         `json:"used_slots"`
+	MeanSlotSize int64       `json:"mean_slot_size"`
+	MaxSlotSize  int64       `json:"max_slot_size"`
+	SizeCV       float64     `json:"size_cv"`
+	MaxToMean    float64     `json:"max_to_mean"`
+	Ranges       []SlotRange `json:"ranges"`
+	TopSlots     []SlotStat  `json:"top_slots"`
+	Keys         []int64     `json:"keys,omitempty"`
+	Sizes        []int64     `json:"sizes,omitempty"`
+	Mems         []int64     `json:"estimated_mems,omitempty"`
+	HotSlots     *HotSlots   `json:"hot_slots,omitempty"`
+}
+
+// HotSlot is a slot taking a disproportionate share of accesses; Hits is
+// estimated from the LFU counters of its keys.
+type HotSlot struct {
+	Slot        int     `json:"slot"`
+	Keys        int64   `json:"keys"`
+	Size        int64   `json:"size"`
+	Hits        int64   `json:"estimated_hits"`
+	AccessShare float64 `json:"access_share"`
+	SizeShare   float64 `json:"size_share"`
+}
+
+// HotSlots is only present when the dump carries LFU counters. A slot is
+// hot when its access share is at least Factor times an even share.
+type HotSlots struct {
+	KeysWithFreq int64     `json:"keys_with_freq"`
+	Factor       float64   `json:"factor"`
+	Slots        []HotSlot `json:"slots"`
+}
+
+// HashTagStat aggregates the keys sharing a {hash tag}, all of which live in
+// Slot. Share is their part of the total size; Hot marks tags at or above
+// the -hashtag-hot share.
+type HashTagStat struct {
+	Tag          string  `json:"tag"`
+	Slot         int     `json:"slot"`
+	Keys         int64   `json:"keys"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	Share        float64 `json:"share"`
+	Hot          bool    `json:"hot,omitempty"`
+}
+
+// HashTagReport covers keys with a non-empty {hash tag}. Untracked counts
+// tagged keys whose tag came after the tracking limit was reached.
+type HashTagReport struct {
+	TaggedKeys    int64              `json:"tagged_keys"`
+	TaggedSize    int64              `json:"tagged_size"`
+	TaggedMem     int64              `json:"tagged_estimated_mem"`
+	DistinctTags  int64              `json:"distinct_tags"`
+	Untracked     int64              `json:"untracked_keys,omitempty"`
+	HotShare      float64            `json:"hot_share"`
+	Hot           []HashTagStat      `json:"hot"`
+	TopByKeys     []HashTagStat      `json:"top_by_keys"`
+	TopBySize     []HashTagStat      `json:"top_by_size"`
+	CollidingTags int64              `json:"colliding_tags"`
+	CollidingKeys int64              `json:"colliding_keys"`
+	CollidingSize int64              `json:"colliding_size"`
+	Collisions    []HashTagCollision `json:"collisions"`
+}
+
+// HashTagPrefix counts the keys of one namespace under a hash tag. Keys that
+// start with the tag are grouped as "{}".
+type HashTagPrefix struct {
+	Prefix string `json:"prefix"`
+	Keys   int64  `json:"keys"`
+	Size   int64  `json:"size"`
+}
+
+// HashTagCollision is a tag shared by keys of different namespaces, which
+// places unrelated data in the same slot.
+type HashTagCollision struct {
+	Tag          string          `json:"tag"`
+	Slot         int             `json:"slot"`
+	Keys         int64           `json:"keys"`
+	Size         int64           `json:"size"`
+	EstimatedMem int64           `json:"estimated_mem"`
+	Prefixes     []HashTagPrefix `json:"prefixes"`
+}
+
+// ShardStat is a shard before and after the planned moves; Deviation is its
+// estimated memory relative to the mean (0.2 = 20% above).
+type ShardStat struct {
+	Name         string  `json:"name"`
+	Keys         int64   `json:"keys"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	Slots        int     `json:"slots"`
+	Deviation    float64 `json:"deviation"`
+	AfterMem     int64   `json:"after_estimated_mem"`
+}
+
+// SlotMove moves the slots Start..End inclusive that From holds data in.
+type SlotMove struct {
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Start        int    `json:"start"`
+	End          int    `json:"end"`
+	Slots        int    `json:"slots"`
+	Keys         int64  `json:"keys"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+type ShardBalance struct {
+	Tolerance float64     `json:"tolerance"`
+	MeanMem   int64       `json:"mean_estimated_mem"`
+	Shards    []ShardStat `json:"shards"`
+	Moves     []SlotMove  `json:"moves"`
+}
+
+// ReshardNode is one target node of a resharding plan, owning the slots
+// Start..End inclusive. Deviation is its estimated memory relative to the mean.
+type ReshardNode struct {
+	Node         int     `json:"node"`
+	Start        int     `json:"start"`
+	End          int     `json:"end"`
+	Slots        int     `json:"slots"`
+	Keys         int64   `json:"keys"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	Deviation    float64 `json:"deviation"`
+}
+
+// ReshardPlan assigns the slot space to a target number of nodes in
+// contiguous ranges. Imbalance is the largest node over the mean minus 1;
+// the Even fields give the same for an even split by slot count.
+type ReshardPlan struct {
+	Shards        int           `json:"shards"`
+	MeanMem       int64         `json:"mean_estimated_mem"`
+	MaxMem        int64         `json:"max_estimated_mem"`
+	Imbalance     float64       `json:"imbalance"`
+	EvenMaxMem    int64         `json:"even_max_estimated_mem"`
+	EvenImbalance float64       `json:"even_imbalance"`
+	Nodes         []ReshardNode `json:"nodes"`
+}
+
+// CrossDBKey is a key name present in several logical DBs; Size and
+// EstimatedMem add up all copies.
+type CrossDBKey struct {
+	Key          string `json:"key"`
+	DBs          []int  `json:"dbs"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// DBPair counts the key names DBs A and B share.
+type DBPair struct {
+	A    int   `json:"a"`
+	B    int   `json:"b"`
+	Keys int64 `json:"keys"`
+	Size int64 `json:"size"`
+}
+
+// CrossDBReport lists key names that appear in more than one DB, usually a
+// client writing to the wrong DB. Copies counts every instance of those
+// names.
+type CrossDBReport struct {
+	SampleRate   float64      `json:"sample_rate"`
+	OverlapKeys  int64        `json:"overlap_keys"`
+	Copies       int64        `json:"copies"`
+	CombinedSize int64        `json:"combined_size"`
+	CombinedMem  int64        `json:"combined_estimated_mem"`
+	Pairs        []DBPair     `json:"pairs"`
+	Keys         []CrossDBKey `json:"keys"`
+}
+
+// DBReport repeats the headline sections for a single logical DB.
+type DBReport struct {
+	DB           int          `json:"db"`
+	Keys         int64        `json:"keys"`
+	Size         int64        `json:"size"`
+	EstimatedMem int64        `json:"estimated_mem"`
+	Types        []TypeStat   `json:"types"`
+	TTLBuckets   []Bucket     `json:"ttl_buckets"`
+	Prefixes     []PrefixStat `json:"prefixes"`
+	BigKeys      []BigKey     `json:"bigkeys"`
+}
+
+// SlotSpan is the slots Start..End inclusive.
+type SlotSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// SlotConflict is a slot holding keys on more than one shard; Keys is
+// parallel to Shards.
+type SlotConflict struct {
+	Slot   int      `json:"slot"`
+	Shards []string `json:"shards"`
+	Keys   []int64  `json:"keys"`
+}
+
+// SlotCoverage infers slot ownership from the keys in each shard's dump.
+// Empty slots cannot be attributed and are listed as ranges.
+type SlotCoverage struct {
+	CoveredSlots  int            `json:"covered_slots"`
+	EmptySlots    int            `json:"empty_slots"`
+	ConflictSlots int            `json:"conflict_slots"`
+	EmptyRanges   []SlotSpan     `json:"empty_ranges"`
+	Conflicts     []SlotConflict `json:"conflicts"`
+}
+
+// DriftPrefix compares a namespace's key count in the dump with a live SCAN.
+// Change is Delta relative to the dump's count (at least 1).
+type DriftPrefix struct {
+	Prefix   string  `json:"prefix"`
+	RDBKeys  int64   `json:"rdb_keys"`
+	LiveKeys int64   `json:"live_keys"`
+	Delta    int64   `json:"delta"`
+	Change   float64 `json:"change"`
+	Drifted  bool    `json:"drifted"`
+}
+
+// DriftReport compares the dump against a live instance, DB by DB for the DBs
+// found in the dump. Namespaces lists drifted namespaces first.
+type DriftReport struct {
+	Addr       string        `json:"addr"`
+	ScannedAt  string        `json:"scanned_at"`
+	DBs        []int         `json:"dbs"`
+	Threshold  float64       `json:"threshold"`
+	RDBKeys    int64         `json:"rdb_keys"`
+	LiveKeys   int64         `json:"live_keys"`
+	Drifted    int           `json:"drifted"`
+	Namespaces []DriftPrefix `json:"namespaces"`
+}
+
+// MemoryCheckKey is one bigkey measured with MEMORY USAGE. SizeRatio is
+// LiveMem over Size, ModelRatio LiveMem over EstimatedMem.
+type MemoryCheckKey struct {
+	DB           int     `json:"db"`
+	Key          string  `json:"key"`
+	Type         string  `json:"type"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	LiveMem      int64   `json:"live_mem"`
+	SizeRatio    float64 `json:"size_ratio"`
+	ModelRatio   float64 `json:"model_ratio"`
+}
+
+// MemoryCheckType sums the measured keys of one type.
+type MemoryCheckType struct {
+	Type         string  `json:"type"`
+	Keys         int64   `json:"keys"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	LiveMem      int64   `json:"live_mem"`
+	SizeRatio    float64 `json:"size_ratio"`
+	ModelRatio   float64 `json:"model_ratio"`
+}
+
+// MemoryCheck compares bigkeys against MEMORY USAGE on a live instance.
+// Missing counts keys that no longer exist there.
+type MemoryCheck struct {
+	Addr         string            `json:"addr"`
+	CheckedAt    string            `json:"checked_at"`
+	Checked      int64             `json:"checked"`
+	Missing      int64             `json:"missing"`
+	Size         int64             `json:"size"`
+	EstimatedMem int64             `json:"estimated_mem"`
+	LiveMem      int64             `json:"live_mem"`
+	SizeRatio    float64           `json:"size_ratio"`
+	ModelRatio   float64           `json:"model_ratio"`
+	Types        []MemoryCheckType `json:"types"`
+	Keys         []MemoryCheckKey  `json:"keys"`
+}
+
+// MigrationKey is one key of a migration plan. Method is migrate,
+// dump-restore or chunked; chunked keys are rewritten on the target from the
+// snapshot in Chunks commands. TransferBytes is the DUMP payload, or the
+// element bytes written for chunked keys.
+type MigrationKey struct {
+	DB            int        `json:"db"`
+	Key           string     `json:"key"`
+	Type          string     `json:"type"`
+	Elements      int64      `json:"elements"`
+	Size          int64      `json:"size"`
+	Expiration    *time.Time `json:"expiration,omitempty"`
+	Method        string     `json:"method"`
+	Chunks        int        `json:"chunks,omitempty"`
+	TransferBytes int64      `json:"transfer_bytes"`
+}
+
+// MigrationPlan moves the bigkeys matching Pattern to Target; the commands
+// are written to Script.
+type MigrationPlan struct {
+	Target        string         `json:"target"`
+	Method        string         `json:"method"`
+	Pattern       string         `json:"pattern"`
+	ChunkElements int64          `json:"chunk_elements"`
+	Script        string         `json:"script"`
+	ChunkedKeys   int            `json:"chunked_keys"`
+	Size          int64          `json:"size"`
+	TransferBytes int64          `json:"transfer_bytes"`
+	Keys          []MigrationKey `json:"keys"`
+}
+
+// Candidate is a key suggested for eviction or remediation. Action is
+// delete, expire (add a TTL), evict or keep; Score ranks by estimated memory
+// freed, weighted by the listed reasons.
+type Candidate struct {
+	DB           int      `json:"db"`
+	Key          string   `json:"key"`
+	Type         string   `json:"type"`
+	Size         int64    `json:"size"`
+	EstimatedMem int64    `json:"estimated_mem"`
+	HasTTL       bool     `json:"has_ttl"`
+	Idle         int64    `json:"idle_seconds,omitempty"`
+	Freq         int64    `json:"freq,omitempty"`
+	Action       string   `json:"action"`
+	Score        float64  `json:"score"`
+	Reasons      []string `json:"reasons"`
+}
+
+// CandidateAction sums the candidates given one action.
+type CandidateAction struct {
+	Action       string `json:"action"`
+	Keys         int64  `json:"keys"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// CandidatePrefix sums the candidates of one first-level namespace.
+type CandidatePrefix struct {
+	Prefix       string `json:"prefix"`
+	Keys         int64  `json:"keys"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// CandidateReport ranks eviction and remediation candidates. EstimatedMem is
+// the memory freed if every candidate were acted on.
+type CandidateReport struct {
+	Signals       []string          `json:"signals"`
+	Policies      []string          `json:"policies,omitempty"`
+	MinSize       int64             `json:"min_size"`
+	CandidateKeys int64             `json:"candidate_keys"`
+	Size          int64             `json:"size"`
+	EstimatedMem  int64             `json:"estimated_mem"`
+	Actions       []CandidateAction `json:"actions"`
+	Prefixes      []CandidatePrefix `json:"prefixes"`
+	Keys          []Candidate       `json:"keys"`
+}
+
+// AllowPattern is one allowlist entry with the keys it matched first.
+type AllowPattern struct {
+	Pattern      string `json:"pattern"`
+	Keys         int64  `json:"keys"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// UnregisteredNamespace groups keys matching no allowlist entry by
+// first-level namespace; Sample is one of its keys.
+type UnregisteredNamespace struct {
+	Prefix       string `json:"prefix"`
+	Keys         int64  `json:"keys"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+	Sample       string `json:"sample"`
+}
+
+// GovernanceReport checks the keyspace against an allowlist of approved
+// patterns.
+type GovernanceReport struct {
+	Patterns         []AllowPattern          `json:"patterns"`
+	AllowedKeys      int64                   `json:"allowed_keys"`
+	AllowedSize      int64                   `json:"allowed_size"`
+	AllowedMem       int64                   `json:"allowed_mem"`
+	UnregisteredKeys int64                   `json:"unregistered_keys"`
+	UnregisteredSize int64                   `json:"unregistered_size"`
+	UnregisteredMem  int64                   `json:"unregistered_mem"`
+	Unregistered     []UnregisteredNamespace `json:"unregistered"`
+}
+
+// ClassGroup is one logical group assigned by a key classifier.
+type ClassGroup struct {
+	Group        string  `json:"group"`
+	Owner        string  `json:"owner,omitempty"`
+	Keys         int64   `json:"keys"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	Share        float64 `json:"share"`
+}
+
+// ClassOwner sums the groups of one owner.
+type ClassOwner struct {
+	Owner        string  `json:"owner"`
+	Groups       int     `json:"groups"`
+	Keys         int64   `json:"keys"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	Share        float64 `json:"share"`
+}
+
+// ClassLabel sums the keys carrying one label value.
+type ClassLabel struct {
+	Label        string `json:"label"`
+	Value        string `json:"value"`
+	Keys         int64  `json:"keys"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// ClassReport groups the keyspace by a key classifier instead of by
+// separator. Shares are of the total estimated memory; keys the classifier
+// put in no group count as unclassified.
+type ClassReport struct {
+	Classifier       string       `json:"classifier,omitempty"`
+	UnclassifiedKeys int64        `json:"unclassified_keys"`
+	UnclassifiedSize int64        `json:"unclassified_size"`
+	UnclassifiedMem  int64        `json:"unclassified_mem"`
+	Groups           []ClassGroup `json:"groups"`
+	Owners           []ClassOwner `json:"owners,omitempty"`
+	Labels           []ClassLabel `json:"labels,omitempty"`
+}
+
+// OrphanKey is a key without the prefix separator.
+type OrphanKey struct {
+	DB           int    `json:"db"`
+	Key          string `json:"key"`
+	Type         string `json:"type"`
+	Size         int64  `json:"size"`
+	EstimatedMem int64  `json:"estimated_mem"`
+}
+
+// OrphanReport sums the keys without the prefix separator; Samples are the
+// largest of them.
+type OrphanReport struct {
+	Keys         int64            `json:"keys"`
+	Size         int64            `json:"size"`
+	EstimatedMem int64            `json:"estimated_mem"`
+	Types        map[string]int64 `json:"types"`
+	Samples      []OrphanKey      `json:"samples"`
+}
+
+// PrefixGrowth compares a prefix between the baseline dump and this one. The
+// growth ratios are deltas relative to the baseline, 0 for new prefixes;
+// Share is the prefix's part of the total memory increase.
+type PrefixGrowth struct {
+	Prefix       string  `json:"prefix"`
+	BaseKeys     int64   `json:"base_keys"`
+	BaseSize     int64   `json:"base_size"`
+	BaseMem      int64   `json:"base_mem"`
+	Keys         int64   `json:"keys"`
+	Size         int64   `json:"size"`
+	EstimatedMem int64   `json:"estimated_mem"`
+	KeyDelta     int64   `json:"key_delta"`
+	SizeDelta    int64   `json:"size_delta"`
+	MemDelta     int64   `json:"mem_delta"`
+	KeyGrowth    float64 `json:"key_growth"`
+	SizeGrowth   float64 `json:"size_growth"`
+	MemGrowth    float64 `json:"mem_growth"`
+	Share        float64 `json:"share"`
+	New          bool    `json:"new,omitempty"`
+}
+
+// GrowthReport compares the dump with an older dump of the same instance.
+// ByAbsolute ranks growing prefixes by memory added, ByRelative by memory
+// growth ratio among prefixes that already had a few keys in the baseline.
+type GrowthReport struct {
+	Baseline     string         `json:"baseline"`
+	BaseKeys     int64          `json:"base_keys"`
+	BaseSize     int64          `json:"base_size"`
+	BaseMem      int64          `json:"base_mem"`
+	Keys         int64          `json:"keys"`
+	Size         int64          `json:"size"`
+	EstimatedMem int64          `json:"estimated_mem"`
+	KeyDelta     int64          `json:"key_delta"`
+	SizeDelta    int64          `json:"size_delta"`
+	MemDelta     int64          `json:"mem_delta"`
+	ByAbsolute   []PrefixGrowth `json:"by_absolute"`
+	ByRelative   []PrefixGrowth `json:"by_relative"`
+}
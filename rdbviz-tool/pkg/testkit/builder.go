@@ -0,0 +1,210 @@
+// Package testkit provides fixtures for testing code that consumes rdbviz
+// reports: in-memory report builders, generated RDB dumps and golden-file
+// comparison helpers.
+package testkit
+
+import (
+	"sort"
+	"time"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// FixedTime is the timestamp builders and fixtures use so generated reports
+// are stable across runs.
+var FixedTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ReportBuilder assembles a report.Report in memory. Summary totals are
+// derived from the added types when Build is called.
+type ReportBuilder struct {
+	r report.Report
+}
+
+// NewReport returns a builder of an empty report generated at FixedTime.
+func NewReport() *ReportBuilder {
+	return &ReportBuilder{r: report.Report{
+		Meta: report.Meta{
+			Source:      "testkit",
+			GeneratedAt: FixedTime.Format(time.RFC3339),
+			Aux:         map[string]string{},
+		},
+		Summary: report.Summary{
+			DBKeys:     map[int]int64{},
+			DBSize:     map[int]int64{},
+			DBMem:      map[int]int64{},
+			TypeCounts: map[string]int{},
+			NowISO:     FixedTime.Format(time.RFC3339),
+		},
+	}}
+}
+
+// Source sets the dump path of the report's meta.
+func (b *ReportBuilder) Source(source string) *ReportBuilder {
+	b.r.Meta.Source = source
+	return b
+}
+
+// RedisVersion sets the Redis version, as read from the redis-ver aux field.
+func (b *ReportBuilder) RedisVersion(version string) *ReportBuilder {
+	b.r.Meta.RedisVersion = version
+	b.r.Meta.Aux["redis-ver"] = version
+	return b
+}
+
+// Type adds count keys of objType taking size bytes; Build sums the types
+// into the summary totals.
+func (b *ReportBuilder) Type(objType string, count, size int64) *ReportBuilder {
+	b.r.Types = append(b.r.Types, report.TypeStat{Type: objType, Count: count, Size: size})
+	return b
+}
+
+// TypeMem sets the estimated memory of the keys of objType added with Type;
+// Build sums it into the summary.
+func (b *ReportBuilder) TypeMem(objType string, mem int64) *ReportBuilder {
+	for i := range b.r.Types {
+		if b.r.Types[i].Type == objType {
+			b.r.Types[i].EstimatedMem = mem
+		}
+	}
+	return b
+}
+
+// DB sets the keys and bytes of database db. Without it Build puts every key
+// in database 0.
+func (b *ReportBuilder) DB(db int, keys, size int64) *ReportBuilder {
+	b.r.Summary.DBKeys[db] = keys
+	b.r.Summary.DBSize[db] = size
+	return b
+}
+
+// DBMem sets the estimated memory of database db. Without it Build puts all
+// of it in database 0 when DB was not called either.
+func (b *ReportBuilder) DBMem(db int, mem int64) *ReportBuilder {
+	b.r.Summary.DBMem[db] = mem
+	return b
+}
+
+// TTL sets the keys with a TTL and those already expired; Build counts the
+// rest as without TTL.
+func (b *ReportBuilder) TTL(withTTL, expired int64) *ReportBuilder {
+	b.r.Summary.WithTTL = withTTL
+	b.r.Summary.Expired = expired
+	return b
+}
+
+// TTLBucket adds a bucket of the TTL distribution.
+func (b *ReportBuilder) TTLBucket(label string, count int64) *ReportBuilder {
+	b.r.TTLBuckets = append(b.r.TTLBuckets, report.Bucket{Label: label, Count: count})
+	return b
+}
+
+// SizeBucket adds a bucket of the key size distribution.
+func (b *ReportBuilder) SizeBucket(label string, count int64) *ReportBuilder {
+	b.r.SizeBuckets = append(b.r.SizeBuckets, report.Bucket{Label: label, Count: count})
+	return b
+}
+
+// Prefix adds a row of the prefix table.
+func (b *ReportBuilder) Prefix(prefix string, count, size int64) *ReportBuilder {
+	b.r.Prefixes = append(b.r.Prefixes, report.PrefixStat{Prefix: prefix, Count: count, Size: size})
+	return b
+}
+
+// PrefixMem sets the estimated memory of the prefix row added with Prefix.
+func (b *ReportBuilder) PrefixMem(prefix string, mem int64) *ReportBuilder {
+	for i := range b.r.Prefixes {
+		if b.r.Prefixes[i].Prefix == prefix {
+			b.r.Prefixes[i].EstimatedMem = mem
+		}
+	}
+	return b
+}
+
+// TypePrefix adds a row of the prefix table of objType.
+func (b *ReportBuilder) TypePrefix(objType, prefix string, count, size int64) *ReportBuilder {
+	for i := range b.r.PrefixesByType {
+		if b.r.PrefixesByType[i].Type == objType {
+			g := &b.r.PrefixesByType[i]
+			g.Prefixes = append(g.Prefixes, report.PrefixStat{Prefix: prefix, Count: count, Size: size})
+			return b
+		}
+	}
+	b.r.PrefixesByType = append(b.r.PrefixesByType, report.PrefixTypeGroup{
+		Type:     objType,
+		Prefixes: []report.PrefixStat{{Prefix: prefix, Count: count, Size: size}},
+	})
+	return b
+}
+
+// TypePrefixMem sets the estimated memory of the prefix row of objType added
+// with TypePrefix.
+func (b *ReportBuilder) TypePrefixMem(objType, prefix string, mem int64) *ReportBuilder {
+	for _, g := range b.r.PrefixesByType {
+		if g.Type != objType {
+			continue
+		}
+		for i := range g.Prefixes {
+			if g.Prefixes[i].Prefix == prefix {
+				g.Prefixes[i].EstimatedMem = mem
+			}
+		}
+	}
+	return b
+}
+
+// BigKey adds a big key, its EstimatedMem included.
+func (b *ReportBuilder) BigKey(bk report.BigKey) *ReportBuilder {
+	b.r.BigKeys = append(b.r.BigKeys, bk)
+	return b
+}
+
+// Build returns the report with totals filled in and lists ordered the same
+// way the analyzer orders them.
+func (b *ReportBuilder) Build() *report.Report {
+	r := b.r
+	s := &r.Summary
+	s.TotalKeys, s.TotalSize, s.TotalMem = 0, 0, 0
+	for _, t := range r.Types {
+		s.TotalKeys += t.Count
+		s.TotalSize += t.Size
+		s.TotalMem += t.EstimatedMem
+		s.TypeCounts[t.Type] = int(t.Count)
+	}
+	if len(s.DBKeys) == 0 && s.TotalKeys > 0 {
+		s.DBKeys[0] = s.TotalKeys
+		s.DBSize[0] = s.TotalSize
+		if len(s.DBMem) == 0 && s.TotalMem > 0 {
+			s.DBMem[0] = s.TotalMem
+		}
+	}
+	s.DBCount = len(s.DBKeys)
+	s.NoTTL = s.TotalKeys - s.WithTTL
+
+	if r.Types == nil {
+		r.Types = []report.TypeStat{}
+	}
+	if r.TTLBuckets == nil {
+		r.TTLBuckets = []report.Bucket{}
+	}
+	if r.SizeBuckets == nil {
+		r.SizeBuckets = []report.Bucket{}
+	}
+	if r.Prefixes == nil {
+		r.Prefixes = []report.PrefixStat{}
+	}
+	if r.PrefixesByType == nil {
+		r.PrefixesByType = []report.PrefixTypeGroup{}
+	}
+	if r.BigKeys == nil {
+		r.BigKeys = []report.BigKey{}
+	}
+
+	sort.Slice(r.Types, func(i, j int) bool { return r.Types[i].Size > r.Types[j].Size })
+	sort.Slice(r.Prefixes, func(i, j int) bool { return r.Prefixes[i].Size > r.Prefixes[j].Size })
+	for _, g := range r.PrefixesByType {
+		sort.Slice(g.Prefixes, func(i, j int) bool { return g.Prefixes[i].Size > g.Prefixes[j].Size })
+	}
+	sort.Slice(r.PrefixesByType, func(i, j int) bool { return r.PrefixesByType[i].Type < r.PrefixesByType[j].Type })
+	sort.Slice(r.BigKeys, func(i, j int) bool { return r.BigKeys[i].Size > r.BigKeys[j].Size })
+	return &r
+}
@@ -0,0 +1,56 @@
+package testkit_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"rdbviz-tool/pkg/report"
+	"rdbviz-tool/pkg/testkit"
+)
+
+// A test builds the report its code under test would read and compares it
+// with a golden file, as AssertGolden does; set RDBVIZ_UPDATE_GOLDEN=1 to
+// rewrite testdata/report.golden.json.
+func ExampleReportBuilder() {
+	r := testkit.NewReport().
+		RedisVersion("7.2.0").
+		Type("string", 10, 4096).
+		Type("hash", 2, 1024).
+		TypeMem("string", 5120).
+		TypeMem("hash", 1536).
+		DB(0, 9, 3072).
+		DBMem(0, 4352).
+		DB(1, 3, 2048).
+		DBMem(1, 2304).
+		TTL(4, 1).
+		Prefix("user", 8, 3500).
+		PrefixMem("user", 4400).
+		Prefix("cart", 2, 1024).
+		PrefixMem("cart", 1280).
+		BigKey(report.BigKey{Key: "user:1", Type: "hash", Size: 900, EstimatedMem: 1104, Encoding: "listpack", Elements: 12}).
+		Build()
+
+	got, err := testkit.Marshal(r)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	const golden = "testdata/report.golden.json"
+	if os.Getenv(testkit.UpdateGoldenEnv) != "" {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("matches golden:", bytes.Equal(got, want))
+	fmt.Println("keys:", r.Summary.TotalKeys, "dbs:", r.Summary.DBCount, "db 1 bytes:", r.Summary.DBSize[1], "memory:", r.Summary.TotalMem)
+	// Output:
+	// matches golden: true
+	// keys: 12 dbs: 2 db 1 bytes: 2048 memory: 6656
+}
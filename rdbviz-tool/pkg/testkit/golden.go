@@ -0,0 +1,74 @@
+package testkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rdbviz-tool/pkg/report"
+)
+
+// UpdateGoldenEnv, when set to a non-empty value, makes AssertGolden rewrite
+// golden files instead of comparing against them.
+const UpdateGoldenEnv = "RDBVIZ_UPDATE_GOLDEN"
+
+// Normalize clears fields that differ between runs (paths and timestamps) so
+// reports can be compared byte for byte.
+func Normalize(r *report.Report) *report.Report {
+	n := *r
+	n.Meta.Source = ""
+	n.Meta.GeneratedAt = ""
+	n.Summary.NowISO = ""
+	return &n
+}
+
+// Marshal encodes a normalized report the same way the CLI writes it.
+func Marshal(r *report.Report) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(Normalize(r)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadReport reads a report JSON file.
+func LoadReport(path string) (*report.Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r report.Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// AssertGolden compares r with the golden file at path after normalization.
+func AssertGolden(t testing.TB, path string, r *report.Report) {
+	t.Helper()
+	got, err := Marshal(r)
+	if err != nil {
+		t.Fatalf("marshal report: %v", err)
+	}
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir golden dir: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden (set %s=1 to create it): %v", UpdateGoldenEnv, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("report differs from golden %s (set %s=1 to update)\n--- got\n%s\n--- want\n%s", path, UpdateGoldenEnv, got, want)
+	}
+}
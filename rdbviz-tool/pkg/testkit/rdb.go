@@ -0,0 +1,184 @@
+package testkit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hdt3213/rdb/encoder"
+	"github.com/hdt3213/rdb/model"
+)
+
+type fixtureKey struct {
+	key   string
+	ttl   time.Time
+	write func(enc *encoder.Encoder, key string, opts ...interface{}) error
+}
+
+// RDBBuilder generates small RDB dumps in memory, so tests do not need to
+// check in binary files.
+type RDBBuilder struct {
+	aux  [][2]string
+	dbs  map[int][]fixtureKey
+	errs []error
+}
+
+// NewRDB returns a builder of an empty Redis 7.2 dump.
+func NewRDB() *RDBBuilder {
+	return &RDBBuilder{
+		aux: [][2]string{{"redis-ver", "7.2.0"}, {"redis-bits", "64"}},
+		dbs: map[int][]fixtureKey{},
+	}
+}
+
+// Aux sets an aux field, replacing a previous value for the same key.
+func (b *RDBBuilder) Aux(key, value string) *RDBBuilder {
+	for i := range b.aux {
+		if b.aux[i][0] == key {
+			b.aux[i][1] = value
+			return b
+		}
+	}
+	b.aux = append(b.aux, [2]string{key, value})
+	return b
+}
+
+func (b *RDBBuilder) add(db int, key string, ttl time.Time, write func(*encoder.Encoder, string, ...interface{}) error) *RDBBuilder {
+	b.dbs[db] = append(b.dbs[db], fixtureKey{key: key, ttl: ttl, write: write})
+	return b
+}
+
+// String adds a string without TTL.
+func (b *RDBBuilder) String(db int, key, value string) *RDBBuilder {
+	return b.StringWithTTL(db, key, value, time.Time{})
+}
+
+// StringWithTTL adds a string expiring at expireAt; a zero time means no TTL.
+func (b *RDBBuilder) StringWithTTL(db int, key, value string, expireAt time.Time) *RDBBuilder {
+	return b.add(db, key, expireAt, func(enc *encoder.Encoder, k string, opts ...interface{}) error {
+		return enc.WriteStringObject(k, []byte(value), opts...)
+	})
+}
+
+// Hash adds a hash.
+func (b *RDBBuilder) Hash(db int, key string, fields map[string]string) *RDBBuilder {
+	h := make(map[string][]byte, len(fields))
+	for f, v := range fields {
+		h[f] = []byte(v)
+	}
+	return b.add(db, key, time.Time{}, func(enc *encoder.Encoder, k string, opts ...interface{}) error {
+		return enc.WriteHashMapObject(k, h, opts...)
+	})
+}
+
+// List adds a list of values, head first.
+func (b *RDBBuilder) List(db int, key string, values ...string) *RDBBuilder {
+	vs := toBytes(values)
+	return b.add(db, key, time.Time{}, func(enc *encoder.Encoder, k string, opts ...interface{}) error {
+		return enc.WriteListObject(k, vs, opts...)
+	})
+}
+
+// Set adds a set.
+func (b *RDBBuilder) Set(db int, key string, members ...string) *RDBBuilder {
+	ms := toBytes(members)
+	return b.add(db, key, time.Time{}, func(enc *encoder.Encoder, k string, opts ...interface{}) error {
+		return enc.WriteSetObject(k, ms, opts...)
+	})
+}
+
+// ZSet adds a sorted set of members and their scores.
+func (b *RDBBuilder) ZSet(db int, key string, scores map[string]float64) *RDBBuilder {
+	entries := make([]*model.ZSetEntry, 0, len(scores))
+	for m, s := range scores {
+		entries = append(entries, &model.ZSetEntry{Member: m, Score: s})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Member < entries[j].Member })
+	return b.add(db, key, time.Time{}, func(enc *encoder.Encoder, k string, opts ...interface{}) error {
+		return enc.WriteZSetObject(k, entries, opts...)
+	})
+}
+
+// Bytes encodes the dump. Databases are written in ascending order and keys
+// in insertion order.
+func (b *RDBBuilder) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := encoder.NewEncoder(&buf)
+	if err := enc.WriteHeader(); err != nil {
+		return nil, err
+	}
+	for _, kv := range b.aux {
+		if err := enc.WriteAux(kv[0], kv[1]); err != nil {
+			return nil, err
+		}
+	}
+	dbs := make([]int, 0, len(b.dbs))
+	for db := range b.dbs {
+		dbs = append(dbs, db)
+	}
+	sort.Ints(dbs)
+	for _, db := range dbs {
+		keys := b.dbs[db]
+		ttlCount := 0
+		for _, k := range keys {
+			if !k.ttl.IsZero() {
+				ttlCount++
+			}
+		}
+		if err := enc.WriteDBHeader(uint(db), uint64(len(keys)), uint64(ttlCount)); err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			var opts []interface{}
+			if !k.ttl.IsZero() {
+				opts = append(opts, encoder.WithTTL(uint64(k.ttl.UnixMilli())))
+			}
+			if err := k.write(enc, k.key, opts...); err != nil {
+				return nil, fmt.Errorf("write %q: %w", k.key, err)
+			}
+		}
+	}
+	if err := enc.WriteEnd(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFile encodes the dump to path.
+func (b *RDBBuilder) WriteFile(path string) error {
+	data, err := b.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// SampleRDB returns a small dump covering every basic type, two databases,
+// keys with and without TTL and a few prefix levels. Expirations are relative
+// to FixedTime, so whether they are already expired depends on the clock used
+// by the analysis.
+func SampleRDB() *RDBBuilder {
+	b := NewRDB()
+	for i := 0; i < 10; i++ {
+		b.String(0, fmt.Sprintf("user:%d:profile", i), fmt.Sprintf(`{"id":%d,"name":"user-%d"}`, i, i))
+	}
+	for i := 0; i < 5; i++ {
+		b.StringWithTTL(0, fmt.Sprintf("session:%d", i), "token", FixedTime.Add(time.Duration(i+1)*time.Hour))
+	}
+	b.Hash(0, "cart:1", map[string]string{"sku:1": "2", "sku:2": "1"})
+	b.List(0, "queue:jobs", "a", "b", "c")
+	b.Set(1, "tags:all", "red", "green", "blue")
+	b.ZSet(1, "rank:daily", map[string]float64{"alice": 3, "bob": 2, "carol": 1})
+	b.String(1, "orphan", "x")
+	return b
+}
+
+func toBytes(values []string) [][]byte {
+	out := make([][]byte, len(values))
+	for i, v := range values {
+		out[i] = []byte(v)
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// profileFlags are the -pprof, -cpuprofile and -memprofile flags of the
+// commands that parse a whole dump.
+type profileFlags struct {
+	addr string
+	cpu  string
+	mem  string
+}
+
+func addProfileFlags(fs *flag.FlagSet) *profileFlags {
+	pf := &profileFlags{}
+	fs.StringVar(&pf.addr, "pprof", "", "serve net/http/pprof on this address, e.g. localhost:6060 (empty to disable)")
+	fs.StringVar(&pf.cpu, "cpuprofile", "", "write a CPU profile of the run to this file")
+	fs.StringVar(&pf.mem, "memprofile", "", "write a heap profile to this file when the run ends")
+	return pf
+}
+
+// start starts the profiling the flags ask for. The returned function stops
+// the CPU profile and writes the heap profile; call it before exiting.
+func (pf *profileFlags) start() func() {
+	if pf.addr != "" {
+		go func() {
+			slog.Info("pprof listening", "url", "http://"+pf.addr+"/debug/pprof/")
+			if err := http.ListenAndServe(pf.addr, nil); err != nil {
+				slog.Error("pprof error", "err", err)
+			}
+		}()
+	}
+	var cpu *os.File
+	if pf.cpu != "" {
+		f, err := os.Create(pf.cpu)
+		if err != nil {
+			fatal(1, "cpuprofile error", "err", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fatal(1, "cpuprofile error", "err", err)
+		}
+		cpu = f
+	}
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+			slog.Info("profile written", "path", pf.cpu)
+			cpu = nil
+		}
+		if pf.mem != "" {
+			f, err := os.Create(pf.mem)
+			if err != nil {
+				slog.Error("memprofile error", "err", err)
+				return
+			}
+			defer f.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				slog.Error("memprofile error", "err", err)
+				return
+			}
+			slog.Info("profile written", "path", pf.mem)
+		}
+	}
+}
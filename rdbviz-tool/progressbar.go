@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+const (
+	progressBarCells = 30
+	// progressBarEvery is how often the bar is redrawn unless -progress is
+	// given; the 5s of the log lines is too slow for a bar.
+	progressBarEvery = 500 * time.Millisecond
+)
+
+// progressBar redraws the progress of an analysis in place on a terminal:
+// percent, throughput, keys/s and ETA. A new line is started for each stage.
+type progressBar struct {
+	w     *os.File
+	stage string
+	width int // of the last line drawn, blanked by the next
+}
+
+func (b *progressBar) update(p rdbviz.Progress) {
+	if b.stage != "" && p.Stage != b.stage {
+		fmt.Fprintln(b.w)
+		b.width = 0
+	}
+	b.stage = p.Stage
+
+	var line strings.Builder
+	line.WriteString(p.Stage)
+	if p.TotalBytes > 0 {
+		filled := min(int(p.Percent()/100*progressBarCells), progressBarCells)
+		fmt.Fprintf(&line, " [%s%s] %5.1f%%  %s / %s", strings.Repeat("=", filled), strings.Repeat(" ", progressBarCells-filled),
+			p.Percent(), rdbviz.FormatBytes(p.BytesRead), rdbviz.FormatBytes(p.TotalBytes))
+	} else if p.Stage != rdbviz.StageScan {
+		fmt.Fprintf(&line, "  %s", rdbviz.FormatBytes(p.BytesRead))
+	}
+	fmt.Fprintf(&line, "  %d keys", p.Keys)
+	if secs := p.Elapsed.Seconds(); secs > 0 {
+		if p.Stage != rdbviz.StageScan {
+			fmt.Fprintf(&line, "  %s/s", rdbviz.FormatBytes(int64(float64(p.BytesRead)/secs)))
+		}
+		fmt.Fprintf(&line, "  %.0f keys/s", float64(p.Keys)/secs)
+	}
+	if d := p.ETA.Round(time.Second); d > 0 {
+		fmt.Fprintf(&line, "  ETA %s", d)
+	}
+	s := line.String()
+	fmt.Fprintf(b.w, "\r%s%s", s, strings.Repeat(" ", max(b.width-len(s), 0)))
+	b.width = len(s)
+}
+
+// finish ends the line of the bar, if one was drawn.
+func (b *progressBar) finish() {
+	if b.stage != "" {
+		fmt.Fprintln(b.w)
+		b.stage, b.width = "", 0
+	}
+}
+
+// progressEvent is one -progress-format json line.
+type progressEvent struct {
+	Event      string  `json:"event"`
+	Stage      string  `json:"stage"`
+	DB         int     `json:"db"`
+	Keys       int64   `json:"keys"`
+	Bytes      int64   `json:"bytes"`
+	TotalBytes int64   `json:"total_bytes,omitempty"`
+	Percent    float64 `json:"percent,omitempty"`
+	Elapsed    float64 `json:"elapsed_seconds"`
+	ETA        float64 `json:"eta_seconds,omitempty"`
+}
+
+func newProgressEvent(p rdbviz.Progress) progressEvent {
+	return progressEvent{
+		Event:      "progress",
+		Stage:      p.Stage,
+		DB:         p.DB,
+		Keys:       p.Keys,
+		Bytes:      p.BytesRead,
+		TotalBytes: p.TotalBytes,
+		Percent:    math.Round(p.Percent()*10) / 10,
+		Elapsed:    math.Round(p.Elapsed.Seconds()*1000) / 1000,
+		ETA:        math.Round(p.ETA.Seconds()),
+	}
+}
+
+// jsonProgress writes each progress tick as one JSON object on stderr, for
+// wrappers that show progress in their own UI.
+func jsonProgress(p rdbviz.Progress) {
+	json.NewEncoder(os.Stderr).Encode(newProgressEvent(p))
+}
+
+// setupProgress installs the -progress-format display on opts and returns
+// the function ending it, to call before anything else is logged. auto draws
+// a bar when stderr is a terminal and logs are text, and logs progress lines
+// otherwise; below info level only json progress is shown.
+func setupProgress(format string, fs *flag.FlagSet, lf *logFlags, opts *rdbviz.Options) func() {
+	if format != "json" && !slog.Default().Enabled(context.Background(), slog.LevelInfo) {
+		// -quiet or a higher -log-level
+		return func() {}
+	}
+	switch format {
+	case "log":
+		opts.OnProgress = logProgress
+		return func() {}
+	case "json":
+		opts.OnProgress = jsonProgress
+		return func() {}
+	case "auto":
+		if !isTerminal(os.Stderr) || lf.format != "text" {
+			opts.OnProgress = logProgress
+			return func() {}
+		}
+	case "bar":
+	default:
+		fatal(2, "-progress-format must be auto, bar, log or json", "got", format)
+	}
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "progress"
+	})
+	if !explicit {
+		opts.Progress = progressBarEvery
+	}
+	bar := &progressBar{w: os.Stderr}
+	opts.OnProgress = bar.update
+	return bar.finish
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// publishWriter returns the writer of -publish target, with the
+// credentials and endpoint of the standard AWS_* variables for s3://, and
+// GOOGLE_OAUTH_ACCESS_TOKEN and STORAGE_EMULATOR_HOST for gs://.
+func publishWriter(target string) rdbviz.PublishWriter {
+	pw := rdbviz.PublishWriter{URL: target}
+	if strings.HasPrefix(target, "gs://") {
+		pw.Token = os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+		pw.Endpoint = os.Getenv("STORAGE_EMULATOR_HOST")
+		return pw
+	}
+	pw.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	pw.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	pw.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	pw.Region = os.Getenv("AWS_REGION")
+	if pw.Region == "" {
+		pw.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	pw.Endpoint = os.Getenv("AWS_ENDPOINT_URL_S3")
+	if pw.Endpoint == "" {
+		pw.Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	return pw
+}
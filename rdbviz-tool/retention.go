@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// retention bounds what serve keeps: the newest keepRuns reports of each
+// instance and shard, and none older than keepAge; 0 lifts either bound.
+type retention struct {
+	keepRuns int
+	keepAge  time.Duration
+}
+
+func (rt retention) enabled() bool {
+	return rt.keepRuns > 0 || rt.keepAge > 0
+}
+
+// retained is a report as seen by the retention: its instance and shard,
+// and when it was made.
+type retained struct {
+	group string
+	time  time.Time
+}
+
+// pruned returns the indexes of the items past the retention.
+func (rt retention) pruned(items []retained, now time.Time) []int {
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return items[order[a]].time.After(items[order[b]].time) })
+	kept := map[string]int{}
+	var out []int
+	for _, i := range order {
+		it := items[i]
+		if (rt.keepAge > 0 && now.Sub(it.time) > rt.keepAge) || (rt.keepRuns > 0 && kept[it.group] >= rt.keepRuns) {
+			out = append(out, i)
+			continue
+		}
+		kept[it.group]++
+	}
+	return out
+}
+
+// prune deletes the runs past rt with their reports. The file does not
+// shrink: bbolt reuses the freed pages for the next runs.
+func (h *historyStore) prune(rt retention, now time.Time) (int, error) {
+	runs, err := h.runs("", "")
+	if err != nil {
+		return 0, err
+	}
+	items := make([]retained, len(runs))
+	for i, run := range runs {
+		items[i] = retained{group: run.Instance + "\x00" + run.Shard, time: run.Time}
+	}
+	drop := rt.pruned(items, now)
+	if len(drop) == 0 {
+		return 0, nil
+	}
+	err = h.db.Update(func(tx *bolt.Tx) error {
+		for _, i := range drop {
+			id := []byte(runs[i].ID)
+			if err := tx.Bucket(historyRuns).Delete(id); err != nil {
+				return err
+			}
+			if err := tx.Bucket(historyReports).Delete(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(drop), nil
+}
+
+// prune deletes the report files past rt, by modification time; reports
+// without an instance form one group.
+func (d *reportDir) prune(rt retention, now time.Time) (int, error) {
+	list, err := d.list()
+	if err != nil {
+		return 0, err
+	}
+	items := make([]retained, len(list))
+	for i, e := range list {
+		items[i] = retained{group: e.Instance + "\x00" + e.Shard, time: e.Modified}
+	}
+	n := 0
+	var errs []error
+	for _, i := range rt.pruned(items, now) {
+		if err := os.Remove(filepath.Join(d.dir, list[i].ID+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+// pruneLoop applies rt to the reports directory and the history, if set,
+// now and then every interval.
+func pruneLoop(rt retention, interval time.Duration, reports *reportDir, history *historyStore) {
+	for {
+		now := time.Now()
+		if reports != nil {
+			n, err := reports.prune(rt, now)
+			if err != nil {
+				slog.Error("pruning -reports", "err", err)
+			}
+			if n > 0 {
+				slog.Info("pruned reports", "dir", reports.dir, "removed", n)
+			}
+		}
+		if history != nil {
+			n, err := history.prune(rt, now)
+			if err != nil {
+				slog.Error("pruning -history", "err", err)
+			}
+			if n > 0 {
+				slog.Info("pruned history", "removed", n)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+// peakRSS is 0 where getrusage is not available.
+func peakRSS() int64 { return 0 }
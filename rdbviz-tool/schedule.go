@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// cronSchedule is a five-field cron expression: minute, hour, day of month,
+// month and day of week, each a set of allowed values as a bitmask. As in
+// cron, when both days are restricted a time matching either runs.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// parseCron parses fields such as "0 3 * * *", "*/15 8-18 * * 1-5" or an
+// @hourly, @daily, @weekly or @monthly alias.
+func parseCron(expr string) (cronSchedule, error) {
+	if alias, ok := cronAliases[expr]; ok {
+		expr = alias
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("cron expression %q: want 5 fields, got %d", expr, len(fields))
+	}
+	var c cronSchedule
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := [5]*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, f := range fields {
+		set, err := parseCronField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("cron expression %q: %v", expr, err)
+		}
+		*sets[i] = set
+	}
+	// 7 is Sunday too
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny, c.dowAny = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+// parseCronField parses a comma-separated list of *, n, a-b, each with an
+// optional /step.
+func parseCronField(f string, lo, hi int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("bad range in %q", part)
+				}
+			} else if hasStep {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (c cronSchedule) matches(t time.Time) bool {
+	if c.minute&(1<<t.Minute()) == 0 || c.hour&(1<<t.Hour()) == 0 || c.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// next returns the first minute after t matching c, or the zero time if
+// none does within five years (e.g. "0 0 31 2 *").
+func (c cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for ; t.Before(end); t = t.Add(time.Minute) {
+		if c.month&(1<<int(t.Month())) == 0 {
+			// skip to the first minute of the next month
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+			continue
+		}
+		if c.matches(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// scheduleEntry is one line of a -schedule file:
+//
+//	# minute hour day month weekday  instance[/shard]  source
+//	0 3 * * *     order-cache/0   /backups/order-cache-0/latest.rdb
+//	@daily        session         https://backups.internal/session/latest.rdb
+//	30 */6 * * *  feed            exec:aws s3 cp s3://backups/feed/latest.rdb -
+//
+// The source is the rest of the line, a dump source as read by fetchDump;
+// exec: covers object storage through its CLI.
+type scheduleEntry struct {
+	line     int
+	spec     string
+	cron     cronSchedule
+	instance string
+	shard    string
+	source   string
+}
+
+func loadSchedule(path string) ([]scheduleEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []scheduleEntry
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		specFields := 5
+		if strings.HasPrefix(fields[0], "@") {
+			specFields = 1
+		}
+		if len(fields) < specFields+2 {
+			return nil, fmt.Errorf("%s:%d: want a schedule, an instance and a source", path, n)
+		}
+		e := scheduleEntry{line: n, spec: strings.Join(fields[:specFields], " ")}
+		if e.cron, err = parseCron(e.spec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		e.instance, e.shard, _ = strings.Cut(fields[specFields], "/")
+		// the source is the rest of the line, spaces included
+		rest := line
+		for i := 0; i <= specFields; i++ {
+			rest = strings.TrimSpace(rest)
+			rest = rest[strings.IndexAny(rest, " \t"):]
+		}
+		e.source = strings.TrimSpace(rest)
+		if !validReportID(e.instance) || (e.shard != "" && !validReportID(e.shard)) {
+			return nil, fmt.Errorf("%s:%d: instance %q is not a valid name", path, n, fields[specFields])
+		}
+		if e.cron.next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("%s:%d: %q never runs", path, n, e.spec)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// schedule runs e through jr at every time of its schedule. A run is skipped
+// when the previous one of e has not finished.
+func (jr *jobRunner) schedule(e scheduleEntry) {
+	log := slog.Default().With("schedule", e.instance, "line", e.line)
+	var last *job
+	for {
+		at := e.cron.next(time.Now())
+		log.Debug("next scheduled run", "at", at)
+		time.Sleep(time.Until(at))
+		if last != nil {
+			if s := jr.snapshot(last); s.Status != jobDone && s.Status != jobFailed {
+				log.Warn("skipping scheduled run, the previous one is still going", "job", last.ID)
+				continue
+			}
+		}
+		j, err := jr.scheduledJob(e, at)
+		if err != nil {
+			log.Error("scheduled run not started", "err", err)
+			continue
+		}
+		log.Info("scheduled run", "job", j.ID, "source", j.Source)
+		last = j
+		go jr.run(j)
+	}
+}
+
+func (jr *jobRunner) scheduledJob(e scheduleEntry, at time.Time) (*job, error) {
+	opts := rdbviz.DefaultOptions()
+	opts.Instance, opts.Shard = e.instance, e.shard
+	id := e.instance
+	if e.shard != "" {
+		id += "-" + e.shard
+	}
+	j := &job{
+		ID:        id + "-" + at.Format("20060102-1504"),
+		Status:    jobQueued,
+		Source:    displaySource(e.source),
+		Created:   time.Now(),
+		fetch:     e.source,
+		opts:      opts,
+		scheduled: true,
+	}
+	return j, jr.reserve(j)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rdbviz-tool/web"
+)
+
+// runServe is the serve subcommand: it serves the rdbviz page, embedded in
+// the binary unless -dir points at a copy, over the reports of a directory
+// or a single report file.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	lf := addLogFlags(fs)
+	af := addAuthFlags(fs)
+	of := addOTLPFlags(fs)
+	cf := addCompletionFlags(fs)
+	gf := addGrafanaFlags(fs)
+	addr := fs.String("addr", "localhost:8080", "listen address")
+	dir := fs.String("dir", "", "directory of the rdbviz page (default the page embedded in the binary)")
+	reportPath := fs.String("report", "", "report served as data/report.json")
+	reportsDir := fs.String("reports", "", "directory of report .json files listed by the page (empty to disable)")
+	publicURL := fs.String("public-url", "", "-notify-url: base URL clients reach the server at, for the report links (default from -addr)")
+	grpcAddr := fs.String("grpc", "", "listen address of the gRPC AnalysisService of pkg/rdbvizpb, e.g. localhost:9090 (needs -reports; empty to disable)")
+	jobs := fs.Int("jobs", 1, "analyses posted to /api/analyze run at a time")
+	allowHosts := fs.String("allow-url-hosts", "", "comma-separated hosts dumps posted to /api/analyze or gRPC may be fetched from, e.g. *.s3.amazonaws.com,minio.internal (default any host at a public address)")
+	var maxUpload int64
+	fs.Var(byteSize{&maxUpload}, "max-upload", "largest dump accepted by /api/analyze, e.g. 20GB (0 for no limit)")
+	uploadDir := fs.String("upload-dir", "", "directory holding dumps posted to /api/analyze while they are analyzed (default the system temp directory)")
+	historyPath := fs.String("history", "", "bbolt file storing reports by instance and shard, browsed and compared under /api/history (empty to disable)")
+	schedulePath := fs.String("schedule", "", "file of cron schedules of dumps to analyze into -reports and -history, see doc/USAGE.md")
+	var rt retention
+	fs.IntVar(&rt.keepRuns, "keep-runs", 0, "reports kept per instance and shard in -reports and -history, the newest (0 for all)")
+	keepDays := fs.Int("keep-days", 0, "days reports are kept in -reports and -history (0 for no limit)")
+	pruneEvery := fs.Duration("prune-every", time.Hour, "how often -keep-runs and -keep-days are applied")
+	fs.Parse(args)
+	lf.setup()
+	if err := gf.setup(); err != nil {
+		fatal(2, "grafana error", "err", err)
+	}
+	scheme := "http"
+	if af.tlsCert != "" {
+		scheme = "https"
+	}
+
+	page := web.FS()
+	if *dir != "" {
+		if _, err := os.Stat(filepath.Join(*dir, "index.html")); err != nil {
+			fatal(2, "no rdbviz page, set -dir", "dir", *dir, "err", err)
+		}
+		page = os.DirFS(*dir)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(page)))
+	if *reportPath != "" {
+		if _, err := os.Stat(*reportPath); err != nil {
+			fatal(2, "report error", "err", err)
+		}
+		mux.HandleFunc("/data/report.json", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, *reportPath)
+		})
+	}
+	var history *historyStore
+	if *historyPath != "" {
+		var err error
+		if history, err = openHistory(*historyPath); err != nil {
+			fatal(2, "history error", "path", *historyPath, "err", err)
+		}
+		history.register(mux)
+	}
+	var reports *reportDir
+	var runner *jobRunner
+	if *reportsDir != "" {
+		if st, err := os.Stat(*reportsDir); err != nil || !st.IsDir() {
+			fatal(2, "-reports must be a directory", "dir", *reportsDir, "err", err)
+		}
+		reports = &reportDir{dir: *reportsDir, cache: map[string]reportEntry{}}
+		mux.HandleFunc("GET /api/reports", reports.handleList)
+		mux.HandleFunc("GET /api/reports/{id}", reports.handleReport)
+		reports.registerAPI(mux)
+		if *jobs < 1 {
+			fatal(2, "-jobs must be at least 1", "got", *jobs)
+		}
+		runner = newJobRunner(reports, history, *uploadDir, maxUpload, *jobs, newURLGuard(*allowHosts))
+		otlp, err := of.writer()
+		if err != nil {
+			fatal(2, "otlp error", "err", err)
+		}
+		runner.otlp = otlp
+		runner.completion = cf
+		runner.grafana = gf
+		runner.publicURL = strings.TrimSuffix(*publicURL, "/")
+		if runner.publicURL == "" {
+			runner.publicURL = scheme + "://" + *addr
+		}
+		runner.register(mux)
+		if *schedulePath != "" {
+			entries, err := loadSchedule(*schedulePath)
+			if err != nil {
+				fatal(2, "schedule error", "err", err)
+			}
+			for _, e := range entries {
+				go runner.schedule(e)
+			}
+			slog.Info("scheduled runs loaded", "file", *schedulePath, "entries", len(entries))
+		}
+	} else if *schedulePath != "" {
+		fatal(2, "-schedule needs -reports")
+	} else if of.endpoint != "" {
+		fatal(2, "-otlp needs -reports")
+	} else if *grpcAddr != "" {
+		fatal(2, "-grpc needs -reports")
+	} else if cf.url != "" {
+		fatal(2, "-notify-url needs -reports")
+	} else if gf.url != "" {
+		fatal(2, "-grafana needs -reports")
+	}
+	rt.keepAge = time.Duration(*keepDays) * 24 * time.Hour
+	switch {
+	case rt.keepRuns < 0 || *keepDays < 0:
+		fatal(2, "-keep-runs and -keep-days must not be negative")
+	case rt.enabled() && *pruneEvery <= 0:
+		fatal(2, "-prune-every must be positive")
+	case rt.enabled() && reports == nil && history == nil:
+		fatal(2, "-keep-runs and -keep-days need -reports or -history")
+	case rt.enabled():
+		go pruneLoop(rt, *pruneEvery, reports, history)
+	}
+	auth, err := af.authenticator()
+	if err != nil {
+		fatal(2, "auth error", "err", err)
+	}
+	tlsConfig, err := af.tlsConfig()
+	if err != nil {
+		fatal(2, "tls error", "err", err)
+	}
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			fatal(1, "grpc listen error", "err", err)
+		}
+		if !auth.enabled() && tlsConfig == nil && !isLoopback(*grpcAddr) {
+			slog.Warn("serving gRPC without authentication, see -token-file, -basic-auth-file and -tls-client-ca", "addr", *grpcAddr)
+		}
+		go func() {
+			if err := serveGRPC(lis, runner, auth, af, tlsConfig); err != nil {
+				fatal(1, "grpc serve error", "err", err)
+			}
+		}()
+		slog.Info("serving gRPC", "addr", *grpcAddr, "tls", af.tlsCert != "")
+	}
+	var handler http.Handler = mux
+	if auth.enabled() {
+		handler = auth.wrap(mux)
+	} else if tlsConfig == nil && !isLoopback(*addr) {
+		slog.Warn("serving reports without authentication, see -token-file, -basic-auth-file and -tls-client-ca", "addr", *addr)
+	}
+	srv := &http.Server{Addr: *addr, Handler: handler, TLSConfig: tlsConfig}
+	slog.Info("serving", "dir", *dir, "reports", *reportsDir, "history", *historyPath, "url", scheme+"://"+*addr,
+		"auth", auth.enabled(), "mtls", tlsConfig != nil)
+	if af.tlsCert != "" {
+		err = srv.ListenAndServeTLS(af.tlsCert, af.tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
+		fatal(1, "serve error", "err", err)
+	}
+}
+
+// reportDir lists the reports of a directory, keeping the meta and summary
+// of each file until it changes so a listing does not reparse every report,
+// and serves their parts through the API of api.go.
+type reportDir struct {
+	dir    string
+	mu     sync.Mutex
+	cache  map[string]reportEntry
+	loaded *loadedReport
+}
+
+// reportEntry is a report of the list; ID is its file name without .json.
+type reportEntry struct {
+	ID          string    `json:"id"`
+	Size        int64     `json:"size"`
+	Modified    time.Time `json:"modified"`
+	Source      string    `json:"source"`
+	Instance    string    `json:"instance,omitempty"`
+	Shard       string    `json:"shard,omitempty"`
+	GeneratedAt string    `json:"generated_at"`
+	TotalKeys   int64     `json:"total_keys"`
+	TotalMem    int64     `json:"estimated_mem"`
+}
+
+// list returns the reports newest first. Files that are not reports are
+// skipped.
+func (d *reportDir) list() ([]reportEntry, error) {
+	files, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := []reportEntry{}
+	seen := map[string]bool{}
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok || f.IsDir() || !validReportID(id) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		seen[id] = true
+		e, ok := d.cache[id]
+		if !ok || e.Size != info.Size() || !e.Modified.Equal(info.ModTime()) {
+			e, err = readReportEntry(filepath.Join(d.dir, f.Name()))
+			if err != nil {
+				slog.Debug("skipping file in -reports", "file", f.Name(), "err", err)
+				continue
+			}
+			e.ID, e.Size, e.Modified = id, info.Size(), info.ModTime()
+			d.cache[id] = e
+		}
+		list = append(list, e)
+	}
+	for id := range d.cache {
+		if !seen[id] {
+			delete(d.cache, id)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Modified.After(list[j].Modified) })
+	return list, nil
+}
+
+// path returns the file of report id, if there is one.
+func (d *reportDir) path(id string) (string, bool) {
+	if !validReportID(id) {
+		return "", false
+	}
+	p := filepath.Join(d.dir, id+".json")
+	st, err := os.Stat(p)
+	return p, err == nil && st.Mode().IsRegular()
+}
+
+// validReportID keeps report IDs to plain file names inside the directory.
+func validReportID(id string) bool {
+	return id != "" && !strings.HasPrefix(id, ".") && !strings.ContainsAny(id, `/\`) && fs.ValidPath(id)
+}
+
+var errNotReport = errors.New("not a report: no summary")
+
+func readReportEntry(path string) (reportEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return reportEntry{}, err
+	}
+	defer f.Close()
+	var head struct {
+		Meta struct {
+			Source      string `json:"source"`
+			Instance    string `json:"instance"`
+			Shard       string `json:"shard"`
+			GeneratedAt string `json:"generated_at"`
+		} `json:"meta"`
+		Summary *struct {
+			TotalKeys int64 `json:"total_keys"`
+			TotalMem  int64 `json:"estimated_mem"`
+		} `json:"summary"`
+	}
+	if err := json.NewDecoder(f).Decode(&head); err != nil {
+		return reportEntry{}, err
+	}
+	if head.Summary == nil {
+		return reportEntry{}, errNotReport
+	}
+	return reportEntry{
+		Source:      head.Meta.Source,
+		Instance:    head.Meta.Instance,
+		Shard:       head.Meta.Shard,
+		GeneratedAt: head.Meta.GeneratedAt,
+		TotalKeys:   head.Summary.TotalKeys,
+		TotalMem:    head.Summary.TotalMem,
+	}, nil
+}
+
+func (d *reportDir) handleList(w http.ResponseWriter, r *http.Request) {
+	list, err := d.list()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, list)
+}
+
+func (d *reportDir) handleReport(w http.ResponseWriter, r *http.Request) {
+	p, ok := d.path(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeFile(w, r, p)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Debug("write response", "err", err)
+	}
+}
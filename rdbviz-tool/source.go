@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// A dump source is a path, read in place; an http or https URL, e.g. a
+// presigned object storage URL; or exec: and a shell command writing the
+// dump to its standard output, e.g. "exec:aws s3 cp s3://backups/latest.rdb -"
+// or, for a live instance, "exec:redis-cli -h cache-1 --rdb /dev/stdout".
+
+// remoteSource tells whether source has to be copied to a local file first.
+func remoteSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "exec:")
+}
+
+// displaySource is source without the query of a URL, which for presigned
+// URLs carries credentials.
+func displaySource(source string) string {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		if i := strings.IndexByte(source, '?'); i >= 0 {
+			return source[:i]
+		}
+	}
+	return source
+}
+
+// fetchDump returns the path of the dump of source, copying a remote one to
+// a temporary file in dir, at most maxSize bytes when positive. cleanup
+// removes that file.
+func fetchDump(ctx context.Context, client *http.Client, source, dir string, maxSize int64) (path string, cleanup func(), err error) {
+	if !remoteSource(source) {
+		return source, func() {}, nil
+	}
+	f, err := os.CreateTemp(dir, "rdbviz-*.rdb")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.Remove(f.Name()) }
+	if command, ok := strings.CutPrefix(source, "exec:"); ok {
+		err = commandDump(ctx, strings.TrimSpace(command), f, maxSize)
+	} else {
+		err = downloadDump(ctx, client, source, f, maxSize)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return f.Name(), cleanup, nil
+}
+
+// copyDump copies r to w, failing past maxSize bytes when positive.
+func copyDump(w io.Writer, r io.Reader, maxSize int64) error {
+	if maxSize <= 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	n, err := io.Copy(w, io.LimitReader(r, maxSize+1))
+	if err == nil && n > maxSize {
+		err = fmt.Errorf("dump larger than %s", rdbviz.FormatBytes(maxSize))
+	}
+	return err
+}
+
+func downloadDump(ctx context.Context, client *http.Client, url string, w io.Writer, maxSize int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", displaySource(url), res.Status)
+	}
+	return copyDump(w, res.Body, maxSize)
+}
+
+func commandDump(ctx context.Context, command string, w io.Writer, maxSize int64) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	copyErr := copyDump(w, out, maxSize)
+	if copyErr != nil {
+		// nothing reads the output any more
+		cmd.Process.Kill()
+	}
+	if err := cmd.Wait(); err != nil && copyErr == nil {
+		return fmt.Errorf("%s: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return copyErr
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// urlGuard limits the dumps clients of /api/analyze and gRPC can have the
+// server fetch, so they cannot reach its internal network or the cloud
+// metadata server. Without allowed hosts any host is accepted but only
+// public addresses are dialed; with them, only those hosts, at any address,
+// since the operator named them.
+type urlGuard struct {
+	// hosts are exact host names or IPs, or *.domain for its subdomains
+	hosts []string
+}
+
+func newURLGuard(hosts string) *urlGuard {
+	g := &urlGuard{}
+	for _, h := range strings.Split(hosts, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			g.hosts = append(g.hosts, h)
+		}
+	}
+	return g
+}
+
+// allowedHost tells whether host is one of the allowed hosts; false when
+// there are none.
+func (g *urlGuard) allowedHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range g.hosts {
+		if domain, ok := strings.CutPrefix(h, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// check tells why s is not a URL a client may have a dump fetched from:
+// paths and exec: commands are for the operator's schedules only.
+func (g *urlGuard) check(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	if len(g.hosts) > 0 && !g.allowedHost(u.Hostname()) {
+		return fmt.Errorf("url host %q is not in -allow-url-hosts", u.Hostname())
+	}
+	return nil
+}
+
+// client returns an HTTP client that dials only what check accepts, each
+// redirect included. A proxy would dial the dump's host itself, past the
+// guard, so none is used.
+func (g *urlGuard) client() *http.Client {
+	public := &net.Dialer{Control: publicAddrOnly}
+	open := &net.Dialer{}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if len(g.hosts) == 0 {
+			return public.DialContext(ctx, network, addr)
+		}
+		if !g.allowedHost(host) {
+			return nil, fmt.Errorf("host %q is not in -allow-url-hosts", host)
+		}
+		return open.DialContext(ctx, network, addr)
+	}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %s URL", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// publicAddrOnly refuses to connect to loopback, private, link-local,
+// unspecified and multicast addresses, after name resolution.
+func publicAddrOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("dial %s: not an IP address", address)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddrSpace.Contains(ip) {
+		return fmt.Errorf("dial %s: address not allowed, see -allow-url-hosts", address)
+	}
+	return nil
+}
+
+// sharedAddrSpace is the carrier-grade NAT range of RFC 6598, which
+// net.IP.IsPrivate leaves out.
+var sharedAddrSpace = &net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}
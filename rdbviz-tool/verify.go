@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/hdt3213/rdb/crc64jones"
+	"github.com/hdt3213/rdb/parser"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+// rdbChecksumVersion is the first RDB version with a CRC64 trailer.
+const rdbChecksumVersion = 5
+
+// runVerify is the verify subcommand: it checks the CRC64 trailer of a dump
+// and decodes every record, so a truncated or corrupted backup is caught
+// before it is restored or analyzed.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	lf := addLogFlags(fs)
+	rdbPath := fs.String("rdb", "", "path to dump.rdb")
+	fs.Parse(args)
+	lf.setup()
+
+	if *rdbPath == "" {
+		fmt.Println("usage: rdbviz-tool verify -rdb dump.rdb")
+		os.Exit(2)
+	}
+
+	ok := true
+	version, stored, computed, err := rdbChecksum(*rdbPath)
+	switch {
+	case err != nil:
+		fmt.Printf("checksum: %v\n", err)
+		ok = false
+	case version < rdbChecksumVersion:
+		fmt.Printf("checksum: RDB version %d has no checksum\n", version)
+	case stored == 0:
+		fmt.Println("checksum: not written (rdbchecksum no)")
+	case stored != computed:
+		fmt.Printf("checksum: MISMATCH, stored %016x, computed %016x\n", stored, computed)
+		ok = false
+	default:
+		fmt.Printf("checksum: ok (%016x)\n", stored)
+	}
+
+	keys, size, lastKey, err := decodeAll(*rdbPath)
+	if err != nil {
+		fmt.Printf("records: decode error after %d keys: %v\n", keys, err)
+		if lastKey != "" {
+			fmt.Printf("last good key: %s\n", redisQuote(lastKey))
+		}
+		ok = false
+	} else {
+		fmt.Printf("records: ok, %d keys (%s)\n", keys, rdbviz.FormatBytes(size))
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// rdbChecksum reads the RDB version from the header and returns the CRC64
+// stored in the last 8 bytes along with the one computed over the rest.
+func rdbChecksum(path string) (version int, stored, computed uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if stat.Size() < 9+8 {
+		return 0, 0, 0, errors.New("file too short for an RDB")
+	}
+
+	r := bufio.NewReader(f)
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, 0, err
+	}
+	if string(header[:5]) != "REDIS" {
+		return 0, 0, 0, errors.New("not an RDB file")
+	}
+	version, err = strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("bad RDB version %q", header[5:])
+	}
+
+	h := crc64jones.New()
+	h.Write(header)
+	if _, err := io.CopyN(h, r, stat.Size()-8-int64(len(header))); err != nil {
+		return 0, 0, 0, err
+	}
+	trailer := make([]byte, 8)
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		return 0, 0, 0, err
+	}
+	return version, binary.LittleEndian.Uint64(trailer), h.Sum64(), nil
+}
+
+// decodeAll parses every record of the dump and returns how many keys
+// decoded, their total size and the last key that decoded.
+func decodeAll(path string) (keys, size int64, lastKey string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	defer f.Close()
+	err = parser.NewDecoder(bufio.NewReader(f)).Parse(func(o parser.RedisObject) bool {
+		if key := o.GetKey(); key != "" {
+			keys++
+			size += int64(o.GetSize())
+			lastKey = key
+		}
+		return true
+	})
+	return keys, size, lastKey, err
+}
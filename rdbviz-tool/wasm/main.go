@@ -0,0 +1,94 @@
+//go:build js && wasm
+
+// Command wasm is the analyzer compiled to WebAssembly for the rdbviz page,
+// so a dump can be analyzed in the browser without leaving the machine:
+//
+//	GOOS=js GOARCH=wasm go build -o ../rdbviz/rdbviz.wasm ./wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" ../rdbviz/
+//
+// It defines one global function,
+//
+//	rdbvizAnalyze(dump: Uint8Array, options: string, onProgress?: (p) => void): Promise<string>
+//
+// where options is a JSON object of rdbviz.Options fields applied over the
+// defaults, e.g. {"PrefixSep": "|", "TopN": 100}, and the promise resolves
+// to the report JSON. The page calls it through rdbviz.js in a Web Worker.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"syscall/js"
+	"time"
+
+	"rdbviz-tool/pkg/rdbviz"
+)
+
+func main() {
+	js.Global().Set("rdbvizAnalyze", js.FuncOf(analyze))
+	select {}
+}
+
+func analyze(this js.Value, args []js.Value) any {
+	promise := js.Global().Get("Promise")
+	handler := js.FuncOf(func(this js.Value, p []js.Value) any {
+		resolve, reject := p[0], p[1]
+		go func() {
+			out, err := run(args)
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(out)
+		}()
+		return nil
+	})
+	defer handler.Release()
+	return promise.New(handler)
+}
+
+func run(args []js.Value) (string, error) {
+	if len(args) == 0 || args[0].Type() != js.TypeObject {
+		return "", errors.New("rdbvizAnalyze: want the dump as a Uint8Array")
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+
+	opts := rdbviz.DefaultOptions()
+	opts.Progress = 0
+	if len(args) > 1 && args[1].Type() == js.TypeString && args[1].String() != "" {
+		if err := json.Unmarshal([]byte(args[1].String()), &opts); err != nil {
+			return "", err
+		}
+	}
+	if len(args) > 2 && args[2].Type() == js.TypeFunction {
+		onProgress := args[2]
+		if opts.Progress <= 0 {
+			opts.Progress = 500 * time.Millisecond
+		}
+		opts.OnProgress = func(p rdbviz.Progress) {
+			onProgress.Invoke(map[string]any{
+				"stage":       p.Stage,
+				"db":          p.DB,
+				"keys":        p.Keys,
+				"bytes_read":  p.BytesRead,
+				"total_bytes": p.TotalBytes,
+				"percent":     p.Percent(),
+				"elapsed_ms":  p.Elapsed.Milliseconds(),
+				"eta_ms":      p.ETA.Milliseconds(),
+			})
+		}
+	}
+
+	rep, err := rdbviz.Analyze(context.Background(), bytes.NewReader(data), opts, nil)
+	if err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(rep)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
@@ -0,0 +1,38 @@
+// rdbviz.js analyzes a dump.rdb in the browser with the WebAssembly build
+// of rdbviz-tool; the dump never leaves the machine.
+//
+//   const report = await RDBViz.analyze(file, { TopN: 100 }, (p) => console.log(p.percent));
+//
+// file is a File, Blob or ArrayBuffer; options are rdbviz.Options fields
+// applied over the defaults. Each call runs in its own Web Worker, which
+// needs rdbviz.wasm and wasm_exec.js next to this script.
+const RDBViz = (() => {
+  const workerURL = new URL("./worker.js", document.currentScript ? document.currentScript.src : location.href);
+
+  async function analyze(file, options, onProgress) {
+    const dump = file instanceof ArrayBuffer ? file : await file.arrayBuffer();
+    return new Promise((resolve, reject) => {
+      const worker = new Worker(workerURL);
+      worker.onmessage = (e) => {
+        const msg = e.data;
+        if (msg.type === "progress") {
+          if (onProgress) onProgress(msg.progress);
+          return;
+        }
+        worker.terminate();
+        if (msg.type === "report") {
+          resolve(msg.report);
+        } else {
+          reject(new Error(msg.error));
+        }
+      };
+      worker.onerror = (e) => {
+        worker.terminate();
+        reject(new Error(e.message || "worker error"));
+      };
+      worker.postMessage({ dump, options: options || {} }, [dump]);
+    });
+  }
+
+  return { analyze };
+})();
@@ -0,0 +1,25 @@
+// Web Worker running the analyzer compiled to WebAssembly, so the page
+// stays responsive while a dump is parsed. Started by rdbviz.js.
+importScripts("./wasm_exec.js");
+
+const ready = (async () => {
+  const go = new Go();
+  const res = await fetch("./rdbviz.wasm");
+  if (!res.ok) {
+    throw new Error("未找到 rdbviz.wasm，请先按文档构建 WebAssembly 版本");
+  }
+  const { instance } = await WebAssembly.instantiate(await res.arrayBuffer(), go.importObject);
+  go.run(instance);
+})();
+
+onmessage = async (e) => {
+  try {
+    await ready;
+    const json = await rdbvizAnalyze(new Uint8Array(e.data.dump), JSON.stringify(e.data.options || {}), (p) =>
+      postMessage({ type: "progress", progress: p })
+    );
+    postMessage({ type: "report", report: JSON.parse(json) });
+  } catch (err) {
+    postMessage({ type: "error", error: err.message || String(err) });
+  }
+};
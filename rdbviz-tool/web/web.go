@@ -0,0 +1,24 @@
+// Package web embeds the rdbviz page, so serve runs from a single binary.
+//
+// static/ is a copy of the page in ../../rdbviz, the copy that is edited;
+// run go generate after changing it.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:generate sh -c "cp ../../rdbviz/index.html ../../rdbviz/app.js ../../rdbviz/style.css ../../rdbviz/rdbviz.js ../../rdbviz/worker.js static/"
+
+//go:embed static
+var static embed.FS
+
+// FS returns the page files, index.html at the root.
+func FS() fs.FS {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -8,6 +8,17 @@ createApp({
       error: "",
       charts: {},
       prefixType: "__all__",
+      bigKeyGroup: "__all__",
+      dbIndex: 0,
+      prefixPath: [],
+      prefixSort: { key: "", desc: true },
+      bigKeySort: { key: "", desc: true },
+      reports: [],
+      reportId: "",
+      history: { instances: [], instance: "", runs: [], runId: "", selected: [], compare: null },
+      wasm: typeof RDBViz !== "undefined",
+      dropping: false,
+      analyzing: "",
     };
   },
   mounted() {
@@ -15,6 +26,31 @@ createApp({
   },
   methods: {
     async loadDefault() {
+      if (window.RDBVIZ_REPORT) {
+        // embedded by rdbviz-tool -html
+        this.report = window.RDBVIZ_REPORT;
+        this.loading = false;
+        this.$nextTick(this.renderCharts);
+        return;
+      }
+      await this.loadHistory();
+      try {
+        // rdbviz-tool serve -reports lists the reports of a directory
+        const list = await fetch("./api/reports");
+        if (list.ok) {
+          this.reports = await list.json();
+          if (this.reports.length) {
+            await this.loadReport(this.reports[0].id);
+            return;
+          }
+        }
+      } catch (e) {
+        // a static server: fall back to data/report.json
+      }
+      if (this.history.runs.length) {
+        await this.loadRun(this.history.runs[0].id);
+        return;
+      }
       try {
         const res = await fetch("./data/report.json");
         if (!res.ok) {
@@ -29,6 +65,117 @@ createApp({
         this.error = e.message || String(e);
       }
     },
+    loadReport(id) {
+      this.reportId = id;
+      this.history.runId = "";
+      return this.fetchReport("./api/reports/" + encodeURIComponent(id), "报告 " + id);
+    },
+    loadRun(id) {
+      this.reportId = "";
+      this.history.runId = id;
+      return this.fetchReport("./api/history/runs/" + encodeURIComponent(id), "历史记录 " + id);
+    },
+    async fetchReport(url, name) {
+      this.loading = true;
+      this.error = "";
+      try {
+        const res = await fetch(url);
+        if (!res.ok) {
+          throw new Error(name + " 加载失败：HTTP " + res.status);
+        }
+        this.report = await res.json();
+        this.resetView();
+        this.loading = false;
+        this.$nextTick(this.renderCharts);
+      } catch (e) {
+        this.loading = false;
+        this.error = e.message || String(e);
+      }
+    },
+    // loadHistory lists the instances of rdbviz-tool serve -history, if the
+    // server keeps one, and the runs of the first.
+    async loadHistory() {
+      try {
+        const res = await fetch("./api/history/instances");
+        if (!res.ok) return;
+        this.history.instances = await res.json();
+      } catch (e) {
+        return;
+      }
+      if (this.history.instances.length) {
+        await this.loadRuns(this.history.instances[0].instance);
+      }
+    },
+    async loadRuns(instance) {
+      this.history.instance = instance;
+      this.history.selected = [];
+      this.history.compare = null;
+      const res = await fetch("./api/history/runs?instance=" + encodeURIComponent(instance));
+      this.history.runs = res.ok ? await res.json() : [];
+      this.$nextTick(this.renderHistoryChart);
+    },
+    // runDelta is the change in estimated memory since the run before.
+    runDelta(i) {
+      const prev = this.history.runs[i + 1];
+      if (!prev) return "-";
+      const d = this.history.runs[i].estimated_mem - prev.estimated_mem;
+      return (d < 0 ? "-" : "+") + this.formatBytes(Math.abs(d));
+    },
+    // toggleCompare selects a run to compare; the two last selected are
+    // compared, older first.
+    async toggleCompare(id) {
+      const sel = this.history.selected;
+      const i = sel.indexOf(id);
+      if (i >= 0) {
+        sel.splice(i, 1);
+      } else {
+        sel.push(id);
+        if (sel.length > 2) sel.shift();
+      }
+      this.history.compare = null;
+      if (sel.length < 2) return;
+      const runs = this.history.runs;
+      const [from, to] = [...sel].sort(
+        (a, b) => runs.findIndex((r) => r.id === b) - runs.findIndex((r) => r.id === a)
+      );
+      const res = await fetch(`./api/history/compare?from=${encodeURIComponent(from)}&to=${encodeURIComponent(to)}`);
+      if (res.ok) this.history.compare = await res.json();
+    },
+    formatDelta(oldValue, newValue, bytes) {
+      const d = newValue - oldValue;
+      const v = bytes ? this.formatBytes(Math.abs(d)) : this.formatInt(Math.abs(d));
+      const pct = oldValue ? ` (${((d / oldValue) * 100).toFixed(1)}%)` : newValue ? " (新增)" : "";
+      return (d < 0 ? "-" : "+") + v + pct;
+    },
+    renderHistoryChart() {
+      const el = document.getElementById("chart-history");
+      if (!el) return;
+      const chart = this.getChartInstance("history", el);
+      const runs = [...this.history.runs].reverse();
+      chart.setOption({
+        tooltip: { trigger: "axis" },
+        legend: { data: ["估算内存", "Key 数"], textStyle: { color: "#d5e3f3" } },
+        xAxis: {
+          type: "category",
+          data: runs.map((r) => new Date(r.time).toLocaleString() + (r.shard ? " " + r.shard : "")),
+          axisLabel: { color: "#d5e3f3" },
+        },
+        yAxis: [
+          { type: "value", axisLabel: { color: "#d5e3f3", formatter: (v) => this.formatBytes(v) } },
+          { type: "value", axisLabel: { color: "#d5e3f3" } },
+        ],
+        series: [
+          { name: "估算内存", type: "line", data: runs.map((r) => r.estimated_mem), itemStyle: { color: "#ff7f50" } },
+          { name: "Key 数", type: "line", yAxisIndex: 1, data: runs.map((r) => r.total_keys), itemStyle: { color: "#29d3d3" } },
+        ],
+      });
+    },
+    resetView() {
+      this.prefixType = "__all__";
+      this.bigKeyGroup = "__all__";
+      this.dbIndex = 0;
+      this.prefixPath = [];
+    },
     onFile(e) {
       const file = e.target.files[0];
       if (!file) return;
@@ -38,7 +185,7 @@ createApp({
           this.report = JSON.parse(reader.result);
           this.error = "";
           this.loading = false;
-          this.prefixType = "__all__";
+          this.resetView();
           this.$nextTick(this.renderCharts);
         } catch (err) {
           this.error = "JSON 解析失败: " + err.message;
@@ -46,6 +193,69 @@ createApp({
       };
       reader.readAsText(file);
     },
+    onRdb(e) {
+      const file = e.target.files[0];
+      if (file) this.analyzeRdb(file);
+    },
+    onDrop(e) {
+      this.dropping = false;
+      const file = e.dataTransfer.files[0];
+      if (file && this.wasm) this.analyzeRdb(file);
+    },
+    async analyzeRdb(file) {
+      this.loading = true;
+      this.error = "";
+      this.analyzing = "正在浏览器内分析 " + file.name + "...";
+      try {
+        const report = await RDBViz.analyze(file, {}, (p) => {
+          this.analyzing = `正在浏览器内分析 ${file.name}：${p.percent.toFixed(1)}%，已解析 ${this.formatInt(p.keys)} 个 Key`;
+        });
+        this.report = report;
+        this.resetView();
+        this.loading = false;
+        this.$nextTick(this.renderCharts);
+      } catch (err) {
+        this.loading = false;
+        this.error = "RDB 分析失败: " + err.message;
+      }
+      this.analyzing = "";
+    },
+    // sortBy sorts a table by key, descending first; a third click restores
+    // the order of the report.
+    sortBy(sort, key) {
+      if (sort.key !== key) {
+        sort.key = key;
+        sort.desc = true;
+      } else if (sort.desc) {
+        sort.desc = false;
+      } else {
+        sort.key = "";
+      }
+    },
+    sortMark(sort, key) {
+      if (sort.key !== key) return "";
+      return sort.desc ? " ↓" : " ↑";
+    },
+    sortRows(rows, sort) {
+      if (!sort.key) return rows;
+      const sign = sort.desc ? -1 : 1;
+      return [...rows].sort((a, b) => {
+        const x = a[sort.key];
+        const y = b[sort.key];
+        if (x === y) return 0;
+        if (x === undefined) return 1;
+        if (y === undefined) return -1;
+        if (typeof x === "string") return sign * x.localeCompare(y);
+        return sign * (x - y);
+      });
+    },
+    // drillable tells whether the table lists prefixes below p.
+    drillable(p) {
+      return this.prefixRows.some((q) => q.prefix !== p && q.prefix.startsWith(p));
+    },
+    drillPrefix(p) {
+      if (this.drillable(p)) this.prefixPath.push(p);
+    },
     formatBytes(bytes) {
       if (!bytes && bytes !== 0) return "-";
       const units = ["B", "KB", "MB", "GB", "TB"];
@@ -61,12 +271,33 @@ createApp({
       if (n === null || n === undefined) return "-";
       return n.toLocaleString();
     },
+    formatDuration(sec) {
+      if (!sec) return "-";
+      if (sec < 60) return sec + " 秒";
+      if (sec < 3600) return (sec / 60).toFixed(1) + " 分钟";
+      if (sec < 86400) return (sec / 3600).toFixed(1) + " 小时";
+      return (sec / 86400).toFixed(1) + " 天";
+    },
+    formatScores(s) {
+      if (!s) return "-";
+      if (s.timestamp) {
+        const unit = s.timestamp === "ms" ? 1 : 1000;
+        const fmt = (v) => new Date(v * unit).toLocaleString();
+        return fmt(s.min) + " ~ " + fmt(s.max) + "（时间戳）";
+      }
+      return s.min + " ~ " + s.max + "，均值 " + s.mean.toFixed(2);
+    },
     renderCharts() {
       if (!this.report) return;
       this.renderTypeChart();
       this.renderTTLChart();
       this.renderSizeChart();
       this.renderDBChart();
+      this.renderKeyLenChart();
+      this.renderEntropyChart();
+      this.renderExpiryChart();
+      this.renderSlotChart();
+      this.renderHistoryChart();
     },
     renderTypeChart() {
       const el = document.getElementById("chart-type");
@@ -133,8 +364,19 @@ createApp({
       const dbKeys = this.report.summary.db_keys || {};
       const labels = Object.keys(dbKeys);
       const values = labels.map((k) => dbKeys[k]);
+      const dbSize = this.report.summary.db_size || {};
+      const dbMem = this.report.summary.db_estimated_mem || {};
       chart.setOption({
-        tooltip: { trigger: "axis" },
+        tooltip: {
+          trigger: "axis",
+          formatter: (p) => {
+            const db = labels[p[0].dataIndex];
+            let text = `DB${db}<br/>Key 数：${this.formatInt(p[0].value)}`;
+            if (dbSize[db] !== undefined) text += `<br/>大小：${this.formatBytes(dbSize[db])}`;
+            if (dbMem[db] !== undefined) text += `<br/>估算内存：${this.formatBytes(dbMem[db])}`;
+            return text;
+          },
+        },
         xAxis: { type: "category", data: labels, axisLabel: { color: "#d5e3f3" } },
         yAxis: { type: "value", axisLabel: { color: "#d5e3f3" } },
         series: [
@@ -150,7 +392,104 @@ createApp({
         grid: { left: 40, right: 10, top: 20, bottom: 30 },
       });
     },
+    renderKeyLenChart() {
+      const el = document.getElementById("chart-keylen");
+      if (!el || !this.report.key_names) return;
+      const chart = this.getChartInstance("keylen", el);
+      const buckets = this.report.key_names.length_buckets;
+      chart.setOption({
+        tooltip: { trigger: "axis" },
+        xAxis: { type: "category", data: buckets.map((b) => b.label), axisLabel: { color: "#d5e3f3" } },
+        yAxis: { type: "value", axisLabel: { color: "#d5e3f3" } },
+        series: [
+          {
+            type: "bar",
+            data: buckets.map((b) => b.count),
+            itemStyle: { color: "#8a7bff", borderRadius: [6, 6, 0, 0] },
+          },
+        ],
+        grid: { left: 40, right: 10, top: 20, bottom: 30 },
+      });
+    },
+    renderEntropyChart() {
+      const el = document.getElementById("chart-entropy");
+      if (!el || !this.report.entropy) return;
+      const chart = this.getChartInstance("entropy", el);
+      const buckets = this.report.entropy.buckets;
+      chart.setOption({
+        tooltip: { trigger: "axis" },
+        xAxis: { type: "category", data: buckets.map((b) => b.label), axisLabel: { color: "#d5e3f3" } },
+        yAxis: { type: "value", axisLabel: { color: "#d5e3f3" } },
+        series: [
+          {
+            type: "bar",
+            data: buckets.map((b) => b.count),
+            itemStyle: { color: "#36cfc9", borderRadius: [6, 6, 0, 0] },
+          },
+        ],
+        grid: { left: 40, right: 10, top: 20, bottom: 30 },
+      });
+    },
+    renderExpiryChart() {
+      const el = document.getElementById("chart-expiry");
+      if (!el || !this.report.expiry_timeline) return;
+      const chart = this.getChartInstance("expiry", el);
+      const hourly = this.report.expiry_timeline.hourly;
+      chart.setOption({
+        tooltip: { trigger: "axis" },
+        xAxis: {
+          type: "category",
+          data: hourly.map((b) => new Date(b.time).toLocaleString()),
+          axisLabel: { color: "#d5e3f3" },
+        },
+        yAxis: { type: "value", axisLabel: { color: "#d5e3f3" } },
+        series: [
+          {
+            type: "bar",
+            data: hourly.map((b) => b.count),
+            itemStyle: { color: "#ff7f50" },
+          },
+        ],
+        grid: { left: 40, right: 10, top: 20, bottom: 30 },
+      });
+    },
+    renderSlotChart() {
+      const el = document.getElementById("chart-slots");
+      if (!el || !this.report.slots) return;
+      const chart = this.getChartInstance("slots", el);
+      const sizes = this.report.slots.sizes;
+      chart.setOption({
+        tooltip: {
+          trigger: "axis",
+          formatter: (p) => `slot ${p[0].dataIndex}<br/>${this.formatBytes(p[0].value)}`,
+        },
+        xAxis: {
+          type: "category",
+          data: sizes.map((_, i) => i),
+          axisLabel: { color: "#d5e3f3", interval: 1023 },
+        },
+        yAxis: { type: "value", axisLabel: { color: "#d5e3f3" } },
+        series: [
+          {
+            type: "line",
+            sampling: "lttb",
+            showSymbol: false,
+            data: sizes,
+            itemStyle: { color: "#4fc3f7" },
+          },
+        ],
+        grid: { left: 60, right: 10, top: 20, bottom: 30 },
+      });
+    },
+    entropyClassLabel(c) {
+      return { incompressible: "已压缩 / 加密", compressible: "可压缩", mixed: "混合" }[c] || c;
+    },
     getChartInstance(name, el) {
+      if (this.charts[name] && this.charts[name].getDom() !== el) {
+        // the panel was rendered again, e.g. after loading another report
+        this.charts[name].dispose();
+        delete this.charts[name];
+      }
       if (!this.charts[name]) {
         this.charts[name] = echarts.init(el);
         window.addEventListener("resize", () => {
@@ -165,11 +504,67 @@ createApp({
       if (!this.report) return [];
       return this.report.types.map((t) => t.type);
     },
-    prefixTable() {
+    currentDB() {
+      if (!this.report || !this.report.dbs || !this.report.dbs.length) return null;
+      return this.report.dbs[this.dbIndex] || this.report.dbs[0];
+    },
+    prefixRows() {
       if (!this.report) return [];
       if (this.prefixType === "__all__") return this.report.prefixes || [];
       const group = (this.report.prefixes_by_type || []).find((g) => g.type === this.prefixType);
       return group ? group.prefixes : [];
     },
+    prefixRoot() {
+      return this.prefixPath.length ? this.prefixPath[this.prefixPath.length - 1] : "";
+    },
+    prefixTable() {
+      const root = this.prefixRoot;
+      const rows = root ? this.prefixRows.filter((p) => p.prefix !== root && p.prefix.startsWith(root)) : this.prefixRows;
+      return this.sortRows(rows, this.prefixSort);
+    },
+    bigKeyTable() {
+      if (!this.report) return [];
+      let rows;
+      if (this.bigKeyGroup === "__all__") {
+        rows = this.report.bigkeys || [];
+      } else {
+        const group = this.bigKeyGroup.startsWith("db:")
+          ? (this.report.bigkeys_by_db || []).find((g) => "db:" + g.db === this.bigKeyGroup)
+          : (this.report.bigkeys_by_type || []).find((g) => "type:" + g.type === this.bigKeyGroup);
+        rows = group ? group.bigkeys : [];
+      }
+      return this.sortRows(rows, this.bigKeySort);
+    },
+    percentileRows() {
+      if (!this.report || !this.report.summary.size_percentiles) return [];
+      const rows = [{ name: "全部", p: this.report.summary.size_percentiles }];
+      for (const t of this.report.types) {
+        if (t.size_percentiles) rows.push({ name: "类型 " + t.type, p: t.size_percentiles });
+      }
+      for (const p of this.report.prefix_size_percentiles || []) {
+        if (p.percentiles) rows.push({ name: p.prefix, p: p.percentiles });
+      }
+      return rows;
+    },
+    compareRows() {
+      const c = this.history.compare;
+      if (!c) return [];
+      const totals = { all: "全部", expired: "已过期" };
+      return [
+        ...c.totals.map((r) => ({ ...r, key: "total:" + r.name, label: totals[r.name] || r.name })),
+        ...c.types.map((r) => ({ ...r, key: "type:" + r.name, label: "类型 " + r.name })),
+        ...c.prefixes.map((r) => ({ ...r, key: "prefix:" + r.name, label: r.name })),
+      ];
+    },
+    bigKeySortLabel() {
+      const labels = {
+        size: "按大小",
+        estimated_mem: "按估算内存",
+        elements: "按元素数",
+        avg_element_size: "按平均元素大小",
+      };
+      const sort = this.report && this.report.meta.bigkey_sort;
+      return labels[sort] || labels.size;
+    },
   },
 }).mount("#app");